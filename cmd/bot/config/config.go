@@ -22,16 +22,35 @@ type RetryConfig struct {
 	MaxIntervalSeconds     int `yaml:"max_interval_seconds"`
 }
 
+// ResultFilter задает фильтрацию и сортировку результата, запрашиваемого у сервера.
+// Пустые поля не передаются, и сервер возвращает всех участников в исходном порядке.
+type ResultFilter struct {
+	HasUsername *bool  `yaml:"has_username"`
+	HasBio      *bool  `yaml:"has_bio"`
+	HasChannel  *bool  `yaml:"has_channel"`
+	Name        string `yaml:"name"`
+	NameRegex   string `yaml:"name_regex"`
+	Bio         string `yaml:"bio"`
+	BioRegex    string `yaml:"bio_regex"`
+	MinID       int64  `yaml:"min_id"`
+	MaxID       int64  `yaml:"max_id"`
+	Sort        string `yaml:"sort"`  // name, username, id, activity
+	Order       string `yaml:"order"` // asc, desc
+}
+
 // BotConfig содержит конфигурацию для Telegram-бота
 type BotConfig struct {
-	Token                  string       `yaml:"token"`
-	BackendURL             string       `yaml:"backend_url"`
+	Token      string `yaml:"token"`
+	BackendURL string `yaml:"backend_url"`
+	// APIKey — ключ доступа к API сервера; может быть задан переменной окружения PARSER_API_KEY.
+	APIKey                 string       `yaml:"api_key"`
 	PollingIntervalSeconds int          `yaml:"polling_interval_seconds"`
 	ExcelThreshold         int          `yaml:"excel_threshold"`
 	MaxFilesPerMessage     int          `yaml:"max_files_per_message"`
 	HTTPTimeoutSeconds     int          `yaml:"http_timeout_seconds"`
 	Render                 ColumnWidths `yaml:"render"`
 	Retry                  RetryConfig  `yaml:"retry"`
+	Results                ResultFilter `yaml:"results"`
 }
 
 // Logging содержит конфигурацию логирования
@@ -40,10 +59,20 @@ type Logging struct {
 	Format string `yaml:"format"` // json, text
 }
 
+// Tracing содержит конфигурацию трассировки OpenTelemetry
+type Tracing struct {
+	Exporter    string  `yaml:"exporter"` // otlp, stdout; пустая строка отключает трассировку
+	Endpoint    string  `yaml:"endpoint"` // host:port коллектора OTLP
+	Insecure    bool    `yaml:"insecure"`
+	SampleRatio float64 `yaml:"sample_ratio"` // от 0 до 1
+	ServiceName string  `yaml:"service_name"`
+}
+
 // Config является оберткой для соответствия структуре YAML файла.
 type Config struct {
 	Bot     BotConfig `yaml:"bot"`
 	Logging Logging   `yaml:"logging"`
+	Tracing Tracing   `yaml:"tracing"`
 }
 
 // LoadBotConfig загружает конфигурацию бота из указанного файла.
@@ -53,13 +82,17 @@ func LoadBotConfig(filename string) (*Config, error) {
 		return nil, fmt.Errorf("failed to read bot config file %s: %w", filename, err)
 	}
 
-	var cfg Config
+	// Доля трасс задается до разбора файла: ноль в нем — допустимое значение.
+	cfg := Config{Tracing: Tracing{SampleRatio: DefaultTracingSampleRatio}}
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal bot config: %w", err)
 	}
 
 	// Устанавливаем значения по умолчанию
 	botCfg := &cfg.Bot
+	if apiKey := os.Getenv("PARSER_API_KEY"); apiKey != "" {
+		botCfg.APIKey = apiKey
+	}
 	if botCfg.MaxFilesPerMessage == 0 {
 		botCfg.MaxFilesPerMessage = DefaultMaxFilesPerMessage
 	}
@@ -99,6 +132,9 @@ func LoadBotConfig(filename string) (*Config, error) {
 	if logging.Format == "" {
 		logging.Format = DefaultLogFormat
 	}
+	if cfg.Tracing.ServiceName == "" {
+		cfg.Tracing.ServiceName = DefaultTracingServiceName
+	}
 
 	return &cfg, nil
 }
@@ -129,6 +165,16 @@ func (c *BotConfig) Validate() error {
 	if c.Retry.MaxIntervalSeconds < c.Retry.InitialIntervalSeconds {
 		return fmt.Errorf("bot.retry.max_interval_seconds must be greater than or equal to initial_interval_seconds")
 	}
+	switch c.Results.Sort {
+	case "", "name", "username", "id", "activity":
+	default:
+		return fmt.Errorf("bot.results.sort must be one of: name, username, id, activity")
+	}
+	switch c.Results.Order {
+	case "", "asc", "desc":
+	default:
+		return fmt.Errorf("bot.results.order must be one of: asc, desc")
+	}
 	return nil
 }
 
@@ -142,6 +188,10 @@ func (c *Config) ValidateFull() error {
 		return err
 	}
 
+	if err := c.Tracing.Validate(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -163,3 +213,16 @@ func (l *Logging) ValidateLogging() error {
 
 	return nil
 }
+
+// Validate проверяет корректность конфигурации трассировки.
+func (t *Tracing) Validate() error {
+	switch t.Exporter {
+	case "", "otlp", "stdout":
+	default:
+		return fmt.Errorf("tracing.exporter must be one of: otlp, stdout (empty disables tracing)")
+	}
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		return fmt.Errorf("tracing.sample_ratio must be between 0 and 1")
+	}
+	return nil
+}
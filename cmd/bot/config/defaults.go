@@ -14,6 +14,10 @@ const (
 	DefaultLogLevel  = "info"
 	DefaultLogFormat = "json"
 
+	// Tracing defaults
+	DefaultTracingSampleRatio = 1.0
+	DefaultTracingServiceName = "telegram-chat-parser-bot"
+
 	// Retry defaults
 	DefaultRetryMaxAttempts     = 3
 	DefaultRetryInitialInterval = 2
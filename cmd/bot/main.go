@@ -7,14 +7,19 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
 	"telegram-chat-parser/cmd/bot/config"
 	"telegram-chat-parser/internal/bot"
 	maskedlog "telegram-chat-parser/internal/log"
+	"telegram-chat-parser/internal/tracing"
 )
 
+// tracingShutdownTimeout ограничивает отправку накопленных спанов при завершении.
+const tracingShutdownTimeout = 5 * time.Second
+
 func main() {
 	// Загрузка конфигурации бота
 	cfg, err := config.LoadBotConfig("bot_config.yml")
@@ -57,9 +62,23 @@ func main() {
 	// и маскировщик токенов.
 	tgbotapi.SetLogger(&maskedlog.TGBotAPIAdapter{Logger: logger.With("component", "tgbotapi")})
 
+	// Трассировка: запросы к серверу передают контекст трассы, и спаны бота и сервера
+	// складываются в одну трассу.
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		ServiceName: cfg.Tracing.ServiceName,
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		slog.Error("failed to set up tracing", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
 	// Инициализация компонентов
 	taskStore := bot.NewTaskStore()
-	serverClient := bot.NewServerClient(cfg.Bot.BackendURL)
+	serverClient := bot.NewServerClient(cfg.Bot.BackendURL, cfg.Bot.APIKey)
 
 	b, err := bot.NewBot(cfg.Bot, serverClient, taskStore, logger.With(slog.String("component", "bot")))
 	if err != nil {
@@ -83,5 +102,11 @@ func main() {
 	// TODO: Реализовать graceful shutdown
 	// bot.Stop() // TODO: Реализовать метод Stop() в боте для корректного завершения
 
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("failed to flush traces", slog.String("error", err.Error()))
+	}
+
 	slog.Info("Bot stopped gracefully")
 }
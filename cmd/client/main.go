@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"flag"
@@ -11,6 +12,8 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,13 +21,106 @@ type TaskStatusResponse struct {
 	TaskID       string `json:"task_id"`
 	Status       string `json:"status"`
 	ErrorMessage string `json:"error_message,omitempty"`
+	// UnresolvedCount — число участников, не попавших в частичный результат.
+	UnresolvedCount int `json:"unresolved_count,omitempty"`
+	// QueuePosition — позиция задачи в очереди сервера, пока она ждет обработки.
+	QueuePosition int       `json:"queue_position,omitempty"`
+	Progress      *Progress `json:"progress,omitempty"`
+}
+
+// Progress описывает ход обработки задачи.
+type Progress struct {
+	Stage             string `json:"stage"`
+	FilesTotal        int    `json:"files_total"`
+	FilesParsed       int    `json:"files_parsed"`
+	MessagesScanned   int64  `json:"messages_scanned"`
+	RawParticipants   int    `json:"raw_participants"`
+	ParticipantsTotal int    `json:"participants_total"`
+	Enriched          int    `json:"enriched"`
+	Requeued          int    `json:"requeued"`
+	Unresolved        int    `json:"unresolved"`
+	ETASeconds        *int64 `json:"eta_seconds,omitempty"`
+}
+
+// String форматирует прогресс в одну строку.
+func (p *Progress) String() string {
+	if p.Stage == "queued" {
+		return "ожидает в очереди"
+	}
+	s := fmt.Sprintf("файлы %d/%d, сообщений %d, участников %d",
+		p.FilesParsed, p.FilesTotal, p.MessagesScanned, p.RawParticipants)
+	if p.Stage == "parsing" {
+		return s
+	}
+	s += fmt.Sprintf(", обогащено %d/%d, повторов %d, не найдено %d",
+		p.Enriched, p.ParticipantsTotal, p.Requeued, p.Unresolved)
+	if p.ETASeconds != nil {
+		s += fmt.Sprintf(", осталось ~%s", time.Duration(*p.ETASeconds)*time.Second)
+	}
+	return s
+}
+
+type ChatInfo struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	MessageCount int    `json:"message_count"`
+}
+
+// apiKeyTransport добавляет ключ API ко всем запросам к серверу.
+type apiKeyTransport struct {
+	key  string
+	base http.RoundTripper
+}
+
+func (t apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.key)
+	return t.base.RoundTrip(req)
+}
+
+// stringList — флаг, который можно указать несколько раз.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
 }
 
 func main() {
-	var serverAddr string
+	var (
+		serverAddr string
+		listChats  bool
+		chatIDs    stringList
+		chatNames  stringList
+		chatTypes  stringList
+		cancelID   string
+		callback   string
+		priority   int
+		apiKey     string
+	)
 	flag.StringVar(&serverAddr, "server", "http://localhost:8080", "Server address")
+	flag.BoolVar(&listChats, "list-chats", false, "List chats in the export files and exit")
+	flag.Var(&chatIDs, "chat-id", "Process only chats with this id (repeatable, comma-separated)")
+	flag.Var(&chatNames, "chat-name", "Process only chats with this name (repeatable)")
+	flag.Var(&chatTypes, "chat-type", "Process only chats of this type (repeatable, comma-separated)")
+	flag.StringVar(&cancelID, "cancel", "", "Cancel the task with this id and exit")
+	flag.StringVar(&callback, "callback", "", "URL the server notifies when the task finishes")
+	flag.IntVar(&priority, "priority", 0, "Task priority in the server queue (-10..10, higher runs first)")
+	flag.StringVar(&apiKey, "api-key", os.Getenv("PARSER_API_KEY"), "Server API key (defaults to PARSER_API_KEY)")
 	flag.Parse()
 
+	if apiKey != "" {
+		http.DefaultClient.Transport = apiKeyTransport{key: apiKey, base: http.DefaultTransport}
+	}
+
+	if cancelID != "" {
+		cancelTask(serverAddr, cancelID)
+		return
+	}
+
 	filePaths := flag.Args()
 	if len(filePaths) == 0 {
 		log.Fatal("At least one file path is required. Usage: client [flags] <file1> <file2> ...")
@@ -34,6 +130,26 @@ func main() {
 	var body bytes.Buffer
 	writer := multipart.NewWriter(&body)
 
+	// Фильтр чатов для полного экспорта аккаунта
+	for field, values := range map[string]stringList{"chat_id": chatIDs, "chat_name": chatNames, "chat_type": chatTypes} {
+		for _, v := range values {
+			if err := writer.WriteField(field, v); err != nil {
+				log.Fatalf("Не удалось записать поле формы %s: %v", field, err)
+			}
+		}
+	}
+
+	if callback != "" {
+		if err := writer.WriteField("callback_url", callback); err != nil {
+			log.Fatalf("Не удалось записать поле формы callback_url: %v", err)
+		}
+	}
+	if priority != 0 {
+		if err := writer.WriteField("priority", strconv.Itoa(priority)); err != nil {
+			log.Fatalf("Не удалось записать поле формы priority: %v", err)
+		}
+	}
+
 	for _, path := range filePaths {
 		file, err := os.Open(path)
 		if err != nil {
@@ -63,6 +179,11 @@ func main() {
 		log.Fatalf("Не удалось закрыть multipart writer: %v", err)
 	}
 
+	if listChats {
+		printChats(serverAddr, writer.FormDataContentType(), &body)
+		return
+	}
+
 	// Отправка файла на сервер
 	resp, err := http.Post(serverAddr+"/api/v1/process", writer.FormDataContentType(), &body)
 	if err != nil {
@@ -70,6 +191,14 @@ func main() {
 	}
 	defer resp.Body.Close()
 
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		log.Fatal("Сервер требует ключ API: укажите -api-key или PARSER_API_KEY")
+	case http.StatusTooManyRequests:
+		// Очередь задач заполнена или исчерпана суточная квота ключа.
+		msg, _ := io.ReadAll(resp.Body)
+		log.Fatalf("Сервер отклонил задачу: %s; повторите через %s с", strings.TrimSpace(string(msg)), resp.Header.Get("Retry-After"))
+	}
 	if resp.StatusCode != http.StatusAccepted {
 		log.Fatalf("Сервер вернул статус: %d", resp.StatusCode)
 	}
@@ -86,58 +215,209 @@ func main() {
 
 	fmt.Printf("Задача создана с идентификатором: %s\n", taskID)
 
-	// Опрос о статусе задачи
+	// Ожидание завершения задачи: поток событий, если сервер его поддерживает, иначе опрос статуса.
+	statusResp, err := watchEvents(serverAddr, taskID)
+	if err != nil {
+		log.Printf("Поток событий недоступен (%v), перехожу к опросу статуса", err)
+		statusResp = pollStatus(serverAddr, taskID)
+	}
+	finishTask(serverAddr, taskID, statusResp)
+}
+
+// printStatus выводит статус задачи и ее прогресс.
+func printStatus(status *TaskStatusResponse) {
+	if status.QueuePosition > 0 {
+		fmt.Printf("Статус задачи: %s (позиция в очереди: %d)\n", status.Status, status.QueuePosition)
+	} else if status.Progress != nil {
+		fmt.Printf("Статус задачи: %s (%s)\n", status.Status, status.Progress)
+	} else {
+		fmt.Printf("Статус задачи: %s\n", status.Status)
+	}
+}
+
+// watchEvents читает поток событий задачи (Server-Sent Events), выводя прогресс
+// и обогащенных участников по мере их получения, и возвращает итоговый статус.
+// Возвращает ошибку, если сервер не поддерживает поток или поток прервался.
+func watchEvents(serverAddr, taskID string) (*TaskStatusResponse, error) {
+	resp, err := http.Get(fmt.Sprintf("%s/api/v1/tasks/%s/events", serverAddr, taskID))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("сервер вернул статус: %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	// Событие с пользователем может превышать размер буфера по умолчанию из-за длинного bio.
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	var event string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			event = name
+			continue
+		}
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+
+		switch event {
+		case "status", "done":
+			var status TaskStatusResponse
+			if err := json.Unmarshal([]byte(data), &status); err != nil {
+				return nil, fmt.Errorf("не удалось декодировать событие %s: %w", event, err)
+			}
+			printStatus(&status)
+			if event == "done" {
+				return &status, nil
+			}
+		case "progress":
+			var p Progress
+			if err := json.Unmarshal([]byte(data), &p); err != nil {
+				return nil, fmt.Errorf("не удалось декодировать событие %s: %w", event, err)
+			}
+			fmt.Printf("Прогресс: %s\n", &p)
+		case "user":
+			var user struct {
+				ID       int64  `json:"id"`
+				Name     string `json:"name"`
+				Username string `json:"username"`
+			}
+			if err := json.Unmarshal([]byte(data), &user); err != nil {
+				return nil, fmt.Errorf("не удалось декодировать событие %s: %w", event, err)
+			}
+			if user.Username != "" {
+				fmt.Printf("  + %s (@%s)\n", user.Name, user.Username)
+			} else {
+				fmt.Printf("  + %s (id %d)\n", user.Name, user.ID)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("поток событий закрыт до завершения задачи")
+}
+
+// pollStatus опрашивает статус задачи, пока она не завершится.
+func pollStatus(serverAddr, taskID string) *TaskStatusResponse {
 	for {
 		time.Sleep(5 * time.Second) // Ожидание 5 секунд перед следующим опросом
 
-		resp, err := http.Get(fmt.Sprintf("%s/api/v1/tasks/%s", serverAddr, taskID))
+		statusResp, err := getStatus(serverAddr, taskID)
 		if err != nil {
 			log.Fatalf("Не удалось опросить статус задачи: %v", err)
 		}
-		defer resp.Body.Close()
+		printStatus(statusResp)
 
-		if resp.StatusCode != http.StatusOK {
-			log.Fatalf("Сервер вернул статус: %d", resp.StatusCode)
+		if statusResp.Status != "pending" && statusResp.Status != "processing" {
+			return statusResp
 		}
+	}
+}
 
-		var statusResp TaskStatusResponse
-		if err := json.NewDecoder(resp.Body).Decode(&statusResp); err != nil {
-			log.Fatalf("Не удалось декодировать ответ статуса: %v", err)
-		}
+func getStatus(serverAddr, taskID string) (*TaskStatusResponse, error) {
+	resp, err := http.Get(fmt.Sprintf("%s/api/v1/tasks/%s", serverAddr, taskID))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
-		fmt.Printf("Статус задачи: %s\n", statusResp.Status)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("сервер вернул статус: %d", resp.StatusCode)
+	}
 
-		switch statusResp.Status {
-		case "completed":
-			fmt.Println("Задача выполнена успешно.")
-			// Получение и вывод результата.
-			resultResp, err := http.Get(fmt.Sprintf("%s/api/v1/tasks/%s/result", serverAddr, taskID))
-			if err != nil {
-				log.Fatalf("Не удалось получить результат: %v", err)
-			}
-			defer resultResp.Body.Close()
+	var statusResp TaskStatusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&statusResp); err != nil {
+		return nil, fmt.Errorf("не удалось декодировать ответ статуса: %w", err)
+	}
+	return &statusResp, nil
+}
 
-			if resultResp.StatusCode != http.StatusOK {
-				log.Fatalf("Сервер вернул статус для результата: %d", resultResp.StatusCode)
-			}
+// finishTask выводит итог завершенной задачи и ее результат.
+func finishTask(serverAddr, taskID string, statusResp *TaskStatusResponse) {
+	switch statusResp.Status {
+	case "completed", "partial":
+		if statusResp.Status == "partial" {
+			fmt.Printf("Задача выполнена частично: %s\n", statusResp.ErrorMessage)
+			fmt.Printf("Необработанных участников: %d (см. поле unresolved результата).\n", statusResp.UnresolvedCount)
+		} else {
+			fmt.Println("Задача выполнена успешно.")
+		}
+		// Получение и вывод результата.
+		resultResp, err := http.Get(fmt.Sprintf("%s/api/v1/tasks/%s/result", serverAddr, taskID))
+		if err != nil {
+			log.Fatalf("Не удалось получить результат: %v", err)
+		}
+		defer resultResp.Body.Close()
 
-			var resultData []byte
-			resultData, err = io.ReadAll(resultResp.Body)
-			if err != nil {
-				log.Fatalf("Не удалось прочитать тело результата: %v", err)
-			}
+		if resultResp.StatusCode != http.StatusOK {
+			log.Fatalf("Сервер вернул статус для результата: %d", resultResp.StatusCode)
+		}
 
-			fmt.Println("Результат задачи:")
-			fmt.Println(string(resultData))
-			return
-		case "failed":
-			fmt.Printf("Задача не выполнена: %s\n", statusResp.ErrorMessage)
-			os.Exit(1)
-		case "pending", "processing":
-			// Продолжение опроса
-			continue
-		default:
-			log.Fatalf("Неизвестный статус задачи: %s", statusResp.Status)
+		var resultData []byte
+		resultData, err = io.ReadAll(resultResp.Body)
+		if err != nil {
+			log.Fatalf("Не удалось прочитать тело результата: %v", err)
 		}
+
+		fmt.Println("Результат задачи:")
+		fmt.Println(string(resultData))
+	case "failed":
+		fmt.Printf("Задача не выполнена: %s\n", statusResp.ErrorMessage)
+		os.Exit(1)
+	case "cancelled":
+		fmt.Printf("Задача отменена. Частичный результат: %s/api/v1/tasks/%s/result\n", serverAddr, taskID)
+		os.Exit(1)
+	default:
+		log.Fatalf("Неизвестный статус задачи: %s", statusResp.Status)
+	}
+}
+
+// cancelTask отменяет задачу на сервере.
+func cancelTask(serverAddr, taskID string) {
+	req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/api/v1/tasks/%s", serverAddr, taskID), nil)
+	if err != nil {
+		log.Fatalf("Не удалось создать запрос: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Fatalf("Не удалось отправить запрос: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		log.Fatalf("Сервер вернул статус: %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	fmt.Printf("Задача %s отменена.\n", taskID)
+}
+
+// printChats выводит список чатов в загруженных файлах экспорта.
+func printChats(serverAddr, contentType string, body io.Reader) {
+	resp, err := http.Post(serverAddr+"/api/v1/chats", contentType, body)
+	if err != nil {
+		log.Fatalf("Не удалось отправить запрос: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		log.Fatalf("Сервер вернул статус: %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var chatsResp struct {
+		Chats []ChatInfo `json:"chats"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&chatsResp); err != nil {
+		log.Fatalf("Не удалось декодировать ответ: %v", err)
+	}
+
+	fmt.Printf("%-15s %-20s %10s  %s\n", "ID", "TYPE", "MESSAGES", "NAME")
+	for _, chat := range chatsResp.Chats {
+		fmt.Printf("%-15d %-20s %10d  %s\n", chat.ID, chat.Type, chat.MessageCount, chat.Name)
 	}
 }
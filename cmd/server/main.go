@@ -8,13 +8,21 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+
+	"github.com/gotd/td/session"
+
 	"telegram-chat-parser/internal/adapters/parser"
 	"telegram-chat-parser/internal/cache"
 	"telegram-chat-parser/internal/core/services"
+	"telegram-chat-parser/internal/domain"
 	"telegram-chat-parser/internal/pkg/config"
+	"telegram-chat-parser/internal/quota"
 	"telegram-chat-parser/internal/server"
 	"telegram-chat-parser/internal/server/usecase"
+	"telegram-chat-parser/internal/storage"
+	"telegram-chat-parser/internal/telegram"
 	"telegram-chat-parser/internal/telegram/router"
+	"telegram-chat-parser/internal/tracing"
 )
 
 func main() {
@@ -60,33 +68,97 @@ func run() error {
 	if err := cfg.Validate(); err != nil {
 		return fmt.Errorf("config validation failed: %w", err)
 	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		ServiceName: cfg.Tracing.ServiceName,
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	if cfg.Tracing.Exporter != "" {
+		slog.Info("Tracing enabled", "exporter", cfg.Tracing.Exporter, "sample_ratio", cfg.Tracing.SampleRatio)
+	}
+	// Спаны отправляются последними, после остановки сервера и фоновых задач.
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("Failed to flush traces", "error", err)
+		}
+	}()
+
 	// 4. Инициализация и запуск фоновых сервисов
 	appCtx, appCancel := context.WithCancel(context.Background())
 
+	// Хранилища создаются до роутера: в базе могут храниться сессии аккаунтов Telegram.
+	stores, err := newStores(cfg)
+	if err != nil {
+		appCancel()
+		return fmt.Errorf("failed to init storage: %w", err)
+	}
+	defer stores.close()
+	taskStore, cacheStore := stores.tasks, stores.cache
+
 	tgServers := cfg.GetTelegramServers()
-	tgRouter, err := router.NewRouter(appCtx,
+	strategy, err := router.NewStrategy(cfg.TelegramAPI.Strategy)
+	if err != nil {
+		appCancel()
+		return fmt.Errorf("failed to create client selection strategy: %w", err)
+	}
+	routerOpts := []router.Option{
 		router.WithServerConfigs(tgServers),
 		router.WithHealthCheckInterval(cfg.TelegramAPI.HealthCheckInterval),
-	)
+		router.WithStrategy(strategy),
+	}
+	sessionStorage, err := newSessionStorage(cfg, stores.sessions)
+	if err != nil {
+		appCancel()
+		return fmt.Errorf("failed to init session storage: %w", err)
+	}
+	if sessionStorage != nil {
+		routerOpts = append(routerOpts, router.WithSessionStorage(sessionStorage))
+	}
+	slog.Info("Using telegram session storage", "type", cfg.TelegramAPI.SessionStorage)
+	tgRouter, err := router.NewRouter(appCtx, routerOpts...)
 	if err != nil {
 		appCancel()
 		return fmt.Errorf("failed to create telegram router: %w", err)
 	}
 
-	// 4. Инициализация зависимостей
-	taskStore := server.NewTaskStore()
-	cacheStore := cache.NewCacheStore()
-	parserSvc := parser.NewJsonParser()
+	enricherOpts := []services.Option{}
+	if stores.users != nil {
+		stores.users.StartCleanupTicker(appCtx, cfg.Server.CleanupInterval)
+		enricherOpts = append(enricherOpts, services.WithUserCache(stores.users))
+	}
+
+	parserSvc := parser.NewAutoParser()
 	extractorSvc := services.NewExtractionService()
 	enricherSvc := services.NewEnrichmentService(tgRouter,
 		cfg.Enrichment.PoolSize,
 		cfg.Enrichment.ClientRetryPause,
 		cfg.Enrichment.OperationTimeout,
+		enricherOpts...,
 	)
 	processor := usecase.NewProcessChatUseCase(cfg, parserSvc, extractorSvc, enricherSvc, cacheStore)
 
 	// 5. Создание HTTP-сервера
-	srv, err := server.New(cfg, processor, taskStore, cacheStore)
+	if cfg.Auth.Enabled() {
+		slog.Info("API key authentication enabled", "keys", len(cfg.Auth.Keys))
+	} else {
+		slog.Warn("No API keys configured, API is available without authentication")
+	}
+	reloadPool := func(context.Context) (router.ReloadResult, error) {
+		return reloadTelegramPool(tgRouter)
+	}
+	srv, err := server.New(cfg, processor, taskStore, cacheStore,
+		server.WithQuotaManager(stores.quotas),
+		server.WithPoolReload(reloadPool),
+		server.WithClientPool(tgRouter),
+	)
 	if err != nil {
 		appCancel()
 		return fmt.Errorf("failed to create server: %w", err)
@@ -102,6 +174,25 @@ func run() error {
 		}
 	}()
 
+	// SIGHUP перечитывает config.yml и применяет изменения списка аккаунтов Telegram
+	// без перезапуска сервера.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for {
+			select {
+			case <-hup:
+				slog.Info("SIGHUP received, reloading telegram client pool")
+				if _, err := reloadTelegramPool(tgRouter); err != nil {
+					slog.Error("Failed to reload telegram client pool", "error", err)
+				}
+			case <-appCtx.Done():
+				return
+			}
+		}
+	}()
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
@@ -129,3 +220,152 @@ func run() error {
 	slog.Info("Application exited gracefully")
 	return nil
 }
+
+// reloadTelegramPool перечитывает config.yml и применяет список серверов Telegram к пулу
+// клиентов роутера. Остальные настройки вступают в силу только после перезапуска.
+func reloadTelegramPool(tgRouter *router.Router) (router.ReloadResult, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return router.ReloadResult{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return router.ReloadResult{}, fmt.Errorf("config validation failed: %w", err)
+	}
+	return tgRouter.Reload(cfg.GetTelegramServers())
+}
+
+// appStores объединяет хранилища сервера.
+type appStores struct {
+	tasks *server.TaskStore
+	cache *cache.CacheStore
+	// users — кэш профилей пользователей; nil, если кэш отключен.
+	users *cache.UserCache
+	// quotas — счетчики суточных квот ключей API.
+	quotas *quota.Manager
+	// sessions — сессии аккаунтов Telegram; nil, если они хранятся в файлах.
+	sessions storage.Store[[]byte]
+	// close закрывает базу данных и должна вызываться после остановки сервера.
+	close func()
+}
+
+// newStores создает хранилища задач, кэша результатов, кэша пользователей
+// и счетчиков квот выбранного в конфигурации типа.
+func newStores(cfg *config.Config) (*appStores, error) {
+	userTTL := cfg.Enrichment.UserCacheTTL
+	if cfg.Storage.Type != storage.TypeBolt {
+		stores := &appStores{
+			tasks:  server.NewTaskStore(),
+			cache:  cache.NewCacheStore(),
+			quotas: quota.NewManager(),
+			close:  func() {},
+		}
+		if userTTL > 0 {
+			stores.users = cache.NewUserCache(userTTL)
+		}
+		return stores, nil
+	}
+
+	db, err := storage.OpenBolt(cfg.Storage.Path)
+	if err != nil {
+		return nil, err
+	}
+	closeDB := func() {
+		if err := db.Close(); err != nil {
+			slog.Error("failed to close storage", "error", err)
+		}
+	}
+
+	tasks, err := storage.NewBoltStore[server.Task](db, "tasks")
+	if err != nil {
+		closeDB()
+		return nil, err
+	}
+	items, err := storage.NewBoltStore[cache.CacheItem](db, "cache")
+	if err != nil {
+		closeDB()
+		return nil, err
+	}
+	counters, err := storage.NewBoltStore[int](db, "quota")
+	if err != nil {
+		closeDB()
+		return nil, err
+	}
+	taskStore := server.NewTaskStoreWithStorage(tasks)
+	interrupted, err := taskStore.FailInterrupted(server.InterruptedTaskMessage)
+	if err != nil {
+		closeDB()
+		return nil, err
+	}
+	if interrupted > 0 {
+		slog.Warn("Tasks interrupted by restart marked as failed", "count", interrupted)
+	}
+	stores := &appStores{
+		tasks:  taskStore,
+		cache:  cache.NewCacheStoreWithStorage(items),
+		quotas: quota.NewManagerWithStorage(counters),
+		close:  closeDB,
+	}
+	if userTTL > 0 {
+		users, err := storage.NewBoltStore[domain.User](db, "users")
+		if err != nil {
+			closeDB()
+			return nil, err
+		}
+		stores.users = cache.NewUserCacheWithStorage(users, userTTL)
+	}
+	if cfg.TelegramAPI.SessionStorage == "bolt" {
+		sessions, err := storage.NewBoltStore[[]byte](db, "sessions")
+		if err != nil {
+			closeDB()
+			return nil, err
+		}
+		stores.sessions = sessions
+	}
+
+	slog.Info("Using persistent storage", "path", cfg.Storage.Path)
+	return stores, nil
+}
+
+// newSessionStorage возвращает хранилище сессий аккаунтов Telegram, выбранное в
+// telegram_api.session_storage, или nil для незашифрованных файлов session_file.
+func newSessionStorage(cfg *config.Config, sessions storage.Store[[]byte]) (func(config.TelegramAPIServer) session.Storage, error) {
+	key, err := cfg.TelegramAPI.DecodeSessionKey()
+	if err != nil {
+		return nil, err
+	}
+	var encryptor *telegram.SessionEncryptor
+	if key != nil && cfg.TelegramAPI.SessionStorage != "file" {
+		if encryptor, err = telegram.NewSessionEncryptor(key); err != nil {
+			return nil, err
+		}
+	}
+
+	switch cfg.TelegramAPI.SessionStorage {
+	case "encrypted_file":
+		return func(srv config.TelegramAPIServer) session.Storage {
+			return encryptor.Storage(&session.FileStorage{Path: srv.SessionFile})
+		}, nil
+	case "bolt":
+		return func(srv config.TelegramAPIServer) session.Storage {
+			var s session.Storage = telegram.NewStoreSessionStorage(sessions, srv.PhoneNumber)
+			// Пока сессии нет в базе, она читается из session_file: аккаунт переносится
+			// в базу без повторного входа, после чего файл удаляется.
+			if srv.SessionFile != "" {
+				path := srv.SessionFile
+				s = telegram.NewFallbackSessionStorage(s, &session.FileStorage{Path: path}, func() error {
+					if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+						return fmt.Errorf("session file %s was migrated to storage but not removed: %w", path, err)
+					}
+					slog.Info("Session file migrated to storage and removed", "session_file", path)
+					return nil
+				})
+			}
+			if encryptor != nil {
+				s = encryptor.Storage(s)
+			}
+			return s
+		}, nil
+	default:
+		return nil, nil
+	}
+}
@@ -30,6 +30,14 @@ func (e *ConsoleExporter) Export(users []domain.User) error {
 			} else {
 				fmt.Printf("%d. Name: %s, ID: %d\n", i+1, user.Name, user.ID)
 			}
+			if a := user.Activity; a != (domain.ActivityStats{}) {
+				fmt.Printf("   Activity: messages: %d", a.MessageCount)
+				if a.FirstMessageDate != "" {
+					fmt.Printf(" (%s — %s)", a.FirstMessageDate, a.LastMessageDate)
+				}
+				fmt.Printf(", mentions: %d, replies sent/received: %d/%d, joined: %d, left: %d, invited: %d\n",
+					a.MentionCount, a.RepliesSent, a.RepliesReceived, a.Joined, a.Left, a.Invited)
+			}
 		}
 	}
 	return nil
@@ -182,4 +182,45 @@ func TestConsoleExporter(t *testing.T) {
 			t.Errorf("Ожидалась ошибка nil, получено %v", err)
 		}
 	})
+	t.Run("Export выводит статистику активности", func(t *testing.T) {
+		old := os.Stdout
+		r, w, _ := os.Pipe()
+		os.Stdout = w
+
+		exporter := &ConsoleExporter{}
+		users := []domain.User{
+			{
+				ID:   1,
+				Name: "Active User",
+				Activity: domain.ActivityStats{
+					MessageCount:     3,
+					FirstMessageDate: "2024-01-01T00:00:00",
+					LastMessageDate:  "2024-02-01T00:00:00",
+					MentionCount:     2,
+					RepliesSent:      1,
+					Joined:           1,
+				},
+			},
+			{ID: 2, Name: "Silent User"},
+		}
+
+		err := exporter.Export(users)
+		if err != nil {
+			t.Errorf("Неожиданная ошибка: %v", err)
+		}
+
+		w.Close()
+		os.Stdout = old
+
+		var buf bytes.Buffer
+		buf.ReadFrom(r)
+		output := buf.String()
+
+		if !strings.Contains(output, "messages: 3 (2024-01-01T00:00:00 — 2024-02-01T00:00:00), mentions: 2, replies sent/received: 1/0, joined: 1, left: 0, invited: 0") {
+			t.Errorf("Ожидалась статистика активности в выводе, получено:\n%s", output)
+		}
+		if strings.Count(output, "Activity:") != 1 {
+			t.Error("Статистика не должна выводиться для пользователя без активности")
+		}
+	})
 }
@@ -0,0 +1,113 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"telegram-chat-parser/internal/domain"
+	"telegram-chat-parser/internal/ports"
+)
+
+// sniffLimit — сколько байт от начала данных просматривается для определения формата.
+const sniffLimit = 512
+
+// utf8BOM — метка порядка байтов, которую некоторые редакторы добавляют в начало файла.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// Format обозначает формат файла экспорта.
+type Format string
+
+const (
+	FormatJSON    Format = "json"
+	FormatHTML    Format = "html"
+	FormatUnknown Format = "unknown"
+)
+
+// DetectFormat определяет формат экспорта по первым значащим байтам данных.
+func DetectFormat(head []byte) Format {
+	head = bytes.TrimPrefix(head, utf8BOM)
+	head = bytes.TrimLeft(head, " \t\r\n")
+	if len(head) == 0 {
+		return FormatUnknown
+	}
+	switch head[0] {
+	case '{':
+		return FormatJSON
+	case '<':
+		return FormatHTML
+	}
+	return FormatUnknown
+}
+
+// AutoParser выбирает парсер по содержимому данных, поэтому принимает
+// как JSON-, так и HTML-экспорт Telegram Desktop.
+type AutoParser struct {
+	json *JsonParser
+	html *HTMLParser
+}
+
+// NewAutoParser создает новый экземпляр AutoParser.
+func NewAutoParser() ports.Parser {
+	return &AutoParser{
+		json: &JsonParser{},
+		html: &HTMLParser{},
+	}
+}
+
+// Parse определяет формат данных и разбирает их соответствующим парсером.
+func (p *AutoParser) Parse(data []byte) (*domain.ExportedChat, error) {
+	head := data
+	if len(head) > sniffLimit {
+		head = head[:sniffLimit]
+	}
+	switch DetectFormat(head) {
+	case FormatHTML:
+		return p.html.Parse(data)
+	case FormatJSON:
+		return p.json.Parse(data)
+	}
+	return nil, fmt.Errorf("unsupported export format: expected JSON or HTML")
+}
+
+// ParseStream определяет формат по началу потока и разбирает его потоково.
+func (p *AutoParser) ParseStream(r io.Reader, fn func(msg *domain.Message) error) (*domain.ExportedChat, error) {
+	format, br, err := sniff(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatHTML:
+		return p.html.ParseStream(br, fn)
+	case FormatJSON:
+		return p.json.ParseStream(br, fn)
+	}
+	return nil, fmt.Errorf("unsupported export format: expected JSON or HTML")
+}
+
+// ParseChats определяет формат по началу потока и разбирает чаты экспорта потоково.
+func (p *AutoParser) ParseChats(r io.Reader, filter domain.ChatFilter, fn func(chat *domain.ChatInfo, msg *domain.Message) error) ([]domain.ChatInfo, error) {
+	format, br, err := sniff(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatHTML:
+		return p.html.ParseChats(br, filter, fn)
+	case FormatJSON:
+		return p.json.ParseChats(br, filter, fn)
+	}
+	return nil, fmt.Errorf("unsupported export format: expected JSON or HTML")
+}
+
+// sniff определяет формат по началу потока, не теряя прочитанные байты.
+func sniff(r io.Reader) (Format, *bufio.Reader, error) {
+	br := bufio.NewReaderSize(r, sniffLimit)
+	head, err := br.Peek(sniffLimit)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return FormatUnknown, nil, fmt.Errorf("failed to read export header: %w", err)
+	}
+	return DetectFormat(head), br, nil
+}
@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"strings"
+	"telegram-chat-parser/internal/domain"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	cases := map[string]Format{
+		`{"name": "chat"}`:             FormatJSON,
+		"\xEF\xBB\xBF  \n{}":           FormatJSON,
+		"<!DOCTYPE html><html></html>": FormatHTML,
+		"\n\t<html>":                   FormatHTML,
+		"":                             FormatUnknown,
+		"name,id":                      FormatUnknown,
+	}
+	for input, expected := range cases {
+		if got := DetectFormat([]byte(input)); got != expected {
+			t.Errorf("DetectFormat(%q) = %s, ожидалось %s", input, got, expected)
+		}
+	}
+}
+
+func TestAutoParser(t *testing.T) {
+	parser := NewAutoParser()
+
+	t.Run("JSON-экспорт", func(t *testing.T) {
+		chat, err := parser.Parse([]byte(`{"name": "Json Chat", "messages": [{"id": 1}]}`))
+		if err != nil {
+			t.Fatalf("Неожиданная ошибка: %v", err)
+		}
+		if chat.Name != "Json Chat" || len(chat.Messages) != 1 {
+			t.Errorf("Неверный результат разбора: %+v", chat)
+		}
+	})
+
+	t.Run("HTML-экспорт", func(t *testing.T) {
+		chat, err := parser.Parse([]byte(testHTMLExport))
+		if err != nil {
+			t.Fatalf("Неожиданная ошибка: %v", err)
+		}
+		if chat.Name != "Test & Chat" || len(chat.Messages) != 4 {
+			t.Errorf("Неверный результат разбора: %+v", chat)
+		}
+	})
+
+	t.Run("Потоковый разбор HTML", func(t *testing.T) {
+		count := 0
+		_, err := parser.(*AutoParser).ParseStream(strings.NewReader(testHTMLExport), func(*domain.Message) error {
+			count++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Неожиданная ошибка: %v", err)
+		}
+		if count != 4 {
+			t.Errorf("Ожидалось 4 сообщения, получено %d", count)
+		}
+	})
+
+	t.Run("Перечисление чатов JSON- и HTML-экспорта", func(t *testing.T) {
+		multi := parser.(*AutoParser)
+		noop := func(*domain.ChatInfo, *domain.Message) error { return nil }
+
+		chats, err := multi.ParseChats(strings.NewReader(testAccountExport), domain.ChatFilter{}, noop)
+		if err != nil {
+			t.Fatalf("Неожиданная ошибка: %v", err)
+		}
+		if len(chats) != 3 {
+			t.Errorf("Ожидалось 3 чата, получено %d", len(chats))
+		}
+
+		chats, err = multi.ParseChats(strings.NewReader(testHTMLExport), domain.ChatFilter{}, noop)
+		if err != nil {
+			t.Fatalf("Неожиданная ошибка: %v", err)
+		}
+		if len(chats) != 1 || chats[0].Name != "Test & Chat" {
+			t.Errorf("Неверные сведения о чате: %+v", chats)
+		}
+	})
+
+	t.Run("Неизвестный формат возвращает ошибку", func(t *testing.T) {
+		if _, err := parser.Parse([]byte("plain text")); err == nil {
+			t.Error("Ожидалась ошибка для неизвестного формата, получено nil")
+		}
+		if _, err := parser.(*AutoParser).ParseStream(strings.NewReader("plain text"), func(*domain.Message) error { return nil }); err == nil {
+			t.Error("Ожидалась ошибка для неизвестного формата, получено nil")
+		}
+	})
+}
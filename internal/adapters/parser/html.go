@@ -0,0 +1,435 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"telegram-chat-parser/internal/domain"
+	"telegram-chat-parser/internal/ports"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// htmlDateLayout — формат атрибута title у даты сообщения в HTML-экспорте,
+// например "01.01.2023 12:00:00 UTC+03:00".
+const htmlDateLayout = "02.01.2006 15:04:05"
+
+// jsonDateLayout — формат даты в JSON-экспорте, к которому приводятся даты из HTML.
+const jsonDateLayout = "2006-01-02T15:04:05"
+
+// HTMLParser реализует интерфейсы Parser, StreamParser и MultiChatParser для HTML-экспорта
+// Telegram Desktop (messages.html, messages2.html, ...).
+//
+// HTML-экспорт не содержит from_id авторов, поэтому участники из него
+// идентифицируются по имени и упоминаниям.
+type HTMLParser struct{}
+
+// NewHTMLParser создает новый экземпляр HTMLParser.
+func NewHTMLParser() ports.Parser {
+	return &HTMLParser{}
+}
+
+// Parse преобразует HTML-страницу экспорта в структуру ExportedChat.
+func (p *HTMLParser) Parse(data []byte) (*domain.ExportedChat, error) {
+	var messages []domain.Message
+	chat, err := p.ParseStream(bytes.NewReader(data), func(msg *domain.Message) error {
+		messages = append(messages, *msg)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	chat.Messages = messages
+	return chat, nil
+}
+
+// ParseStream разбирает HTML-страницу экспорта потоково и передает в fn
+// каждое сообщение по мере закрытия его блока.
+func (p *HTMLParser) ParseStream(r io.Reader, fn func(msg *domain.Message) error) (*domain.ExportedChat, error) {
+	s := &htmlState{fn: fn}
+	if err := s.run(r); err != nil {
+		return nil, err
+	}
+	return &domain.ExportedChat{Name: s.chatName}, nil
+}
+
+// ParseChats разбирает HTML-страницу как экспорт из одного чата. В HTML-экспорте
+// известно только название чата, поэтому фильтр по id или типу его не выбирает.
+func (p *HTMLParser) ParseChats(r io.Reader, filter domain.ChatFilter, fn func(chat *domain.ChatInfo, msg *domain.Message) error) ([]domain.ChatInfo, error) {
+	var (
+		info    domain.ChatInfo
+		checked bool
+	)
+	s := &htmlState{}
+	s.fn = func(msg *domain.Message) error {
+		// Заголовок страницы предшествует сообщениям, поэтому к первому сообщению
+		// название чата уже известно.
+		if !checked {
+			checked = true
+			info.Name = s.chatName
+			info.Selected = filter.Match(info)
+		}
+		info.MessageCount++
+		if !info.Selected {
+			return nil
+		}
+		return fn(&info, msg)
+	}
+	if err := s.run(r); err != nil {
+		return nil, err
+	}
+
+	info.Name = s.chatName
+	if !checked {
+		info.Selected = filter.Match(info)
+	}
+	return []domain.ChatInfo{info}, nil
+}
+
+// run читает HTML из r до конца, вызывая s.fn для каждого сообщения.
+func (s *htmlState) run(r io.Reader) error {
+	z := html.NewTokenizer(r)
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if errors.Is(z.Err(), io.EOF) {
+				if !s.seenHistory {
+					return errors.New("failed to parse html: no telegram export history found")
+				}
+				return nil
+			}
+			return fmt.Errorf("failed to parse html: %w", z.Err())
+		case html.StartTagToken:
+			tok := z.Token()
+			s.startTag(tok)
+			if !isVoidElement(tok.Data) {
+				s.push(tok)
+			}
+		case html.SelfClosingTagToken:
+			s.startTag(z.Token())
+		case html.EndTagToken:
+			tok := z.Token()
+			if isVoidElement(tok.Data) {
+				continue
+			}
+			if err := s.pop(tok.Data); err != nil {
+				return err
+			}
+		case html.TextToken:
+			s.text(string(z.Text()))
+		}
+	}
+}
+
+// htmlRole описывает, какую часть сообщения представляет элемент.
+type htmlRole int
+
+const (
+	roleNone htmlRole = iota
+	roleMessage
+	roleFromName
+	roleForwardedFrom
+	roleText
+	roleLink
+	roleForwarded
+	roleReply
+	roleHeader
+	roleTitle
+	roleIgnored
+)
+
+type htmlElement struct {
+	tag  string
+	role htmlRole
+}
+
+// htmlState хранит состояние разбора между токенами.
+type htmlState struct {
+	fn          func(msg *domain.Message) error
+	stack       []htmlElement
+	seenHistory bool
+
+	chatName  string
+	title     strings.Builder
+	inHeader  int
+	inForward int
+
+	msg        *domain.Message
+	lastAuthor string
+	from       strings.Builder
+	forwarded  strings.Builder
+	body       strings.Builder
+	link       strings.Builder
+	linkHref   string
+	linkByName bool
+}
+
+func (s *htmlState) startTag(tok html.Token) {
+	if tok.Data == "br" && s.inRole(roleText) {
+		s.body.WriteString("\n")
+	}
+}
+
+func (s *htmlState) push(tok html.Token) {
+	el := htmlElement{tag: tok.Data, role: s.roleOf(tok)}
+
+	switch el.role {
+	case roleMessage:
+		s.beginMessage(tok)
+	case roleHeader:
+		s.inHeader++
+	case roleForwarded:
+		s.inForward++
+	case roleLink:
+		s.link.Reset()
+		s.linkHref = attr(tok, "href")
+		s.linkByName = strings.Contains(attr(tok, "onclick"), "ShowMentionName")
+	case roleForwardedFrom:
+		s.forwarded.Reset()
+	}
+
+	// Ссылка в блоке reply_to указывает на исходное сообщение: "#go_to_message123".
+	if s.msg != nil && tok.Data == "a" && s.inRole(roleReply) {
+		s.msg.ReplyToMessageID = replyMessageID(attr(tok, "href"))
+	}
+
+	if s.msg != nil && tok.Data == "div" && hasClass(tok, "date") {
+		s.msg.Date = convertHTMLDate(attr(tok, "title"))
+	}
+
+	s.stack = append(s.stack, el)
+}
+
+func (s *htmlState) pop(tag string) error {
+	// Ищем ближайший открытый элемент с таким тегом; незакрытые вложенные элементы
+	// закрываются неявно, как это делают браузеры.
+	i := len(s.stack) - 1
+	for i >= 0 && s.stack[i].tag != tag {
+		i--
+	}
+	if i < 0 {
+		return nil
+	}
+
+	for len(s.stack) > i {
+		el := s.stack[len(s.stack)-1]
+		s.stack = s.stack[:len(s.stack)-1]
+		if err := s.closeElement(el); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *htmlState) closeElement(el htmlElement) error {
+	switch el.role {
+	case roleMessage:
+		return s.endMessage()
+	case roleHeader:
+		s.inHeader--
+	case roleForwarded:
+		s.inForward--
+	case roleTitle:
+		if s.chatName == "" {
+			s.chatName = strings.TrimSpace(s.title.String())
+		}
+	case roleFromName:
+		if s.msg != nil {
+			s.msg.From = strings.TrimSpace(s.from.String())
+		}
+	case roleForwardedFrom:
+		// Для вложенных пересылок сохраняется автор внешней.
+		if s.msg != nil && s.msg.ForwardedFrom == "" {
+			s.msg.ForwardedFrom = strings.TrimSpace(s.forwarded.String())
+		}
+	case roleLink:
+		s.endLink()
+	}
+	return nil
+}
+
+func (s *htmlState) text(t string) {
+	if s.inRole(roleIgnored) {
+		return
+	}
+	switch {
+	case s.inRole(roleTitle):
+		s.title.WriteString(t)
+	case s.inRole(roleFromName):
+		s.from.WriteString(t)
+	case s.inRole(roleForwardedFrom):
+		s.forwarded.WriteString(t)
+	case s.inRole(roleText):
+		s.body.WriteString(t)
+		if s.inRole(roleLink) {
+			s.link.WriteString(t)
+		}
+	}
+}
+
+// roleOf определяет роль элемента по тегу и CSS-классам экспорта.
+func (s *htmlState) roleOf(tok html.Token) htmlRole {
+	if tok.Data == "a" {
+		if s.inRole(roleText) {
+			return roleLink
+		}
+		return roleNone
+	}
+	// Подпись "via @bot" рядом с именем автора и дата рядом с автором пересылки
+	// не являются частью имени.
+	if tok.Data == "span" && hasClass(tok, "details") && (s.inRole(roleFromName) || s.inRole(roleForwardedFrom)) {
+		return roleIgnored
+	}
+	if tok.Data != "div" {
+		return roleNone
+	}
+
+	switch {
+	case hasClass(tok, "history"):
+		s.seenHistory = true
+	case hasClass(tok, "page_header"):
+		return roleHeader
+	case s.inHeader > 0 && hasClass(tok, "text"):
+		return roleTitle
+	case hasClass(tok, "message") && (hasClass(tok, "default") || hasClass(tok, "service")):
+		return roleMessage
+	case s.msg == nil:
+		return roleNone
+	case hasClass(tok, "forwarded"):
+		return roleForwarded
+	case hasClass(tok, "reply_to"):
+		return roleReply
+	case hasClass(tok, "from_name") && s.inForward == 0 && !s.inRole(roleReply):
+		s.from.Reset()
+		return roleFromName
+	case hasClass(tok, "from_name") && s.inForward > 0:
+		return roleForwardedFrom
+	case hasClass(tok, "text") && !s.inRole(roleReply):
+		return roleText
+	case s.msg.Type == "service" && hasClass(tok, "body"):
+		return roleText
+	}
+	return roleNone
+}
+
+func (s *htmlState) beginMessage(tok html.Token) {
+	s.msg = &domain.Message{Type: "message"}
+	if hasClass(tok, "service") {
+		s.msg.Type = "service"
+	}
+	if id, err := strconv.Atoi(strings.TrimPrefix(attr(tok, "id"), "message")); err == nil {
+		s.msg.ID = id
+	}
+	// Сообщения подряд от одного автора помечаются классом joined и не содержат from_name.
+	if hasClass(tok, "joined") {
+		s.msg.From = s.lastAuthor
+	}
+	s.body.Reset()
+}
+
+func (s *htmlState) endMessage() error {
+	msg := s.msg
+	s.msg = nil
+	if msg == nil {
+		return nil
+	}
+
+	text, err := json.Marshal(strings.TrimSpace(s.body.String()))
+	if err != nil {
+		return fmt.Errorf("failed to encode message text: %w", err)
+	}
+	msg.Text = text
+
+	if msg.Type == "message" {
+		s.lastAuthor = msg.From
+	}
+	return s.fn(msg)
+}
+
+// endLink превращает ссылку в тексте сообщения в сущность упоминания.
+func (s *htmlState) endLink() {
+	if s.msg == nil {
+		return
+	}
+	text := strings.TrimSpace(s.link.String())
+	switch {
+	case s.linkByName:
+		s.msg.TextEntities = append(s.msg.TextEntities, domain.TextEntity{Type: "mention_name", Text: text})
+	case strings.HasPrefix(text, "@"):
+		s.msg.TextEntities = append(s.msg.TextEntities, domain.TextEntity{Type: "mention", Text: text})
+	case strings.HasPrefix(s.linkHref, "https://t.me/"):
+		s.msg.TextEntities = append(s.msg.TextEntities, domain.TextEntity{Type: "link", Text: text})
+	}
+}
+
+func (s *htmlState) inRole(role htmlRole) bool {
+	for i := len(s.stack) - 1; i >= 0; i-- {
+		if s.stack[i].role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// replyMessageID извлекает ID сообщения из ссылки вида "#go_to_message123"
+// или "messages2.html#go_to_message123". Возвращает 0, если ссылка другого вида.
+func replyMessageID(href string) int {
+	_, after, found := strings.Cut(href, "go_to_message")
+	if !found {
+		return 0
+	}
+	id, err := strconv.Atoi(after)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// convertHTMLDate приводит дату из HTML-экспорта к формату JSON-экспорта.
+// Если формат не распознан, возвращает исходную строку.
+func convertHTMLDate(title string) string {
+	if title == "" {
+		return ""
+	}
+	fields := strings.Fields(title)
+	if len(fields) < 2 {
+		return title
+	}
+	t, err := time.Parse(htmlDateLayout, fields[0]+" "+fields[1])
+	if err != nil {
+		return title
+	}
+	return t.Format(jsonDateLayout)
+}
+
+func attr(tok html.Token, key string) string {
+	for _, a := range tok.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasClass(tok html.Token, class string) bool {
+	for _, c := range strings.Fields(attr(tok, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+func isVoidElement(tag string) bool {
+	switch tag {
+	case "br", "img", "hr", "meta", "link", "input", "source", "wbr":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package parser
+
+import (
+	"encoding/json"
+	"strings"
+	"telegram-chat-parser/internal/domain"
+	"testing"
+)
+
+const testHTMLExport = `<!DOCTYPE html>
+<html>
+ <head><meta charset="utf-8"/><title>Exported Data</title></head>
+ <body>
+  <div class="page_wrap">
+   <div class="page_header">
+    <div class="content">
+     <div class="text bold">Test &amp; Chat</div>
+    </div>
+   </div>
+   <div class="page_body chat_page">
+    <div class="history">
+     <div class="message service" id="message-1">
+      <div class="body details">John Doe joined group</div>
+     </div>
+     <div class="message default clearfix" id="message1">
+      <div class="pull_left userpic_wrap"><div class="userpic userpic1"><div class="initials">JD</div></div></div>
+      <div class="body">
+       <div class="pull_right date details" title="01.01.2023 12:30:00 UTC+03:00">12:30</div>
+       <div class="from_name">John Doe <span class="details">via @somebot</span></div>
+       <div class="text">Hello <a href="https://t.me/jane">@jane</a> and <a href="" onclick="return ShowMentionName()">Bob</a><br>bye</div>
+      </div>
+     </div>
+     <div class="message default clearfix joined" id="message2">
+      <div class="body">
+       <div class="pull_right date details" title="01.01.2023 12:31:00 UTC+03:00">12:31</div>
+       <div class="text">Second</div>
+      </div>
+     </div>
+     <div class="message default clearfix" id="message3">
+      <div class="body">
+       <div class="from_name">Jane</div>
+       <div class="reply_to details">In reply to <a href="#go_to_message1">this message</a></div>
+       <div class="forwarded body">
+        <div class="from_name">Original Author <span class="date details" title="01.12.2022 10:00:00 UTC+03:00"> 01.12.2022 10:00:00</span></div>
+        <div class="text">Forwarded <a href="https://t.me/fwd">@fwd</a></div>
+       </div>
+      </div>
+     </div>
+    </div>
+   </div>
+  </div>
+ </body>
+</html>`
+
+func TestHTMLParser(t *testing.T) {
+	t.Run("Разбор HTML-экспорта Telegram Desktop", func(t *testing.T) {
+		chat, err := NewHTMLParser().Parse([]byte(testHTMLExport))
+		if err != nil {
+			t.Fatalf("Неожиданная ошибка: %v", err)
+		}
+
+		if chat.Name != "Test & Chat" {
+			t.Errorf("Ожидалось имя 'Test & Chat', получено '%s'", chat.Name)
+		}
+		if len(chat.Messages) != 4 {
+			t.Fatalf("Ожидалось 4 сообщения, получено %d", len(chat.Messages))
+		}
+
+		service := chat.Messages[0]
+		if service.Type != "service" || service.ID != -1 {
+			t.Errorf("Ожидалось служебное сообщение с ID -1, получено %+v", service)
+		}
+
+		first := chat.Messages[1]
+		if first.ID != 1 || first.From != "John Doe" {
+			t.Errorf("Неверный автор первого сообщения: %+v", first)
+		}
+		if first.Date != "2023-01-01T12:30:00" {
+			t.Errorf("Ожидалась дата '2023-01-01T12:30:00', получено '%s'", first.Date)
+		}
+		var text string
+		if err := json.Unmarshal(first.Text, &text); err != nil {
+			t.Fatalf("Текст сообщения должен быть JSON-строкой: %v", err)
+		}
+		if text != "Hello @jane and Bob\nbye" {
+			t.Errorf("Неверный текст сообщения: %q", text)
+		}
+		expectedEntities := []domain.TextEntity{
+			{Type: "mention", Text: "@jane"},
+			{Type: "mention_name", Text: "Bob"},
+		}
+		if len(first.TextEntities) != len(expectedEntities) {
+			t.Fatalf("Ожидалось %d сущностей, получено %+v", len(expectedEntities), first.TextEntities)
+		}
+		for i, e := range expectedEntities {
+			if first.TextEntities[i] != e {
+				t.Errorf("Ожидалась сущность %+v, получено %+v", e, first.TextEntities[i])
+			}
+		}
+
+		if joined := chat.Messages[2]; joined.From != "John Doe" {
+			t.Errorf("Сообщение joined должно наследовать автора, получено '%s'", joined.From)
+		}
+
+		forwarded := chat.Messages[3]
+		if forwarded.From != "Jane" {
+			t.Errorf("Автор пересланного сообщения должен быть 'Jane', получено '%s'", forwarded.From)
+		}
+		if len(forwarded.TextEntities) != 1 || forwarded.TextEntities[0].Text != "@fwd" {
+			t.Errorf("Ожидалось упоминание @fwd, получено %+v", forwarded.TextEntities)
+		}
+		if forwarded.ForwardedFrom != "Original Author" {
+			t.Errorf("Ожидался автор пересылки 'Original Author', получено '%s'", forwarded.ForwardedFrom)
+		}
+		if forwarded.ReplyToMessageID != 1 {
+			t.Errorf("Ожидался ответ на сообщение 1, получено %d", forwarded.ReplyToMessageID)
+		}
+	})
+
+	t.Run("Документ без истории сообщений возвращает ошибку", func(t *testing.T) {
+		_, err := NewHTMLParser().Parse([]byte(`<html><body><p>hello</p></body></html>`))
+		if err == nil {
+			t.Error("Ожидалась ошибка для HTML без истории, получено nil")
+		}
+	})
+
+	t.Run("Потоковый разбор передает сообщения по одному", func(t *testing.T) {
+		parser := &HTMLParser{}
+		count := 0
+		chat, err := parser.ParseStream(strings.NewReader(testHTMLExport), func(msg *domain.Message) error {
+			count++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Неожиданная ошибка: %v", err)
+		}
+		if count != 4 || len(chat.Messages) != 0 {
+			t.Errorf("Ожидалось 4 переданных сообщения без накопления, получено %d/%d", count, len(chat.Messages))
+		}
+	})
+	t.Run("ParseChats выбирает чат по названию", func(t *testing.T) {
+		parser := &HTMLParser{}
+		count := 0
+		chats, err := parser.ParseChats(strings.NewReader(testHTMLExport), domain.ChatFilter{Names: []string{"test & chat"}},
+			func(chat *domain.ChatInfo, msg *domain.Message) error {
+				count++
+				return nil
+			})
+		if err != nil {
+			t.Fatalf("Неожиданная ошибка: %v", err)
+		}
+		if len(chats) != 1 || chats[0].Name != "Test & Chat" || !chats[0].Selected || chats[0].MessageCount != 4 {
+			t.Errorf("Неверные сведения о чате: %+v", chats)
+		}
+		if count != 4 {
+			t.Errorf("Ожидалось 4 сообщения, получено %d", count)
+		}
+	})
+
+	t.Run("ParseChats пропускает чат, не прошедший фильтр", func(t *testing.T) {
+		parser := &HTMLParser{}
+		count := 0
+		chats, err := parser.ParseChats(strings.NewReader(testHTMLExport), domain.ChatFilter{Types: []string{"public_channel"}},
+			func(*domain.ChatInfo, *domain.Message) error {
+				count++
+				return nil
+			})
+		if err != nil {
+			t.Fatalf("Неожиданная ошибка: %v", err)
+		}
+		if len(chats) != 1 || chats[0].Selected || count != 0 {
+			t.Errorf("Ожидалось, что чат не выбран, получено %+v и %d сообщений", chats, count)
+		}
+	})
+}
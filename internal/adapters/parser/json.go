@@ -2,12 +2,16 @@ package parser
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"telegram-chat-parser/internal/domain"
 	"telegram-chat-parser/internal/ports"
 )
 
-// JsonParser реализует интерфейс Parser для разбора JSON данных.
+// JsonParser реализует интерфейсы Parser, StreamParser и MultiChatParser для разбора JSON данных.
+// Поддерживается как экспорт одного чата, так и полный экспорт аккаунта,
+// в котором чаты перечислены в chats.list и left_chats.list.
 type JsonParser struct{}
 
 // NewJsonParser создает новый экземпляр JsonParser.
@@ -15,11 +19,226 @@ func NewJsonParser() ports.Parser {
 	return &JsonParser{}
 }
 
+// chatMessageFunc обрабатывает сообщение вместе со сведениями о его чате.
+type chatMessageFunc func(chat *domain.ChatInfo, msg *domain.Message) error
+
 // Parse преобразует срез байт с JSON в структуру ExportedChat.
+// Для полного экспорта аккаунта сообщения всех чатов объединяются в один ExportedChat
+// с типом domain.ChatTypeAccountExport.
 func (p *JsonParser) Parse(data []byte) (*domain.ExportedChat, error) {
-	var chat domain.ExportedChat
-	if err := json.Unmarshal(data, &chat); err != nil {
+	var export struct {
+		domain.ExportedChat
+		domain.AccountExport
+	}
+	if err := json.Unmarshal(data, &export); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal json: %w", err)
 	}
-	return &chat, nil
+
+	chats := export.AllChats()
+	if len(chats) == 0 {
+		return &export.ExportedChat, nil
+	}
+
+	merged := &domain.ExportedChat{Type: domain.ChatTypeAccountExport}
+	for _, chat := range chats {
+		merged.Messages = append(merged.Messages, chat.Messages...)
+	}
+	return merged, nil
+}
+
+// ParseStream читает JSON из r потоково: массив messages разбирается по одному
+// сообщению, и каждое сообщение сразу передается в fn. Поле Messages в возвращаемой
+// структуре остается пустым, поэтому потребление памяти не зависит от размера экспорта.
+// Для полного экспорта аккаунта в fn передаются сообщения всех чатов.
+func (p *JsonParser) ParseStream(r io.Reader, fn func(msg *domain.Message) error) (*domain.ExportedChat, error) {
+	chats, account, err := p.parse(r, domain.ChatFilter{}, func(_ *domain.ChatInfo, msg *domain.Message) error {
+		return fn(msg)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if account {
+		return &domain.ExportedChat{Type: domain.ChatTypeAccountExport}, nil
+	}
+	return &domain.ExportedChat{Name: chats[0].Name, Type: chats[0].Type, ID: chats[0].ID}, nil
+}
+
+// ParseChats разбирает экспорт потоково и передает в fn сообщения чатов,
+// удовлетворяющих filter. Экспорт одного чата рассматривается как список из одного чата.
+//
+// Фильтр проверяется в момент начала массива messages, поэтому учитываются поля
+// name, type и id, расположенные перед ним (так их записывает Telegram Desktop).
+func (p *JsonParser) ParseChats(r io.Reader, filter domain.ChatFilter, fn func(chat *domain.ChatInfo, msg *domain.Message) error) ([]domain.ChatInfo, error) {
+	chats, _, err := p.parse(r, filter, fn)
+	return chats, err
+}
+
+// parse разбирает корневой объект экспорта. Второе возвращаемое значение сообщает,
+// что это полный экспорт аккаунта.
+func (p *JsonParser) parse(r io.Reader, filter domain.ChatFilter, fn chatMessageFunc) ([]domain.ChatInfo, bool, error) {
+	dec := json.NewDecoder(r)
+
+	var (
+		root    domain.ChatInfo
+		chats   []domain.ChatInfo
+		account bool
+	)
+	err := decodeChat(dec, &root, filter, fn, func(key string) (bool, error) {
+		if key != "chats" && key != "left_chats" {
+			return false, nil
+		}
+		account = true
+		list, err := streamChatList(dec, filter, fn)
+		chats = append(chats, list...)
+		return true, err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if account {
+		return chats, true, nil
+	}
+	return []domain.ChatInfo{root}, false, nil
+}
+
+// decodeChat разбирает объект одного чата. Ключи, которые обрабатывает extra,
+// не разбираются как поля чата.
+func decodeChat(dec *json.Decoder, info *domain.ChatInfo, filter domain.ChatFilter, fn chatMessageFunc, extra func(key string) (bool, error)) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	seenMessages := false
+	for dec.More() {
+		key, err := readKey(dec)
+		if err != nil {
+			return err
+		}
+
+		handled := false
+		if extra != nil {
+			handled, err = extra(key)
+		}
+		if !handled && err == nil {
+			switch key {
+			case "name":
+				err = dec.Decode(&info.Name)
+			case "type":
+				err = dec.Decode(&info.Type)
+			case "id":
+				err = dec.Decode(&info.ID)
+			case "messages":
+				seenMessages = true
+				info.Selected = filter.Match(*info)
+				err = streamMessages(dec, func(msg *domain.Message) error {
+					info.MessageCount++
+					if !info.Selected {
+						return nil
+					}
+					return fn(info, msg)
+				})
+			default:
+				err = skipValue(dec)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to decode field %q: %w", key, err)
+		}
+	}
+
+	if !seenMessages {
+		info.Selected = filter.Match(*info)
+	}
+	return expectDelim(dec, '}')
+}
+
+// streamChatList разбирает раздел chats или left_chats экспорта аккаунта.
+func streamChatList(dec *json.Decoder, filter domain.ChatFilter, fn chatMessageFunc) ([]domain.ChatInfo, error) {
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+
+	var chats []domain.ChatInfo
+	for dec.More() {
+		key, err := readKey(dec)
+		if err != nil {
+			return nil, err
+		}
+		if key != "list" {
+			if err := skipValue(dec); err != nil {
+				return nil, fmt.Errorf("failed to decode field %q: %w", key, err)
+			}
+			continue
+		}
+
+		if err := expectDelim(dec, '['); err != nil {
+			return nil, err
+		}
+		for dec.More() {
+			var info domain.ChatInfo
+			if err := decodeChat(dec, &info, filter, fn, nil); err != nil {
+				return nil, fmt.Errorf("failed to decode chat #%d: %w", len(chats)+1, err)
+			}
+			chats = append(chats, info)
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return nil, err
+		}
+	}
+
+	return chats, expectDelim(dec, '}')
+}
+
+// streamMessages разбирает массив сообщений поэлементно.
+func streamMessages(dec *json.Decoder, fn func(msg *domain.Message) error) error {
+	if err := expectDelim(dec, '['); err != nil {
+		return err
+	}
+
+	for dec.More() {
+		var msg domain.Message
+		if err := dec.Decode(&msg); err != nil {
+			return fmt.Errorf("failed to unmarshal message: %w", err)
+		}
+		if err := fn(&msg); err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(dec, ']')
+}
+
+// readKey читает очередной ключ JSON-объекта.
+func readKey(dec *json.Decoder) (string, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return "", fmt.Errorf("failed to read json token: %w", err)
+	}
+	key, ok := tok.(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected json token %v, expected object key", tok)
+	}
+	return key, nil
+}
+
+// skipValue пропускает значение, которое не нужно для извлечения участников.
+func skipValue(dec *json.Decoder) error {
+	var skip json.RawMessage
+	return dec.Decode(&skip)
+}
+
+// expectDelim проверяет, что следующий токен является указанным разделителем.
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to unmarshal json: unexpected end of input")
+		}
+		return fmt.Errorf("failed to unmarshal json: %w", err)
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("failed to unmarshal json: unexpected token %v, expected %q", tok, want)
+	}
+	return nil
 }
@@ -1,6 +1,10 @@
 package parser
 
 import (
+	"errors"
+	"reflect"
+	"strings"
+	"telegram-chat-parser/internal/domain"
 	"testing"
 )
 
@@ -132,3 +136,212 @@ func TestJsonParser(t *testing.T) {
 		}
 	})
 }
+
+func TestJsonParserParticipantFields(t *testing.T) {
+	parser := &JsonParser{}
+	testData := `{"messages": [{
+		"id": 2,
+		"type": "message",
+		"from": "Jane",
+		"from_id": "user2",
+		"forwarded_from": "Original",
+		"forwarded_from_id": "user3",
+		"saved_from": "Archivist",
+		"reply_to_message_id": 1,
+		"reactions": [{"type": "emoji", "count": 2, "emoji": "👍", "recent": [{"from": "Fan", "from_id": "user4", "date": "2024-01-01T00:00:00"}]}],
+		"text_entities": [{"type": "mention_name", "text": "Quiet", "user_id": 5}]
+	}, {
+		"id": 3,
+		"type": "service",
+		"actor": "John",
+		"actor_id": "user1",
+		"action": "invite_members",
+		"members": ["Newbie"]
+	}]}`
+
+	chat, err := parser.Parse([]byte(testData))
+	if err != nil {
+		t.Fatalf("Неожиданная ошибка: %v", err)
+	}
+
+	msg := chat.Messages[0]
+	if msg.ForwardedFrom != "Original" || msg.ForwardedFromID != "user3" || msg.SavedFrom != "Archivist" || msg.ReplyToMessageID != 1 {
+		t.Errorf("Неверные поля пересылки и ответа: %+v", msg)
+	}
+	if len(msg.Reactions) != 1 || len(msg.Reactions[0].Recent) != 1 || msg.Reactions[0].Recent[0].FromID != "user4" {
+		t.Errorf("Неверные реакции: %+v", msg.Reactions)
+	}
+	if len(msg.TextEntities) != 1 || msg.TextEntities[0].UserID != 5 {
+		t.Errorf("Ожидалось упоминание по имени с user_id 5, получено %+v", msg.TextEntities)
+	}
+	if members := chat.Messages[1].Members; len(members) != 1 || members[0] != "Newbie" {
+		t.Errorf("Ожидался приглашенный участник Newbie, получено %v", members)
+	}
+}
+
+func TestJsonParserParseStream(t *testing.T) {
+	t.Run("Потоковый разбор передает сообщения по одному", func(t *testing.T) {
+		parser := &JsonParser{}
+		testData := `{
+			"name": "Test Chat",
+			"type": "private_group",
+			"id": 12345,
+			"personal_information": {"nested": [1, 2, {"a": "b"}]},
+			"messages": [
+				{"id": 1, "type": "message", "from": "John Doe", "from_id": "user123", "text": "Hello"},
+				{"id": 2, "type": "message", "from": "Jane", "from_id": "user456", "text": ["part1", {"type": "bold", "text": "x"}]}
+			]
+		}`
+
+		var ids []int
+		chat, err := parser.ParseStream(strings.NewReader(testData), func(msg *domain.Message) error {
+			ids = append(ids, msg.ID)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Неожиданная ошибка: %v", err)
+		}
+
+		if chat.Name != "Test Chat" || chat.Type != "private_group" || chat.ID != 12345 {
+			t.Errorf("Неверные метаданные чата: %+v", chat)
+		}
+		if len(chat.Messages) != 0 {
+			t.Errorf("Ожидалось, что сообщения не накапливаются, получено %d", len(chat.Messages))
+		}
+		if len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+			t.Errorf("Ожидались сообщения [1 2], получено %v", ids)
+		}
+	})
+
+	t.Run("Ошибка обработчика прерывает разбор", func(t *testing.T) {
+		parser := &JsonParser{}
+		stopErr := errors.New("stop")
+		calls := 0
+
+		_, err := parser.ParseStream(strings.NewReader(`{"messages": [{"id": 1}, {"id": 2}]}`), func(msg *domain.Message) error {
+			calls++
+			return stopErr
+		})
+		if !errors.Is(err, stopErr) {
+			t.Errorf("Ожидалась ошибка обработчика, получено %v", err)
+		}
+		if calls != 1 {
+			t.Errorf("Ожидался 1 вызов обработчика, получено %d", calls)
+		}
+	})
+
+	t.Run("Некорректный JSON возвращает ошибку", func(t *testing.T) {
+		parser := &JsonParser{}
+		for _, input := range []string{``, `[]`, `{"messages": [{"id": 1}`, `{"messages": {}}`} {
+			if _, err := parser.ParseStream(strings.NewReader(input), func(*domain.Message) error { return nil }); err == nil {
+				t.Errorf("Ожидалась ошибка для %q, получено nil", input)
+			}
+		}
+	})
+}
+
+const testAccountExport = `{
+	"about": "Here is the data you requested.",
+	"personal_information": {"user_id": 1, "first_name": "Me"},
+	"contacts": {"list": [{"first_name": "A", "phone_number": "+1"}]},
+	"chats": {
+		"about": "This page lists all chats from this export.",
+		"list": [
+			{"name": "Family", "type": "private_group", "id": 100, "messages": [
+				{"id": 1, "type": "message", "from": "Mom", "from_id": "user10"},
+				{"id": 2, "type": "message", "from": "Dad", "from_id": "user11"}
+			]},
+			{"name": "Work", "type": "private_supergroup", "id": 200, "messages": [
+				{"id": 1, "type": "message", "from": "Boss", "from_id": "user20"}
+			]}
+		]
+	},
+	"left_chats": {"about": "Chats you left.", "list": [
+		{"name": "Old", "type": "public_supergroup", "id": 300, "messages": [
+			{"id": 7, "type": "message", "from": "Stranger", "from_id": "user30"}
+		]}
+	]}
+}`
+
+func TestJsonParserAccountExport(t *testing.T) {
+	t.Run("Parse объединяет сообщения всех чатов", func(t *testing.T) {
+		parser := &JsonParser{}
+		chat, err := parser.Parse([]byte(testAccountExport))
+		if err != nil {
+			t.Fatalf("Неожиданная ошибка: %v", err)
+		}
+		if chat.Type != domain.ChatTypeAccountExport {
+			t.Errorf("Ожидался тип %q, получено %q", domain.ChatTypeAccountExport, chat.Type)
+		}
+		if len(chat.Messages) != 4 {
+			t.Errorf("Ожидалось 4 сообщения, получено %d", len(chat.Messages))
+		}
+	})
+
+	t.Run("ParseStream передает сообщения всех чатов", func(t *testing.T) {
+		parser := &JsonParser{}
+		var authors []string
+		chat, err := parser.ParseStream(strings.NewReader(testAccountExport), func(msg *domain.Message) error {
+			authors = append(authors, msg.From)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Неожиданная ошибка: %v", err)
+		}
+		if chat.Type != domain.ChatTypeAccountExport {
+			t.Errorf("Ожидался тип %q, получено %q", domain.ChatTypeAccountExport, chat.Type)
+		}
+		if strings.Join(authors, ",") != "Mom,Dad,Boss,Stranger" {
+			t.Errorf("Неожиданные авторы: %v", authors)
+		}
+	})
+
+	t.Run("ParseChats перечисляет чаты и применяет фильтр", func(t *testing.T) {
+		parser := &JsonParser{}
+		var got []string
+		chats, err := parser.ParseChats(strings.NewReader(testAccountExport), domain.ChatFilter{IDs: []int{100, 300}},
+			func(chat *domain.ChatInfo, msg *domain.Message) error {
+				got = append(got, chat.Name+":"+msg.From)
+				return nil
+			})
+		if err != nil {
+			t.Fatalf("Неожиданная ошибка: %v", err)
+		}
+
+		expected := []domain.ChatInfo{
+			{ID: 100, Name: "Family", Type: "private_group", MessageCount: 2, Selected: true},
+			{ID: 200, Name: "Work", Type: "private_supergroup", MessageCount: 1, Selected: false},
+			{ID: 300, Name: "Old", Type: "public_supergroup", MessageCount: 1, Selected: true},
+		}
+		if !reflect.DeepEqual(chats, expected) {
+			t.Errorf("Ожидалось %+v, получено %+v", expected, chats)
+		}
+		if strings.Join(got, ",") != "Family:Mom,Family:Dad,Old:Stranger" {
+			t.Errorf("Неожиданные сообщения: %v", got)
+		}
+	})
+
+	t.Run("ParseChats для экспорта одного чата", func(t *testing.T) {
+		parser := &JsonParser{}
+		data := `{"name": "Solo", "type": "personal_chat", "id": 5, "messages": [{"id": 1, "from": "A", "from_id": "user1"}]}`
+
+		chats, err := parser.ParseChats(strings.NewReader(data), domain.ChatFilter{Names: []string{"solo"}},
+			func(*domain.ChatInfo, *domain.Message) error { return nil })
+		if err != nil {
+			t.Fatalf("Неожиданная ошибка: %v", err)
+		}
+		expected := []domain.ChatInfo{{ID: 5, Name: "Solo", Type: "personal_chat", MessageCount: 1, Selected: true}}
+		if !reflect.DeepEqual(chats, expected) {
+			t.Errorf("Ожидалось %+v, получено %+v", expected, chats)
+		}
+	})
+
+	t.Run("Некорректный список чатов возвращает ошибку", func(t *testing.T) {
+		parser := &JsonParser{}
+		for _, input := range []string{`{"chats": []}`, `{"chats": {"list": {}}}`, `{"chats": {"list": [{"messages": [}]}}`} {
+			if _, err := parser.ParseChats(strings.NewReader(input), domain.ChatFilter{}, func(*domain.ChatInfo, *domain.Message) error { return nil }); err == nil {
+				t.Errorf("Ожидалась ошибка для %q, получено nil", input)
+			}
+		}
+	})
+}
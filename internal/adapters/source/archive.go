@@ -0,0 +1,322 @@
+package source
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrArchiveLimitExceeded возвращается, когда архив превышает допустимые лимиты
+	// по количеству записей или объему распакованных данных (защита от архивных бомб).
+	ErrArchiveLimitExceeded = errors.New("archive limit exceeded")
+	// ErrNoExportFiles возвращается, когда в архиве нет ни одного файла экспорта чата.
+	ErrNoExportFiles = errors.New("archive contains no telegram export files")
+)
+
+// exportFileRegexp описывает имена файлов экспорта Telegram Desktop внутри архива:
+// result.json для JSON-экспорта и messages.html, messages2.html, ... для HTML-экспорта.
+var exportFileRegexp = regexp.MustCompile(`^(result\.json|messages\d*\.html)$`)
+
+var (
+	zipMagic  = []byte("PK\x03\x04")
+	gzipMagic = []byte{0x1f, 0x8b}
+)
+
+// ArchiveKind обозначает тип архива.
+type ArchiveKind string
+
+const (
+	ArchiveNone  ArchiveKind = ""
+	ArchiveZip   ArchiveKind = "zip"
+	ArchiveTarGz ArchiveKind = "tar.gz"
+	// ArchiveGzip — один сжатый gzip файл, например result.json.gz.
+	ArchiveGzip ArchiveKind = "gzip"
+)
+
+// ArchiveLimits задает ограничения при распаковке архива.
+type ArchiveLimits struct {
+	// MaxEntries — максимальное количество записей в архиве, включая медиафайлы.
+	MaxEntries int
+	// MaxExtractedBytes — максимальный суммарный объем распакованных файлов экспорта.
+	MaxExtractedBytes int64
+}
+
+// DetectArchive определяет тип архива по сигнатуре файла.
+func DetectArchive(filePath string) (ArchiveKind, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return ArchiveNone, fmt.Errorf("failed to open file %s: %w", filePath, err)
+	}
+	defer f.Close()
+
+	head := make([]byte, len(zipMagic))
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return ArchiveNone, fmt.Errorf("failed to read file %s: %w", filePath, err)
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, zipMagic):
+		return ArchiveZip, nil
+	case bytes.HasPrefix(head, gzipMagic):
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return ArchiveNone, fmt.Errorf("failed to read file %s: %w", filePath, err)
+		}
+		return detectGzip(f)
+	}
+	return ArchiveNone, nil
+}
+
+// detectGzip отличает tar.gz от одного сжатого файла по заголовку tar в начале
+// распакованных данных.
+func detectGzip(r io.Reader) (ArchiveKind, error) {
+	gz, err := gzip.NewReader(bufio.NewReader(r))
+	if err != nil {
+		return ArchiveNone, fmt.Errorf("failed to open gzip: %w", err)
+	}
+	defer gz.Close()
+
+	_, err = tar.NewReader(gz).Next()
+	if err == nil || errors.Is(err, io.EOF) {
+		return ArchiveTarGz, nil
+	}
+	return ArchiveGzip, nil
+}
+
+// ArchiveSource извлекает файлы экспорта чата (result.json, messages*.html)
+// из ZIP или tar.gz архива папки экспорта Telegram Desktop или из одного сжатого
+// gzip файла экспорта. Медиафайлы игнорируются.
+type ArchiveSource struct {
+	filePath string
+	kind     ArchiveKind
+	limits   ArchiveLimits
+}
+
+// NewArchiveSource создает новый экземпляр ArchiveSource.
+func NewArchiveSource(filePath string, kind ArchiveKind, limits ArchiveLimits) *ArchiveSource {
+	return &ArchiveSource{filePath: filePath, kind: kind, limits: limits}
+}
+
+// Extract распаковывает файлы экспорта в каталог dir и возвращает пути к ним,
+// упорядоченные по пути внутри архива.
+func (s *ArchiveSource) Extract(dir string) ([]string, error) {
+	var (
+		paths []string
+		err   error
+	)
+	switch s.kind {
+	case ArchiveZip:
+		paths, err = s.extractZip(dir)
+	case ArchiveTarGz:
+		paths, err = s.extractTarGz(dir)
+	case ArchiveGzip:
+		paths, err = s.extractGzip(dir)
+	default:
+		return nil, fmt.Errorf("unsupported archive type %q", s.kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract archive %s: %w", filepath.Base(s.filePath), err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(s.filePath), ErrNoExportFiles)
+	}
+	return paths, nil
+}
+
+// archiveEntry описывает найденный в архиве файл экспорта.
+type archiveEntry struct {
+	name string
+	open func() (io.ReadCloser, error)
+}
+
+func (s *ArchiveSource) extractZip(dir string) ([]string, error) {
+	zr, err := zip.OpenReader(s.filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip: %w", err)
+	}
+	defer zr.Close()
+
+	if err := s.checkEntries(len(zr.File)); err != nil {
+		return nil, err
+	}
+
+	var entries []archiveEntry
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !isExportFile(f.Name) {
+			continue
+		}
+		entries = append(entries, archiveEntry{name: f.Name, open: f.Open})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	w := s.newWriter(dir)
+	for _, e := range entries {
+		rc, err := e.open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", e.name, err)
+		}
+		err = w.write(e.name, rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return w.paths, nil
+}
+
+func (s *ArchiveSource) extractTarGz(dir string) ([]string, error) {
+	f, err := os.Open(s.filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gzip: %w", err)
+	}
+	defer gz.Close()
+
+	// tar читается последовательно, поэтому файлы распаковываются в порядке следования,
+	// а затем пути сортируются по имени записи.
+	type extracted struct{ name, path string }
+	var found []extracted
+
+	w := s.newWriter(dir)
+	tr := tar.NewReader(gz)
+	for count := 1; ; count++ {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar: %w", err)
+		}
+		if err := s.checkEntries(count); err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg || !isExportFile(hdr.Name) {
+			continue
+		}
+		if err := w.write(hdr.Name, io.NopCloser(tr)); err != nil {
+			return nil, err
+		}
+		found = append(found, extracted{name: hdr.Name, path: w.paths[len(w.paths)-1]})
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].name < found[j].name })
+	paths := make([]string, 0, len(found))
+	for _, e := range found {
+		paths = append(paths, e.path)
+	}
+	return paths, nil
+}
+
+// extractGzip распаковывает один сжатый файл. Его имя берется из заголовка gzip или
+// из имени архива без расширения .gz и должно оканчиваться на .json или .html; иначе
+// файл не считается экспортом и не распаковывается.
+func (s *ArchiveSource) extractGzip(dir string) ([]string, error) {
+	f, err := os.Open(s.filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gzip: %w", err)
+	}
+	defer gz.Close()
+
+	name := gz.Name
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(s.filePath), ".gz")
+	}
+	if !isGzipExportFile(name) {
+		return nil, nil
+	}
+	w := s.newWriter(dir)
+	if err := w.write(name, gz); err != nil {
+		return nil, err
+	}
+	return w.paths, nil
+}
+
+func (s *ArchiveSource) checkEntries(count int) error {
+	if s.limits.MaxEntries > 0 && count > s.limits.MaxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrArchiveLimitExceeded, s.limits.MaxEntries)
+	}
+	return nil
+}
+
+func (s *ArchiveSource) newWriter(dir string) *extractWriter {
+	return &extractWriter{dir: dir, maxBytes: s.limits.MaxExtractedBytes}
+}
+
+// extractWriter записывает файлы экспорта на диск и следит за суммарным объемом.
+// Объем считается по фактически прочитанным байтам, а не по заголовкам архива,
+// которые могут быть подделаны.
+type extractWriter struct {
+	dir      string
+	maxBytes int64
+	written  int64
+	paths    []string
+}
+
+func (w *extractWriter) write(name string, r io.Reader) error {
+	// Имя записи из архива не используется в пути на диске, что исключает выход за пределы dir.
+	dst := filepath.Join(w.dir, fmt.Sprintf("%03d-%s", len(w.paths), path.Base(name)))
+	f, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create file for %s: %w", name, err)
+	}
+
+	src := r
+	if w.maxBytes > 0 {
+		// Читаем на один байт больше лимита, чтобы отличить "ровно лимит" от превышения.
+		src = io.LimitReader(r, w.maxBytes-w.written+1)
+	}
+	n, err := io.Copy(f, src)
+	w.written += n
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %w", name, err)
+	}
+	if w.maxBytes > 0 && w.written > w.maxBytes {
+		return fmt.Errorf("%w: extracted data exceeds %d bytes", ErrArchiveLimitExceeded, w.maxBytes)
+	}
+
+	w.paths = append(w.paths, dst)
+	return nil
+}
+
+// isExportFile проверяет, является ли запись архива файлом экспорта чата.
+func isExportFile(name string) bool {
+	name = strings.ReplaceAll(name, "\\", "/")
+	return exportFileRegexp.MatchString(path.Base(name))
+}
+
+// isGzipExportFile проверяет имя сжатого файла экспорта. Оно может отличаться от
+// имен файлов в папке экспорта (например, chat.json), но формат должен быть JSON или HTML.
+func isGzipExportFile(name string) bool {
+	switch strings.ToLower(path.Ext(strings.ReplaceAll(name, "\\", "/"))) {
+	case ".json", ".html":
+		return true
+	}
+	return false
+}
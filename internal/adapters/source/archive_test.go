@@ -0,0 +1,207 @@
+package source
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type archiveFile struct {
+	name    string
+	content string
+}
+
+func writeZip(t *testing.T, files []archiveFile) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatalf("Не удалось создать запись %s: %v", f.name, err)
+		}
+		if _, err := w.Write([]byte(f.content)); err != nil {
+			t.Fatalf("Не удалось записать %s: %v", f.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Не удалось закрыть zip: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "export.zip")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Не удалось записать архив: %v", err)
+	}
+	return path
+}
+
+func writeTarGz(t *testing.T, files []archiveFile) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("Не удалось записать заголовок %s: %v", f.name, err)
+		}
+		if _, err := tw.Write([]byte(f.content)); err != nil {
+			t.Fatalf("Не удалось записать %s: %v", f.name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Не удалось закрыть tar: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("Не удалось закрыть gzip: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "export.tar.gz")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Не удалось записать архив: %v", err)
+	}
+	return path
+}
+
+func writeGzip(t *testing.T, fileName, headerName, content string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Name = headerName
+	if _, err := gw.Write([]byte(content)); err != nil {
+		t.Fatalf("Не удалось записать gzip: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("Не удалось закрыть gzip: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), fileName)
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Не удалось записать архив: %v", err)
+	}
+	return path
+}
+
+var exportFolder = []archiveFile{
+	{name: "ChatExport/photos/photo_1.jpg", content: "binary"},
+	{name: "ChatExport/messages2.html", content: "<html>2</html>"},
+	{name: "ChatExport/messages.html", content: "<html>1</html>"},
+	{name: "ChatExport/files/result.json.bak", content: "ignored"},
+	{name: "Other/result.json", content: `{"name": "chat"}`},
+}
+
+func TestArchiveSource(t *testing.T) {
+	noLimits := ArchiveLimits{}
+
+	for _, tc := range []struct {
+		name  string
+		write func(*testing.T, []archiveFile) string
+		kind  ArchiveKind
+	}{
+		{"zip", writeZip, ArchiveZip},
+		{"tar.gz", writeTarGz, ArchiveTarGz},
+	} {
+		t.Run("Extract извлекает файлы экспорта из "+tc.name, func(t *testing.T) {
+			archivePath := tc.write(t, exportFolder)
+
+			kind, err := DetectArchive(archivePath)
+			if err != nil || kind != tc.kind {
+				t.Fatalf("Ожидался тип %s, получено %s (ошибка %v)", tc.kind, kind, err)
+			}
+
+			paths, err := NewArchiveSource(archivePath, kind, noLimits).Extract(t.TempDir())
+			if err != nil {
+				t.Fatalf("Неожиданная ошибка: %v", err)
+			}
+
+			expected := []string{"<html>1</html>", "<html>2</html>", `{"name": "chat"}`}
+			if len(paths) != len(expected) {
+				t.Fatalf("Ожидалось %d файлов, получено %d: %v", len(expected), len(paths), paths)
+			}
+			for i, p := range paths {
+				data, err := os.ReadFile(p)
+				if err != nil {
+					t.Fatalf("Не удалось прочитать %s: %v", p, err)
+				}
+				if string(data) != expected[i] {
+					t.Errorf("Файл %d: ожидалось %q, получено %q", i, expected[i], data)
+				}
+			}
+		})
+
+		t.Run("Extract отклоняет архив со слишком большим числом записей ("+tc.name+")", func(t *testing.T) {
+			archivePath := tc.write(t, exportFolder)
+			_, err := NewArchiveSource(archivePath, tc.kind, ArchiveLimits{MaxEntries: 2}).Extract(t.TempDir())
+			if !errors.Is(err, ErrArchiveLimitExceeded) {
+				t.Errorf("Ожидалась ошибка ErrArchiveLimitExceeded, получено %v", err)
+			}
+		})
+
+		t.Run("Extract отклоняет архив с превышением объема ("+tc.name+")", func(t *testing.T) {
+			archivePath := tc.write(t, []archiveFile{{name: "result.json", content: string(bytes.Repeat([]byte("a"), 1024))}})
+			_, err := NewArchiveSource(archivePath, tc.kind, ArchiveLimits{MaxExtractedBytes: 100}).Extract(t.TempDir())
+			if !errors.Is(err, ErrArchiveLimitExceeded) {
+				t.Errorf("Ожидалась ошибка ErrArchiveLimitExceeded, получено %v", err)
+			}
+		})
+
+		t.Run("Extract возвращает ошибку для архива без экспорта ("+tc.name+")", func(t *testing.T) {
+			archivePath := tc.write(t, []archiveFile{{name: "photos/1.jpg", content: "x"}})
+			_, err := NewArchiveSource(archivePath, tc.kind, noLimits).Extract(t.TempDir())
+			if !errors.Is(err, ErrNoExportFiles) {
+				t.Errorf("Ожидалась ошибка ErrNoExportFiles, получено %v", err)
+			}
+		})
+	}
+
+	t.Run("Сжатый gzip файл экспорта без tar", func(t *testing.T) {
+		content := `{"name": "chat", "messages": []}`
+		for _, headerName := range []string{"result.json", ""} {
+			archivePath := writeGzip(t, "chat.json.gz", headerName, content)
+
+			kind, err := DetectArchive(archivePath)
+			if err != nil || kind != ArchiveGzip {
+				t.Fatalf("Ожидался тип %s, получено %s (ошибка %v)", ArchiveGzip, kind, err)
+			}
+			paths, err := NewArchiveSource(archivePath, kind, noLimits).Extract(t.TempDir())
+			if err != nil {
+				t.Fatalf("Неожиданная ошибка: %v", err)
+			}
+			if len(paths) != 1 {
+				t.Fatalf("Ожидался один файл, получено %v", paths)
+			}
+			data, err := os.ReadFile(paths[0])
+			if err != nil || string(data) != content {
+				t.Errorf("Ожидалось %q, получено %q (ошибка %v)", content, data, err)
+			}
+		}
+
+		// Сжатый файл другого формата не распаковывается.
+		for _, names := range [][2]string{{"photo.jpg.gz", ""}, {"chat.json.gz", "photo.jpg"}, {"data.gz", ""}} {
+			archivePath := writeGzip(t, names[0], names[1], "binary")
+			_, err := NewArchiveSource(archivePath, ArchiveGzip, noLimits).Extract(t.TempDir())
+			if !errors.Is(err, ErrNoExportFiles) {
+				t.Errorf("%v: ожидалась ошибка ErrNoExportFiles, получено %v", names, err)
+			}
+		}
+
+		archivePath := writeGzip(t, "chat.json.gz", "", string(bytes.Repeat([]byte("a"), 1024)))
+		_, err := NewArchiveSource(archivePath, ArchiveGzip, ArchiveLimits{MaxExtractedBytes: 100}).Extract(t.TempDir())
+		if !errors.Is(err, ErrArchiveLimitExceeded) {
+			t.Errorf("Ожидалась ошибка ErrArchiveLimitExceeded, получено %v", err)
+		}
+	})
+
+	t.Run("DetectArchive не считает обычный файл архивом", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "result.json")
+		if err := os.WriteFile(path, []byte(`{}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		kind, err := DetectArchive(path)
+		if err != nil || kind != ArchiveNone {
+			t.Errorf("Ожидался ArchiveNone, получено %q (ошибка %v)", kind, err)
+		}
+	})
+}
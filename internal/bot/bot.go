@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html"
 	"io"
@@ -17,8 +19,10 @@ import (
 
 	"github.com/mattn/go-runewidth"
 	"github.com/xuri/excelize/v2"
+	"go.opentelemetry.io/otel/attribute"
 
 	"telegram-chat-parser/cmd/bot/config"
+	"telegram-chat-parser/internal/tracing"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -42,7 +46,8 @@ type fileBatch struct {
 type ServerAPI interface {
 	StartTask(ctx context.Context, files []DocumentFile) (*StartTaskResponse, error)
 	GetTaskStatus(ctx context.Context, taskID string) (*TaskStatusResponse, error)
-	GetTaskResult(ctx context.Context, taskID string, page, pageSize int) (*TaskResultResponse, error)
+	StreamTaskEvents(ctx context.Context, taskID string, fn func(event string, data []byte) error) error
+	GetTaskResult(ctx context.Context, taskID string, page, pageSize int, filter config.ResultFilter) (*TaskResultResponse, error)
 }
 
 type Bot struct {
@@ -157,7 +162,7 @@ func (b *Bot) handleMessage(ctx context.Context, msg *tgbotapi.Message) {
 		return
 	}
 
-	reply := tgbotapi.NewMessage(msg.Chat.ID, "Пожалуйста, отправьте мне JSON-файл с историей чата, выгруженный из Telegram.")
+	reply := tgbotapi.NewMessage(msg.Chat.ID, "Пожалуйста, отправьте мне файл с историей чата, выгруженный из Telegram (JSON или HTML).")
 	b.sendMessage(reply)
 }
 
@@ -166,7 +171,9 @@ func (b *Bot) handleCommand(ctx context.Context, msg *tgbotapi.Message) {
 	switch msg.Command() {
 	case startCommand:
 		replyText := fmt.Sprintf("Добро пожаловать! Я бот для анализа истории чатов Telegram.\n\n"+
-			"Просто отправьте мне один или несколько JSON-файлов с историей (до %d шт.) в одном сообщении, и я извлеку список участников.\n\n"+
+			"Просто отправьте мне один или несколько файлов с историей (до %d шт.) в одном сообщении, и я извлеку список участников.\n\n"+
+			"Поддерживаются экспорты Telegram Desktop в форматах JSON (result.json) и HTML (messages.html, messages2.html, ...), "+
+			"а также папка экспорта, упакованная в ZIP или tar.gz.\n\n"+
 			"Вы можете отправить как одиночный файл, так и группу файлов (альбом).\n\n"+
 			"Файлы не сохраняются на сервере и обрабатываются на лету.", b.cfg.MaxFilesPerMessage)
 		reply := tgbotapi.NewMessage(msg.Chat.ID, replyText)
@@ -252,6 +259,10 @@ func (b *Bot) processFileBatch(ctx context.Context, chatID int64, docs []*tgbota
 	}
 	logger := b.logger.With(slog.Int64("chat_id", chatID), slog.Int("file_count", len(docs)))
 
+	// Контекст трассы передается серверу в запросе на создание задачи.
+	ctx, span := tracing.Start(ctx, "Bot.processFileBatch", attribute.Int("files", len(docs)))
+	defer span.End()
+
 	if len(docs) > b.cfg.MaxFilesPerMessage {
 		logger.Warn("file limit exceeded for single message", slog.Int("file_count", len(docs)), slog.Int("max_files", b.cfg.MaxFilesPerMessage))
 		reply := tgbotapi.NewMessage(chatID, fmt.Sprintf("Превышен лимит файлов в одном сообщении. Вы отправили %d, а разрешено %d. Обработка отменена.", len(docs), b.cfg.MaxFilesPerMessage))
@@ -314,9 +325,28 @@ func (b *Bot) processFileBatch(ctx context.Context, chatID int64, docs []*tgbota
 	}
 
 	b.taskStore.Set(chatID, "pending")
-	b.sendMessage(tgbotapi.NewMessage(chatID, fmt.Sprintf("Начинаю обработку %d файлов...", len(filesToProcess))))
+	// Это сообщение затем редактируется, показывая прогресс обработки.
+	statusMessageID := b.sendMessageForEdit(tgbotapi.NewMessage(chatID, fmt.Sprintf("Начинаю обработку %d файлов...", len(filesToProcess))))
 
 	startResp, err := b.serverClient.StartTask(ctx, filesToProcess)
+	var queueFullErr *QueueFullError
+	if errors.As(err, &queueFullErr) {
+		logger.Warn("backend task queue is full", slog.Duration("retry_after", queueFullErr.RetryAfter))
+		b.sendMessage(tgbotapi.NewMessage(chatID, fmt.Sprintf(
+			"Сервер сейчас обрабатывает слишком много файлов. Пожалуйста, повторите попытку через %s.",
+			max(queueFullErr.RetryAfter, time.Second))))
+		b.taskStore.Delete(chatID)
+		return
+	}
+	var quotaErr *QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		logger.Warn("backend daily quota exceeded", slog.Duration("retry_after", quotaErr.RetryAfter))
+		b.sendMessage(tgbotapi.NewMessage(chatID, fmt.Sprintf(
+			"Дневной лимит обработки файлов исчерпан. Лимит обновится через %s.",
+			max(quotaErr.RetryAfter, time.Second).Round(time.Minute))))
+		b.taskStore.Delete(chatID)
+		return
+	}
 	if err != nil {
 		logger.Error("failed to start task on backend", slog.String("error", err.Error()))
 		b.sendMessage(tgbotapi.NewMessage(chatID, "Не удалось начать обработку файлов на сервере. Пожалуйста, попробуйте позже."))
@@ -327,17 +357,35 @@ func (b *Bot) processFileBatch(ctx context.Context, chatID int64, docs []*tgbota
 	taskID := startResp.TaskID
 	logger = logger.With(slog.String("task_id", taskID))
 	logger.Info("task started on backend")
+	span.SetAttributes(tracing.TaskIDKey.String(taskID))
 
 	b.taskStore.Set(chatID, taskID)
 	taskStartTime := time.Now()
-	go b.pollTaskStatus(context.Background(), chatID, taskID, taskStartTime)
+	// Ожидание задачи переживает обработку сообщения, но остается в той же трассе.
+	watchCtx := tracing.ContextWithTaskID(tracing.ContinueTrace(context.Background(), ctx), taskID)
+	go b.watchTask(watchCtx, chatID, taskID, statusMessageID, taskStartTime)
 }
 
 func (b *Bot) sendMessage(msg tgbotapi.Chattable) error {
 	if b.sendMessageOverride != nil {
 		return b.sendMessageOverride(msg)
 	}
-	return b.sendMessageWithRetry(context.Background(), msg)
+	_, err := b.sendMessageWithRetry(context.Background(), msg)
+	return err
+}
+
+// sendMessageForEdit отправляет сообщение и возвращает его ID для последующего
+// редактирования. 0 означает, что сообщение не отправлено.
+func (b *Bot) sendMessageForEdit(msg tgbotapi.Chattable) int {
+	if b.sendMessageOverride != nil {
+		b.sendMessageOverride(msg)
+		return 0
+	}
+	sent, err := b.sendMessageWithRetry(context.Background(), msg)
+	if err != nil {
+		return 0
+	}
+	return sent.MessageID
 }
 
 // isRetryableError проверяет, является ли ошибка временной и стоит ли повторять запрос.
@@ -354,7 +402,7 @@ func isRetryableError(err error) bool {
 		strings.Contains(errStr, "unexpected EOF")
 }
 
-func (b *Bot) sendMessageWithRetry(ctx context.Context, msg tgbotapi.Chattable) error {
+func (b *Bot) sendMessageWithRetry(ctx context.Context, msg tgbotapi.Chattable) (tgbotapi.Message, error) {
 	var lastErr error
 
 	initialInterval := time.Duration(b.cfg.Retry.InitialIntervalSeconds) * time.Second
@@ -364,13 +412,13 @@ func (b *Bot) sendMessageWithRetry(ctx context.Context, msg tgbotapi.Chattable)
 	for attempt := 0; attempt < b.cfg.Retry.MaxAttempts; attempt++ {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return tgbotapi.Message{}, ctx.Err()
 		default:
 		}
 
-		_, err := b.sendMessageFunc(msg)
+		sent, err := b.sendMessageFunc(msg)
 		if err == nil {
-			return nil // Успешная отправка
+			return sent, nil // Успешная отправка
 		}
 
 		lastErr = err
@@ -378,13 +426,13 @@ func (b *Bot) sendMessageWithRetry(ctx context.Context, msg tgbotapi.Chattable)
 		// Не повторяем, если пользователь заблокировал бота.
 		if strings.Contains(err.Error(), "bot was blocked by the user") {
 			b.logger.Warn("message not sent because bot was blocked by the user")
-			return err
+			return tgbotapi.Message{}, err
 		}
 
 		// Повторяем только определенные временные ошибки.
 		if !isRetryableError(err) {
 			b.logger.Error("failed to send message due to non-retryable error", "error", err)
-			return err
+			return tgbotapi.Message{}, err
 		}
 
 		b.logger.Warn(
@@ -400,7 +448,7 @@ func (b *Bot) sendMessageWithRetry(ctx context.Context, msg tgbotapi.Chattable)
 		select {
 		case <-ctx.Done():
 			timer.Stop()
-			return ctx.Err()
+			return tgbotapi.Message{}, ctx.Err()
 		case <-timer.C:
 		}
 
@@ -412,17 +460,70 @@ func (b *Bot) sendMessageWithRetry(ctx context.Context, msg tgbotapi.Chattable)
 	}
 
 	b.logger.Error("failed to send message after all attempts", "last_error", lastErr)
-	return fmt.Errorf("failed to send message after %d attempts: %w", b.cfg.Retry.MaxAttempts, lastErr)
+	return tgbotapi.Message{}, fmt.Errorf("failed to send message after %d attempts: %w", b.cfg.Retry.MaxAttempts, lastErr)
+}
+
+// watchTask ожидает завершения задачи по потоку событий сервера, показывая прогресс
+// редактированием сообщения statusMessageID. Если сервер не поддерживает поток
+// или он прервался, бот переходит к опросу статуса.
+func (b *Bot) watchTask(ctx context.Context, chatID int64, taskID string, statusMessageID int, taskStartTime time.Time) {
+	logger := b.logger.With(slog.Int64("chat_id", chatID), slog.String("task_id", taskID))
+
+	ctx, span := tracing.Start(ctx, "Bot.watchTask")
+	defer span.End()
+
+	var statusText string
+	var final *TaskStatusResponse
+	err := b.serverClient.StreamTaskEvents(ctx, taskID, func(event string, data []byte) error {
+		switch event {
+		case "status":
+			// Статус сообщает позицию задачи, пока она ждет в очереди сервера.
+			var status TaskStatusResponse
+			if err := json.Unmarshal(data, &status); err != nil {
+				return fmt.Errorf("failed to decode status event: %w", err)
+			}
+			statusText = b.updateStatusMessage(chatID, statusMessageID, formatProgress(&status), statusText)
+		case "progress":
+			var p ProgressDTO
+			if err := json.Unmarshal(data, &p); err != nil {
+				return fmt.Errorf("failed to decode progress event: %w", err)
+			}
+			statusText = b.updateStatusMessage(chatID, statusMessageID, formatProgress(&TaskStatusResponse{Progress: &p}), statusText)
+		case "done":
+			var status TaskStatusResponse
+			if err := json.Unmarshal(data, &status); err != nil {
+				return fmt.Errorf("failed to decode done event: %w", err)
+			}
+			final = &status
+			return ErrStopStream
+		}
+		return nil
+	})
+	if final == nil {
+		if err != nil && ctx.Err() == nil {
+			logger.Warn("task event stream unavailable, falling back to polling", slog.String("error", err.Error()))
+		}
+		b.pollTaskStatus(ctx, chatID, taskID, statusMessageID, taskStartTime)
+		return
+	}
+
+	defer b.taskStore.Delete(chatID)
+	if !b.finishTask(ctx, chatID, taskID, final, taskStartTime) {
+		logger.Warn("unexpected final task status", slog.String("status", final.Status))
+	}
 }
 
 // pollTaskStatus асинхронно опрашивает статус задачи на бэкенд-сервере.
-func (b *Bot) pollTaskStatus(ctx context.Context, chatID int64, taskID string, taskStartTime time.Time) {
+// Прогресс обработки показывается редактированием сообщения statusMessageID,
+// а не отправкой новых сообщений.
+func (b *Bot) pollTaskStatus(ctx context.Context, chatID int64, taskID string, statusMessageID int, taskStartTime time.Time) {
 	logger := b.logger.With(slog.Int64("chat_id", chatID), slog.String("task_id", taskID))
 	defer b.taskStore.Delete(chatID)
 
 	ticker := time.NewTicker(time.Duration(b.cfg.PollingIntervalSeconds) * time.Second)
 	defer ticker.Stop()
 
+	var statusText string
 	for {
 		select {
 		case <-ctx.Done():
@@ -436,18 +537,13 @@ func (b *Bot) pollTaskStatus(ctx context.Context, chatID int64, taskID string, t
 				continue
 			}
 
-			switch status.Status {
-			case "completed":
-				logger.Info("task completed")
-				b.processCompletedTask(ctx, chatID, taskID, taskStartTime)
-				return
-			case "failed":
-				logger.Warn("task failed", slog.String("reason", status.ErrorMessage))
-				reply := tgbotapi.NewMessage(chatID, fmt.Sprintf("Произошла ошибка при обработке файла: %s", status.ErrorMessage))
-				b.sendMessage(reply)
+			if b.finishTask(ctx, chatID, taskID, status, taskStartTime) {
 				return
+			}
+			switch status.Status {
 			case "pending", "processing":
 				logger.Debug("task is in progress", slog.String("status", status.Status))
+				statusText = b.updateStatusMessage(chatID, statusMessageID, formatProgress(status), statusText)
 			default:
 				logger.Warn("unknown task status", slog.String("status", status.Status))
 			}
@@ -455,12 +551,84 @@ func (b *Bot) pollTaskStatus(ctx context.Context, chatID int64, taskID string, t
 	}
 }
 
+// finishTask сообщает пользователю итог завершенной задачи и отправляет результат.
+// Возвращает false, если задача еще не завершена.
+func (b *Bot) finishTask(ctx context.Context, chatID int64, taskID string, status *TaskStatusResponse, taskStartTime time.Time) bool {
+	logger := b.logger.With(slog.Int64("chat_id", chatID), slog.String("task_id", taskID))
+
+	switch status.Status {
+	case "completed":
+		logger.Info("task completed")
+		b.processCompletedTask(ctx, chatID, taskID, taskStartTime)
+	case "partial":
+		logger.Warn("task finished with partial result", slog.String("reason", status.ErrorMessage), slog.Int("unresolved", status.UnresolvedCount))
+		b.sendMessage(tgbotapi.NewMessage(chatID, fmt.Sprintf(
+			"Обработка прервана до завершения, не удалось обработать участников: %d. Отправляю частичный результат.",
+			status.UnresolvedCount)))
+		b.processCompletedTask(ctx, chatID, taskID, taskStartTime)
+	case "failed":
+		logger.Warn("task failed", slog.String("reason", status.ErrorMessage))
+		reply := tgbotapi.NewMessage(chatID, fmt.Sprintf("Произошла ошибка при обработке файла: %s", status.ErrorMessage))
+		b.sendMessage(reply)
+	case "cancelled":
+		logger.Info("task cancelled")
+		b.sendMessage(tgbotapi.NewMessage(chatID, "Обработка файла была отменена."))
+	default:
+		return false
+	}
+	return true
+}
+
+// updateStatusMessage заменяет текст сообщения о статусе задачи. Неизменившийся текст
+// не отправляется: Telegram отклоняет редактирование без изменений. Возвращает текущий текст.
+func (b *Bot) updateStatusMessage(chatID int64, messageID int, text, current string) string {
+	if messageID == 0 || text == "" || text == current {
+		return current
+	}
+	if err := b.sendMessage(tgbotapi.NewEditMessageText(chatID, messageID, text)); err != nil {
+		b.logger.Warn("failed to update status message", slog.Int64("chat_id", chatID), slog.String("error", err.Error()))
+		return current
+	}
+	return text
+}
+
+// formatProgress описывает ход обработки задачи для сообщения о статусе.
+// Возвращает пустую строку, если сервер не сообщил прогресс.
+func formatProgress(status *TaskStatusResponse) string {
+	if status.QueuePosition > 0 {
+		return fmt.Sprintf("Задача ожидает в очереди сервера, позиция: %d", status.QueuePosition)
+	}
+	p := status.Progress
+	if p == nil || p.Stage == "queued" {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Идет обработка...\n")
+	fmt.Fprintf(&sb, "Файлов разобрано: %d из %d\n", p.FilesParsed, p.FilesTotal)
+	fmt.Fprintf(&sb, "Сообщений просмотрено: %d\n", p.MessagesScanned)
+	fmt.Fprintf(&sb, "Найдено участников: %d", p.RawParticipants)
+	if p.Stage != "parsing" {
+		fmt.Fprintf(&sb, "\nОбогащено: %d из %d", p.Enriched, p.ParticipantsTotal)
+		if p.Requeued > 0 {
+			fmt.Fprintf(&sb, "\nПовторных попыток: %d", p.Requeued)
+		}
+		if p.Unresolved > 0 {
+			fmt.Fprintf(&sb, "\nНе найдено: %d", p.Unresolved)
+		}
+		if p.ETASeconds != nil {
+			fmt.Fprintf(&sb, "\nОсталось примерно: %s", time.Duration(*p.ETASeconds)*time.Second)
+		}
+	}
+	return sb.String()
+}
+
 // processCompletedTask обрабатывает успешно завершенную задачу.
 func (b *Bot) processCompletedTask(ctx context.Context, chatID int64, taskID string, taskStartTime time.Time) {
 	logger := b.logger.With(slog.Int64("chat_id", chatID), slog.String("task_id", taskID))
 	logger.Info("fetching results for completed task")
 
-	users, err := b.fetchAllResults(ctx, taskID)
+	users, err := b.fetchAllResults(ctx, taskID, b.cfg.Results)
 	if err != nil {
 		logger.Error("failed to fetch all results", slog.String("error", err.Error()))
 		reply := tgbotapi.NewMessage(chatID, "Не удалось получить результаты для выполненной задачи. Пожалуйста, попробуйте позже.")
@@ -489,13 +657,15 @@ func (b *Bot) processCompletedTask(ctx context.Context, chatID int64, taskID str
 }
 
 // fetchAllResults собирает все страницы с результатами для данной задачи.
-func (b *Bot) fetchAllResults(ctx context.Context, taskID string) ([]UserDTO, error) {
+// Фильтрация и сортировка выполняются сервером, поэтому страницы содержат только
+// подходящих участников в нужном порядке.
+func (b *Bot) fetchAllResults(ctx context.Context, taskID string, filter config.ResultFilter) ([]UserDTO, error) {
 	var allUsers []UserDTO
 	page := 1
 	pageSize := 100
 
 	for {
-		result, err := b.serverClient.GetTaskResult(ctx, taskID, page, pageSize)
+		result, err := b.serverClient.GetTaskResult(ctx, taskID, page, pageSize, filter)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get task result page %d: %w", page, err)
 		}
@@ -528,6 +698,11 @@ func (b *Bot) sendExcelResult(chatID int64, users []UserDTO, taskStartTime, send
 	if showChannel {
 		headers = append(headers, "Канал")
 	}
+	headers = append(headers,
+		"Сообщений", "Первое сообщение", "Последнее сообщение", "Упоминаний",
+		"Ответов отправлено", "Ответов получено", "Вступлений", "Выходов", "Приглашено",
+		"Источники",
+	)
 
 	for i, h := range headers {
 		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
@@ -536,13 +711,19 @@ func (b *Bot) sendExcelResult(chatID int64, users []UserDTO, taskStartTime, send
 
 	exportDate := time.Now().Format(time.RFC3339)
 	for i, user := range users {
-		row := i + 2
-		f.SetCellValue(sheetName, fmt.Sprintf("A%d", row), exportDate)
-		f.SetCellValue(sheetName, fmt.Sprintf("B%d", row), user.Username)
-		f.SetCellValue(sheetName, fmt.Sprintf("C%d", row), user.Name)
-		f.SetCellValue(sheetName, fmt.Sprintf("D%d", row), user.Bio)
+		values := []interface{}{exportDate, user.Username, user.Name, user.Bio}
 		if showChannel {
-			f.SetCellValue(sheetName, fmt.Sprintf("E%d", row), user.Channel)
+			values = append(values, user.Channel)
+		}
+		a := user.Activity
+		values = append(values,
+			a.MessageCount, a.FirstMessageDate, a.LastMessageDate, a.MentionCount,
+			a.RepliesSent, a.RepliesReceived, a.Joined, a.Left, a.Invited,
+			strings.Join(user.Sources, ", "),
+		)
+		for col, v := range values {
+			cell, _ := excelize.CoordinatesToCellName(col+1, i+2)
+			f.SetCellValue(sheetName, cell, v)
 		}
 	}
 
@@ -703,7 +884,7 @@ func (b *Bot) sendTextResult(chatID int64, users []UserDTO, taskStartTime, sendS
 		return
 	}
 
-	if err := b.sendMessageWithRetry(context.Background(), reply); err != nil {
+	if _, err := b.sendMessageWithRetry(context.Background(), reply); err != nil {
 		b.logger.Error("не удалось отправить текстовый результат", "error", err)
 		return
 	}
@@ -3,12 +3,14 @@ package bot
 import (
 	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"sort"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -18,11 +20,16 @@ import (
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // mockServerClient — это мок для ServerAPI.
 type mockServerClient struct {
-	startTaskFunc func(ctx context.Context, files []DocumentFile) (*StartTaskResponse, error)
+	startTaskFunc     func(ctx context.Context, files []DocumentFile) (*StartTaskResponse, error)
+	getTaskResultFunc func(ctx context.Context, taskID string, page, pageSize int, filter config.ResultFilter) (*TaskResultResponse, error)
+	streamEventsFunc  func(ctx context.Context, taskID string, fn func(event string, data []byte) error) error
 }
 
 func (m *mockServerClient) StartTask(ctx context.Context, files []DocumentFile) (*StartTaskResponse, error) {
@@ -36,7 +43,17 @@ func (m *mockServerClient) GetTaskStatus(ctx context.Context, taskID string) (*T
 	return &TaskStatusResponse{Status: "completed"}, nil
 }
 
-func (m *mockServerClient) GetTaskResult(ctx context.Context, taskID string, page, pageSize int) (*TaskResultResponse, error) {
+func (m *mockServerClient) StreamTaskEvents(ctx context.Context, taskID string, fn func(event string, data []byte) error) error {
+	if m.streamEventsFunc != nil {
+		return m.streamEventsFunc(ctx, taskID, fn)
+	}
+	return errors.New("event stream is not supported")
+}
+
+func (m *mockServerClient) GetTaskResult(ctx context.Context, taskID string, page, pageSize int, filter config.ResultFilter) (*TaskResultResponse, error) {
+	if m.getTaskResultFunc != nil {
+		return m.getTaskResultFunc(ctx, taskID, page, pageSize, filter)
+	}
 	return &TaskResultResponse{Data: []UserDTO{}}, nil
 }
 
@@ -384,3 +401,259 @@ func TestBot_ProcessFileBatch_Sorting(t *testing.T) {
 		assert.Equal(t, expected.name, receivedFiles[i].Name, "File at position %d should be %s based on hash sort", i, expected.name)
 	}
 }
+
+func TestBot_FetchAllResults_PassesFilter(t *testing.T) {
+	hasUsername := true
+	filter := config.ResultFilter{HasUsername: &hasUsername, Sort: "activity"}
+
+	var pages []int
+	mockClient := &mockServerClient{
+		getTaskResultFunc: func(ctx context.Context, taskID string, page, pageSize int, got config.ResultFilter) (*TaskResultResponse, error) {
+			assert.Equal(t, filter, got)
+			pages = append(pages, page)
+			return &TaskResultResponse{
+				Pagination: PaginationDTO{CurrentPage: page, TotalPages: 2},
+				Data:       []UserDTO{{ID: int64(page)}},
+			}, nil
+		},
+	}
+	b := newTestBot(t, config.BotConfig{Results: filter}, mockClient)
+
+	users, err := b.fetchAllResults(context.Background(), "task-id", b.cfg.Results)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, pages)
+	assert.Len(t, users, 2)
+}
+
+func TestServerClient_GetTaskResult_Query(t *testing.T) {
+	hasBio := false
+	var gotQuery map[string][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/tasks/task-id/result", r.URL.Path)
+		gotQuery = r.URL.Query()
+		w.Write([]byte(`{"pagination":{"total_pages":1},"data":[]}`))
+	}))
+	defer srv.Close()
+
+	client := NewServerClient(srv.URL, "")
+	_, err := client.GetTaskResult(context.Background(), "task-id", 2, 100, config.ResultFilter{
+		HasBio:    &hasBio,
+		NameRegex: "^A+",
+		MinID:     10,
+		Sort:      "name",
+		Order:     "desc",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]string{
+		"page":       {"2"},
+		"page_size":  {"100"},
+		"has_bio":    {"false"},
+		"name_regex": {"^A+"},
+		"min_id":     {"10"},
+		"sort":       {"name"},
+		"order":      {"desc"},
+	}, gotQuery)
+}
+
+func TestBot_UpdateStatusMessage(t *testing.T) {
+	var sent []tgbotapi.Chattable
+	bot := newTestBot(t, config.BotConfig{}, &mockServerClient{})
+	bot.sendMessageFunc = func(msg tgbotapi.Chattable) (tgbotapi.Message, error) {
+		sent = append(sent, msg)
+		return tgbotapi.Message{}, nil
+	}
+
+	eta := int64(90)
+	status := &TaskStatusResponse{Status: "processing", Progress: &ProgressDTO{
+		Stage:             "enriching",
+		FilesTotal:        2,
+		FilesParsed:       2,
+		MessagesScanned:   1500,
+		RawParticipants:   120,
+		ParticipantsTotal: 100,
+		Enriched:          40,
+		Requeued:          3,
+		ETASeconds:        &eta,
+	}}
+	assert.Equal(t, "Задача ожидает в очереди сервера, позиция: 3",
+		formatProgress(&TaskStatusResponse{Status: "pending", QueuePosition: 3, Progress: &ProgressDTO{Stage: "queued"}}))
+	assert.Empty(t, formatProgress(&TaskStatusResponse{Status: "pending", Progress: &ProgressDTO{Stage: "queued"}}))
+
+	text := formatProgress(status)
+	assert.Contains(t, text, "Файлов разобрано: 2 из 2")
+	assert.Contains(t, text, "Обогащено: 40 из 100")
+	assert.Contains(t, text, "Повторных попыток: 3")
+	assert.NotContains(t, text, "Не найдено")
+	assert.Contains(t, text, "Осталось примерно: 1m30s")
+	assert.Empty(t, formatProgress(&TaskStatusResponse{Status: "pending"}))
+
+	current := bot.updateStatusMessage(42, 7, text, "")
+	assert.Equal(t, text, current)
+	// Неизменившийся прогресс не редактирует сообщение повторно.
+	current = bot.updateStatusMessage(42, 7, text, current)
+	// Без ID сообщения редактировать нечего.
+	bot.updateStatusMessage(42, 0, "другой текст", current)
+
+	require.Len(t, sent, 1)
+	edit, ok := sent[0].(tgbotapi.EditMessageTextConfig)
+	require.True(t, ok)
+	assert.Equal(t, int64(42), edit.ChatID)
+	assert.Equal(t, 7, edit.MessageID)
+	assert.Equal(t, text, edit.Text)
+}
+
+func TestServerClient_PropagatesTraceContext(t *testing.T) {
+	prev := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(prev) })
+
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Write([]byte(`{"status":"processing"}`))
+	}))
+	defer srv.Close()
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	_, err := NewServerClient(srv.URL, "").GetTaskStatus(ctx, "task-1")
+	require.NoError(t, err)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", traceparent)
+}
+
+func TestServerClient_StartTask_QueueFull(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "12")
+		http.Error(w, "Task queue is full, try again later", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	_, err := NewServerClient(srv.URL, "").StartTask(context.Background(), []DocumentFile{{Name: "a.json", Content: strings.NewReader("{}")}})
+	var queueFullErr *QueueFullError
+	require.ErrorAs(t, err, &queueFullErr)
+	assert.Equal(t, 12*time.Second, queueFullErr.RetryAfter)
+}
+
+func TestServerClient_StartTask_QuotaExceeded(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer bot-key", r.Header.Get("Authorization"))
+		w.Header().Set("Retry-After", "3600")
+		w.Header().Set("X-Quota-Exceeded", "uploads")
+		http.Error(w, "daily quota exceeded: 10 uploads per day", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	_, err := NewServerClient(srv.URL, "bot-key").StartTask(context.Background(), []DocumentFile{{Name: "a.json", Content: strings.NewReader("{}")}})
+	var quotaErr *QuotaExceededError
+	require.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, time.Hour, quotaErr.RetryAfter)
+}
+
+func TestServerClient_StreamTaskEvents(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/tasks/task-id/events" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: status\ndata: {\"status\":\"processing\"}\n\n")
+		fmt.Fprint(w, ": keep-alive\n\n")
+		fmt.Fprint(w, "event: user\ndata: {\"id\":1}\n\n")
+		fmt.Fprint(w, "event: done\ndata: {\"status\":\"completed\"}\n\n")
+	}))
+	defer srv.Close()
+	client := NewServerClient(srv.URL, "")
+
+	t.Run("События до остановки", func(t *testing.T) {
+		var events []string
+		err := client.StreamTaskEvents(context.Background(), "task-id", func(event string, data []byte) error {
+			events = append(events, event+" "+string(data))
+			if event == "done" {
+				return ErrStopStream
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			`status {"status":"processing"}`,
+			`user {"id":1}`,
+			`done {"status":"completed"}`,
+		}, events)
+	})
+
+	t.Run("Поток закрыт до завершения", func(t *testing.T) {
+		err := client.StreamTaskEvents(context.Background(), "task-id", func(string, []byte) error { return nil })
+		assert.Error(t, err)
+	})
+
+	t.Run("Сервер без поддержки событий", func(t *testing.T) {
+		err := client.StreamTaskEvents(context.Background(), "other-task", func(string, []byte) error { return nil })
+		assert.Error(t, err)
+	})
+}
+
+func TestBot_WatchTask(t *testing.T) {
+	t.Run("Завершение по потоку событий", func(t *testing.T) {
+		resultFetched := false
+		mockClient := &mockServerClient{
+			streamEventsFunc: func(ctx context.Context, taskID string, fn func(event string, data []byte) error) error {
+				for _, e := range []struct{ name, data string }{
+					{"status", `{"status":"processing"}`},
+					{"progress", `{"stage":"enriching","participants_total":2,"enriched":1}`},
+					{"user", `{"id":1}`},
+					{"done", `{"status":"completed"}`},
+				} {
+					if err := fn(e.name, []byte(e.data)); err != nil {
+						if errors.Is(err, ErrStopStream) {
+							return nil
+						}
+						return err
+					}
+				}
+				return errors.New("stream closed")
+			},
+			getTaskResultFunc: func(ctx context.Context, taskID string, page, pageSize int, filter config.ResultFilter) (*TaskResultResponse, error) {
+				resultFetched = true
+				return &TaskResultResponse{Pagination: PaginationDTO{TotalPages: 1}}, nil
+			},
+		}
+		bot := newTestBot(t, config.BotConfig{PollingIntervalSeconds: 1}, mockClient)
+		var edits []string
+		bot.sendMessageFunc = func(msg tgbotapi.Chattable) (tgbotapi.Message, error) {
+			if edit, ok := msg.(tgbotapi.EditMessageTextConfig); ok {
+				edits = append(edits, edit.Text)
+			}
+			return tgbotapi.Message{}, nil
+		}
+		bot.taskStore.Set(1, "task-id")
+
+		bot.watchTask(context.Background(), 1, "task-id", 10, time.Now())
+
+		require.Len(t, edits, 1)
+		assert.Contains(t, edits[0], "Обогащено: 1 из 2")
+		assert.True(t, resultFetched)
+		_, ok := bot.taskStore.Get(1)
+		assert.False(t, ok)
+	})
+
+	t.Run("Опрос статуса без потока событий", func(t *testing.T) {
+		resultFetched := false
+		mockClient := &mockServerClient{
+			getTaskResultFunc: func(ctx context.Context, taskID string, page, pageSize int, filter config.ResultFilter) (*TaskResultResponse, error) {
+				resultFetched = true
+				return &TaskResultResponse{Pagination: PaginationDTO{TotalPages: 1}}, nil
+			},
+		}
+		bot := newTestBot(t, config.BotConfig{PollingIntervalSeconds: 1}, mockClient)
+
+		bot.watchTask(context.Background(), 1, "task-id", 10, time.Now())
+		assert.True(t, resultFetched)
+	})
+}
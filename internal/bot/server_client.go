@@ -1,30 +1,84 @@
 package bot
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"telegram-chat-parser/cmd/bot/config"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
+// QueueFullError возвращается, когда очередь задач сервера заполнена (429 Too Many Requests).
+type QueueFullError struct {
+	// RetryAfter — рекомендованная сервером пауза перед повтором; 0, если не указана.
+	RetryAfter time.Duration
+}
+
+func (e *QueueFullError) Error() string {
+	return fmt.Sprintf("server task queue is full, retry after %s", e.RetryAfter)
+}
+
+// QuotaExceededError возвращается, когда исчерпана суточная квота ключа API бота.
+type QuotaExceededError struct {
+	// RetryAfter — время до сброса квоты.
+	RetryAfter time.Duration
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("daily quota exceeded, retry after %s", e.RetryAfter)
+}
+
+// ErrStopStream возвращается обработчиком событий, чтобы завершить чтение потока без ошибки.
+var ErrStopStream = errors.New("stop stream")
+
 // ServerClient — клиент для взаимодействия с API бэкенд-сервера.
 type ServerClient struct {
-	baseURL    string
+	baseURL string
+	// apiKey передается в заголовке Authorization, если сервер требует аутентификацию.
+	apiKey     string
 	httpClient *http.Client
+	// streamClient используется для потока событий, который длится все время обработки,
+	// поэтому у него нет общего таймаута.
+	streamClient *http.Client
 }
 
 // NewServerClient создает новый экземпляр ServerClient.
-func NewServerClient(baseURL string) *ServerClient {
+// Пустой apiKey означает, что сервер доступен без аутентификации.
+func NewServerClient(baseURL, apiKey string) *ServerClient {
 	return &ServerClient{
 		baseURL: baseURL,
+		apiKey:  apiKey,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second, // Общий таймаут для запросов
 		},
+		streamClient: &http.Client{},
+	}
+}
+
+// newRequest создает запрос к серверу с ключом API и контекстом трассы из ctx.
+func (c *ServerClient) newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
 	}
+	// Заголовок traceparent связывает обработку запроса на сервере с трассой бота.
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return req, nil
 }
 
 // API-ответы
@@ -36,6 +90,26 @@ type TaskStatusResponse struct {
 	TaskID       string `json:"task_id"`
 	Status       string `json:"status"`
 	ErrorMessage string `json:"error_message,omitempty"`
+	// UnresolvedCount — число участников, не попавших в частичный результат.
+	UnresolvedCount int `json:"unresolved_count,omitempty"`
+	// QueuePosition — позиция задачи в очереди сервера, пока она ждет обработки.
+	QueuePosition int `json:"queue_position,omitempty"`
+	// Progress — ход обработки; отсутствует у задач, запущенных до обновления сервера.
+	Progress *ProgressDTO `json:"progress,omitempty"`
+}
+
+// ProgressDTO представляет собой прогресс обработки задачи из ответа сервера.
+type ProgressDTO struct {
+	Stage             string `json:"stage"`
+	FilesTotal        int    `json:"files_total"`
+	FilesParsed       int    `json:"files_parsed"`
+	MessagesScanned   int64  `json:"messages_scanned"`
+	RawParticipants   int    `json:"raw_participants"`
+	ParticipantsTotal int    `json:"participants_total"`
+	Enriched          int    `json:"enriched"`
+	Requeued          int    `json:"requeued"`
+	Unresolved        int    `json:"unresolved"`
+	ETASeconds        *int64 `json:"eta_seconds,omitempty"`
 }
 
 // PaginationDTO представляет собой объект пагинации из ответа сервера.
@@ -53,6 +127,22 @@ type UserDTO struct {
 	Username string `json:"username"`
 	Bio      string `json:"bio"`
 	Channel  string `json:"channel,omitempty"`
+	// Sources перечисляет способы, которыми участник был найден в чате.
+	Sources  []string    `json:"sources,omitempty"`
+	Activity ActivityDTO `json:"activity"`
+}
+
+// ActivityDTO представляет статистику активности участника в чате.
+type ActivityDTO struct {
+	MessageCount     int    `json:"message_count"`
+	FirstMessageDate string `json:"first_message_date,omitempty"`
+	LastMessageDate  string `json:"last_message_date,omitempty"`
+	MentionCount     int    `json:"mention_count"`
+	RepliesSent      int    `json:"replies_sent"`
+	RepliesReceived  int    `json:"replies_received"`
+	Joined           int    `json:"joined"`
+	Left             int    `json:"left"`
+	Invited          int    `json:"invited"`
 }
 
 type TaskResultResponse struct {
@@ -83,7 +173,7 @@ func (c *ServerClient) StartTask(ctx context.Context, files []DocumentFile) (*St
 
 	w.Close()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/v1/process", &b)
+	req, err := c.newRequest(ctx, http.MethodPost, c.baseURL+"/api/v1/process", &b)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -95,6 +185,13 @@ func (c *ServerClient) StartTask(ctx context.Context, files []DocumentFile) (*St
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		if resp.Header.Get("X-Quota-Exceeded") != "" {
+			return nil, &QuotaExceededError{RetryAfter: time.Duration(retryAfter) * time.Second}
+		}
+		return nil, &QueueFullError{RetryAfter: time.Duration(retryAfter) * time.Second}
+	}
 	if resp.StatusCode != http.StatusAccepted {
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
@@ -109,7 +206,7 @@ func (c *ServerClient) StartTask(ctx context.Context, files []DocumentFile) (*St
 
 // GetTaskStatus запрашивает статус задачи.
 func (c *ServerClient) GetTaskStatus(ctx context.Context, taskID string) (*TaskStatusResponse, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/v1/tasks/"+taskID, nil)
+	req, err := c.newRequest(ctx, http.MethodGet, c.baseURL+"/api/v1/tasks/"+taskID, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -132,10 +229,61 @@ func (c *ServerClient) GetTaskStatus(ctx context.Context, taskID string) (*TaskS
 	return &result, nil
 }
 
-// GetTaskResult запрашивает результат выполненной задачи.
-func (c *ServerClient) GetTaskResult(ctx context.Context, taskID string, page, pageSize int) (*TaskResultResponse, error) {
-	url := fmt.Sprintf("%s/api/v1/tasks/%s/result?page=%d&page_size=%d", c.baseURL, taskID, page, pageSize)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+// StreamTaskEvents читает поток событий задачи (Server-Sent Events) и вызывает fn
+// для каждого события. Чтение продолжается, пока fn не вернет ошибку: ErrStopStream
+// завершает его без ошибки. Закрытие потока сервером до этого считается ошибкой,
+// как и ответ старого сервера без поддержки событий.
+func (c *ServerClient) StreamTaskEvents(ctx context.Context, taskID string, fn func(event string, data []byte) error) error {
+	req, err := c.newRequest(ctx, http.MethodGet, c.baseURL+"/api/v1/tasks/"+taskID+"/events", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.streamClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	// Событие с пользователем может превышать размер буфера по умолчанию из-за длинного bio.
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	var event string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			event = name
+			continue
+		}
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		if err := fn(event, []byte(data)); err != nil {
+			if errors.Is(err, ErrStopStream) {
+				return nil
+			}
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read event stream: %w", err)
+	}
+	return fmt.Errorf("event stream closed before task finished")
+}
+
+// GetTaskResult запрашивает страницу результата выполненной задачи с учетом фильтра.
+func (c *ServerClient) GetTaskResult(ctx context.Context, taskID string, page, pageSize int, filter config.ResultFilter) (*TaskResultResponse, error) {
+	query := resultFilterQuery(filter)
+	query.Set("page", strconv.Itoa(page))
+	query.Set("page_size", strconv.Itoa(pageSize))
+	url := fmt.Sprintf("%s/api/v1/tasks/%s/result?%s", c.baseURL, taskID, query.Encode())
+	req, err := c.newRequest(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -157,3 +305,36 @@ func (c *ServerClient) GetTaskResult(ctx context.Context, taskID string, page, p
 
 	return &result, nil
 }
+
+// resultFilterQuery преобразует фильтр результата в параметры запроса.
+func resultFilterQuery(f config.ResultFilter) url.Values {
+	query := url.Values{}
+	setBool := func(key string, v *bool) {
+		if v != nil {
+			query.Set(key, strconv.FormatBool(*v))
+		}
+	}
+	setString := func(key, v string) {
+		if v != "" {
+			query.Set(key, v)
+		}
+	}
+	setID := func(key string, v int64) {
+		if v != 0 {
+			query.Set(key, strconv.FormatInt(v, 10))
+		}
+	}
+
+	setBool("has_username", f.HasUsername)
+	setBool("has_bio", f.HasBio)
+	setBool("has_channel", f.HasChannel)
+	setString("name", f.Name)
+	setString("name_regex", f.NameRegex)
+	setString("bio", f.Bio)
+	setString("bio_regex", f.BioRegex)
+	setID("min_id", f.MinID)
+	setID("max_id", f.MaxID)
+	setString("sort", f.Sort)
+	setString("order", f.Order)
+	return query
+}
@@ -4,69 +4,77 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
-	"sync"
 	"telegram-chat-parser/internal/domain"
+	"telegram-chat-parser/internal/metrics"
+	"telegram-chat-parser/internal/storage"
 	"time"
 )
 
 // CacheItem представляет кэшированный результат
 type CacheItem struct {
-	Data      []domain.User
-	ExpiresAt time.Time
+	Data      []domain.User `json:"data"`
+	ExpiresAt time.Time     `json:"expires_at"`
 }
 
-// CacheStore управляет хранением и извлечением кэшированных результатов
+// CacheStore управляет хранением и извлечением кэшированных результатов.
+// Элементы хранятся в storage.Store: в памяти или во встроенной базе на диске.
 type CacheStore struct {
-	cache map[string]*CacheItem
-	mutex sync.RWMutex
+	store storage.Store[CacheItem]
 }
 
-// NewCacheStore создает новый экземпляр CacheStore
+// NewCacheStore создает новый экземпляр CacheStore с хранением в памяти
 func NewCacheStore() *CacheStore {
-	return &CacheStore{
-		cache: make(map[string]*CacheItem),
-	}
+	return NewCacheStoreWithStorage(storage.NewMemoryStore[CacheItem]())
 }
 
-// Get извлекает кэшированный элемент по его ключу (хешу)
-func (cs *CacheStore) Get(key string) (*CacheItem, bool) {
-	cs.mutex.RLock()
-	defer cs.mutex.RUnlock()
+// NewCacheStoreWithStorage создает CacheStore поверх указанного хранилища.
+func NewCacheStoreWithStorage(store storage.Store[CacheItem]) *CacheStore {
+	return &CacheStore{store: store}
+}
 
-	item, exists := cs.cache[key]
-	if !exists || time.Now().After(item.ExpiresAt) {
+// Get извлекает кэшированный элемент по его ключу (хешу).
+// Ошибка чтения хранилища считается промахом кэша.
+func (cs *CacheStore) Get(key string) (*CacheItem, bool) {
+	item, err := cs.store.Get(key)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			slog.Error("failed to read cache", "key", key, "error", err)
+		}
 		// Элемент не существует или срок его действия истек
+		metrics.CacheRequests.WithLabelValues(metrics.CacheMiss).Inc()
 		return nil, false
 	}
 
-	return item, true
+	metrics.CacheRequests.WithLabelValues(metrics.CacheHit).Inc()
+	return &item, true
 }
 
 // Put сохраняет элемент в кэш с указанным сроком действия
-func (cs *CacheStore) Put(key string, data []domain.User, ttl time.Duration) {
-	cs.mutex.Lock()
-	defer cs.mutex.Unlock()
-
-	now := time.Now()
-	cs.cache[key] = &CacheItem{
+func (cs *CacheStore) Put(key string, data []domain.User, ttl time.Duration) error {
+	item := CacheItem{
 		Data:      data,
-		ExpiresAt: now.Add(ttl),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := cs.store.Put(key, item, item.ExpiresAt); err != nil {
+		return fmt.Errorf("failed to put cache item: %w", err)
 	}
+	return nil
 }
 
 // CleanupExpired удаляет просроченные элементы из кэша
 func (cs *CacheStore) CleanupExpired() {
-	cs.mutex.Lock()
-	defer cs.mutex.Unlock()
-
-	now := time.Now()
-	for key, item := range cs.cache {
-		if now.After(item.ExpiresAt) {
-			delete(cs.cache, key)
-		}
+	removed, err := cs.store.DeleteExpired(time.Now())
+	if err != nil {
+		slog.Error("failed to cleanup expired cache items", "error", err)
+		return
+	}
+	if removed > 0 {
+		slog.Debug("expired cache items removed", "count", removed)
 	}
 }
 
@@ -3,10 +3,14 @@ package cache
 import (
 	"context"
 	"os"
+	"path/filepath"
 	"telegram-chat-parser/internal/domain"
+	"telegram-chat-parser/internal/metrics"
+	"telegram-chat-parser/internal/storage"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -15,7 +19,7 @@ func TestCacheStore(t *testing.T) {
 	t.Run("Создание нового хранилища кэша", func(t *testing.T) {
 		cs := NewCacheStore()
 		assert.NotNil(t, cs)
-		assert.NotNil(t, cs.cache)
+		assert.NotNil(t, cs.store)
 	})
 
 	t.Run("Запись и чтение из кэша", func(t *testing.T) {
@@ -39,6 +43,20 @@ func TestCacheStore(t *testing.T) {
 		assert.False(t, found)
 	})
 
+	t.Run("Учет попаданий и промахов в метриках", func(t *testing.T) {
+		cs := NewCacheStore()
+		hits := metrics.CacheRequests.WithLabelValues(metrics.CacheHit)
+		misses := metrics.CacheRequests.WithLabelValues(metrics.CacheMiss)
+		hitsBefore, missesBefore := testutil.ToFloat64(hits), testutil.ToFloat64(misses)
+
+		require.NoError(t, cs.Put("metrics_key", nil, time.Minute))
+		cs.Get("metrics_key")
+		cs.Get("metrics_missing_key")
+
+		assert.Equal(t, hitsBefore+1, testutil.ToFloat64(hits))
+		assert.Equal(t, missesBefore+1, testutil.ToFloat64(misses))
+	})
+
 	t.Run("Чтение просроченного ключа", func(t *testing.T) {
 		cs := NewCacheStore()
 		key := "expired_key"
@@ -69,6 +87,29 @@ func TestCacheStore(t *testing.T) {
 	})
 }
 
+func TestCacheStore_PersistentStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	open := func() (*CacheStore, func()) {
+		db, err := storage.OpenBolt(path)
+		require.NoError(t, err)
+		store, err := storage.NewBoltStore[CacheItem](db, "cache")
+		require.NoError(t, err)
+		return NewCacheStoreWithStorage(store), func() { db.Close() }
+	}
+
+	cs, closeDB := open()
+	data := []domain.User{{ID: 1, Name: "User1", Username: "user1"}}
+	require.NoError(t, cs.Put("key", data, time.Minute))
+	closeDB()
+
+	cs, closeDB = open()
+	defer closeDB()
+
+	item, found := cs.Get("key")
+	require.True(t, found, "Элемент кэша должен пережить перезапуск")
+	assert.Equal(t, data, item.Data)
+}
+
 func TestStartCleanupTicker(t *testing.T) {
 	cs := NewCacheStore()
 	expiredKey := "expired"
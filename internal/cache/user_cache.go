@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"telegram-chat-parser/internal/domain"
+	"telegram-chat-parser/internal/storage"
+	"time"
+)
+
+// UserCache хранит обогащенные профили пользователей между задачами.
+// Профиль доступен по двум ключам: Telegram ID и нормализованному username.
+// Способы обнаружения и статистика активности относятся к конкретной задаче и не кэшируются.
+type UserCache struct {
+	store storage.Store[domain.User]
+	ttl   time.Duration
+}
+
+// NewUserCache создает кэш пользователей в памяти с указанным временем жизни записей.
+func NewUserCache(ttl time.Duration) *UserCache {
+	return NewUserCacheWithStorage(storage.NewMemoryStore[domain.User](), ttl)
+}
+
+// NewUserCacheWithStorage создает кэш пользователей поверх указанного хранилища.
+func NewUserCacheWithStorage(store storage.Store[domain.User], ttl time.Duration) *UserCache {
+	return &UserCache{store: store, ttl: ttl}
+}
+
+// GetByID возвращает профиль пользователя по Telegram ID.
+func (c *UserCache) GetByID(id int64) (domain.User, bool) {
+	if id == 0 {
+		return domain.User{}, false
+	}
+	return c.get(userIDKey(id))
+}
+
+// GetByUsername возвращает профиль пользователя по username без учета регистра и "@".
+func (c *UserCache) GetByUsername(username string) (domain.User, bool) {
+	key := usernameKey(username)
+	if key == "" {
+		return domain.User{}, false
+	}
+	return c.get(key)
+}
+
+// Put сохраняет профиль пользователя под его ID и username.
+// Ошибки хранилища только логируются: кэш не должен влиять на результат задачи.
+func (c *UserCache) Put(user domain.User) {
+	profile := domain.User{
+		ID:       user.ID,
+		Name:     user.Name,
+		Username: user.Username,
+		Bio:      user.Bio,
+		Channel:  user.Channel,
+	}
+	expiresAt := time.Now().Add(c.ttl)
+
+	var keys []string
+	if profile.ID != 0 {
+		keys = append(keys, userIDKey(profile.ID))
+	}
+	if key := usernameKey(profile.Username); key != "" {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		if err := c.store.Put(key, profile, expiresAt); err != nil {
+			slog.Error("failed to put user into cache", "key", key, "error", err)
+		}
+	}
+}
+
+// CleanupExpired удаляет просроченные профили из кэша
+func (c *UserCache) CleanupExpired() {
+	removed, err := c.store.DeleteExpired(time.Now())
+	if err != nil {
+		slog.Error("failed to cleanup expired users", "error", err)
+		return
+	}
+	if removed > 0 {
+		slog.Debug("expired cached users removed", "count", removed)
+	}
+}
+
+// StartCleanupTicker запускает таймер для периодической очистки просроченных профилей
+func (c *UserCache) StartCleanupTicker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.CleanupExpired()
+			}
+		}
+	}()
+}
+
+func (c *UserCache) get(key string) (domain.User, bool) {
+	user, err := c.store.Get(key)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			slog.Error("failed to read user cache", "key", key, "error", err)
+		}
+		return domain.User{}, false
+	}
+	return user, true
+}
+
+func userIDKey(id int64) string {
+	return "id:" + strconv.FormatInt(id, 10)
+}
+
+// usernameKey нормализует username: Telegram не различает регистр и префикс "@".
+func usernameKey(username string) string {
+	username = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(username), "@"))
+	if username == "" {
+		return ""
+	}
+	return "username:" + username
+}
@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"telegram-chat-parser/internal/domain"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserCache(t *testing.T) {
+	t.Run("Профиль доступен по ID и нормализованному username", func(t *testing.T) {
+		c := NewUserCache(time.Minute)
+		c.Put(domain.User{
+			ID:       42,
+			Name:     "Test User",
+			Username: "TestUser",
+			Bio:      "Bio @channel",
+			Channel:  "channel",
+			Sources:  []domain.ParticipantSource{domain.SourceAuthor},
+			Activity: domain.ActivityStats{MessageCount: 3},
+		})
+
+		expected := domain.User{ID: 42, Name: "Test User", Username: "TestUser", Bio: "Bio @channel", Channel: "channel"}
+
+		byID, found := c.GetByID(42)
+		require.True(t, found)
+		assert.Equal(t, expected, byID, "Источники и активность не должны кэшироваться")
+
+		for _, username := range []string{"TestUser", "testuser", "@TESTUSER"} {
+			byName, found := c.GetByUsername(username)
+			require.True(t, found, username)
+			assert.Equal(t, expected, byName)
+		}
+	})
+
+	t.Run("Промах по неизвестным и пустым ключам", func(t *testing.T) {
+		c := NewUserCache(time.Minute)
+		c.Put(domain.User{Name: "No keys"})
+
+		_, found := c.GetByID(0)
+		assert.False(t, found)
+		_, found = c.GetByUsername("")
+		assert.False(t, found)
+		_, found = c.GetByUsername("unknown")
+		assert.False(t, found)
+	})
+
+	t.Run("Просроченные профили не возвращаются", func(t *testing.T) {
+		c := NewUserCache(-time.Second)
+		c.Put(domain.User{ID: 1, Username: "expired"})
+
+		_, found := c.GetByID(1)
+		assert.False(t, found)
+		_, found = c.GetByUsername("expired")
+		assert.False(t, found)
+	})
+}
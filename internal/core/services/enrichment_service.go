@@ -6,15 +6,21 @@ import (
 	"fmt"
 	"log/slog"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/gotd/td/tg"
+	"go.opentelemetry.io/otel/attribute"
 
 	"telegram-chat-parser/internal/domain"
+	"telegram-chat-parser/internal/metrics"
 	"telegram-chat-parser/internal/ports"
+	"telegram-chat-parser/internal/progress"
+	"telegram-chat-parser/internal/quota"
+	"telegram-chat-parser/internal/tracing"
 )
 
 // ErrParticipantNotResolved - терминальная ошибка, указывающая, что участник не может быть найден.
@@ -51,11 +57,20 @@ func WithLogger(l *slog.Logger) Option {
 	}
 }
 
+// WithUserCache подключает кэш профилей пользователей, общий для всех задач.
+// Участники, найденные в кэше, обогащаются без вызовов Telegram API.
+func WithUserCache(c ports.UserCache) Option {
+	return func(s *EnrichmentService) {
+		s.userCache = c
+	}
+}
+
 // EnrichmentService обогащает данные участников, используя Telegram API.
-// Сервис не хранит состояние и безопасен для одновременного использования.
+// Сервис не хранит состояние задач и безопасен для одновременного использования.
 type EnrichmentService struct {
 	router           ports.Router
 	log              *slog.Logger
+	userCache        ports.UserCache
 	poolSize         int
 	clientRetryPause time.Duration
 	operationTimeout time.Duration
@@ -79,8 +94,17 @@ func NewEnrichmentService(r ports.Router, poolSize int, clientRetryPause, operat
 	return s
 }
 
+// enrichTask — участник в очереди воркеров вместе с его индексом в списке участников.
+type enrichTask struct {
+	index       int
+	participant domain.RawParticipant
+	// charged — запрос уже списан с квоты: повтор после временной ошибки ее не расходует.
+	charged bool
+}
+
 // enrichResult — вспомогательная структура для передачи результатов от воркеров.
 type enrichResult struct {
+	index int
 	user  domain.User
 	err   error
 	isSet bool // Отличает успешное обогащение от случая, когда пользователь не был найден.
@@ -88,13 +112,19 @@ type enrichResult struct {
 
 // Enrich обрабатывает список "сырых" участников для обогащения их данных.
 // Метод принимает функциональные опции для переопределения конфигурации сервиса по умолчанию для этого конкретного вызова.
-func (s *EnrichmentService) Enrich(ctx context.Context, participants []domain.RawParticipant) ([]domain.User, error) {
+// Если обработка прервана (таймаут, отмена, ошибки), возвращает собранных пользователей
+// вместе с *domain.PartialResultError, перечисляющей необработанных участников и причины.
+func (s *EnrichmentService) Enrich(ctx context.Context, participants []domain.RawParticipant) (users []domain.User, err error) {
+	ctx, span := tracing.Start(ctx, "EnrichmentService.Enrich", attribute.Int("participants", len(participants)))
+	defer func() { tracing.End(span, err) }()
+
 	if len(participants) == 0 {
 		return nil, nil
 	}
 
 	// Дедупликация списка участников по UserID или Username.
-	seen := make(map[string]struct{}, len(participants))
+	// Способы обнаружения и статистика активности дубликатов объединяются.
+	seen := make(map[string]int, len(participants))
 	uniqueParticipants := make([]domain.RawParticipant, 0, len(participants))
 	for _, p := range participants {
 		var key string
@@ -110,10 +140,14 @@ func (s *EnrichmentService) Enrich(ctx context.Context, participants []domain.Ra
 			continue
 		}
 
-		if _, ok := seen[key]; !ok {
-			seen[key] = struct{}{}
-			uniqueParticipants = append(uniqueParticipants, p)
+		if idx, ok := seen[key]; ok {
+			uniqueParticipants[idx].Sources = domain.MergeSources(uniqueParticipants[idx].Sources, p.Sources...)
+			uniqueParticipants[idx].Activity.Merge(p.Activity)
+			continue
 		}
+		seen[key] = len(uniqueParticipants)
+		p.Sources = slices.Clone(p.Sources)
+		uniqueParticipants = append(uniqueParticipants, p)
 	}
 
 	if len(uniqueParticipants) < len(participants) {
@@ -130,8 +164,10 @@ func (s *EnrichmentService) Enrich(ctx context.Context, participants []domain.Ra
 		"participants", len(participants),
 		"pool_size", s.poolSize,
 	)
+	tracker := progress.FromContext(ctx)
+	tracker.EnrichmentStarted(len(participants))
 
-	tasks := make(chan domain.RawParticipant, len(participants))
+	tasks := make(chan enrichTask, len(participants))
 	results := make(chan enrichResult, len(participants))
 	var wg sync.WaitGroup
 
@@ -140,50 +176,70 @@ func (s *EnrichmentService) Enrich(ctx context.Context, participants []domain.Ra
 		go s.worker(ctx, &wg, tasks, results)
 	}
 
-	for _, p := range participants {
-		tasks <- p
+	for i, p := range participants {
+		tasks <- enrichTask{index: i, participant: p}
 	}
 
 	enrichedUsersMap := make(map[int64]domain.User, len(participants))
 	var unidentifiedUsers []domain.User // Для пользователей с ID = 0.
+	var unresolved []domain.UnresolvedParticipant
 	var processingErrors []error
+	finished := make([]bool, len(participants))
 	finishedCount := 0
 
 	for finishedCount < len(participants) {
 		select {
 		case res := <-results:
+			finished[res.index] = true
 			if res.err != nil {
 				// Это терминальная ошибка (скорее всего, таймаут), задача завершена с ошибкой.
 				processingErrors = append(processingErrors, res.err)
+				tracker.Unresolved(1)
+				unresolved = append(unresolved, domain.NewUnresolvedParticipant(participants[res.index], unresolvedReason(res.err), res.err))
 			} else if res.isSet {
+				tracker.Enriched(res.user)
 				// Пользователи с ID=0 не могут быть однозначно идентифицированы,
 				// поэтому мы не применяем к ним логику дедупликации и собираем отдельно.
 				if res.user.ID == 0 {
 					unidentifiedUsers = append(unidentifiedUsers, res.user)
 				} else if res.user.Username != "" {
 					// Пользователь с юзернеймом имеет приоритет и перезаписывает любую существующую запись.
+					if existing, exists := enrichedUsersMap[res.user.ID]; exists {
+						mergeUserDiscovery(&res.user, existing)
+					}
 					enrichedUsersMap[res.user.ID] = res.user
 				} else {
 					// Пользователя без юзернейма добавляем, только если такого ID еще нет в мапе.
 					// Это предотвращает перезапись пользователя с юзернеймом на пользователя без него.
-					if _, exists := enrichedUsersMap[res.user.ID]; !exists {
+					if existing, exists := enrichedUsersMap[res.user.ID]; !exists {
 						enrichedUsersMap[res.user.ID] = res.user
+					} else {
+						mergeUserDiscovery(&existing, res.user)
+						enrichedUsersMap[res.user.ID] = existing
 					}
 				}
+			} else {
+				tracker.Unresolved(1)
+				unresolved = append(unresolved, domain.NewUnresolvedParticipant(participants[res.index], domain.UnresolvedNotFound, nil))
 			}
 			finishedCount++
 		case <-ctx.Done():
 			// Глобальный таймаут сработал, пока мы ждали результатов.
-			enrichedUsers := make([]domain.User, 0, len(enrichedUsersMap)+len(unidentifiedUsers))
-			for _, u := range enrichedUsersMap {
-				enrichedUsers = append(enrichedUsers, u)
+			enrichedUsers := collectEnrichedUsers(enrichedUsersMap, unidentifiedUsers)
+
+			// Участники, которых не успели обработать, попадают в список необработанных.
+			reason := unresolvedReason(ctx.Err())
+			for i, p := range participants {
+				if !finished[i] {
+					unresolved = append(unresolved, domain.NewUnresolvedParticipant(p, reason, nil))
+				}
 			}
-			enrichedUsers = append(enrichedUsers, unidentifiedUsers...)
+			tracker.Unresolved(len(participants) - finishedCount)
 
 			err := fmt.Errorf("enrichment process timed out: %w", ctx.Err())
-			s.log.WarnContext(ctx, "Enrichment process timed out", "enriched_count", len(enrichedUsers), "error", err)
+			s.log.WarnContext(ctx, "Enrichment process timed out", "enriched_count", len(enrichedUsers), "unresolved_count", len(unresolved), "error", err)
 			// Прекращаем ждать и возвращаем то, что успели собрать.
-			return enrichedUsers, err
+			return enrichedUsers, &domain.PartialResultError{Unresolved: unresolved, Err: err}
 		}
 	}
 
@@ -193,69 +249,120 @@ func (s *EnrichmentService) Enrich(ctx context.Context, participants []domain.Ra
 	wg.Wait()
 	close(results)
 
+	enrichedUsers := collectEnrichedUsers(enrichedUsersMap, unidentifiedUsers)
+
+	if len(processingErrors) > 0 {
+		return enrichedUsers, &domain.PartialResultError{Unresolved: unresolved, Err: errors.Join(processingErrors...)}
+	}
+
+	// Ненайденные участники не считаются ошибкой обогащения.
+	s.log.InfoContext(ctx, "Enrichment process finished successfully", "enriched_count", len(enrichedUsers), "not_found_count", len(unresolved))
+	return enrichedUsers, nil
+}
+
+// collectEnrichedUsers собирает итоговый список: идентифицированные пользователи,
+// затем пользователи без ID.
+func collectEnrichedUsers(enrichedUsersMap map[int64]domain.User, unidentifiedUsers []domain.User) []domain.User {
 	enrichedUsers := make([]domain.User, 0, len(enrichedUsersMap)+len(unidentifiedUsers))
 	for _, u := range enrichedUsersMap {
 		enrichedUsers = append(enrichedUsers, u)
 	}
-	enrichedUsers = append(enrichedUsers, unidentifiedUsers...)
+	return append(enrichedUsers, unidentifiedUsers...)
+}
 
-	if len(processingErrors) > 0 {
-		return enrichedUsers, errors.Join(processingErrors...)
+// unresolvedReason определяет причину, по которой участник не был обработан, по ошибке.
+func unresolvedReason(err error) domain.UnresolvedReason {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return domain.UnresolvedTimeout
+	case errors.Is(err, context.Canceled):
+		return domain.UnresolvedCancelled
+	case errors.Is(err, quota.ErrExceeded):
+		return domain.UnresolvedQuotaExceeded
+	default:
+		return domain.UnresolvedError
 	}
+}
 
-	s.log.InfoContext(ctx, "Enrichment process finished successfully", "enriched_count", len(enrichedUsers))
-	return enrichedUsers, nil
+// mergeUserDiscovery добавляет к dst способы обнаружения и активность той же записи
+// пользователя, найденной под другим ключом (например, автора и его @упоминания).
+func mergeUserDiscovery(dst *domain.User, src domain.User) {
+	dst.Sources = domain.MergeSources(slices.Clone(dst.Sources), src.Sources...)
+	dst.Activity.Merge(src.Activity)
 }
 
-func (s *EnrichmentService) worker(ctx context.Context, wg *sync.WaitGroup, tasks chan domain.RawParticipant, results chan<- enrichResult) {
+func (s *EnrichmentService) worker(ctx context.Context, wg *sync.WaitGroup, tasks chan enrichTask, results chan<- enrichResult) {
 	defer wg.Done()
 	for {
 		select {
 		case <-ctx.Done():
 			// Глобальный контекст завершен, выходим.
 			return
-		case p, ok := <-tasks:
+		case task, ok := <-tasks:
 			if !ok {
 				// Канал задач закрыт, больше работы нет.
 				return
 			}
+			p := task.participant
 
-			user, err := s.enrichParticipant(ctx, p)
+			user, err := s.enrichParticipant(ctx, &task)
 			if err != nil {
 				// Проверяем, является ли ошибка терминальной (например, пользователь не найден).
 				if errors.Is(err, ErrParticipantNotResolved) {
 					s.log.DebugContext(ctx, "Participant could not be resolved, skipping", "participant", p, "error", err)
 					// Это не ошибка всего процесса, а просто неудача для одного участника.
 					// Отправляем пустой результат, чтобы счетчик в Enrich уменьшился.
-					results <- enrichResult{isSet: false}
+					results <- enrichResult{index: task.index, isSet: false}
+				} else if errors.Is(err, quota.ErrExceeded) {
+					// Квота не восстановится до конца суток, повторять запрос бессмысленно.
+					s.log.WarnContext(ctx, "Lookup quota exceeded, participant left unresolved", "participant", p, "error", err)
+					results <- enrichResult{index: task.index, err: err}
 				} else if ctx.Err() != nil {
 					// Глобальный контекст отменен, это терминальная ошибка для воркера.
 					s.log.WarnContext(ctx, "Failed to enrich participant due to context cancellation", "participant", p, "error", err)
-					results <- enrichResult{err: err}
+					results <- enrichResult{index: task.index, err: err}
 				} else {
 					// Любая другая ошибка считается временной, перемещаем задачу в конец очереди.
 					s.log.WarnContext(ctx, "Re-queueing participant due to transient error", "participant", p, "error", err)
-					tasks <- p
+					progress.FromContext(ctx).Requeued()
+					metrics.EnrichmentRequeues.Inc()
+					tasks <- task
 				}
 				continue
 			}
 
-			// Успех, отправляем результат.
-			results <- enrichResult{user: user, isSet: true}
+			// Успех, отправляем результат вместе со способами обнаружения и активностью участника.
+			user.Sources = p.Sources
+			user.Activity = p.Activity
+			results <- enrichResult{index: task.index, user: user, isSet: true}
 		}
 	}
 }
 
-func (s *EnrichmentService) enrichParticipant(ctx context.Context, p domain.RawParticipant) (domain.User, error) {
+func (s *EnrichmentService) enrichParticipant(ctx context.Context, task *enrichTask) (domain.User, error) {
+	p := task.participant
 	if p.Username == "" && p.UserID == "" {
 		s.log.DebugContext(ctx, "Participant has no username or ID, skipping enrichment", "participant_name", p.Name)
 		return domain.User{ID: 0, Name: p.Name}, nil
 	}
 
+	if user, ok := s.cachedUser(p); ok {
+		s.log.DebugContext(ctx, "Participant found in user cache", "participant", p, "user_id", user.ID)
+		return user, nil
+	}
+
 	var tgUser *tg.User
 	var err error
 
 	if p.Username != "" {
+		// Каждый участник списывается с суточной квоты владельца задачи один раз,
+		// сколько бы попыток ни потребовалось.
+		if !task.charged {
+			if err := quota.FromContext(ctx).Take(quota.KindLookups); err != nil {
+				return domain.User{}, fmt.Errorf("failed to resolve participant %v: %w", p, err)
+			}
+			task.charged = true
+		}
 		s.log.DebugContext(ctx, "Resolving participant by username", "username", p.Username)
 		tgUser, err = s.resolveByUsername(ctx, p.Username)
 	} else {
@@ -303,20 +410,41 @@ func (s *EnrichmentService) enrichParticipant(ctx context.Context, p domain.RawP
 
 	channel := extractChannelFromBio(bio)
 
-	return domain.User{
+	user := domain.User{
 		ID:       tgUser.ID,
 		Name:     strings.TrimSpace(fmt.Sprintf("%s %s", tgUser.FirstName, tgUser.LastName)),
 		Username: tgUser.Username,
 		Bio:      bio,
 		Channel:  channel,
-	}, nil
+	}
+	if s.userCache != nil {
+		s.userCache.Put(user)
+	}
+	return user, nil
+}
+
+// cachedUser ищет профиль участника в кэше пользователей: по username, если он известен,
+// иначе по ID. Так автор сообщения без username получает профиль, полученный ранее
+// по его @упоминанию в другой задаче.
+func (s *EnrichmentService) cachedUser(p domain.RawParticipant) (domain.User, bool) {
+	if s.userCache == nil {
+		return domain.User{}, false
+	}
+	if p.Username != "" {
+		return s.userCache.GetByUsername(p.Username)
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(p.UserID, "user"), 10, 64)
+	if err != nil {
+		return domain.User{}, false
+	}
+	return s.userCache.GetByID(id)
 }
 
 func (s *EnrichmentService) resolveByUsername(ctx context.Context, username string) (*tg.User, error) {
 	cleanUsername := strings.TrimPrefix(username, "@")
 	s.log.DebugContext(ctx, "Executing ContactsResolveUsername", "username", cleanUsername)
 	logArgs := []any{"operation", "ContactsResolveUsername", "username", cleanUsername}
-	res, err := s.executeOperation(ctx, logArgs, func(ctx context.Context, cl ports.TelegramClient) (any, error) {
+	res, err := s.executeOperation(ctx, ports.MethodContactsResolveUsername, logArgs, func(ctx context.Context, cl ports.TelegramClient) (any, error) {
 		return cl.ContactsResolveUsername(ctx, &tg.ContactsResolveUsernameRequest{Username: cleanUsername})
 	})
 	if err != nil {
@@ -354,7 +482,7 @@ func (s *EnrichmentService) resolveByUserID(ctx context.Context, userIDStr strin
 
 	s.log.DebugContext(ctx, "Executing UsersGetUsers", "user_id", id)
 	logArgs := []any{"operation", "UsersGetUsers", "user_id", id}
-	res, err := s.executeOperation(ctx, logArgs, func(ctx context.Context, cl ports.TelegramClient) (any, error) {
+	res, err := s.executeOperation(ctx, ports.MethodUsersGetUsers, logArgs, func(ctx context.Context, cl ports.TelegramClient) (any, error) {
 		return cl.UsersGetUsers(ctx, []tg.InputUserClass{&tg.InputUser{UserID: id}})
 	})
 	if err != nil {
@@ -391,7 +519,7 @@ func (s *EnrichmentService) getFullUserInfo(ctx context.Context, user *tg.User)
 
 	s.log.DebugContext(ctx, "Executing UsersGetFullUser", "user_id", user.ID)
 	logArgs := []any{"operation", "UsersGetFullUser", "user_id", user.ID}
-	res, err := s.executeOperation(ctx, logArgs, func(ctx context.Context, cl ports.TelegramClient) (any, error) {
+	res, err := s.executeOperation(ctx, ports.MethodUsersGetFullUser, logArgs, func(ctx context.Context, cl ports.TelegramClient) (any, error) {
 		return cl.UsersGetFullUser(ctx, &tg.InputUser{UserID: user.ID, AccessHash: accessHash})
 	})
 	if err != nil {
@@ -413,7 +541,17 @@ func (s *EnrichmentService) getFullUserInfo(ctx context.Context, user *tg.User)
 	return userFull.FullUser.About, nil
 }
 
-func (s *EnrichmentService) executeOperation(ctx context.Context, logArgs []any, fn func(ctx context.Context, cl ports.TelegramClient) (any, error)) (any, error) {
+// executeOperation выполняет вызов метода method Telegram API у клиента из роутера.
+// Если бюджет запросов выбранного клиента исчерпан, после паузы берется другой клиент.
+func (s *EnrichmentService) executeOperation(ctx context.Context, method string, logArgs []any, fn func(ctx context.Context, cl ports.TelegramClient) (any, error)) (res any, err error) {
+	// Спан охватывает все попытки вызова; клиент последней попытки записывается в атрибуты.
+	ctx, span := tracing.Start(ctx, "EnrichmentService.executeOperation "+method, tracing.MethodKey.String(method))
+	attempts := 0
+	defer func() {
+		span.SetAttributes(attribute.Int("attempts", attempts))
+		tracing.End(span, err)
+	}()
+
 	// Внутренний цикл отвечает за получение клиента. Он "бесконечный", но ограничен родительским контекстом.
 	for {
 		if err := ctx.Err(); err != nil {
@@ -421,7 +559,7 @@ func (s *EnrichmentService) executeOperation(ctx context.Context, logArgs []any,
 		}
 
 		s.log.DebugContext(ctx, "Attempting to get a client from the router")
-		apiClient, err := s.router.GetClient(ctx)
+		apiClient, err := s.router.GetClient(ports.ContextWithMethod(ctx, method))
 		if err != nil {
 			logArgs := []any{"error", err, "pause", s.clientRetryPause}
 			if nextRecovery := s.router.NextRecoveryTime(); !nextRecovery.IsZero() {
@@ -442,6 +580,8 @@ func (s *EnrichmentService) executeOperation(ctx context.Context, logArgs []any,
 		}
 
 		s.log.DebugContext(ctx, "Obtained client successfully", "client_id", apiClient.ID())
+		attempts++
+		span.SetAttributes(tracing.ClientIDKey.String(apiClient.ID()))
 
 		opCtx, opCancel := context.WithTimeout(ctx, s.operationTimeout)
 		res, opErr := fn(opCtx, apiClient)
@@ -455,6 +595,16 @@ func (s *EnrichmentService) executeOperation(ctx context.Context, logArgs []any,
 			return res, nil // Успех
 		}
 
+		if errors.Is(opErr, ports.ErrRateLimited) {
+			s.log.DebugContext(ctx, "Client request budget exhausted, will retry", append(finalLogArgs, "pause", s.clientRetryPause)...)
+			select {
+			case <-time.After(s.clientRetryPause):
+				continue
+			case <-ctx.Done():
+				return nil, fmt.Errorf("failed to get client as context was cancelled: %w", ctx.Err())
+			}
+		}
+
 		// Ошибка от операции возвращается вызывающей стороне, которая решит, что делать дальше (например, перепоставить задачу).
 		finalLogArgs = append(finalLogArgs, "error", opErr)
 		s.log.WarnContext(ctx, "API operation failed", finalLogArgs...)
@@ -3,9 +3,11 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"sync"
+	"telegram-chat-parser/internal/cache"
 	"telegram-chat-parser/internal/domain"
 	"testing"
 	"time"
@@ -13,8 +15,11 @@ import (
 	"github.com/gotd/td/tg"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
 	"telegram-chat-parser/internal/ports"
+	"telegram-chat-parser/internal/progress"
+	"telegram-chat-parser/internal/quota"
 )
 
 // mockClient — это мок для интерфейса ports.TelegramClient.
@@ -127,11 +132,16 @@ func TestEnrichmentService_Enrich_RequeueOnFailure(t *testing.T) {
 	router.On("GetClient", mock.Anything).Return(client2, nil).Once()
 	client2.On("UsersGetFullUser", mock.Anything, mock.Anything).Return(fullUser, nil).Once()
 
-	users, err := service.Enrich(context.Background(), []domain.RawParticipant{participant})
+	tracker := progress.NewTracker()
+	users, err := service.Enrich(progress.NewContext(context.Background(), tracker), []domain.RawParticipant{participant})
 
 	assert.NoError(t, err)
 	assert.Len(t, users, 1)
 	assert.Equal(t, "Bio", users[0].Bio)
+	snapshot := tracker.Snapshot()
+	assert.Equal(t, 1, snapshot.ParticipantsTotal)
+	assert.Equal(t, 1, snapshot.Enriched)
+	assert.Equal(t, 1, snapshot.Requeued)
 	router.AssertExpectations(t)
 	client1.AssertExpectations(t)
 	client2.AssertExpectations(t)
@@ -166,6 +176,43 @@ func TestEnrichmentService_Enrich_RetryOnGetClientError(t *testing.T) {
 	client.AssertExpectations(t)
 }
 
+// TestEnrichmentService_Enrich_RetryOnRateLimit проверяет, что при исчерпанном бюджете клиента
+// запрос повторяется с другим клиентом без перепостановки участника в очередь.
+func TestEnrichmentService_Enrich_RetryOnRateLimit(t *testing.T) {
+	router := new(mockRouter)
+	limited, client := new(mockClient), new(mockClient)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	service := NewEnrichmentService(router, 1, 10*time.Millisecond, 1*time.Second, WithLogger(logger))
+
+	participant := domain.RawParticipant{Username: "testuser"}
+	tgUser := &tg.User{ID: 1, Username: "testuser", FirstName: "Test"}
+	tgUser.SetAccessHash(123)
+	resolvedPeer := &tg.ContactsResolvedPeer{Users: []tg.UserClass{tgUser}}
+	fullUser := &tg.UsersUserFull{FullUser: tg.UserFull{About: "Bio"}}
+
+	// Роутер получает метод API через контекст.
+	withMethod := func(method string) any {
+		return mock.MatchedBy(func(ctx context.Context) bool { return ports.MethodFromContext(ctx) == method })
+	}
+	router.On("GetClient", withMethod(ports.MethodContactsResolveUsername)).Return(limited, nil).Once()
+	limited.On("ContactsResolveUsername", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w: wait 30s", ports.ErrRateLimited)).Once()
+	router.On("GetClient", withMethod(ports.MethodContactsResolveUsername)).Return(client, nil).Once()
+	client.On("ContactsResolveUsername", mock.Anything, mock.Anything).Return(resolvedPeer, nil).Once()
+	router.On("GetClient", withMethod(ports.MethodUsersGetFullUser)).Return(client, nil).Once()
+	client.On("UsersGetFullUser", mock.Anything, mock.Anything).Return(fullUser, nil).Once()
+
+	tracker := progress.NewTracker()
+	users, err := service.Enrich(progress.NewContext(context.Background(), tracker), []domain.RawParticipant{participant})
+
+	assert.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, "Bio", users[0].Bio)
+	assert.Zero(t, tracker.Snapshot().Requeued)
+	router.AssertExpectations(t)
+	limited.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
 func TestEnrichmentService_Enrich_TotalTimeout(t *testing.T) {
 	router := new(mockRouter)
 	client := new(mockClient)
@@ -201,6 +248,13 @@ func TestEnrichmentService_Enrich_TotalTimeout(t *testing.T) {
 	assert.ErrorIs(t, err, context.DeadlineExceeded, "Ожидалась ошибка истечения времени ожидания контекста")
 	assert.Len(t, users, 1, "Должен вернуть частично обработанных пользователей")
 	assert.Equal(t, int64(1), users[0].ID)
+
+	var partialErr *domain.PartialResultError
+	if assert.ErrorAs(t, err, &partialErr) {
+		assert.Len(t, partialErr.Unresolved, 1)
+		assert.Equal(t, "user2", partialErr.Unresolved[0].Username)
+		assert.Equal(t, domain.UnresolvedTimeout, partialErr.Unresolved[0].Reason)
+	}
 }
 
 func TestEnrichmentService_Enrich_ParallelProcessing(t *testing.T) {
@@ -261,6 +315,24 @@ func TestEnrichmentService_Enrich_ParallelProcessing(t *testing.T) {
 	assert.Len(t, users, 2)
 }
 
+// TestEnrichmentService_Enrich_NotFound проверяет, что ненайденный участник не делает результат частичным.
+func TestEnrichmentService_Enrich_NotFound(t *testing.T) {
+	router := new(mockRouter)
+	client := new(mockClient)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	service := NewEnrichmentService(router, 1, 10*time.Millisecond, 1*time.Second, WithLogger(logger))
+
+	router.On("GetClient", mock.Anything).Return(client, nil).Once()
+	client.On("ContactsResolveUsername", mock.Anything, mock.Anything).Return(&tg.ContactsResolvedPeer{}, nil).Once()
+
+	users, err := service.Enrich(context.Background(), []domain.RawParticipant{{Username: "ghost"}})
+
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+	router.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
 func TestEnrichmentService_Enrich_NoUsernameOrID(t *testing.T) {
 	router := new(mockRouter)
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
@@ -363,6 +435,140 @@ func TestEnrichmentService_Enrich_Deduplication(t *testing.T) {
 	client.AssertExpectations(t)
 }
 
+func TestEnrichmentService_Enrich_MergesSourcesAndActivity(t *testing.T) {
+	router := new(mockRouter)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	service := NewEnrichmentService(router, 1, 10*time.Millisecond, 1*time.Second, WithLogger(logger))
+
+	participants := []domain.RawParticipant{
+		{UserID: "user1", Name: "John", Sources: []domain.ParticipantSource{domain.SourceAuthor},
+			Activity: domain.ActivityStats{MessageCount: 2, FirstMessageDate: "2024-01-02T00:00:00", LastMessageDate: "2024-01-03T00:00:00"}},
+		{UserID: "user1", Name: "John", Sources: []domain.ParticipantSource{domain.SourceReaction, domain.SourceAuthor},
+			Activity: domain.ActivityStats{MessageCount: 1, FirstMessageDate: "2024-01-01T00:00:00", LastMessageDate: "2024-01-01T00:00:00", Joined: 1}},
+	}
+
+	users, err := service.Enrich(context.Background(), participants)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.User{
+		{ID: 1, Name: "John", Sources: []domain.ParticipantSource{domain.SourceAuthor, domain.SourceReaction},
+			Activity: domain.ActivityStats{MessageCount: 3, FirstMessageDate: "2024-01-01T00:00:00", LastMessageDate: "2024-01-03T00:00:00", Joined: 1}},
+	}, users)
+	// Исходные данные не изменяются при объединении.
+	assert.Equal(t, []domain.ParticipantSource{domain.SourceAuthor}, participants[0].Sources)
+	router.AssertNotCalled(t, "GetClient")
+}
+
+func TestEnrichmentService_Enrich_UserCache(t *testing.T) {
+	router := new(mockRouter)
+	client := new(mockClient)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	userCache := cache.NewUserCache(time.Hour)
+	service := NewEnrichmentService(router, 1, 10*time.Millisecond, 1*time.Second,
+		WithLogger(logger),
+		WithUserCache(userCache),
+	)
+
+	tgUser := &tg.User{ID: 1, Username: "testuser", FirstName: "Test", LastName: "User"}
+	tgUser.SetAccessHash(123)
+	resolvedPeer := &tg.ContactsResolvedPeer{Users: []tg.UserClass{tgUser}}
+	fullUser := &tg.UsersUserFull{FullUser: tg.UserFull{About: "Bio t.me/channel"}}
+
+	// Telegram API вызывается только при первом обогащении.
+	router.On("GetClient", mock.Anything).Return(client, nil).Twice()
+	client.On("ContactsResolveUsername", mock.Anything, mock.Anything).Return(resolvedPeer, nil).Once()
+	client.On("UsersGetFullUser", mock.Anything, mock.Anything).Return(fullUser, nil).Once()
+
+	first, err := service.Enrich(context.Background(), []domain.RawParticipant{{Username: "testuser"}})
+	assert.NoError(t, err)
+	assert.Len(t, first, 1)
+
+	// Повторная задача: username в другом регистре и автор без username с тем же ID.
+	second, err := service.Enrich(context.Background(), []domain.RawParticipant{
+		{Username: "@TestUser", Sources: []domain.ParticipantSource{domain.SourceMention}},
+		{UserID: "user1", Name: "Old Name", Sources: []domain.ParticipantSource{domain.SourceAuthor}, Activity: domain.ActivityStats{MessageCount: 2}},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, second, 1) {
+		user := second[0]
+		assert.Equal(t, int64(1), user.ID)
+		assert.Equal(t, "testuser", user.Username)
+		assert.Equal(t, "Test User", user.Name)
+		assert.Equal(t, "Bio t.me/channel", user.Bio)
+		assert.Equal(t, "channel", user.Channel)
+		assert.ElementsMatch(t, []domain.ParticipantSource{domain.SourceMention, domain.SourceAuthor}, user.Sources)
+		assert.Equal(t, 2, user.Activity.MessageCount)
+	}
+
+	router.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+// TestEnrichmentService_Enrich_LookupQuota проверяет, что после исчерпания квоты запросов
+// оставшиеся участники не обогащаются и не возвращаются в очередь.
+func TestEnrichmentService_Enrich_LookupQuota(t *testing.T) {
+	router := new(mockRouter)
+	client := new(mockClient)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	service := NewEnrichmentService(router, 1, 10*time.Millisecond, 1*time.Second, WithLogger(logger))
+
+	tgUser := &tg.User{ID: 1, Username: "user1", FirstName: "First"}
+	tgUser.SetAccessHash(123)
+	router.On("GetClient", mock.Anything).Return(client, nil).Twice()
+	client.On("ContactsResolveUsername", mock.Anything, &tg.ContactsResolveUsernameRequest{Username: "user1"}).
+		Return(&tg.ContactsResolvedPeer{Users: []tg.UserClass{tgUser}}, nil).Once()
+	client.On("UsersGetFullUser", mock.Anything, mock.Anything).Return(&tg.UsersUserFull{}, nil).Once()
+
+	account := quota.NewManager().Account("ci", quota.Limits{Lookups: 1})
+	users, err := service.Enrich(quota.NewContext(context.Background(), account), []domain.RawParticipant{
+		{Username: "user1"},
+		{Username: "user2"},
+		{UserID: "user3", Name: "Without username"},
+	})
+
+	var partialErr *domain.PartialResultError
+	if assert.ErrorAs(t, err, &partialErr) {
+		assert.ErrorIs(t, err, quota.ErrExceeded)
+		if assert.Len(t, partialErr.Unresolved, 1) {
+			assert.Equal(t, "user2", partialErr.Unresolved[0].Username)
+			assert.Equal(t, domain.UnresolvedQuotaExceeded, partialErr.Unresolved[0].Reason)
+		}
+	}
+	// Участник без username не требует запроса к API и квоту не расходует.
+	assert.Len(t, users, 2)
+	router.AssertExpectations(t)
+	client.AssertExpectations(t)
+}
+
+// TestEnrichmentService_Enrich_LookupQuotaRequeue проверяет, что повтор запроса после
+// временной ошибки не расходует квоту запросов повторно.
+func TestEnrichmentService_Enrich_LookupQuotaRequeue(t *testing.T) {
+	router := new(mockRouter)
+	client := new(mockClient)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	service := NewEnrichmentService(router, 1, 10*time.Millisecond, 1*time.Second, WithLogger(logger))
+
+	tgUser := &tg.User{ID: 1, Username: "user1", FirstName: "First"}
+	tgUser.SetAccessHash(123)
+	router.On("GetClient", mock.Anything).Return(client, nil)
+	client.On("ContactsResolveUsername", mock.Anything, mock.Anything).Return(nil, errors.New("API_ERROR")).Twice()
+	client.On("ContactsResolveUsername", mock.Anything, mock.Anything).
+		Return(&tg.ContactsResolvedPeer{Users: []tg.UserClass{tgUser}}, nil).Once()
+	client.On("UsersGetFullUser", mock.Anything, mock.Anything).Return(&tg.UsersUserFull{}, nil).Once()
+
+	manager := quota.NewManager()
+	limits := quota.Limits{Lookups: 1}
+	account := manager.Account("ci", limits)
+	users, err := service.Enrich(quota.NewContext(context.Background(), account), []domain.RawParticipant{{Username: "user1"}})
+
+	require.NoError(t, err)
+	assert.Len(t, users, 1)
+	usage, err := manager.Usage("ci", limits)
+	require.NoError(t, err)
+	assert.Equal(t, 1, usage.Lookups.Used)
+	client.AssertExpectations(t)
+}
+
 func TestExtractChannelFromBio(t *testing.T) {
 	testCases := []struct {
 		name        string
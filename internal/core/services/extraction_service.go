@@ -1,11 +1,15 @@
 package services
 
 import (
+	"fmt"
 	"strings"
 	"telegram-chat-parser/internal/domain"
 	"telegram-chat-parser/internal/ports"
 )
 
+// deletedAccountName — имя, под которым в экспорте отображаются удаленные аккаунты.
+const deletedAccountName = "Deleted Account"
+
 // ExtractionServiceImpl реализует интерфейс ExtractionService.
 type ExtractionServiceImpl struct{}
 
@@ -16,43 +20,241 @@ func NewExtractionService() ports.ExtractionService {
 
 // ExtractRawParticipants извлекает "сырой" список авторов и упоминаний из чата.
 func (s *ExtractionServiceImpl) ExtractRawParticipants(chat *domain.ExportedChat) ([]domain.RawParticipant, error) {
-	var rawParticipants []domain.RawParticipant
-	// Мапы для отслеживания уникальных участников
-	uniqueUsers := make(map[string]bool)    // для отслеживания user ID
-	uniqueMentions := make(map[string]bool) // для отслеживания username упоминаний
-
-	for _, msg := range chat.Messages {
-		entityID := msg.FromID
-		entityName := msg.From
-		if msg.Type == "service" {
-			entityID = msg.ActorID
-			entityName = msg.Actor
-		}
-
-		// Добавляем только пользователей-авторов
-		if strings.HasPrefix(entityID, "user") && entityName != "" && entityName != "Deleted Account" {
-			if !uniqueUsers[entityID] {
-				uniqueUsers[entityID] = true
-				rawParticipants = append(rawParticipants, domain.RawParticipant{
-					UserID: entityID,
-					Name:   entityName,
-				})
+	collector := newParticipantCollector()
+	for i := range chat.Messages {
+		collector.Add(&chat.Messages[i])
+	}
+	return collector.Participants(), nil
+}
+
+// NewCollector создает коллектор для инкрементального извлечения участников.
+func (s *ExtractionServiceImpl) NewCollector() ports.ParticipantCollector {
+	return newParticipantCollector()
+}
+
+// participantCollector накапливает уникальных участников, способы их обнаружения
+// и статистику активности.
+// Хранит только участников, ключи дедупликации и авторов сообщений текущего чата
+// (для ответов), а не сами сообщения.
+type participantCollector struct {
+	rawParticipants []domain.RawParticipant
+	byUserID        map[string]int // индекс участника по user ID
+	byMention       map[string]int // индекс участника по username упоминания
+	byName          map[string]int // индекс участника по имени (HTML-экспорт, приглашения)
+
+	// authors хранит индексы авторов последних сообщений текущего чата по ID сообщения,
+	// чтобы находить адресата ответа по reply_to_message_id. authorIDs — ID сообщений
+	// из authors в порядке добавления, начиная с authorsHead, для вытеснения старых.
+	authors       map[int]int
+	authorIDs     []int
+	authorsHead   int
+	lastMessageID int
+}
+
+const (
+	// replyWindowPerParticipant — сколько последних сообщений на участника запоминается
+	// для поиска адресатов ответов. Так память коллектора растет с числом участников,
+	// а не сообщений; ответы на более ранние сообщения не учитываются.
+	replyWindowPerParticipant = 100
+	// minReplyWindow — размер окна ответов для чатов с небольшим числом участников.
+	minReplyWindow = 10000
+)
+
+func newParticipantCollector() *participantCollector {
+	return &participantCollector{
+		byUserID:  make(map[string]int),
+		byMention: make(map[string]int),
+		byName:    make(map[string]int),
+		authors:   make(map[int]int),
+	}
+}
+
+// Add обрабатывает одно сообщение, запоминает новых участников и обновляет
+// статистику их активности.
+func (c *participantCollector) Add(msg *domain.Message) {
+	entityID, entityName, kind := msg.FromID, msg.From, domain.SourceAuthor
+	if msg.Type == "service" {
+		entityID, entityName, kind = msg.ActorID, msg.Actor, domain.SourceActor
+	}
+
+	// Ответ ищется до регистрации текущего сообщения, так как ссылается на более раннее.
+	repliedIdx := -1
+	if msg.ReplyToMessageID != 0 && msg.ReplyToPeerID == "" {
+		if idx, ok := c.authorOf(msg.ReplyToMessageID); ok {
+			repliedIdx = idx
+			c.addSource(idx, domain.SourceReply)
+		}
+	}
+
+	authorIdx := c.addPerson(entityID, entityName, kind)
+	c.rememberAuthor(msg.ID, authorIdx)
+	if authorIdx >= 0 && msg.Type != "service" {
+		author := &c.rawParticipants[authorIdx].Activity
+		author.AddMessage(msg.Date)
+		if msg.ReplyToMessageID != 0 {
+			author.RepliesSent++
+		}
+	}
+	if repliedIdx >= 0 {
+		c.rawParticipants[repliedIdx].Activity.RepliesReceived++
+	}
+
+	c.addPerson(msg.ForwardedFromID, msg.ForwardedFrom, domain.SourceForward)
+	c.addPerson("", msg.SavedFrom, domain.SourceSavedFrom)
+
+	c.addServiceAction(msg, authorIdx)
+
+	for _, reaction := range msg.Reactions {
+		for _, r := range reaction.Recent {
+			c.addPerson(r.FromID, r.From, domain.SourceReaction)
+		}
+	}
+
+	for _, entity := range msg.TextEntities {
+		idx := -1
+		switch entity.Type {
+		case "mention":
+			idx = c.addMention(entity.Text)
+		case "mention_name":
+			if entity.UserID != 0 {
+				idx = c.addPerson(fmt.Sprintf("user%d", entity.UserID), entity.Text, domain.SourceMentionName)
+			} else {
+				// В HTML-экспорте ID упомянутого по имени пользователя неизвестен.
+				idx = c.addPerson("", entity.Text, domain.SourceMentionName)
 			}
 		}
+		if idx >= 0 {
+			c.rawParticipants[idx].Activity.MentionCount++
+		}
+	}
+}
 
-		// Добавляем упоминания
-		for _, entity := range msg.TextEntities {
-			if entity.Type == "mention" {
-				username := entity.Text
-				if !uniqueMentions[username] {
-					uniqueMentions[username] = true
-					rawParticipants = append(rawParticipants, domain.RawParticipant{
-						Username: username,
-					})
-				}
+// addServiceAction учитывает вступления, выходы и приглашения из служебного сообщения.
+// Участники в members указаны только по имени.
+func (c *participantCollector) addServiceAction(msg *domain.Message, actorIdx int) {
+	switch msg.Action {
+	case "join_group_by_link", "join_group_by_request":
+		if actorIdx >= 0 {
+			c.rawParticipants[actorIdx].Activity.Joined++
+		}
+		return
+	}
+
+	for _, member := range msg.Members {
+		idx := c.addPerson("", member, domain.SourceMember)
+		if idx < 0 {
+			continue
+		}
+		switch msg.Action {
+		case "invite_members":
+			c.rawParticipants[idx].Activity.Joined++
+			// Вступление в публичную группу оформляется как приглашение самого себя.
+			if actorIdx >= 0 && actorIdx != idx {
+				c.rawParticipants[actorIdx].Activity.Invited++
 			}
+		case "remove_members":
+			c.rawParticipants[idx].Activity.Left++
+		}
+	}
+}
+
+// Participants возвращает накопленных участников в порядке их обнаружения.
+func (c *participantCollector) Participants() []domain.RawParticipant {
+	return c.rawParticipants
+}
+
+// addPerson регистрирует пользователя по ID и имени и возвращает его индекс
+// или -1, если он не является участником (канал, удаленный аккаунт, нет имени).
+// Участник, известный только по имени, получает ID, когда тот впервые встречается.
+func (c *participantCollector) addPerson(id, name string, kind domain.ParticipantSource) int {
+	if name == "" || name == deletedAccountName {
+		return -1
+	}
+
+	if id == "" {
+		if idx, ok := c.byName[name]; ok {
+			c.addSource(idx, kind)
+			return idx
 		}
+		c.rawParticipants = append(c.rawParticipants, domain.RawParticipant{Name: name, Sources: []domain.ParticipantSource{kind}})
+		c.byName[name] = len(c.rawParticipants) - 1
+		return len(c.rawParticipants) - 1
+	}
+
+	// Добавляем только пользователей, но не каналы и группы.
+	if !strings.HasPrefix(id, "user") {
+		return -1
+	}
+	if idx, ok := c.byUserID[id]; ok {
+		c.addSource(idx, kind)
+		return idx
 	}
+	if idx, ok := c.byName[name]; ok && c.rawParticipants[idx].UserID == "" {
+		c.rawParticipants[idx].UserID = id
+		c.byUserID[id] = idx
+		c.addSource(idx, kind)
+		return idx
+	}
+
+	c.rawParticipants = append(c.rawParticipants, domain.RawParticipant{UserID: id, Name: name, Sources: []domain.ParticipantSource{kind}})
+	idx := len(c.rawParticipants) - 1
+	c.byUserID[id] = idx
+	if _, ok := c.byName[name]; !ok {
+		c.byName[name] = idx
+	}
+	return idx
+}
+
+func (c *participantCollector) addMention(username string) int {
+	if idx, ok := c.byMention[username]; ok {
+		c.addSource(idx, domain.SourceMention)
+		return idx
+	}
+	c.rawParticipants = append(c.rawParticipants, domain.RawParticipant{
+		Username: username,
+		Sources:  []domain.ParticipantSource{domain.SourceMention},
+	})
+	c.byMention[username] = len(c.rawParticipants) - 1
+	return len(c.rawParticipants) - 1
+}
+
+func (c *participantCollector) addSource(idx int, kind domain.ParticipantSource) {
+	c.rawParticipants[idx].Sources = domain.MergeSources(c.rawParticipants[idx].Sources, kind)
+}
+
+// rememberAuthor запоминает автора сообщения для поиска адресатов ответов.
+// ID сообщений в чате возрастают, поэтому неубывающий ID означает начало следующего
+// чата (например, в полном экспорте аккаунта), и авторы предыдущего забываются.
+// Неположительные ID (служебные блоки HTML-экспорта) не учитываются.
+func (c *participantCollector) rememberAuthor(messageID, idx int) {
+	if messageID <= 0 {
+		return
+	}
+	if messageID <= c.lastMessageID {
+		clear(c.authors)
+		c.authorIDs, c.authorsHead = c.authorIDs[:0], 0
+	}
+	c.lastMessageID = messageID
+	if idx < 0 {
+		return
+	}
+	c.authors[messageID] = idx
+	c.authorIDs = append(c.authorIDs, messageID)
+
+	// Вытесняем самые старые сообщения, когда окно заполнено.
+	window := max(minReplyWindow, replyWindowPerParticipant*len(c.rawParticipants))
+	for len(c.authors) > window {
+		delete(c.authors, c.authorIDs[c.authorsHead])
+		c.authorsHead++
+	}
+	// Вытесненные ID сдвигаются, когда занимают половину среза, чтобы он не рос.
+	if c.authorsHead > len(c.authorIDs)/2 {
+		c.authorIDs = append(c.authorIDs[:0], c.authorIDs[c.authorsHead:]...)
+		c.authorsHead = 0
+	}
+}
 
-	return rawParticipants, nil
+func (c *participantCollector) authorOf(messageID int) (int, bool) {
+	idx, ok := c.authors[messageID]
+	return idx, ok
 }
@@ -2,6 +2,7 @@ package services
 
 import (
 	"encoding/json"
+	"fmt"
 	"reflect"
 	"telegram-chat-parser/internal/domain"
 	"testing"
@@ -54,12 +55,12 @@ func TestExtractionService(t *testing.T) {
 		}
 
 		expected := []domain.RawParticipant{
-			{UserID: "user123", Name: "John Doe"},
-			{UserID: "user456", Name: "Jane Smith"},
+			{UserID: "user123", Name: "John Doe", Sources: []domain.ParticipantSource{domain.SourceAuthor}},
+			{UserID: "user456", Name: "Jane Smith", Sources: []domain.ParticipantSource{domain.SourceAuthor}},
 		}
 
 		for i, exp := range expected {
-			if !reflect.DeepEqual(participants[i], exp) {
+			if !reflect.DeepEqual(withoutActivity(participants)[i], exp) {
 				t.Errorf("Ожидался участник %+v, получено %+v", exp, participants[i])
 			}
 		}
@@ -291,4 +292,193 @@ func TestExtractionService(t *testing.T) {
 			t.Errorf("Ожидалось 0 участников (удаленный аккаунт отфильтрован), получено %d", len(participants))
 		}
 	})
+
+	t.Run("NewCollector накапливает участников инкрементально", func(t *testing.T) {
+		service := NewExtractionService()
+		collector := service.NewCollector()
+
+		collector.Add(&domain.Message{ID: 1, Type: "message", From: "John Doe", FromID: "user123"})
+		collector.Add(&domain.Message{
+			ID:           2,
+			Type:         "message",
+			From:         "John Doe",
+			FromID:       "user123",
+			TextEntities: []domain.TextEntity{{Type: "mention", Text: "@testuser"}},
+		})
+		collector.Add(&domain.Message{ID: 3, Type: "service", Actor: "Jane", ActorID: "user456"})
+
+		expected := []domain.RawParticipant{
+			{UserID: "user123", Name: "John Doe", Sources: []domain.ParticipantSource{domain.SourceAuthor}},
+			{Username: "@testuser", Sources: []domain.ParticipantSource{domain.SourceMention}},
+			{UserID: "user456", Name: "Jane", Sources: []domain.ParticipantSource{domain.SourceActor}},
+		}
+		if !reflect.DeepEqual(withoutActivity(collector.Participants()), expected) {
+			t.Errorf("Ожидались участники %+v, получено %+v", expected, collector.Participants())
+		}
+	})
+
+	t.Run("ExtractRawParticipants добавляет авторов без ID по имени", func(t *testing.T) {
+		service := NewExtractionService()
+
+		chat := &domain.ExportedChat{
+			Messages: []domain.Message{
+				{ID: 1, Type: "message", From: "John Doe"},
+				{ID: 2, Type: "message", From: "John Doe"},
+				{ID: 3, Type: "message", From: "Deleted Account"},
+			},
+		}
+
+		participants, err := service.ExtractRawParticipants(chat)
+		if err != nil {
+			t.Errorf("Неожиданная ошибка: %v", err)
+		}
+
+		expected := []domain.RawParticipant{{Name: "John Doe", Sources: []domain.ParticipantSource{domain.SourceAuthor}}}
+		if !reflect.DeepEqual(withoutActivity(participants), expected) {
+			t.Errorf("Ожидались участники %+v, получено %+v", expected, participants)
+		}
+	})
+	t.Run("ExtractRawParticipants извлекает пересылки, ответы, реакции и приглашения", func(t *testing.T) {
+		service := NewExtractionService()
+
+		chat := &domain.ExportedChat{
+			Messages: []domain.Message{
+				{ID: 1, Type: "message", From: "John", FromID: "user1"},
+				{
+					ID:               2,
+					Type:             "message",
+					From:             "Jane",
+					FromID:           "user2",
+					ReplyToMessageID: 1,
+					ForwardedFrom:    "Original",
+					ForwardedFromID:  "user3",
+					Reactions: []domain.Reaction{
+						{Type: "emoji", Emoji: "👍", Recent: []domain.ReactionAuthor{{From: "Fan", FromID: "user4"}, {From: "John", FromID: "user1"}}},
+					},
+					TextEntities: []domain.TextEntity{{Type: "mention_name", Text: "Quiet", UserID: 5}},
+				},
+				{ID: 3, Type: "message", From: "Jane", FromID: "user2", ForwardedFrom: "Some Channel", ForwardedFromID: "channel9"},
+				{ID: 4, Type: "message", From: "Jane", FromID: "user2", SavedFrom: "Archivist"},
+				{ID: 5, Type: "service", Actor: "John", ActorID: "user1", Members: []string{"Newbie", "Jane"}},
+				// Ответ на сообщение из другого чата не относится к автору сообщения 1 этого чата.
+				{ID: 6, Type: "message", From: "Jane", FromID: "user2", ReplyToMessageID: 1, ReplyToPeerID: "channel7"},
+			},
+		}
+
+		participants, err := service.ExtractRawParticipants(chat)
+		if err != nil {
+			t.Fatalf("Неожиданная ошибка: %v", err)
+		}
+
+		expected := []domain.RawParticipant{
+			{UserID: "user1", Name: "John", Sources: []domain.ParticipantSource{domain.SourceAuthor, domain.SourceReply, domain.SourceReaction, domain.SourceActor}},
+			{UserID: "user2", Name: "Jane", Sources: []domain.ParticipantSource{domain.SourceAuthor, domain.SourceMember}},
+			{UserID: "user3", Name: "Original", Sources: []domain.ParticipantSource{domain.SourceForward}},
+			{UserID: "user4", Name: "Fan", Sources: []domain.ParticipantSource{domain.SourceReaction}},
+			{UserID: "user5", Name: "Quiet", Sources: []domain.ParticipantSource{domain.SourceMentionName}},
+			{Name: "Archivist", Sources: []domain.ParticipantSource{domain.SourceSavedFrom}},
+			{Name: "Newbie", Sources: []domain.ParticipantSource{domain.SourceMember}},
+		}
+		if !reflect.DeepEqual(withoutActivity(participants), expected) {
+			t.Errorf("Ожидались участники %+v, получено %+v", expected, participants)
+		}
+	})
+
+	t.Run("Участник без ID получает ID при следующем появлении", func(t *testing.T) {
+		collector := NewExtractionService().NewCollector()
+
+		collector.Add(&domain.Message{ID: 1, Type: "service", Actor: "Admin", ActorID: "user1", Members: []string{"Newbie"}})
+		collector.Add(&domain.Message{ID: 2, Type: "message", From: "Newbie", FromID: "user2"})
+
+		expected := []domain.RawParticipant{
+			{UserID: "user1", Name: "Admin", Sources: []domain.ParticipantSource{domain.SourceActor}},
+			{UserID: "user2", Name: "Newbie", Sources: []domain.ParticipantSource{domain.SourceMember, domain.SourceAuthor}},
+		}
+		if !reflect.DeepEqual(withoutActivity(collector.Participants()), expected) {
+			t.Errorf("Ожидались участники %+v, получено %+v", expected, collector.Participants())
+		}
+	})
+
+	t.Run("Ответы не связываются с сообщениями предыдущего чата", func(t *testing.T) {
+		collector := NewExtractionService().NewCollector()
+
+		// Первый чат.
+		collector.Add(&domain.Message{ID: 10, Type: "message", From: "John", FromID: "user1"})
+		// Второй чат полного экспорта: нумерация сообщений начинается заново.
+		collector.Add(&domain.Message{ID: 1, Type: "message", From: "Jane", FromID: "user2"})
+		collector.Add(&domain.Message{ID: 2, Type: "message", From: "Jane", FromID: "user2", ReplyToMessageID: 10})
+
+		for _, p := range collector.Participants() {
+			if p.UserID == "user1" && len(p.Sources) != 1 {
+				t.Errorf("Ожидалось, что John обнаружен только как автор, получено %v", p.Sources)
+			}
+		}
+	})
+
+	t.Run("Авторы для ответов хранятся в окне, ограниченном числом участников", func(t *testing.T) {
+		collector := newParticipantCollector()
+		total := minReplyWindow + 500
+		for id := 1; id <= total; id++ {
+			from := fmt.Sprintf("User %d", id%2)
+			collector.Add(&domain.Message{ID: id, Type: "message", From: from, FromID: fmt.Sprintf("user%d", id%2+1)})
+		}
+		if len(collector.authors) != minReplyWindow {
+			t.Fatalf("Ожидалось %d запомненных авторов, получено %d", minReplyWindow, len(collector.authors))
+		}
+		if len(collector.authorIDs) > 2*minReplyWindow {
+			t.Errorf("Срез ID сообщений не сжимается: %d", len(collector.authorIDs))
+		}
+		if _, ok := collector.authorOf(1); ok {
+			t.Error("Автор вытесненного сообщения не должен находиться")
+		}
+		if idx, ok := collector.authorOf(total); !ok || collector.rawParticipants[idx].UserID != fmt.Sprintf("user%d", total%2+1) {
+			t.Errorf("Автор последнего сообщения не найден: %d, %v", idx, ok)
+		}
+	})
+
+	t.Run("Коллектор считает статистику активности", func(t *testing.T) {
+		collector := NewExtractionService().NewCollector()
+
+		collector.Add(&domain.Message{ID: 1, Type: "service", Action: "invite_members", Actor: "Admin", ActorID: "user1", Members: []string{"Jane", "Bob"}})
+		collector.Add(&domain.Message{ID: 2, Type: "message", Date: "2024-01-02T10:00:00", From: "Jane", FromID: "user2"})
+		collector.Add(&domain.Message{
+			ID: 3, Type: "message", Date: "2024-01-01T09:00:00", From: "Admin", FromID: "user1", ReplyToMessageID: 2,
+			TextEntities: []domain.TextEntity{{Type: "mention", Text: "@jane"}, {Type: "mention_name", Text: "Jane", UserID: 2}},
+		})
+		collector.Add(&domain.Message{ID: 4, Type: "message", Date: "2024-01-03T12:00:00", From: "Jane", FromID: "user2", ReplyToMessageID: 3,
+			TextEntities: []domain.TextEntity{{Type: "mention", Text: "@jane"}}})
+		collector.Add(&domain.Message{ID: 5, Type: "service", Action: "remove_members", Actor: "Bob", Members: []string{"Bob"}})
+		collector.Add(&domain.Message{ID: 6, Type: "service", Action: "join_group_by_link", Actor: "Carl", ActorID: "user3"})
+
+		stats := make(map[string]domain.ActivityStats)
+		for _, p := range collector.Participants() {
+			key := p.Name
+			if key == "" {
+				key = p.Username
+			}
+			stats[key] = p.Activity
+		}
+
+		expected := map[string]domain.ActivityStats{
+			"Admin": {MessageCount: 1, FirstMessageDate: "2024-01-01T09:00:00", LastMessageDate: "2024-01-01T09:00:00", RepliesSent: 1, RepliesReceived: 1, Invited: 2},
+			"Jane":  {MessageCount: 2, FirstMessageDate: "2024-01-02T10:00:00", LastMessageDate: "2024-01-03T12:00:00", MentionCount: 1, RepliesSent: 1, RepliesReceived: 1, Joined: 1},
+			"Bob":   {Joined: 1, Left: 1},
+			"@jane": {MentionCount: 2},
+			"Carl":  {Joined: 1},
+		}
+		if !reflect.DeepEqual(stats, expected) {
+			t.Errorf("Ожидалась статистика %+v, получено %+v", expected, stats)
+		}
+	})
+}
+
+// withoutActivity возвращает копию участников без статистики, чтобы сравнивать
+// только состав участников и способы их обнаружения.
+func withoutActivity(participants []domain.RawParticipant) []domain.RawParticipant {
+	result := make([]domain.RawParticipant, len(participants))
+	for i, p := range participants {
+		p.Activity = domain.ActivityStats{}
+		result[i] = p
+	}
+	return result
 }
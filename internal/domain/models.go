@@ -1,6 +1,15 @@
 package domain
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ChatTypeAccountExport — тип, которым помечается результат разбора полного экспорта
+// аккаунта, когда сообщения всех его чатов объединены в один ExportedChat.
+const ChatTypeAccountExport = "account_export"
 
 // ExportedChat представляет корневую структуру файла экспорта.
 type ExportedChat struct {
@@ -10,23 +19,148 @@ type ExportedChat struct {
 	Messages []Message `json:"messages"`
 }
 
+// AccountExport представляет полный экспорт аккаунта Telegram (Settings → Export
+// Telegram Data), в котором чаты перечислены в chats.list и left_chats.list.
+type AccountExport struct {
+	Chats     ChatList `json:"chats"`
+	LeftChats ChatList `json:"left_chats"`
+}
+
+// ChatList представляет раздел со списком чатов в экспорте аккаунта.
+type ChatList struct {
+	List []ExportedChat `json:"list"`
+}
+
+// AllChats возвращает все чаты экспорта: сначала текущие, затем покинутые.
+func (a *AccountExport) AllChats() []ExportedChat {
+	chats := make([]ExportedChat, 0, len(a.Chats.List)+len(a.LeftChats.List))
+	chats = append(chats, a.Chats.List...)
+	return append(chats, a.LeftChats.List...)
+}
+
+// ChatInfo описывает чат экспорта без сообщений.
+type ChatInfo struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	MessageCount int    `json:"message_count"`
+	// Selected показывает, прошел ли чат фильтр и были ли извлечены его участники.
+	Selected bool `json:"selected"`
+}
+
+// ChatFilter задает, из каких чатов экспорта извлекать участников.
+// Внутри одного критерия значения объединяются по "или", разные критерии — по "и".
+// Пустой критерий не ограничивает выбор, пустой фильтр выбирает все чаты.
+type ChatFilter struct {
+	IDs   []int
+	Names []string // Сравниваются без учета регистра.
+	Types []string // Например, private_supergroup, public_channel, personal_chat.
+}
+
+// IsEmpty сообщает, что фильтр не задан.
+func (f ChatFilter) IsEmpty() bool {
+	return len(f.IDs) == 0 && len(f.Names) == 0 && len(f.Types) == 0
+}
+
+// Match проверяет, удовлетворяет ли чат фильтру.
+func (f ChatFilter) Match(chat ChatInfo) bool {
+	if len(f.IDs) > 0 && !containsInt(f.IDs, chat.ID) {
+		return false
+	}
+	if len(f.Names) > 0 && !containsFold(f.Names, chat.Name) {
+		return false
+	}
+	if len(f.Types) > 0 && !containsFold(f.Types, chat.Type) {
+		return false
+	}
+	return true
+}
+
+// String возвращает каноническое представление фильтра, не зависящее от порядка значений.
+// Используется в ключе кеша.
+func (f ChatFilter) String() string {
+	ids := make([]string, 0, len(f.IDs))
+	for _, id := range f.IDs {
+		ids = append(ids, fmt.Sprint(id))
+	}
+	return fmt.Sprintf("ids=%s;names=%s;types=%s", canonical(ids), canonical(f.Names), canonical(f.Types))
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, v string) bool {
+	for _, x := range values {
+		if strings.EqualFold(x, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func canonical(values []string) string {
+	sorted := make([]string, 0, len(values))
+	for _, v := range values {
+		sorted = append(sorted, strings.ToLower(v))
+	}
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
 // Message представляет одно сообщение в чате.
 type Message struct {
-	ID           int             `json:"id"`
-	Type         string          `json:"type"`
-	Date         string          `json:"date"`
-	From         string          `json:"from"`
-	FromID       string          `json:"from_id"`
-	Actor        string          `json:"actor"`
-	ActorID      string          `json:"actor_id"`
-	Text         json.RawMessage `json:"text"` // Может быть строкой или массивом
-	TextEntities []TextEntity    `json:"text_entities"`
+	ID      int    `json:"id"`
+	Type    string `json:"type"`
+	Date    string `json:"date"`
+	From    string `json:"from"`
+	FromID  string `json:"from_id"`
+	Actor   string `json:"actor"`
+	ActorID string `json:"actor_id"`
+	// Action — вид служебного сообщения, например invite_members или join_group_by_link.
+	Action string `json:"action"`
+	// Members — имена приглашенных участников в служебных сообщениях invite_members.
+	Members []string `json:"members"`
+	// ForwardedFrom и ForwardedFromID описывают автора пересланного сообщения.
+	ForwardedFrom   string `json:"forwarded_from"`
+	ForwardedFromID string `json:"forwarded_from_id"`
+	// SavedFrom — имя автора сообщения, сохраненного в "Избранное".
+	SavedFrom        string `json:"saved_from"`
+	ReplyToMessageID int    `json:"reply_to_message_id"`
+	// ReplyToPeerID заполняется, если ответ дан на сообщение из другого чата.
+	ReplyToPeerID string          `json:"reply_to_peer_id"`
+	Reactions     []Reaction      `json:"reactions"`
+	Text          json.RawMessage `json:"text"` // Может быть строкой или массивом
+	TextEntities  []TextEntity    `json:"text_entities"`
+}
+
+// Reaction представляет реакцию на сообщение.
+// Recent содержит последних поставивших ее пользователей, а не всех.
+type Reaction struct {
+	Type   string           `json:"type"`
+	Count  int              `json:"count"`
+	Emoji  string           `json:"emoji"`
+	Recent []ReactionAuthor `json:"recent"`
+}
+
+// ReactionAuthor описывает пользователя, поставившего реакцию.
+type ReactionAuthor struct {
+	From   string `json:"from"`
+	FromID string `json:"from_id"`
+	Date   string `json:"date"`
 }
 
 // TextEntity представляет "богатую" часть текста (упоминание, ссылка и т.д.).
 type TextEntity struct {
 	Type string `json:"type"`
 	Text string `json:"text"`
+	// UserID указывается для упоминаний по имени (mention_name) пользователей без username.
+	UserID int64 `json:"user_id,omitempty"`
 }
 
 // User представляет участника чата.
@@ -37,6 +171,95 @@ type User struct {
 	Username string `json:"username"`
 	Bio      string `json:"bio"`
 	Channel  string `json:"channel,omitempty"`
+	// Sources перечисляет способы, которыми участник был обнаружен в экспорте.
+	Sources  []ParticipantSource `json:"sources,omitempty"`
+	Activity ActivityStats       `json:"activity"`
+}
+
+// ActivityStats описывает активность участника в чате.
+type ActivityStats struct {
+	MessageCount int `json:"message_count"`
+	// Даты в формате экспорта ("2006-01-02T15:04:05"), поэтому сравниваются как строки.
+	FirstMessageDate string `json:"first_message_date,omitempty"`
+	LastMessageDate  string `json:"last_message_date,omitempty"`
+	// MentionCount — сколько раз участника упомянули (по @username или по имени).
+	MentionCount    int `json:"mention_count"`
+	RepliesSent     int `json:"replies_sent"`
+	RepliesReceived int `json:"replies_received"`
+	// Joined и Left — сколько раз участник вступал в чат и покидал (или был исключен).
+	Joined int `json:"joined"`
+	Left   int `json:"left"`
+	// Invited — сколько участников он пригласил.
+	Invited int `json:"invited"`
+}
+
+// AddMessage учитывает сообщение участника с указанной датой.
+func (a *ActivityStats) AddMessage(date string) {
+	a.MessageCount++
+	a.addDates(date, date)
+}
+
+// Merge добавляет к статистике данные того же участника, собранные отдельно
+// (из другого файла или под другим ключом).
+func (a *ActivityStats) Merge(b ActivityStats) {
+	a.MessageCount += b.MessageCount
+	a.MentionCount += b.MentionCount
+	a.RepliesSent += b.RepliesSent
+	a.RepliesReceived += b.RepliesReceived
+	a.Joined += b.Joined
+	a.Left += b.Left
+	a.Invited += b.Invited
+	a.addDates(b.FirstMessageDate, b.LastMessageDate)
+}
+
+func (a *ActivityStats) addDates(first, last string) {
+	if first != "" && (a.FirstMessageDate == "" || first < a.FirstMessageDate) {
+		a.FirstMessageDate = first
+	}
+	if last != "" && last > a.LastMessageDate {
+		a.LastMessageDate = last
+	}
+}
+
+// ParticipantSource обозначает, каким образом участник был обнаружен в экспорте.
+type ParticipantSource string
+
+const (
+	// SourceAuthor — автор сообщения.
+	SourceAuthor ParticipantSource = "author"
+	// SourceActor — инициатор служебного сообщения (вступление, приглашение и т.д.).
+	SourceActor ParticipantSource = "actor"
+	// SourceMention — упоминание по @username.
+	SourceMention ParticipantSource = "mention"
+	// SourceMentionName — упоминание по имени пользователя без username.
+	SourceMentionName ParticipantSource = "mention_name"
+	// SourceForward — автор пересланного сообщения.
+	SourceForward ParticipantSource = "forward"
+	// SourceSavedFrom — автор сообщения, сохраненного в "Избранное".
+	SourceSavedFrom ParticipantSource = "saved_from"
+	// SourceReply — автор сообщения, на которое ответили.
+	SourceReply ParticipantSource = "reply"
+	// SourceReaction — пользователь, поставивший реакцию.
+	SourceReaction ParticipantSource = "reaction"
+	// SourceMember — участник из служебного сообщения о составе чата (приглашение, исключение).
+	SourceMember ParticipantSource = "member"
+)
+
+// MergeSources добавляет к a отсутствующие в нем способы обнаружения из b, сохраняя порядок.
+func MergeSources(a []ParticipantSource, b ...ParticipantSource) []ParticipantSource {
+	for _, src := range b {
+		found := false
+		for _, existing := range a {
+			if existing == src {
+				found = true
+				break
+			}
+		}
+		if !found {
+			a = append(a, src)
+		}
+	}
+	return a
 }
 
 // RawParticipant представляет "сырые" данные об участнике, извлеченные из файла,
@@ -49,4 +272,66 @@ type RawParticipant struct {
 	Name string
 	// Имя пользователя для упоминаний (например, '@username').
 	Username string
+	// Sources перечисляет способы обнаружения участника в порядке их появления.
+	Sources []ParticipantSource
+	// Activity — статистика активности участника в обработанных чатах.
+	Activity ActivityStats
+}
+
+// UnresolvedReason объясняет, почему данные участника не были получены через API.
+type UnresolvedReason string
+
+const (
+	// UnresolvedNotFound — Telegram не нашел пользователя по username.
+	UnresolvedNotFound UnresolvedReason = "not_found"
+	// UnresolvedTimeout — истек таймаут задачи до обработки участника.
+	UnresolvedTimeout UnresolvedReason = "timeout"
+	// UnresolvedCancelled — задача была отменена до обработки участника.
+	UnresolvedCancelled UnresolvedReason = "cancelled"
+	// UnresolvedQuotaExceeded — исчерпана суточная квота запросов к Telegram API ключа задачи.
+	UnresolvedQuotaExceeded UnresolvedReason = "quota_exceeded"
+	// UnresolvedError — обработка участника завершилась ошибкой.
+	UnresolvedError UnresolvedReason = "error"
+)
+
+// UnresolvedParticipant описывает участника, который не попал в результат обогащения.
+type UnresolvedParticipant struct {
+	UserID   string              `json:"user_id,omitempty"`
+	Name     string              `json:"name,omitempty"`
+	Username string              `json:"username,omitempty"`
+	Sources  []ParticipantSource `json:"sources,omitempty"`
+	Reason   UnresolvedReason    `json:"reason"`
+	// Error — текст ошибки для причины error.
+	Error string `json:"error,omitempty"`
+}
+
+// NewUnresolvedParticipant создает описание необработанного участника.
+func NewUnresolvedParticipant(p RawParticipant, reason UnresolvedReason, err error) UnresolvedParticipant {
+	u := UnresolvedParticipant{
+		UserID:   p.UserID,
+		Name:     p.Name,
+		Username: p.Username,
+		Sources:  p.Sources,
+		Reason:   reason,
+	}
+	if err != nil {
+		u.Error = err.Error()
+	}
+	return u
+}
+
+// PartialResultError возвращается вместе с частичным результатом обогащения,
+// когда часть участников не удалось обработать (например, по таймауту задачи).
+type PartialResultError struct {
+	// Unresolved перечисляет участников, не попавших в результат, с причинами.
+	Unresolved []UnresolvedParticipant
+	Err        error
+}
+
+func (e *PartialResultError) Error() string {
+	return fmt.Sprintf("partial result, %d participants unresolved: %v", len(e.Unresolved), e.Err)
+}
+
+func (e *PartialResultError) Unwrap() error {
+	return e.Err
 }
@@ -284,3 +284,35 @@ func TestExportedChatWithMarshaling(t *testing.T) {
 		t.Errorf("Ожидалось имя 'Test Chat', получено '%s'", unmarshaledChat.Name)
 	}
 }
+
+func TestChatFilter(t *testing.T) {
+	chat := ChatInfo{ID: 100, Name: "Work Chat", Type: "private_supergroup"}
+
+	cases := []struct {
+		name     string
+		filter   ChatFilter
+		expected bool
+	}{
+		{"пустой фильтр выбирает все", ChatFilter{}, true},
+		{"по id", ChatFilter{IDs: []int{1, 100}}, true},
+		{"другой id", ChatFilter{IDs: []int{1}}, false},
+		{"по названию без учета регистра", ChatFilter{Names: []string{"work chat"}}, true},
+		{"по типу", ChatFilter{Types: []string{"public_channel", "private_supergroup"}}, true},
+		{"критерии объединяются по и", ChatFilter{IDs: []int{100}, Types: []string{"public_channel"}}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.filter.Match(chat); got != tc.expected {
+				t.Errorf("Match() = %v, ожидалось %v", got, tc.expected)
+			}
+		})
+	}
+
+	t.Run("String не зависит от порядка значений", func(t *testing.T) {
+		a := ChatFilter{IDs: []int{2, 1}, Names: []string{"B", "a"}}
+		b := ChatFilter{IDs: []int{1, 2}, Names: []string{"A", "b"}}
+		if a.String() != b.String() {
+			t.Errorf("Ожидалось совпадение %q и %q", a.String(), b.String())
+		}
+	})
+}
@@ -0,0 +1,116 @@
+// Package metrics объявляет метрики сервиса и отдает их в формате Prometheus.
+// Метрики регистрируются в собственном реестре пакета, поэтому компоненты сервиса
+// обновляют их напрямую, без передачи реестра через конструкторы.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Результаты загрузки файлов через POST /api/v1/process (метка result метрики Uploads).
+const (
+	UploadAccepted      = "accepted"
+	UploadInvalid       = "invalid"
+	UploadQueueFull     = "queue_full"
+	UploadQuotaExceeded = "quota_exceeded"
+	UploadError         = "error"
+)
+
+// Результаты вызова Telegram API (метка result метрики TelegramRequests).
+const (
+	ResultOK          = "ok"
+	ResultError       = "error"
+	ResultFloodWait   = "flood_wait"
+	ResultRateLimited = "rate_limited"
+)
+
+// Результаты обращения к кешу результатов (метка result метрики CacheRequests).
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
+const namespace = "chat_parser"
+
+// Registry — реестр метрик сервиса. Кроме метрик пакета содержит метрики среды
+// выполнения Go и процесса.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Метрики HTTP-сервера и очереди задач.
+var (
+	Uploads = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uploads_total",
+		Help:      "Uploads to POST /api/v1/process by result.",
+	}, []string{"result"})
+	UploadSize = factory.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upload_size_bytes",
+		Help:      "Total size of files in accepted uploads.",
+		Buckets:   prometheus.ExponentialBuckets(1<<10, 4, 10), // 1 КБ … 256 МБ
+	})
+	TaskDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "task_duration_seconds",
+		Help:      "Processing time of tasks by final status, excluding time in the queue.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 3600},
+	}, []string{"status"})
+	TaskQueueDepth = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "task_queue_depth",
+		Help:      "Tasks waiting in the queue for a free worker.",
+	})
+)
+
+// Метрики клиентов Telegram API и роутера.
+var (
+	TelegramRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_requests_total",
+		Help:      "Telegram API calls made through the router by method, client and result.",
+	}, []string{"method", "client", "result"})
+	FloodWait = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "telegram_flood_wait_seconds",
+		Help:      "FLOOD_WAIT errors by client and the wait requested by Telegram.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 300, 900, 3600, 86400},
+	}, []string{"client"})
+	RouterClients = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "router_clients",
+		Help:      "Telegram clients in the router pool by state.",
+	}, []string{"state"})
+)
+
+// Метрики кеша результатов и сервиса обогащения.
+var (
+	CacheRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Result cache lookups by result.",
+	}, []string{"result"})
+	EnrichmentRequeues = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "enrichment_requeues_total",
+		Help:      "Participants put back into the enrichment queue after a transient error.",
+	})
+)
+
+// Handler возвращает HTTP-обработчик, отдающий метрики реестра Registry.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
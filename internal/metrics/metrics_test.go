@@ -0,0 +1,25 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	Uploads.WithLabelValues(UploadAccepted).Inc()
+	RouterClients.WithLabelValues("healthy").Set(2)
+	TaskDuration.WithLabelValues("completed").Observe(3)
+
+	rr := httptest.NewRecorder()
+	Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	body := rr.Body.String()
+	assert.Contains(t, body, `chat_parser_uploads_total{result="accepted"} 1`)
+	assert.Contains(t, body, `chat_parser_router_clients{state="healthy"} 2`)
+	assert.Contains(t, body, `chat_parser_task_duration_seconds_bucket{status="completed",le="5"} 1`)
+	assert.Contains(t, body, "go_goroutines")
+}
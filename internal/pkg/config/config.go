@@ -2,12 +2,16 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
+	"net/url"
 	"os"
 	"time"
 
 	"github.com/joho/godotenv"
 	"gopkg.in/yaml.v2"
+
+	"telegram-chat-parser/internal/storage"
 )
 
 // Server содержит конфигурацию сервера
@@ -29,18 +33,87 @@ type TelegramAPIServer struct {
 	PhoneNumber  string        `yaml:"phone_number"`
 	SessionFile  string        `yaml:"session_file"`
 	RequestDelay time.Duration `yaml:"request_delay"`
+	// RateLimits — ограничения частоты запросов клиента к Telegram API.
+	RateLimits RateLimits `yaml:"rate_limits"`
+	// Weight — доля запросов клиента при стратегии weighted. 0 означает 1.
+	Weight int `yaml:"weight"`
+	// Disabled исключает аккаунт из пула, не удаляя его из конфигурации.
+	Disabled bool `yaml:"disabled"`
+	// LoginMethod — способ входа в аккаунт без сохраненной сессии: "code" (код из SMS
+	// или приложения, по умолчанию) или "qr" (QR-код, подтверждаемый в приложении).
+	LoginMethod string `yaml:"login_method"`
+}
+
+// RateLimit задает ограничение частоты запросов «корзиной токенов».
+type RateLimit struct {
+	PerMinute float64 `yaml:"per_minute"` // 0 - без ограничений
+	Burst     int     `yaml:"burst"`      // запросов подряд без ожидания; 0 - один
+}
+
+// RateLimits содержит ограничения частоты запросов одного сервера Telegram API:
+// общее и отдельные для методов, которые Telegram ограничивает строже.
+type RateLimits struct {
+	Requests        RateLimit `yaml:"requests"`
+	ResolveUsername RateLimit `yaml:"resolve_username"`
+	GetFullUser     RateLimit `yaml:"get_full_user"`
+}
+
+func (l RateLimit) validate(name string) error {
+	if l.PerMinute < 0 {
+		return fmt.Errorf("%s.per_minute must be non-negative (0 for no limits)", name)
+	}
+	if l.Burst < 0 {
+		return fmt.Errorf("%s.burst must be non-negative", name)
+	}
+	return nil
 }
 
 // TelegramAPI содержит конфигурацию Telegram API
 type TelegramAPI struct {
 	Servers             []TelegramAPIServer `yaml:"servers"`
 	HealthCheckInterval time.Duration       `yaml:"health_check_interval"`
+	// Strategy — стратегия выбора клиента: round_robin, least_in_flight, weighted
+	// или least_flood_waited.
+	Strategy string `yaml:"strategy"`
+	// SessionStorage — где хранятся сессии аккаунтов: "file" (session_file), "encrypted_file"
+	// (session_file, зашифрованный ключом SessionKey) или "bolt" (встроенная база storage.path).
+	SessionStorage string `yaml:"session_storage"`
+	// SessionKey — ключ шифрования сессий AES-256 в base64 (32 байта). Обязателен для
+	// "encrypted_file"; для "bolt" включает шифрование сессий в базе.
+	// Может быть задан переменной окружения TELEGRAM_SESSION_KEY.
+	SessionKey string `yaml:"session_key"`
+}
+
+// SessionKeySize — размер ключа шифрования сессий (AES-256).
+const SessionKeySize = 32
+
+// DecodeSessionKey возвращает ключ шифрования сессий или nil, если ключ не задан.
+func (t TelegramAPI) DecodeSessionKey() ([]byte, error) {
+	if t.SessionKey == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(t.SessionKey)
+	if err != nil {
+		return nil, fmt.Errorf("telegram_api.session_key must be base64: %w", err)
+	}
+	if len(key) != SessionKeySize {
+		return nil, fmt.Errorf("telegram_api.session_key must be %d bytes, got %d", SessionKeySize, len(key))
+	}
+	return key, nil
 }
 
 // Processing содержит конфигурацию обработки
 type Processing struct {
 	TaskTimeout time.Duration `yaml:"task_timeout"` // 0 - без ограничений
 	CacheTTL    time.Duration `yaml:"cache_ttl"`
+	// MaxArchiveEntries — максимальное количество записей в загруженном архиве.
+	MaxArchiveEntries int `yaml:"max_archive_entries"`
+	// MaxArchiveExtractedMB — максимальный объем файлов экспорта, распакованных из архива.
+	MaxArchiveExtractedMB int64 `yaml:"max_archive_extracted_mb"`
+	// MaxConcurrentTasks — сколько задач обрабатывается одновременно; остальные ждут в очереди.
+	MaxConcurrentTasks int `yaml:"max_concurrent_tasks"`
+	// MaxQueuedTasks — сколько задач может ждать в очереди. Сверх этого /process отвечает 429.
+	MaxQueuedTasks int `yaml:"max_queued_tasks"`
 }
 
 // Enrichment содержит конфигурацию сервиса обогащения данных
@@ -48,6 +121,63 @@ type Enrichment struct {
 	PoolSize         int           `yaml:"pool_size"`
 	ClientRetryPause time.Duration `yaml:"client_retry_pause"`
 	OperationTimeout time.Duration `yaml:"operation_timeout"`
+	// UserCacheTTL — время жизни профиля пользователя в кэше, общем для всех задач. 0 отключает кэш.
+	UserCacheTTL time.Duration `yaml:"user_cache_ttl"`
+}
+
+// Storage содержит конфигурацию хранилища задач и кэша результатов
+type Storage struct {
+	// Type — тип хранилища: "memory" (данные теряются при перезапуске) или "bolt"
+	// (встроенная база на диске).
+	Type string `yaml:"type"`
+	// Path — путь к файлу базы для типа "bolt".
+	Path string `yaml:"path"`
+}
+
+// Webhook содержит конфигурацию уведомлений о завершении задач (callback_url)
+type Webhook struct {
+	// Secret — ключ подписи уведомлений HMAC-SHA256. Пустой ключ отключает уведомления.
+	// Может быть задан переменной окружения WEBHOOK_SECRET.
+	Secret string `yaml:"secret"`
+	// PublicURL — внешний адрес сервера для ссылки на результат в уведомлении.
+	// Если не задан, уведомление не содержит ссылку на результат.
+	PublicURL string `yaml:"public_url"`
+	// AllowPrivateNetworks разрешает callback_url во внутренней сети сервера: loopback,
+	// частные сети и link-local, включая адрес метаданных облака. По умолчанию запрещено.
+	AllowPrivateNetworks bool `yaml:"allow_private_networks"`
+	// Timeout — таймаут одной попытки доставки.
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxAttempts — максимальное количество попыток доставки.
+	MaxAttempts int `yaml:"max_attempts"`
+	// InitialBackoff — пауза перед второй попыткой; каждая следующая пауза удваивается.
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	// MaxBackoff — максимальная пауза между попытками.
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+}
+
+// Auth содержит конфигурацию доступа к API по ключам
+type Auth struct {
+	// Keys — ключи доступа. Если ни одного ключа не задано, API доступен без аутентификации.
+	Keys []APIKey `yaml:"keys"`
+	// KeysFile — путь к YAML-файлу с дополнительными ключами (секция keys в том же формате),
+	// чтобы не хранить ключи в config.yml.
+	KeysFile string `yaml:"keys_file"`
+}
+
+// APIKey описывает ключ доступа к API и его суточные квоты.
+// Сутки отсчитываются по UTC; нулевая квота означает отсутствие ограничения.
+type APIKey struct {
+	// Name — имя владельца ключа. Задачи принадлежат владельцу и недоступны другим ключам.
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+	// DailyUploads — сколько задач можно создать через /process за сутки.
+	DailyUploads int `yaml:"daily_uploads"`
+	// DailyLookups — сколько участников можно найти по username при обогащении за сутки.
+	// Участник расходует одну единицу, сколько бы запросов к Telegram API и повторов ни
+	// потребовалось. Участники без username и из кэша профилей не учитываются.
+	DailyLookups int `yaml:"daily_lookups"`
+	// Admin разрешает ключу доступ к /api/v1/admin.
+	Admin bool `yaml:"admin"`
 }
 
 // Logging содержит конфигурацию логирования
@@ -56,13 +186,33 @@ type Logging struct {
 	Format string `yaml:"format"` // json, text
 }
 
+// Tracing содержит конфигурацию трассировки OpenTelemetry
+type Tracing struct {
+	// Exporter — куда отправлять трассы: "otlp" (коллектор OTLP/HTTP), "stdout"
+	// (стандартный вывод, для локальной отладки) или пустая строка, чтобы не записывать трассы.
+	Exporter string `yaml:"exporter"`
+	// Endpoint — адрес коллектора OTLP (host:port). Если не задан, используется
+	// переменная окружения OTEL_EXPORTER_OTLP_ENDPOINT или localhost:4318.
+	Endpoint string `yaml:"endpoint"`
+	// Insecure отключает TLS при подключении к коллектору.
+	Insecure bool `yaml:"insecure"`
+	// SampleRatio — доля записываемых трасс от 0 до 1.
+	SampleRatio float64 `yaml:"sample_ratio"`
+	// ServiceName — имя сервиса в трассах.
+	ServiceName string `yaml:"service_name"`
+}
+
 // Config содержит конфигурацию приложения
 type Config struct {
 	Server      Server      `yaml:"server"`
 	TelegramAPI TelegramAPI `yaml:"telegram_api"`
 	Processing  Processing  `yaml:"processing"`
 	Enrichment  Enrichment  `yaml:"enrichment"`
+	Storage     Storage     `yaml:"storage"`
+	Webhook     Webhook     `yaml:"webhook"`
+	Auth        Auth        `yaml:"auth"`
 	Logging     Logging     `yaml:"logging"`
+	Tracing     Tracing     `yaml:"tracing"`
 }
 
 // GetTelegramServers возвращает список конфигураций серверов Telegram.
@@ -83,6 +233,14 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("failed to load configuration: %w", err)
 	}
 
+	// Ключ подписи лучше не хранить в config.yml рядом с остальными настройками.
+	cfg.Webhook.Secret = getEnv("WEBHOOK_SECRET", cfg.Webhook.Secret)
+	cfg.TelegramAPI.SessionKey = getEnv("TELEGRAM_SESSION_KEY", cfg.TelegramAPI.SessionKey)
+
+	if err := cfg.Auth.loadKeysFile(); err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
 	cfg.SetDefaults()
 	return cfg, nil
 }
@@ -105,6 +263,30 @@ func loadFromYAML(filename string, cfg *Config) error {
 	return nil
 }
 
+// loadKeysFile добавляет к ключам из config.yml ключи из auth.keys_file.
+func (a *Auth) loadKeysFile() error {
+	if a.KeysFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(a.KeysFile)
+	if err != nil {
+		return fmt.Errorf("failed to read keys file %s: %w", a.KeysFile, err)
+	}
+	var file struct {
+		Keys []APIKey `yaml:"keys"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse keys file %s: %w", a.KeysFile, err)
+	}
+	a.Keys = append(a.Keys, file.Keys...)
+	return nil
+}
+
+// Enabled сообщает, включена ли аутентификация по ключам.
+func (a Auth) Enabled() bool {
+	return len(a.Keys) > 0
+}
+
 // SetDefaults устанавливает значения по умолчанию для конфигурации
 func (c *Config) SetDefaults() {
 	if c.Logging.Format == "" {
@@ -126,20 +308,41 @@ func defaultConfig() *Config {
 		},
 		TelegramAPI: TelegramAPI{
 			HealthCheckInterval: DefaultHealthCheckInterval,
+			Strategy:            DefaultRouterStrategy,
+			SessionStorage:      DefaultSessionStorage,
 		},
 		Processing: Processing{
-			TaskTimeout: DefaultTaskTimeout,
-			CacheTTL:    DefaultCacheTTL,
+			TaskTimeout:           DefaultTaskTimeout,
+			CacheTTL:              DefaultCacheTTL,
+			MaxArchiveEntries:     DefaultMaxArchiveEntries,
+			MaxArchiveExtractedMB: DefaultMaxArchiveExtractedMB,
+			MaxConcurrentTasks:    DefaultMaxConcurrentTasks,
+			MaxQueuedTasks:        DefaultMaxQueuedTasks,
 		},
 		Enrichment: Enrichment{
 			PoolSize:         DefaultEnrichmentPoolSize,
 			ClientRetryPause: DefaultEnrichmentClientRetryPause,
 			OperationTimeout: DefaultEnrichmentOperationTimeout,
+			UserCacheTTL:     DefaultEnrichmentUserCacheTTL,
+		},
+		Storage: Storage{
+			Type: DefaultStorageType,
+			Path: DefaultStoragePath,
+		},
+		Webhook: Webhook{
+			Timeout:        DefaultWebhookTimeout,
+			MaxAttempts:    DefaultWebhookMaxAttempts,
+			InitialBackoff: DefaultWebhookInitialBackoff,
+			MaxBackoff:     DefaultWebhookMaxBackoff,
 		},
 		Logging: Logging{
 			Level:  DefaultLogLevel,
 			Format: DefaultLogFormat,
 		},
+		Tracing: Tracing{
+			SampleRatio: DefaultTracingSampleRatio,
+			ServiceName: DefaultTracingServiceName,
+		},
 	}
 }
 
@@ -156,6 +359,8 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("telegram_api configuration not found or empty")
 	}
 
+	phones := make(map[string]struct{}, len(servers))
+	enabled := 0
 	for i, s := range servers {
 		if s.APIID <= 0 {
 			return fmt.Errorf("telegram_api.servers[%d].api_id must be a positive integer", i)
@@ -166,6 +371,35 @@ func (c *Config) Validate() error {
 		if s.PhoneNumber == "" {
 			return fmt.Errorf("telegram_api.servers[%d].phone_number cannot be empty", i)
 		}
+		// Номер телефона идентифицирует аккаунт при перезагрузке пула.
+		if _, ok := phones[s.PhoneNumber]; ok {
+			return fmt.Errorf("telegram_api.servers[%d].phone_number %q is duplicated", i, s.PhoneNumber)
+		}
+		phones[s.PhoneNumber] = struct{}{}
+		if !s.Disabled {
+			enabled++
+		}
+		if s.Weight < 0 {
+			return fmt.Errorf("telegram_api.servers[%d].weight must be non-negative", i)
+		}
+		switch s.LoginMethod {
+		case "", "code", "qr":
+		default:
+			return fmt.Errorf("telegram_api.servers[%d].login_method must be one of: code, qr (empty means code)", i)
+		}
+		prefix := fmt.Sprintf("telegram_api.servers[%d].rate_limits", i)
+		if err := s.RateLimits.Requests.validate(prefix + ".requests"); err != nil {
+			return err
+		}
+		if err := s.RateLimits.ResolveUsername.validate(prefix + ".resolve_username"); err != nil {
+			return err
+		}
+		if err := s.RateLimits.GetFullUser.validate(prefix + ".get_full_user"); err != nil {
+			return err
+		}
+	}
+	if enabled == 0 {
+		return fmt.Errorf("telegram_api.servers: all servers are disabled")
 	}
 
 	// Валидация остальных полей
@@ -185,10 +419,49 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("processing.cache_ttl must be positive")
 	}
 
+	if c.Processing.MaxArchiveEntries <= 0 {
+		return fmt.Errorf("processing.max_archive_entries must be positive")
+	}
+
+	if c.Processing.MaxArchiveExtractedMB <= 0 {
+		return fmt.Errorf("processing.max_archive_extracted_mb must be positive")
+	}
+
+	if c.Processing.MaxConcurrentTasks <= 0 {
+		return fmt.Errorf("processing.max_concurrent_tasks must be positive")
+	}
+
+	if c.Processing.MaxQueuedTasks <= 0 {
+		return fmt.Errorf("processing.max_queued_tasks must be positive")
+	}
+
 	if c.TelegramAPI.HealthCheckInterval <= 0 {
 		return fmt.Errorf("telegram_api.health_check_interval must be positive")
 	}
 
+	switch c.TelegramAPI.Strategy {
+	case "round_robin", "least_in_flight", "weighted", "least_flood_waited":
+	default:
+		return fmt.Errorf("telegram_api.strategy must be one of: round_robin, least_in_flight, weighted, least_flood_waited")
+	}
+
+	if _, err := c.TelegramAPI.DecodeSessionKey(); err != nil {
+		return err
+	}
+	switch c.TelegramAPI.SessionStorage {
+	case "file":
+	case "encrypted_file":
+		if c.TelegramAPI.SessionKey == "" {
+			return fmt.Errorf("telegram_api.session_key (or TELEGRAM_SESSION_KEY) is required for encrypted_file session storage")
+		}
+	case "bolt":
+		if c.Storage.Type != storage.TypeBolt {
+			return fmt.Errorf("telegram_api.session_storage bolt requires storage.type bolt")
+		}
+	default:
+		return fmt.Errorf("telegram_api.session_storage must be one of: file, encrypted_file, bolt")
+	}
+
 	if c.Enrichment.PoolSize <= 0 {
 		return fmt.Errorf("enrichment.pool_size must be positive")
 	}
@@ -197,6 +470,60 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("enrichment.client_retry_pause must be positive")
 	}
 
+	if c.Enrichment.UserCacheTTL < 0 {
+		return fmt.Errorf("enrichment.user_cache_ttl must be non-negative (0 disables the cache)")
+	}
+
+	switch c.Storage.Type {
+	case storage.TypeMemory:
+	case storage.TypeBolt:
+		if c.Storage.Path == "" {
+			return fmt.Errorf("storage.path cannot be empty for bolt storage")
+		}
+	default:
+		return fmt.Errorf("storage.type must be one of: memory, bolt")
+	}
+
+	if c.Webhook.PublicURL != "" {
+		u, err := url.Parse(c.Webhook.PublicURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook.public_url must be an absolute http(s) URL")
+		}
+	}
+
+	if c.Webhook.Timeout <= 0 {
+		return fmt.Errorf("webhook.timeout must be positive")
+	}
+
+	if c.Webhook.MaxAttempts <= 0 {
+		return fmt.Errorf("webhook.max_attempts must be positive")
+	}
+
+	if c.Webhook.InitialBackoff <= 0 || c.Webhook.MaxBackoff < c.Webhook.InitialBackoff {
+		return fmt.Errorf("webhook.initial_backoff must be positive and not greater than webhook.max_backoff")
+	}
+
+	names := make(map[string]bool, len(c.Auth.Keys))
+	keys := make(map[string]bool, len(c.Auth.Keys))
+	for i, k := range c.Auth.Keys {
+		if k.Name == "" {
+			return fmt.Errorf("auth.keys[%d].name cannot be empty", i)
+		}
+		if k.Key == "" {
+			return fmt.Errorf("auth.keys[%d].key cannot be empty", i)
+		}
+		if names[k.Name] {
+			return fmt.Errorf("auth.keys[%d].name %q is not unique", i, k.Name)
+		}
+		if keys[k.Key] {
+			return fmt.Errorf("auth.keys[%d].key is not unique", i)
+		}
+		if k.DailyUploads < 0 || k.DailyLookups < 0 {
+			return fmt.Errorf("auth.keys[%d] quotas must be non-negative (0 for no limits)", i)
+		}
+		names[k.Name], keys[k.Key] = true, true
+	}
+
 	switch c.Logging.Level {
 	case "debug", "info", "warn", "error":
 		// all good
@@ -211,6 +538,16 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("logging.format must be one of: text, json (empty means text)")
 	}
 
+	switch c.Tracing.Exporter {
+	case "", "otlp", "stdout":
+	default:
+		return fmt.Errorf("tracing.exporter must be one of: otlp, stdout (empty disables tracing)")
+	}
+
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("tracing.sample_ratio must be between 0 and 1")
+	}
+
 	return nil
 }
 
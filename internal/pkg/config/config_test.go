@@ -23,6 +23,9 @@ telegram_api:
       api_hash: "hash1"
       phone_number: "+111"
       session_file: "tg1.session"
+      rate_limits:
+        requests: {per_minute: 60, burst: 5}
+        resolve_username: {per_minute: 2}
     - api_id: 67890
       api_hash: "hash2"
       phone_number: "+222"
@@ -87,6 +90,11 @@ func TestLoadFromYAML(t *testing.T) {
 		assert.Equal(t, "hash1", cfg.TelegramAPI.Servers[0].APIHash)
 		assert.Equal(t, 67890, cfg.TelegramAPI.Servers[1].APIID)
 		assert.Equal(t, "hash2", cfg.TelegramAPI.Servers[1].APIHash)
+		assert.Equal(t, RateLimits{
+			Requests:        RateLimit{PerMinute: 60, Burst: 5},
+			ResolveUsername: RateLimit{PerMinute: 2},
+		}, cfg.TelegramAPI.Servers[0].RateLimits)
+		assert.Zero(t, cfg.TelegramAPI.Servers[1].RateLimits)
 		assert.Equal(t, 60*time.Second, cfg.TelegramAPI.HealthCheckInterval)
 
 		assert.Equal(t, 120*time.Second, cfg.Processing.TaskTimeout)
@@ -109,6 +117,23 @@ func TestLoadFromYAML(t *testing.T) {
 		err := loadFromYAML(path, cfg)
 		assert.Error(t, err)
 	})
+
+	t.Run("api keys from keys file", func(t *testing.T) {
+		keysFile := createTempConfigFile(t, "keys:\n  - name: ci\n    key: ci-key\n    daily_lookups: 500\n")
+		cfg := defaultConfig()
+		err := loadFromYAML(createTempConfigFile(t, "auth:\n  keys_file: "+keysFile+"\n  keys:\n    - name: admin\n      key: admin-key\n"), cfg)
+		require.NoError(t, err)
+		require.NoError(t, cfg.Auth.loadKeysFile())
+
+		assert.True(t, cfg.Auth.Enabled())
+		assert.Equal(t, []APIKey{
+			{Name: "admin", Key: "admin-key"},
+			{Name: "ci", Key: "ci-key", DailyLookups: 500},
+		}, cfg.Auth.Keys)
+
+		cfg.Auth.KeysFile = "non_existent_keys.yml"
+		assert.Error(t, cfg.Auth.loadKeysFile())
+	})
 }
 
 func TestGetTelegramServers(t *testing.T) {
@@ -129,6 +154,9 @@ func TestGetTelegramServers(t *testing.T) {
 	})
 }
 
+// testSessionKey — 32 байта в base64.
+const testSessionKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+
 func TestValidate(t *testing.T) {
 	validConfig := func(t *testing.T) *Config {
 		cfg := defaultConfig()
@@ -147,15 +175,76 @@ func TestValidate(t *testing.T) {
 		{"invalid server api_id", func(c *Config) { c.TelegramAPI.Servers[0].APIID = 0 }, true},
 		{"empty server api_hash", func(c *Config) { c.TelegramAPI.Servers[0].APIHash = "" }, true},
 		{"empty server phone", func(c *Config) { c.TelegramAPI.Servers[0].PhoneNumber = "" }, true},
+		{"server rate limits", func(c *Config) {
+			c.TelegramAPI.Servers[0].RateLimits = RateLimits{
+				Requests:        RateLimit{PerMinute: 60, Burst: 5},
+				ResolveUsername: RateLimit{PerMinute: 2},
+			}
+		}, false},
+		{"disabled server", func(c *Config) { c.TelegramAPI.Servers[0].Disabled = true }, false},
+		{"all servers disabled", func(c *Config) {
+			c.TelegramAPI.Servers[0].Disabled = true
+			c.TelegramAPI.Servers[1].Disabled = true
+		}, true},
+		{"duplicate server phone", func(c *Config) { c.TelegramAPI.Servers[1].PhoneNumber = c.TelegramAPI.Servers[0].PhoneNumber }, true},
+		{"server weight", func(c *Config) { c.TelegramAPI.Servers[0].Weight = 3 }, false},
+		{"negative server weight", func(c *Config) { c.TelegramAPI.Servers[0].Weight = -1 }, true},
+		{"qr login", func(c *Config) { c.TelegramAPI.Servers[0].LoginMethod = "qr" }, false},
+		{"unknown login method", func(c *Config) { c.TelegramAPI.Servers[0].LoginMethod = "sms" }, true},
+		{"weighted strategy", func(c *Config) { c.TelegramAPI.Strategy = "weighted" }, false},
+		{"invalid strategy", func(c *Config) { c.TelegramAPI.Strategy = "random" }, true},
+		{"encrypted session storage", func(c *Config) {
+			c.TelegramAPI.SessionStorage = "encrypted_file"
+			c.TelegramAPI.SessionKey = testSessionKey
+		}, false},
+		{"encrypted session storage without key", func(c *Config) { c.TelegramAPI.SessionStorage = "encrypted_file" }, true},
+		{"session key not base64", func(c *Config) { c.TelegramAPI.SessionKey = "not a key!" }, true},
+		{"short session key", func(c *Config) { c.TelegramAPI.SessionKey = "c2hvcnQ=" }, true},
+		{"bolt session storage", func(c *Config) {
+			c.TelegramAPI.SessionStorage = "bolt"
+			c.Storage.Type = "bolt"
+		}, false},
+		{"bolt session storage without bolt storage", func(c *Config) { c.TelegramAPI.SessionStorage = "bolt" }, true},
+		{"invalid session storage", func(c *Config) { c.TelegramAPI.SessionStorage = "redis" }, true},
+		{"negative rate limit", func(c *Config) { c.TelegramAPI.Servers[0].RateLimits.GetFullUser.PerMinute = -1 }, true},
+		{"negative rate limit burst", func(c *Config) { c.TelegramAPI.Servers[0].RateLimits.Requests.Burst = -1 }, true},
 		{"invalid port", func(c *Config) { c.Server.Port = 0 }, true},
 		{"invalid shutdown timeout", func(c *Config) { c.Server.ShutdownTimeout = 0 }, true},
 		{"invalid task_timeout", func(c *Config) { c.Processing.TaskTimeout = -1 }, true},
 		{"invalid cache_ttl", func(c *Config) { c.Processing.CacheTTL = 0 }, true},
+		{"invalid max_archive_entries", func(c *Config) { c.Processing.MaxArchiveEntries = 0 }, true},
+		{"invalid max_archive_extracted_mb", func(c *Config) { c.Processing.MaxArchiveExtractedMB = 0 }, true},
+		{"invalid max_concurrent_tasks", func(c *Config) { c.Processing.MaxConcurrentTasks = 0 }, true},
+		{"invalid max_queued_tasks", func(c *Config) { c.Processing.MaxQueuedTasks = 0 }, true},
 		{"invalid health_check", func(c *Config) { c.TelegramAPI.HealthCheckInterval = 0 }, true},
 		{"invalid pool_size", func(c *Config) { c.Enrichment.PoolSize = 0 }, true},
 		{"invalid retry_pause", func(c *Config) { c.Enrichment.ClientRetryPause = 0 }, true},
+		{"disabled user_cache_ttl", func(c *Config) { c.Enrichment.UserCacheTTL = 0 }, false},
+		{"invalid user_cache_ttl", func(c *Config) { c.Enrichment.UserCacheTTL = -time.Second }, true},
+		{"bolt storage", func(c *Config) { c.Storage.Type = "bolt" }, false},
+		{"invalid storage type", func(c *Config) { c.Storage.Type = "redis" }, true},
+		{"empty bolt storage path", func(c *Config) { c.Storage.Type = "bolt"; c.Storage.Path = "" }, true},
+		{"webhook public_url", func(c *Config) { c.Webhook.PublicURL = "https://parser.example.com" }, false},
+		{"relative webhook public_url", func(c *Config) { c.Webhook.PublicURL = "parser.example.com" }, true},
+		{"invalid webhook timeout", func(c *Config) { c.Webhook.Timeout = 0 }, true},
+		{"invalid webhook max_attempts", func(c *Config) { c.Webhook.MaxAttempts = 0 }, true},
+		{"webhook max_backoff below initial", func(c *Config) { c.Webhook.MaxBackoff = c.Webhook.InitialBackoff / 2 }, true},
+		{"api keys", func(c *Config) {
+			c.Auth.Keys = []APIKey{{Name: "a", Key: "ka", DailyUploads: 10}, {Name: "b", Key: "kb"}}
+		}, false},
+		{"empty api key", func(c *Config) { c.Auth.Keys = []APIKey{{Name: "a"}} }, true},
+		{"duplicate api key name", func(c *Config) {
+			c.Auth.Keys = []APIKey{{Name: "a", Key: "ka"}, {Name: "a", Key: "kb"}}
+		}, true},
+		{"duplicate api key", func(c *Config) {
+			c.Auth.Keys = []APIKey{{Name: "a", Key: "k"}, {Name: "b", Key: "k"}}
+		}, true},
+		{"negative api key quota", func(c *Config) { c.Auth.Keys = []APIKey{{Name: "a", Key: "k", DailyLookups: -1}} }, true},
 		{"invalid logging level", func(c *Config) { c.Logging.Level = "wrong" }, true},
 		{"invalid logging format", func(c *Config) { c.Logging.Format = "xml" }, true}, // добавляем проверку нового поля
+		{"otlp tracing", func(c *Config) { c.Tracing.Exporter = "otlp"; c.Tracing.SampleRatio = 0.1 }, false},
+		{"invalid tracing exporter", func(c *Config) { c.Tracing.Exporter = "jaeger" }, true},
+		{"invalid tracing sample_ratio", func(c *Config) { c.Tracing.SampleRatio = 1.5 }, true},
 	}
 
 	for _, tc := range testCases {
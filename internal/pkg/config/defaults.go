@@ -1,6 +1,10 @@
 package config
 
-import "time"
+import (
+	"time"
+
+	"telegram-chat-parser/internal/storage"
+)
 
 // Default values for configuration.
 const (
@@ -15,19 +19,40 @@ const (
 	DefaultCleanupInterval = 1 * time.Hour
 
 	// Processing defaults
-	DefaultTaskTimeout = 600 * time.Second
-	DefaultCacheTTL    = 60 * time.Minute
+	DefaultTaskTimeout           = 600 * time.Second
+	DefaultCacheTTL              = 60 * time.Minute
+	DefaultMaxArchiveEntries     = 100000
+	DefaultMaxArchiveExtractedMB = 4096
+	DefaultMaxConcurrentTasks    = 2
+	DefaultMaxQueuedTasks        = 100
 
 	// Telegram API defaults
 	DefaultHealthCheckInterval  = 30 * time.Second
 	DefaultTelegramRequestDelay = 0 * time.Second
+	DefaultRouterStrategy       = "round_robin"
+	DefaultSessionStorage       = "file"
 
 	// Enrichment defaults
 	DefaultEnrichmentPoolSize         = 1
 	DefaultEnrichmentClientRetryPause = 1 * time.Second
 	DefaultEnrichmentOperationTimeout = 5 * time.Second
+	DefaultEnrichmentUserCacheTTL     = 24 * time.Hour
+
+	// Storage defaults
+	DefaultStorageType = storage.TypeMemory
+	DefaultStoragePath = "data/storage.db"
+
+	// Webhook defaults
+	DefaultWebhookTimeout        = 10 * time.Second
+	DefaultWebhookMaxAttempts    = 5
+	DefaultWebhookInitialBackoff = 1 * time.Second
+	DefaultWebhookMaxBackoff     = 1 * time.Minute
 
 	// Logging defaults
 	DefaultLogLevel  = "info"
 	DefaultLogFormat = "json"
+
+	// Tracing defaults
+	DefaultTracingSampleRatio = 1.0
+	DefaultTracingServiceName = "telegram-chat-parser"
 )
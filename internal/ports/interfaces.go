@@ -2,6 +2,7 @@ package ports
 
 import (
 	"context"
+	"io"
 	"telegram-chat-parser/internal/domain"
 )
 
@@ -17,18 +18,59 @@ type Parser interface {
 	Parse(data []byte) (*domain.ExportedChat, error)
 }
 
+// StreamParser определяет интерфейс для потокового разбора данных чата.
+// Реализации не загружают весь экспорт в память, а передают сообщения по одному.
+type StreamParser interface {
+	// ParseStream читает данные из r и вызывает fn для каждого сообщения.
+	// Возвращает метаданные чата без списка сообщений.
+	ParseStream(r io.Reader, fn func(msg *domain.Message) error) (*domain.ExportedChat, error)
+}
+
+// MultiChatParser определяет интерфейс для потокового разбора экспорта, который может
+// содержать несколько чатов, например полного экспорта аккаунта Telegram.
+type MultiChatParser interface {
+	// ParseChats читает данные из r и вызывает fn для каждого сообщения чатов,
+	// удовлетворяющих filter. Возвращает сведения обо всех чатах экспорта,
+	// включая не прошедшие фильтр.
+	ParseChats(r io.Reader, filter domain.ChatFilter, fn func(chat *domain.ChatInfo, msg *domain.Message) error) ([]domain.ChatInfo, error)
+}
+
+// ParticipantCollector накапливает уникальных участников по мере поступления сообщений.
+type ParticipantCollector interface {
+	// Add обрабатывает одно сообщение.
+	Add(msg *domain.Message)
+	// Participants возвращает всех накопленных участников.
+	Participants() []domain.RawParticipant
+}
+
 // ExtractionService определяет интерфейс для извлечения "сырых" данных
 // об участниках из структуры чата.
 type ExtractionService interface {
 	ExtractRawParticipants(chat *domain.ExportedChat) ([]domain.RawParticipant, error)
+	// NewCollector создает коллектор для инкрементального извлечения участников
+	// из потока сообщений.
+	NewCollector() ParticipantCollector
 }
 
 // EnrichmentService определяет интерфейс для обогащения данных об участниках
 // с помощью Telegram API.
+// При неполной обработке Enrich возвращает частичный результат вместе с
+// *domain.PartialResultError.
 type EnrichmentService interface {
 	Enrich(ctx context.Context, participants []domain.RawParticipant) ([]domain.User, error)
 }
 
+// UserCache хранит обогащенные профили пользователей между задачами, чтобы повторно
+// встречающиеся пользователи не требовали вызовов Telegram API.
+type UserCache interface {
+	// GetByID возвращает профиль пользователя по Telegram ID.
+	GetByID(id int64) (domain.User, bool)
+	// GetByUsername возвращает профиль пользователя по username (без учета регистра и "@").
+	GetByUsername(username string) (domain.User, bool)
+	// Put сохраняет профиль пользователя под его ID и username.
+	Put(user domain.User)
+}
+
 // Exporter определяет интерфейс для вывода результата.
 type Exporter interface {
 	// Export принимает финальный список пользователей и выводит их.
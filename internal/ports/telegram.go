@@ -2,6 +2,7 @@ package ports
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/gotd/td/tg"
@@ -18,6 +19,62 @@ type TelegramClient interface {
 	GetRecoveryTime() time.Time
 }
 
+// Методы Telegram API, для которых клиент ведет отдельный бюджет запросов.
+const (
+	MethodContactsResolveUsername = "contacts.resolveUsername"
+	MethodUsersGetFullUser        = "users.getFullUser"
+	MethodUsersGetUsers           = "users.getUsers"
+)
+
+// ErrRateLimited возвращается клиентом, когда бюджет запросов исчерпан и дождаться его
+// пополнения не позволяет контекст запроса. Клиент при этом остается работоспособным.
+var ErrRateLimited = errors.New("client request budget exhausted")
+
+// RateLimitedClient реализуется клиентами с ограничением частоты запросов.
+// Роутер использует его, чтобы выбирать клиентов с оставшимся бюджетом.
+type RateLimitedClient interface {
+	// RateBudget возвращает, сколько запросов method клиент может выполнить без ожидания.
+	RateBudget(method string) float64
+}
+
+// InFlightClient реализуется клиентами, которые считают выполняемые запросы.
+type InFlightClient interface {
+	// InFlight возвращает количество запросов, выполняемых или ожидающих выполнения.
+	InFlight() int
+}
+
+// FloodWaitClient реализуется клиентами, которые помнят последнюю ошибку FLOOD_WAIT.
+type FloodWaitClient interface {
+	// LastFloodWait возвращает время последнего FLOOD_WAIT или нулевое время.
+	LastFloodWait() time.Time
+}
+
+// StoppableClient реализуется клиентами с фоновым процессом, запускаемым Start.
+type StoppableClient interface {
+	// Stopped возвращает канал, который закрывается после завершения фонового процесса клиента.
+	Stopped() <-chan struct{}
+}
+
+// WeightedClient реализуется клиентами с весом, заданным в конфигурации.
+type WeightedClient interface {
+	// Weight возвращает относительную долю запросов, которую должен получать клиент.
+	Weight() int
+}
+
+type methodContextKey struct{}
+
+// ContextWithMethod возвращает контекст, сообщающий роутеру, какой метод API будет
+// вызван у полученного клиента.
+func ContextWithMethod(ctx context.Context, method string) context.Context {
+	return context.WithValue(ctx, methodContextKey{}, method)
+}
+
+// MethodFromContext возвращает метод API из контекста или пустую строку.
+func MethodFromContext(ctx context.Context) string {
+	method, _ := ctx.Value(methodContextKey{}).(string)
+	return method
+}
+
 // Router определяет интерфейс для роутера клиентов Telegram.
 type Router interface {
 	GetClient(ctx context.Context) (TelegramClient, error)
@@ -29,3 +86,9 @@ type Router interface {
 type Strategy interface {
 	Next(clients []TelegramClient) (TelegramClient, error)
 }
+
+// StatefulStrategy реализуется стратегиями, которые хранят состояние клиентов между выборами.
+type StatefulStrategy interface {
+	// Forget удаляет состояние клиента, удаленного из пула.
+	Forget(clientID string)
+}
@@ -0,0 +1,193 @@
+// Package progress отслеживает ход обработки задачи: разбор файлов и обогащение участников.
+// Трекер передается через контекст, поэтому use case и сервис обогащения сообщают
+// о прогрессе, не зная, кто его читает.
+package progress
+
+import (
+	"context"
+	"sync"
+	"telegram-chat-parser/internal/domain"
+	"time"
+)
+
+// Этапы обработки задачи.
+const (
+	// StageQueued — задача ждет свободного места в очереди задач.
+	StageQueued    = "queued"
+	StageParsing   = "parsing"
+	StageEnriching = "enriching"
+	StageFinished  = "finished"
+)
+
+// Snapshot — состояние прогресса задачи на момент запроса.
+type Snapshot struct {
+	Stage           string `json:"stage"`
+	FilesTotal      int    `json:"files_total"`
+	FilesParsed     int    `json:"files_parsed"`
+	MessagesScanned int64  `json:"messages_scanned"`
+	// RawParticipants — участники, найденные в файлах, до дедупликации.
+	RawParticipants int `json:"raw_participants"`
+	// ParticipantsTotal — уникальные участники, переданные на обогащение.
+	ParticipantsTotal int `json:"participants_total"`
+	Enriched          int `json:"enriched"`
+	// Requeued — сколько раз участники возвращались в очередь после временной ошибки.
+	Requeued   int `json:"requeued"`
+	Unresolved int `json:"unresolved"`
+	// ETASeconds — оценка оставшегося времени обогащения по текущей скорости
+	// обработки участников клиентами Telegram. Отсутствует, пока скорость неизвестна.
+	ETASeconds *int64 `json:"eta_seconds,omitempty"`
+}
+
+// Tracker накапливает прогресс одной задачи и обогащенных пользователей по мере их
+// получения. Безопасен для одновременного использования; методы nil-трекера ничего
+// не делают, поэтому код обработки не проверяет его наличие.
+type Tracker struct {
+	mutex         sync.Mutex
+	snapshot      Snapshot
+	users         []domain.User
+	changed       chan struct{}
+	enrichStarted time.Time
+	now           func() time.Time
+}
+
+// NewTracker создает трекер задачи, ожидающей в очереди.
+func NewTracker() *Tracker {
+	return &Tracker{
+		snapshot: Snapshot{Stage: StageQueued},
+		changed:  make(chan struct{}),
+		now:      time.Now,
+	}
+}
+
+type contextKey struct{}
+
+// NewContext возвращает контекст, несущий трекер t.
+func NewContext(ctx context.Context, t *Tracker) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// FromContext возвращает трекер из контекста или nil, если его нет.
+func FromContext(ctx context.Context) *Tracker {
+	t, _ := ctx.Value(contextKey{}).(*Tracker)
+	return t
+}
+
+// SetFilesTotal задает количество файлов задачи (после распаковки архивов)
+// и переводит задачу на этап разбора.
+func (t *Tracker) SetFilesTotal(n int) {
+	t.update(func(s *Snapshot) {
+		s.Stage = StageParsing
+		s.FilesTotal = n
+	})
+}
+
+// FileParsed учитывает разобранный файл и найденных в нем участников.
+func (t *Tracker) FileParsed(rawParticipants int) {
+	t.update(func(s *Snapshot) {
+		s.FilesParsed++
+		s.RawParticipants += rawParticipants
+	})
+}
+
+// MessagesScanned учитывает n просмотренных сообщений.
+func (t *Tracker) MessagesScanned(n int) {
+	t.update(func(s *Snapshot) { s.MessagesScanned += int64(n) })
+}
+
+// EnrichmentStarted переводит задачу на этап обогащения total уникальных участников.
+func (t *Tracker) EnrichmentStarted(total int) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.snapshot.Stage = StageEnriching
+	t.snapshot.ParticipantsTotal = total
+	t.enrichStarted = t.now()
+	t.notify()
+}
+
+// Enriched учитывает обогащенного участника. Пользователи сохраняются в порядке
+// получения, еще до объединения дубликатов в итоговом результате.
+func (t *Tracker) Enriched(user domain.User) {
+	t.update(func(s *Snapshot) {
+		s.Enriched++
+		t.users = append(t.users, user)
+	})
+}
+
+// Requeued учитывает возврат участника в очередь.
+func (t *Tracker) Requeued() {
+	t.update(func(s *Snapshot) { s.Requeued++ })
+}
+
+// Unresolved учитывает n участников, не попавших в результат.
+func (t *Tracker) Unresolved(n int) {
+	t.update(func(s *Snapshot) { s.Unresolved += n })
+}
+
+// Finish отмечает завершение обработки.
+func (t *Tracker) Finish() {
+	t.update(func(s *Snapshot) { s.Stage = StageFinished })
+}
+
+// Users возвращает пользователей, обогащенных после первых from.
+func (t *Tracker) Users(from int) []domain.User {
+	if t == nil {
+		return nil
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if from >= len(t.users) {
+		return nil
+	}
+	return append([]domain.User(nil), t.users[from:]...)
+}
+
+// Changed возвращает канал, который закрывается при следующем изменении прогресса.
+// После срабатывания канал нужно запросить заново.
+func (t *Tracker) Changed() <-chan struct{} {
+	if t == nil {
+		return nil
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.changed
+}
+
+// Snapshot возвращает текущее состояние прогресса с оценкой оставшегося времени.
+func (t *Tracker) Snapshot() Snapshot {
+	if t == nil {
+		return Snapshot{}
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	s := t.snapshot
+	if s.Stage == StageEnriching {
+		done := s.Enriched + s.Unresolved
+		remaining := s.ParticipantsTotal - done
+		elapsed := t.now().Sub(t.enrichStarted)
+		if done > 0 && remaining > 0 && elapsed > 0 {
+			eta := int64((elapsed * time.Duration(remaining) / time.Duration(done)).Round(time.Second) / time.Second)
+			s.ETASeconds = &eta
+		}
+	}
+	return s
+}
+
+func (t *Tracker) update(fn func(s *Snapshot)) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	fn(&t.snapshot)
+	t.notify()
+}
+
+// notify будит ожидающих изменений. Вызывается под мьютексом.
+func (t *Tracker) notify() {
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
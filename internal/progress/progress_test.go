@@ -0,0 +1,100 @@
+package progress
+
+import (
+	"context"
+	"telegram-chat-parser/internal/domain"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracker(t *testing.T) {
+	t.Run("Накопление прогресса", func(t *testing.T) {
+		now := time.Unix(1000, 0)
+		tr := NewTracker()
+		tr.now = func() time.Time { return now }
+		assert.Equal(t, StageQueued, tr.Snapshot().Stage)
+
+		tr.SetFilesTotal(2)
+		tr.MessagesScanned(100)
+		tr.FileParsed(30)
+		tr.MessagesScanned(50)
+		tr.FileParsed(20)
+
+		s := tr.Snapshot()
+		assert.Equal(t, StageParsing, s.Stage)
+		assert.Equal(t, 2, s.FilesTotal)
+		assert.Equal(t, 2, s.FilesParsed)
+		assert.Equal(t, int64(150), s.MessagesScanned)
+		assert.Equal(t, 50, s.RawParticipants)
+		assert.Nil(t, s.ETASeconds)
+
+		tr.EnrichmentStarted(40)
+		assert.Nil(t, tr.Snapshot().ETASeconds, "скорость еще неизвестна")
+
+		// За 10 секунд обработано 10 участников: оставшиеся 30 займут 30 секунд.
+		now = now.Add(10 * time.Second)
+		for i := 0; i < 8; i++ {
+			tr.Enriched(domain.User{ID: int64(i)})
+		}
+		tr.Unresolved(2)
+		tr.Requeued()
+
+		s = tr.Snapshot()
+		assert.Equal(t, StageEnriching, s.Stage)
+		assert.Equal(t, 40, s.ParticipantsTotal)
+		assert.Equal(t, 8, s.Enriched)
+		assert.Equal(t, 2, s.Unresolved)
+		assert.Equal(t, 1, s.Requeued)
+		if assert.NotNil(t, s.ETASeconds) {
+			assert.Equal(t, int64(30), *s.ETASeconds)
+		}
+
+		tr.Finish()
+		s = tr.Snapshot()
+		assert.Equal(t, StageFinished, s.Stage)
+		assert.Nil(t, s.ETASeconds)
+	})
+
+	t.Run("Пользователи и уведомления об изменениях", func(t *testing.T) {
+		tr := NewTracker()
+		changed := tr.Changed()
+
+		tr.Enriched(domain.User{ID: 1})
+		select {
+		case <-changed:
+		default:
+			t.Fatal("канал изменений не закрыт")
+		}
+		assert.NotEqual(t, changed, tr.Changed(), "после изменения выдается новый канал")
+
+		tr.Enriched(domain.User{ID: 2})
+		tr.Enriched(domain.User{ID: 3})
+		assert.Len(t, tr.Users(0), 3)
+		assert.Equal(t, []domain.User{{ID: 2}, {ID: 3}}, tr.Users(1))
+		assert.Nil(t, tr.Users(3))
+	})
+
+	t.Run("Трекер в контексте", func(t *testing.T) {
+		assert.Nil(t, FromContext(context.Background()))
+
+		tr := NewTracker()
+		assert.Same(t, tr, FromContext(NewContext(context.Background(), tr)))
+	})
+
+	t.Run("nil-трекер ничего не делает", func(t *testing.T) {
+		var tr *Tracker
+		tr.SetFilesTotal(1)
+		tr.FileParsed(1)
+		tr.MessagesScanned(1)
+		tr.EnrichmentStarted(1)
+		tr.Enriched(domain.User{})
+		tr.Requeued()
+		tr.Unresolved(1)
+		tr.Finish()
+		assert.Equal(t, Snapshot{}, tr.Snapshot())
+		assert.Nil(t, tr.Users(0))
+		assert.Nil(t, tr.Changed())
+	})
+}
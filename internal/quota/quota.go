@@ -0,0 +1,236 @@
+// Package quota учитывает суточные квоты ключей API: созданные задачи и участников,
+// найденных по username при обогащении. Счетчики хранятся в storage.Store и сбрасываются
+// в полночь по UTC. Квота задачи передается через контекст, поэтому сервис обогащения
+// списывает участников, не зная, какому ключу принадлежит задача.
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"telegram-chat-parser/internal/storage"
+	"time"
+)
+
+// Виды квот.
+const (
+	// KindUploads — задачи, созданные через /process.
+	KindUploads = "uploads"
+	// KindLookups — участники, найденные по username при обогащении: по одному на
+	// участника, независимо от числа запросов к Telegram API.
+	KindLookups = "lookups"
+)
+
+// ErrExceeded возвращается, когда суточная квота исчерпана.
+var ErrExceeded = errors.New("daily quota exceeded")
+
+// Limits — суточные квоты владельца. Нулевое значение означает отсутствие ограничения.
+type Limits struct {
+	Uploads int
+	Lookups int
+}
+
+func (l Limits) of(kind string) int {
+	switch kind {
+	case KindUploads:
+		return l.Uploads
+	case KindLookups:
+		return l.Lookups
+	}
+	return 0
+}
+
+// Counter — расход квоты за текущие сутки. Limit 0 означает отсутствие ограничения.
+type Counter struct {
+	Used  int `json:"used"`
+	Limit int `json:"limit"`
+}
+
+// Usage — расход квот владельца за текущие сутки.
+type Usage struct {
+	Uploads Counter   `json:"uploads"`
+	Lookups Counter   `json:"lookups"`
+	ResetAt time.Time `json:"reset_at"`
+}
+
+// Manager ведет суточные счетчики квот всех владельцев.
+type Manager struct {
+	mutex sync.Mutex
+	store storage.Store[int]
+	now   func() time.Time
+}
+
+// NewManager создает менеджер квот со счетчиками в памяти.
+func NewManager() *Manager {
+	return NewManagerWithStorage(storage.NewMemoryStore[int]())
+}
+
+// NewManagerWithStorage создает менеджер квот поверх указанного хранилища.
+func NewManagerWithStorage(store storage.Store[int]) *Manager {
+	return &Manager{store: store, now: time.Now}
+}
+
+// Take списывает единицу квоты kind владельца owner. Если лимит limit за текущие
+// сутки уже израсходован, возвращает ErrExceeded и ничего не списывает.
+func (m *Manager) Take(owner, kind string, limit int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.now()
+	key := counterKey(owner, kind, now)
+	used, err := m.used(key)
+	if err != nil {
+		return err
+	}
+	if limit > 0 && used >= limit {
+		return fmt.Errorf("%w: %d %s per day", ErrExceeded, limit, kind)
+	}
+	// Счетчик нужен только до конца суток.
+	if err := m.store.Put(key, used+1, nextDay(now)); err != nil {
+		return fmt.Errorf("не удалось сохранить счетчик квоты %s: %w", key, err)
+	}
+	return nil
+}
+
+// Refund возвращает единицу квоты kind владельца owner, списанную Take за текущие
+// сутки, например когда задача в итоге не была принята.
+func (m *Manager) Refund(owner, kind string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.now()
+	key := counterKey(owner, kind, now)
+	used, err := m.used(key)
+	if err != nil || used == 0 {
+		return err
+	}
+	if err := m.store.Put(key, used-1, nextDay(now)); err != nil {
+		return fmt.Errorf("не удалось сохранить счетчик квоты %s: %w", key, err)
+	}
+	return nil
+}
+
+// Usage возвращает расход квот владельца за текущие сутки.
+func (m *Manager) Usage(owner string, limits Limits) (Usage, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.now()
+	usage := Usage{
+		Uploads: Counter{Limit: limits.Uploads},
+		Lookups: Counter{Limit: limits.Lookups},
+		ResetAt: nextDay(now),
+	}
+	var err error
+	if usage.Uploads.Used, err = m.used(counterKey(owner, KindUploads, now)); err != nil {
+		return Usage{}, err
+	}
+	if usage.Lookups.Used, err = m.used(counterKey(owner, KindLookups, now)); err != nil {
+		return Usage{}, err
+	}
+	return usage, nil
+}
+
+// ResetAt возвращает момент сброса счетчиков — ближайшую полночь по UTC.
+func (m *Manager) ResetAt() time.Time {
+	return nextDay(m.now())
+}
+
+// Account возвращает квоты владельца для передачи в обработку задачи.
+func (m *Manager) Account(owner string, limits Limits) *Account {
+	return &Account{manager: m, owner: owner, limits: limits}
+}
+
+// CleanupExpired удаляет счетчики прошедших суток
+func (m *Manager) CleanupExpired() {
+	removed, err := m.store.DeleteExpired(m.now())
+	if err != nil {
+		slog.Error("failed to cleanup expired quota counters", "error", err)
+		return
+	}
+	if removed > 0 {
+		slog.Debug("expired quota counters removed", "count", removed)
+	}
+}
+
+// StartCleanupTicker запускает тикер для периодической очистки счетчиков прошедших суток
+func (m *Manager) StartCleanupTicker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.CleanupExpired()
+			}
+		}
+	}()
+}
+
+func (m *Manager) used(key string) (int, error) {
+	used, err := m.store.Get(key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("не удалось прочитать счетчик квоты %s: %w", key, err)
+	}
+	return used, nil
+}
+
+// Account — квоты одного владельца. Методы nil-аккаунта ничего не ограничивают,
+// поэтому код обработки не проверяет, включены ли квоты.
+type Account struct {
+	manager *Manager
+	owner   string
+	limits  Limits
+}
+
+// Take списывает единицу квоты kind. Возвращает ErrExceeded, если квота исчерпана.
+// Ошибки хранилища только логируются: сбой учета не должен прерывать обработку.
+func (a *Account) Take(kind string) error {
+	if a == nil {
+		return nil
+	}
+	err := a.manager.Take(a.owner, kind, a.limits.of(kind))
+	if err != nil && !errors.Is(err, ErrExceeded) {
+		slog.Error("failed to take quota", "owner", a.owner, "kind", kind, "error", err)
+		return nil
+	}
+	return err
+}
+
+// Refund возвращает единицу квоты kind, списанную Take. Ошибки хранилища только логируются.
+func (a *Account) Refund(kind string) {
+	if a == nil {
+		return
+	}
+	if err := a.manager.Refund(a.owner, kind); err != nil {
+		slog.Error("failed to refund quota", "owner", a.owner, "kind", kind, "error", err)
+	}
+}
+
+type contextKey struct{}
+
+// NewContext возвращает контекст, несущий квоты a.
+func NewContext(ctx context.Context, a *Account) context.Context {
+	return context.WithValue(ctx, contextKey{}, a)
+}
+
+// FromContext возвращает квоты из контекста или nil, если их нет.
+func FromContext(ctx context.Context) *Account {
+	a, _ := ctx.Value(contextKey{}).(*Account)
+	return a
+}
+
+func counterKey(owner, kind string, now time.Time) string {
+	return owner + "/" + kind + "/" + now.UTC().Format(time.DateOnly)
+}
+
+func nextDay(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
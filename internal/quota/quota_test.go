@@ -0,0 +1,83 @@
+package quota
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager(t *testing.T) {
+	t.Run("Списание и исчерпание квоты", func(t *testing.T) {
+		m := NewManager()
+		now := time.Date(2026, 10, 16, 23, 59, 0, 0, time.UTC)
+		m.now = func() time.Time { return now }
+
+		require.NoError(t, m.Take("ci", KindUploads, 2))
+		require.NoError(t, m.Take("ci", KindUploads, 2))
+		assert.ErrorIs(t, m.Take("ci", KindUploads, 2), ErrExceeded)
+
+		// Квоты разных владельцев и видов независимы.
+		assert.NoError(t, m.Take("other", KindUploads, 2))
+		assert.NoError(t, m.Take("ci", KindLookups, 2))
+
+		usage, err := m.Usage("ci", Limits{Uploads: 2})
+		require.NoError(t, err)
+		assert.Equal(t, Counter{Used: 2, Limit: 2}, usage.Uploads)
+		assert.Equal(t, Counter{Used: 1}, usage.Lookups)
+		assert.Equal(t, time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC), usage.ResetAt)
+
+		// В полночь по UTC счетчики сбрасываются.
+		now = now.Add(2 * time.Minute)
+		assert.NoError(t, m.Take("ci", KindUploads, 2))
+		m.CleanupExpired()
+		usage, err = m.Usage("ci", Limits{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, usage.Uploads.Used)
+		assert.Zero(t, usage.Lookups.Used)
+	})
+
+	t.Run("Возврат квоты", func(t *testing.T) {
+		m := NewManager()
+		require.NoError(t, m.Take("ci", KindUploads, 1))
+		assert.ErrorIs(t, m.Take("ci", KindUploads, 1), ErrExceeded)
+
+		require.NoError(t, m.Refund("ci", KindUploads))
+		require.NoError(t, m.Take("ci", KindUploads, 1))
+
+		// Возврат без списания не уводит счетчик ниже нуля.
+		require.NoError(t, m.Refund("ci", KindLookups))
+		usage, err := m.Usage("ci", Limits{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, usage.Uploads.Used)
+		assert.Zero(t, usage.Lookups.Used)
+	})
+
+	t.Run("Нулевой лимит не ограничивает", func(t *testing.T) {
+		m := NewManager()
+		for i := 0; i < 100; i++ {
+			require.NoError(t, m.Take("ci", KindLookups, 0))
+		}
+	})
+}
+
+func TestAccount(t *testing.T) {
+	t.Run("Квоты в контексте", func(t *testing.T) {
+		assert.Nil(t, FromContext(context.Background()))
+
+		a := NewManager().Account("ci", Limits{Lookups: 1})
+		ctx := NewContext(context.Background(), a)
+		assert.Same(t, a, FromContext(ctx))
+		assert.NoError(t, FromContext(ctx).Take(KindLookups))
+		assert.ErrorIs(t, FromContext(ctx).Take(KindLookups), ErrExceeded)
+		assert.NoError(t, FromContext(ctx).Take(KindUploads))
+	})
+
+	t.Run("nil-аккаунт не ограничивает", func(t *testing.T) {
+		var a *Account
+		assert.NoError(t, a.Take(KindLookups))
+		a.Refund(KindLookups)
+	})
+}
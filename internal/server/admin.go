@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"telegram-chat-parser/internal/telegram"
+	"telegram-chat-parser/internal/telegram/router"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// PoolReloadFunc перечитывает конфигурацию и применяет список аккаунтов Telegram к пулу клиентов.
+type PoolReloadFunc func(ctx context.Context) (router.ReloadResult, error)
+
+// WithPoolReload включает эндпоинт перезагрузки пула клиентов Telegram.
+func WithPoolReload(f PoolReloadFunc) Option {
+	return func(s *Server) {
+		s.reloadPool = f
+	}
+}
+
+// ClientPool — пул клиентов Telegram, состояние которого доступно администратору.
+type ClientPool interface {
+	Clients() []router.ClientStatus
+	Client(id string) (router.ClientStatus, error)
+	CheckClient(ctx context.Context, id string) error
+	Quarantine(id string, d time.Duration) error
+	SubmitAuthCode(id, code string) error
+	SubmitAuthPassword(id, password string) error
+	AuthQRCode(id string) ([]byte, error)
+}
+
+// WithClientPool включает эндпоинты просмотра и управления пулом клиентов Telegram.
+func WithClientPool(p ClientPool) Option {
+	return func(s *Server) {
+		s.clientPool = p
+	}
+}
+
+// adminRoutes регистрирует эндпоинты администрирования.
+func (s *Server) adminRoutes(r chi.Router) {
+	if s.reloadPool != nil {
+		// Перезагрузка пула аккаунтов из config.yml, как по сигналу SIGHUP
+		r.Post("/clients/reload", func(w http.ResponseWriter, r *http.Request) {
+			res, err := s.reloadPool(r.Context())
+			if err != nil {
+				slog.Error("Failed to reload telegram client pool", "error", err)
+				http.Error(w, "Failed to reload client pool: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(res)
+		})
+	}
+
+	if s.clientPool != nil {
+		pool := s.clientPool
+
+		// Состояние всех клиентов пула
+		r.Get("/clients", func(w http.ResponseWriter, r *http.Request) {
+			clients := pool.Clients()
+			healthy := 0
+			for _, c := range clients {
+				if c.State == router.ClientStateHealthy {
+					healthy++
+				}
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(struct {
+				Healthy   int                   `json:"healthy"`
+				Unhealthy int                   `json:"unhealthy"`
+				Clients   []router.ClientStatus `json:"clients"`
+			}{Healthy: healthy, Unhealthy: len(clients) - healthy, Clients: clients})
+		})
+
+		// Принудительная проверка работоспособности; работоспособный клиент возвращается в пул
+		r.Post("/clients/{clientID}/check", func(w http.ResponseWriter, r *http.Request) {
+			clientID := chi.URLParam(r, "clientID")
+			if err := pool.CheckClient(r.Context(), clientID); err != nil {
+				if errors.Is(err, router.ErrClientNotFound) {
+					http.Error(w, err.Error(), http.StatusNotFound)
+					return
+				}
+				// Неудачная проверка отражается в состоянии клиента.
+				slog.Warn("Forced client health check failed", "client_id", clientID, "error", err)
+			}
+			writeClientStatus(w, pool, clientID)
+		})
+
+		// Исключение клиента из пула на время duration (по умолчанию — до принудительной проверки)
+		r.Post("/clients/{clientID}/quarantine", func(w http.ResponseWriter, r *http.Request) {
+			clientID := chi.URLParam(r, "clientID")
+			var duration time.Duration
+			if raw := r.URL.Query().Get("duration"); raw != "" {
+				var err error
+				if duration, err = time.ParseDuration(raw); err != nil || duration < 0 {
+					http.Error(w, "Invalid duration: expected a non-negative Go duration such as 30m", http.StatusBadRequest)
+					return
+				}
+			}
+			if err := pool.Quarantine(clientID, duration); err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			writeClientStatus(w, pool, clientID)
+		})
+
+		// Код подтверждения для входа в аккаунт, когда сервер запущен без терминала
+		r.Post("/clients/{clientID}/auth/code", func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				Code string `json:"code"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+				http.Error(w, "Code is required", http.StatusBadRequest)
+				return
+			}
+			clientID := chi.URLParam(r, "clientID")
+			if !submitAuth(w, pool.SubmitAuthCode(clientID, req.Code)) {
+				return
+			}
+			writeClientStatus(w, pool, clientID)
+		})
+
+		// Пароль 2FA для входа в аккаунт
+		r.Post("/clients/{clientID}/auth/password", func(w http.ResponseWriter, r *http.Request) {
+			var req struct {
+				Password string `json:"password"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Password == "" {
+				http.Error(w, "Password is required", http.StatusBadRequest)
+				return
+			}
+			clientID := chi.URLParam(r, "clientID")
+			if !submitAuth(w, pool.SubmitAuthPassword(clientID, req.Password)) {
+				return
+			}
+			writeClientStatus(w, pool, clientID)
+		})
+
+		// QR-код для входа в аккаунт: его нужно отсканировать в приложении Telegram
+		r.Get("/clients/{clientID}/auth/qr", func(w http.ResponseWriter, r *http.Request) {
+			png, err := pool.AuthQRCode(chi.URLParam(r, "clientID"))
+			if !submitAuth(w, err) {
+				return
+			}
+			// Код действует около 30 секунд и заменяется новым, поэтому не кешируется.
+			w.Header().Set("Content-Type", "image/png")
+			w.Header().Set("Cache-Control", "no-store")
+			_, _ = w.Write(png)
+		})
+	}
+}
+
+// submitAuth отвечает ошибкой шага входа (кода, пароля или QR-кода) и сообщает, был ли он успешным.
+func submitAuth(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, router.ErrClientNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, telegram.ErrAuthNotPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	return false
+}
+
+// writeClientStatus отвечает текущим состоянием клиента пула.
+func writeClientStatus(w http.ResponseWriter, pool ClientPool, clientID string) {
+	status, err := pool.Client(clientID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,268 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"telegram-chat-parser/internal/cache"
+	"telegram-chat-parser/internal/pkg/config"
+	"telegram-chat-parser/internal/telegram"
+	"telegram-chat-parser/internal/telegram/router"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_AdminPoolReload(t *testing.T) {
+	cfg := &config.Config{
+		Server:     config.Server{CleanupInterval: time.Minute},
+		Processing: config.Processing{CacheTTL: time.Minute, MaxConcurrentTasks: 1, MaxQueuedTasks: 1},
+		Auth: config.Auth{Keys: []config.APIKey{
+			{Name: "ops", Key: "ops-key", Admin: true},
+			{Name: "ci", Key: "ci-key"},
+		}},
+	}
+	var reloadErr error
+	reload := func(context.Context) (router.ReloadResult, error) {
+		return router.ReloadResult{Added: 1, Unchanged: 2}, reloadErr
+	}
+	srv, err := New(cfg, new(mockProcessor), NewTaskStore(), cache.NewCacheStore(), WithPoolReload(reload))
+	require.NoError(t, err)
+
+	do := func(srv *Server, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v1/admin/clients/reload", nil)
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Ключ администратора", func(t *testing.T) {
+		rr := do(srv, "ops-key")
+		require.Equal(t, http.StatusOK, rr.Code)
+		var res router.ReloadResult
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res))
+		assert.Equal(t, router.ReloadResult{Added: 1, Unchanged: 2}, res)
+	})
+
+	t.Run("Обычный ключ", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, do(srv, "ci-key").Code)
+		assert.Equal(t, http.StatusUnauthorized, do(srv, "").Code)
+	})
+
+	t.Run("Ошибка перезагрузки", func(t *testing.T) {
+		reloadErr = errors.New("config validation failed")
+		defer func() { reloadErr = nil }()
+		rr := do(srv, "ops-key")
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.Contains(t, rr.Body.String(), "config validation failed")
+	})
+
+	t.Run("Перезагрузка не настроена", func(t *testing.T) {
+		srv, err := New(cfg, new(mockProcessor), NewTaskStore(), cache.NewCacheStore())
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, do(srv, "ops-key").Code)
+	})
+}
+
+// fakeClientPool — пул клиентов с фиксированным состоянием.
+type fakeClientPool struct {
+	clients     map[string]router.ClientStatus
+	checkErr    error
+	quarantined map[string]time.Duration
+	submitted   map[string]string
+}
+
+func (p *fakeClientPool) Clients() []router.ClientStatus {
+	return []router.ClientStatus{p.clients["c1"], p.clients["c2"]}
+}
+
+func (p *fakeClientPool) Client(id string) (router.ClientStatus, error) {
+	status, ok := p.clients[id]
+	if !ok {
+		return router.ClientStatus{}, router.ErrClientNotFound
+	}
+	return status, nil
+}
+
+func (p *fakeClientPool) CheckClient(_ context.Context, id string) error {
+	if _, ok := p.clients[id]; !ok {
+		return router.ErrClientNotFound
+	}
+	return p.checkErr
+}
+
+func (p *fakeClientPool) Quarantine(id string, d time.Duration) error {
+	if _, ok := p.clients[id]; !ok {
+		return router.ErrClientNotFound
+	}
+	p.quarantined[id] = d
+	return nil
+}
+
+func (p *fakeClientPool) SubmitAuthCode(id, code string) error {
+	return p.submitAuth(id, "code", code)
+}
+
+func (p *fakeClientPool) SubmitAuthPassword(id, password string) error {
+	return p.submitAuth(id, "password", password)
+}
+
+func (p *fakeClientPool) AuthQRCode(id string) ([]byte, error) {
+	if err := p.submitAuth(id, "qr", ""); err != nil {
+		return nil, err
+	}
+	return []byte("\x89PNG\r\n\x1a\n"), nil
+}
+
+// submitAuth принимает код и пароль только для клиентов, ожидающих входа.
+func (p *fakeClientPool) submitAuth(id, kind, value string) error {
+	status, ok := p.clients[id]
+	if !ok {
+		return router.ErrClientNotFound
+	}
+	if status.Auth == nil {
+		return telegram.ErrAuthNotPending
+	}
+	p.submitted[id+"/"+kind] = value
+	return nil
+}
+
+func TestServer_AdminClients(t *testing.T) {
+	cfg := &config.Config{
+		Server:     config.Server{CleanupInterval: time.Minute},
+		Processing: config.Processing{CacheTTL: time.Minute, MaxConcurrentTasks: 1, MaxQueuedTasks: 1},
+		Auth:       config.Auth{Keys: []config.APIKey{{Name: "ops", Key: "ops-key", Admin: true}}},
+	}
+	pool := &fakeClientPool{
+		clients: map[string]router.ClientStatus{
+			"c1": {ID: "c1", Phone: "+79*******67", State: router.ClientStateHealthy,
+				Requests: map[string]router.RequestCounter{"contacts.resolveUsername": {Total: 3, Errors: 1}}},
+			"c2": {ID: "c2", Phone: "+79*******02", State: router.ClientStateQuarantined},
+			"c3": {ID: "c3", Phone: "+79*******03", State: router.ClientStateUnhealthy,
+				Auth: &telegram.AuthStatus{State: telegram.AuthStateWaitingCode, CodeType: "app"}},
+		},
+		quarantined: make(map[string]time.Duration),
+		submitted:   make(map[string]string),
+	}
+	srv, err := New(cfg, new(mockProcessor), NewTaskStore(), cache.NewCacheStore(), WithClientPool(pool))
+	require.NoError(t, err)
+
+	post := func(target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", target, strings.NewReader(body))
+		req.Header.Set(APIKeyHeader, "ops-key")
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+		return rr
+	}
+	do := func(method, target string) *httptest.ResponseRecorder {
+		if method == "POST" {
+			return post(target, "")
+		}
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set(APIKeyHeader, "ops-key")
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Состояние пула", func(t *testing.T) {
+		rr := do("GET", "/api/v1/admin/clients")
+		require.Equal(t, http.StatusOK, rr.Code)
+		var resp struct {
+			Healthy   int                   `json:"healthy"`
+			Unhealthy int                   `json:"unhealthy"`
+			Clients   []router.ClientStatus `json:"clients"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Equal(t, 1, resp.Healthy)
+		assert.Equal(t, 1, resp.Unhealthy)
+		assert.Equal(t, pool.Clients(), resp.Clients)
+	})
+
+	t.Run("Принудительная проверка", func(t *testing.T) {
+		rr := do("POST", "/api/v1/admin/clients/c1/check")
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"id":"c1"`)
+
+		// Неудачная проверка не является ошибкой запроса.
+		pool.checkErr = errors.New("FLOOD_WAIT (30)")
+		defer func() { pool.checkErr = nil }()
+		assert.Equal(t, http.StatusOK, do("POST", "/api/v1/admin/clients/c1/check").Code)
+
+		assert.Equal(t, http.StatusNotFound, do("POST", "/api/v1/admin/clients/unknown/check").Code)
+	})
+
+	t.Run("Карантин", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, do("POST", "/api/v1/admin/clients/c1/quarantine?duration=30m").Code)
+		assert.Equal(t, 30*time.Minute, pool.quarantined["c1"])
+
+		require.Equal(t, http.StatusOK, do("POST", "/api/v1/admin/clients/c2/quarantine").Code)
+		assert.Zero(t, pool.quarantined["c2"])
+
+		assert.Equal(t, http.StatusBadRequest, do("POST", "/api/v1/admin/clients/c1/quarantine?duration=soon").Code)
+		assert.Equal(t, http.StatusBadRequest, do("POST", "/api/v1/admin/clients/c1/quarantine?duration=-1m").Code)
+		assert.Equal(t, http.StatusNotFound, do("POST", "/api/v1/admin/clients/unknown/quarantine").Code)
+	})
+
+	t.Run("Вход в аккаунт", func(t *testing.T) {
+		rr := post("/api/v1/admin/clients/c3/auth/code", `{"code":"12345"}`)
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "12345", pool.submitted["c3/code"])
+		assert.Contains(t, rr.Body.String(), `"auth":{"state":"waiting_code"`)
+
+		require.Equal(t, http.StatusOK, post("/api/v1/admin/clients/c3/auth/password", `{"password":"secret"}`).Code)
+		assert.Equal(t, "secret", pool.submitted["c3/password"])
+
+		assert.Equal(t, http.StatusBadRequest, post("/api/v1/admin/clients/c3/auth/code", `{}`).Code)
+		assert.Equal(t, http.StatusBadRequest, post("/api/v1/admin/clients/c3/auth/password", `not json`).Code)
+		assert.Equal(t, http.StatusConflict, post("/api/v1/admin/clients/c1/auth/code", `{"code":"12345"}`).Code)
+		assert.Equal(t, http.StatusNotFound, post("/api/v1/admin/clients/unknown/auth/code", `{"code":"12345"}`).Code)
+	})
+
+	t.Run("QR-код для входа", func(t *testing.T) {
+		rr := do("GET", "/api/v1/admin/clients/c3/auth/qr")
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "image/png", rr.Header().Get("Content-Type"))
+		assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+		assert.True(t, bytes.HasPrefix(rr.Body.Bytes(), []byte("\x89PNG")))
+
+		assert.Equal(t, http.StatusConflict, do("GET", "/api/v1/admin/clients/c1/auth/qr").Code)
+		assert.Equal(t, http.StatusNotFound, do("GET", "/api/v1/admin/clients/unknown/auth/qr").Code)
+	})
+}
+
+func TestServer_AdminDisabledWithoutAdminKey(t *testing.T) {
+	reload := func(context.Context) (router.ReloadResult, error) { return router.ReloadResult{}, nil }
+	for name, keys := range map[string][]config.APIKey{
+		"Аутентификация отключена": nil,
+		"Нет ключа администратора": {{Name: "ci", Key: "ci-key"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := &config.Config{
+				Server:     config.Server{CleanupInterval: time.Minute},
+				Processing: config.Processing{CacheTTL: time.Minute, MaxConcurrentTasks: 1, MaxQueuedTasks: 1},
+				Auth:       config.Auth{Keys: keys},
+			}
+			srv, err := New(cfg, new(mockProcessor), NewTaskStore(), cache.NewCacheStore(),
+				WithPoolReload(reload), WithClientPool(&fakeClientPool{}))
+			require.NoError(t, err)
+
+			for _, target := range []string{"/api/v1/admin/clients/reload", "/api/v1/admin/clients/c1/auth/code"} {
+				req := httptest.NewRequest("POST", target, strings.NewReader(`{"code":"12345"}`))
+				req.Header.Set(APIKeyHeader, "ci-key")
+				rr := httptest.NewRecorder()
+				srv.HTTPServer.Handler.ServeHTTP(rr, req)
+				assert.Equal(t, http.StatusNotFound, rr.Code, target)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"telegram-chat-parser/internal/pkg/config"
+	"telegram-chat-parser/internal/quota"
+	"time"
+)
+
+const (
+	// APIKeyHeader — заголовок с ключом API, альтернатива "Authorization: Bearer <ключ>".
+	APIKeyHeader = "X-API-Key"
+	// QuotaExceededHeader содержит вид исчерпанной квоты в ответе 429, чтобы клиент мог
+	// отличить исчерпанную квоту от заполненной очереди задач.
+	QuotaExceededHeader = "X-Quota-Exceeded"
+)
+
+// apiKeys проверяет ключи доступа к API. Ключи хранятся по SHA-256, поэтому время
+// поиска не зависит от того, насколько присланный ключ похож на настоящий.
+type apiKeys struct {
+	byHash map[[sha256.Size]byte]config.APIKey
+}
+
+func newAPIKeys(keys []config.APIKey) *apiKeys {
+	k := &apiKeys{byHash: make(map[[sha256.Size]byte]config.APIKey, len(keys))}
+	for _, key := range keys {
+		k.byHash[sha256.Sum256([]byte(key.Key))] = key
+	}
+	return k
+}
+
+// enabled сообщает, настроен ли хотя бы один ключ. Без ключей API открыт, как и раньше.
+func (k *apiKeys) enabled() bool {
+	return len(k.byHash) > 0
+}
+
+// hasAdmin сообщает, настроен ли ключ администратора. Без него эндпоинты
+// администрирования не регистрируются: вход в аккаунты Telegram и управление пулом
+// не должны быть доступны без ключа.
+func (k *apiKeys) hasAdmin() bool {
+	for _, key := range k.byHash {
+		if key.Admin {
+			return true
+		}
+	}
+	return false
+}
+
+// middleware пропускает только запросы с известным ключом и сохраняет ключ в контексте запроса.
+func (k *apiKeys) middleware(next http.Handler) http.Handler {
+	if !k.enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := requestAPIKey(r)
+		if raw == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "API key is required", http.StatusUnauthorized)
+			return
+		}
+		key, ok := k.byHash[sha256.Sum256([]byte(raw))]
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+	})
+}
+
+// adminOnly пропускает только запросы с ключом администратора.
+func (k *apiKeys) adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key, _ := apiKeyFromContext(r.Context()); !key.Admin {
+			http.Error(w, "Admin API key is required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestAPIKey извлекает ключ из заголовка Authorization или X-API-Key.
+func requestAPIKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		scheme, token, found := strings.Cut(auth, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	return strings.TrimSpace(r.Header.Get(APIKeyHeader))
+}
+
+type apiKeyContextKey struct{}
+
+// apiKeyFromContext возвращает ключ, с которым выполнен запрос.
+// Если аутентификация отключена, ключа в контексте нет.
+func apiKeyFromContext(ctx context.Context) (config.APIKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey{}).(config.APIKey)
+	return key, ok
+}
+
+// requestOwner возвращает владельца задач, создаваемых запросом: имя ключа или
+// пустую строку, если аутентификация отключена.
+func requestOwner(r *http.Request) string {
+	key, _ := apiKeyFromContext(r.Context())
+	return key.Name
+}
+
+// getOwnedTask возвращает задачу, если она принадлежит владельцу запроса. Чужая задача
+// неотличима от отсутствующей, чтобы по ответу нельзя было проверить чужой ID.
+func getOwnedTask(taskStore *TaskStore, r *http.Request, taskID string) (*Task, error) {
+	task, err := taskStore.GetTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if task.Owner != requestOwner(r) {
+		return nil, fmt.Errorf("задача с ID %s не найдена", taskID)
+	}
+	return task, nil
+}
+
+// requestQuota возвращает квоты ключа запроса или nil, если аутентификация отключена.
+func requestQuota(quotas *quota.Manager, r *http.Request) *quota.Account {
+	key, ok := apiKeyFromContext(r.Context())
+	if !ok {
+		return nil
+	}
+	return quotas.Account(key.Name, quota.Limits{Uploads: key.DailyUploads, Lookups: key.DailyLookups})
+}
+
+// writeQuotaExceeded отвечает 429 Too Many Requests; Retry-After указывает на сброс квот.
+func writeQuotaExceeded(w http.ResponseWriter, quotas *quota.Manager, kind string, err error) {
+	retryAfter := max(time.Until(quotas.ResetAt()), time.Second)
+	w.Header().Set(QuotaExceededHeader, kind)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	http.Error(w, err.Error(), http.StatusTooManyRequests)
+}
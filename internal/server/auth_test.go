@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"telegram-chat-parser/internal/cache"
+	"telegram-chat-parser/internal/domain"
+	"telegram-chat-parser/internal/pkg/config"
+	"telegram-chat-parser/internal/quota"
+	"telegram-chat-parser/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestAPIKey(t *testing.T) {
+	testCases := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"bearer", map[string]string{"Authorization": "Bearer key-1"}, "key-1"},
+		{"bearer без учета регистра", map[string]string{"Authorization": "bearer  key-1 "}, "key-1"},
+		{"x-api-key", map[string]string{APIKeyHeader: "key-2"}, "key-2"},
+		{"другая схема", map[string]string{"Authorization": "Basic a2V5", APIKeyHeader: "key-2"}, ""},
+		{"без ключа", nil, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			assert.Equal(t, tc.want, requestAPIKey(req))
+		})
+	}
+}
+
+func TestServer_APIKeys(t *testing.T) {
+	cfg := &config.Config{
+		Server:     config.Server{CleanupInterval: time.Minute},
+		Processing: config.Processing{CacheTTL: time.Minute, MaxConcurrentTasks: 1, MaxQueuedTasks: 10},
+		Auth: config.Auth{Keys: []config.APIKey{
+			{Name: "alice", Key: "alice-key", DailyUploads: 1, DailyLookups: 5},
+			{Name: "bob", Key: "bob-key"},
+		}},
+	}
+	mockProc := new(mockProcessor)
+	srv, err := New(cfg, mockProc, NewTaskStore(), cache.NewCacheStore())
+	require.NoError(t, err)
+
+	do := func(method, target, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+		return rr
+	}
+	submit := func(key string) *httptest.ResponseRecorder {
+		body, contentType := newUploadForm(t, nil)
+		req := httptest.NewRequest("POST", "/api/v1/process", body)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set(APIKeyHeader, key)
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Запрос без ключа", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do("GET", "/health", "").Code, "health доступен без ключа")
+
+		rr := do("GET", "/api/v1/tasks/any", "")
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Equal(t, "Bearer", rr.Header().Get("WWW-Authenticate"))
+
+		assert.Equal(t, http.StatusUnauthorized, do("GET", "/api/v1/tasks/any", "wrong-key").Code)
+	})
+
+	var taskID string
+	t.Run("Задача доступна только владельцу", func(t *testing.T) {
+		lookups := make(chan error, 1)
+		mockProc.On("ProcessChat", mock.Anything, mock.AnythingOfType("[]string"), domain.ChatFilter{}).
+			Run(func(args mock.Arguments) {
+				// Квота ключа передается в обработку через контекст задачи.
+				lookups <- quota.FromContext(args.Get(0).(context.Context)).Take(quota.KindLookups)
+			}).
+			Return([]domain.User{{ID: 1}}, nil).Once()
+
+		rr := submit("alice-key")
+		require.Equal(t, http.StatusAccepted, rr.Code)
+		var created map[string]string
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+		taskID = created["task_id"]
+		require.NoError(t, <-lookups)
+
+		assert.Eventually(t, func() bool {
+			task, err := srv.taskStore.GetTask(taskID)
+			return err == nil && task.Status == TaskStatusCompleted
+		}, 5*time.Second, 10*time.Millisecond)
+
+		assert.Equal(t, http.StatusOK, do("GET", "/api/v1/tasks/"+taskID, "alice-key").Code)
+		assert.Equal(t, http.StatusOK, do("GET", "/api/v1/tasks/"+taskID+"/result", "alice-key").Code)
+
+		for _, target := range []string{"/api/v1/tasks/" + taskID, "/api/v1/tasks/" + taskID + "/result", "/api/v1/tasks/" + taskID + "/events"} {
+			assert.Equal(t, http.StatusNotFound, do("GET", target, "bob-key").Code, target)
+		}
+		assert.Equal(t, http.StatusNotFound, do("DELETE", "/api/v1/tasks/"+taskID, "bob-key").Code)
+		mockProc.AssertExpectations(t)
+	})
+
+	t.Run("Суточная квота задач", func(t *testing.T) {
+		rr := submit("alice-key")
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Equal(t, quota.KindUploads, rr.Header().Get(QuotaExceededHeader))
+		retryAfter, err := strconv.Atoi(rr.Header().Get("Retry-After"))
+		require.NoError(t, err)
+		assert.Positive(t, retryAfter)
+		assert.LessOrEqual(t, retryAfter, 24*60*60)
+	})
+
+	t.Run("Расход квот", func(t *testing.T) {
+		rr := do("GET", "/api/v1/quota", "alice-key")
+		require.Equal(t, http.StatusOK, rr.Code)
+		var resp struct {
+			Key     string        `json:"key"`
+			Uploads quota.Counter `json:"uploads"`
+			Lookups quota.Counter `json:"lookups"`
+			ResetAt time.Time     `json:"reset_at"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Equal(t, "alice", resp.Key)
+		assert.Equal(t, quota.Counter{Used: 1, Limit: 1}, resp.Uploads)
+		assert.Equal(t, quota.Counter{Used: 1, Limit: 5}, resp.Lookups)
+		assert.True(t, resp.ResetAt.After(time.Now()))
+	})
+
+	t.Run("Аутентификация отключена", func(t *testing.T) {
+		cfg := *cfg
+		cfg.Auth = config.Auth{}
+		srv, err := New(&cfg, mockProc, NewTaskStore(), cache.NewCacheStore())
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/quota", nil))
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+// failingTaskStorage не сохраняет новые задачи.
+type failingTaskStorage struct {
+	storage.Store[Task]
+}
+
+func (failingTaskStorage) Put(string, Task, time.Time) error {
+	return errors.New("disk full")
+}
+
+func TestServer_UploadQuotaRefund(t *testing.T) {
+	cfg := &config.Config{
+		Server:     config.Server{CleanupInterval: time.Minute},
+		Processing: config.Processing{CacheTTL: time.Minute, MaxConcurrentTasks: 1, MaxQueuedTasks: 10},
+		Auth:       config.Auth{Keys: []config.APIKey{{Name: "alice", Key: "alice-key", DailyUploads: 1}}},
+	}
+	quotas := quota.NewManager()
+	taskStore := NewTaskStoreWithStorage(failingTaskStorage{storage.NewMemoryStore[Task]()})
+	srv, err := New(cfg, new(mockProcessor), taskStore, cache.NewCacheStore(), WithQuotaManager(quotas))
+	require.NoError(t, err)
+
+	// Задача не создана, поэтому квота возвращается, и повторная попытка не упирается в лимит.
+	for i := 0; i < 2; i++ {
+		body, contentType := newUploadForm(t, nil)
+		req := httptest.NewRequest("POST", "/api/v1/process", body)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set(APIKeyHeader, "alice-key")
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	}
+	usage, err := quotas.Usage("alice", quota.Limits{Uploads: 1})
+	require.NoError(t, err)
+	assert.Zero(t, usage.Uploads.Used)
+}
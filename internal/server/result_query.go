@@ -0,0 +1,213 @@
+package server
+
+import (
+	"cmp"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"telegram-chat-parser/internal/domain"
+)
+
+// Поля сортировки результата.
+const (
+	SortByName     = "name"
+	SortByUsername = "username"
+	SortByID       = "id"
+	SortByActivity = "activity"
+)
+
+// ResultQuery описывает фильтрацию и сортировку результата задачи,
+// заданные параметрами запроса GET /api/v1/tasks/{taskID}/result.
+type ResultQuery struct {
+	// HasUsername, HasBio и HasChannel оставляют участников с заполненным (true)
+	// или пустым (false) полем. nil означает отсутствие условия.
+	HasUsername *bool
+	HasBio      *bool
+	HasChannel  *bool
+
+	// Name и Bio — подстроки без учета регистра.
+	Name string
+	Bio  string
+	// NameRegex и BioRegex — регулярные выражения для имени и описания.
+	NameRegex *regexp.Regexp
+	BioRegex  *regexp.Regexp
+
+	// MinID и MaxID ограничивают диапазон ID включительно. 0 означает отсутствие границы.
+	MinID int64
+	MaxID int64
+
+	// Sort — поле сортировки, пустое значение сохраняет исходный порядок.
+	Sort string
+	// Desc задает сортировку по убыванию.
+	Desc bool
+}
+
+// parseResultQuery разбирает параметры фильтрации и сортировки результата.
+// Сортировка по активности по умолчанию выполняется по убыванию, остальные — по возрастанию.
+func parseResultQuery(values url.Values) (ResultQuery, error) {
+	var (
+		q   ResultQuery
+		err error
+	)
+
+	if q.HasUsername, err = parseOptionalBool(values, "has_username"); err != nil {
+		return ResultQuery{}, err
+	}
+	if q.HasBio, err = parseOptionalBool(values, "has_bio"); err != nil {
+		return ResultQuery{}, err
+	}
+	if q.HasChannel, err = parseOptionalBool(values, "has_channel"); err != nil {
+		return ResultQuery{}, err
+	}
+
+	q.Name = strings.ToLower(strings.TrimSpace(values.Get("name")))
+	q.Bio = strings.ToLower(strings.TrimSpace(values.Get("bio")))
+	if q.NameRegex, err = parseOptionalRegexp(values, "name_regex"); err != nil {
+		return ResultQuery{}, err
+	}
+	if q.BioRegex, err = parseOptionalRegexp(values, "bio_regex"); err != nil {
+		return ResultQuery{}, err
+	}
+
+	if q.MinID, err = parseOptionalID(values, "min_id"); err != nil {
+		return ResultQuery{}, err
+	}
+	if q.MaxID, err = parseOptionalID(values, "max_id"); err != nil {
+		return ResultQuery{}, err
+	}
+	if q.MinID != 0 && q.MaxID != 0 && q.MinID > q.MaxID {
+		return ResultQuery{}, fmt.Errorf("min_id must not be greater than max_id")
+	}
+
+	switch q.Sort = strings.ToLower(values.Get("sort")); q.Sort {
+	case "", SortByName, SortByUsername, SortByID:
+	case SortByActivity:
+		q.Desc = true
+	default:
+		return ResultQuery{}, fmt.Errorf("invalid sort %q: expected one of name, username, id, activity", q.Sort)
+	}
+
+	switch order := strings.ToLower(values.Get("order")); order {
+	case "":
+	case "asc":
+		q.Desc = false
+	case "desc":
+		q.Desc = true
+	default:
+		return ResultQuery{}, fmt.Errorf("invalid order %q: expected asc or desc", order)
+	}
+
+	return q, nil
+}
+
+// Apply возвращает отфильтрованную и отсортированную копию users. Исходный срез не изменяется.
+func (q ResultQuery) Apply(users []domain.User) []domain.User {
+	result := make([]domain.User, 0, len(users))
+	for _, u := range users {
+		if q.Match(u) {
+			result = append(result, u)
+		}
+	}
+
+	if q.Sort != "" {
+		slices.SortStableFunc(result, func(a, b domain.User) int {
+			c := compareUsers(q.Sort, a, b)
+			if q.Desc {
+				return -c
+			}
+			return c
+		})
+	}
+	return result
+}
+
+// Match проверяет, удовлетворяет ли пользователь всем условиям фильтра.
+func (q ResultQuery) Match(u domain.User) bool {
+	if !matchPresence(q.HasUsername, u.Username) ||
+		!matchPresence(q.HasBio, u.Bio) ||
+		!matchPresence(q.HasChannel, u.Channel) {
+		return false
+	}
+	if q.Name != "" && !strings.Contains(strings.ToLower(u.Name), q.Name) {
+		return false
+	}
+	if q.Bio != "" && !strings.Contains(strings.ToLower(u.Bio), q.Bio) {
+		return false
+	}
+	if q.NameRegex != nil && !q.NameRegex.MatchString(u.Name) {
+		return false
+	}
+	if q.BioRegex != nil && !q.BioRegex.MatchString(u.Bio) {
+		return false
+	}
+	if q.MinID != 0 && u.ID < q.MinID {
+		return false
+	}
+	if q.MaxID != 0 && u.ID > q.MaxID {
+		return false
+	}
+	return true
+}
+
+// compareUsers сравнивает пользователей по полю сортировки. Активность сравнивается
+// по числу сообщений, затем по дате последнего сообщения и числу упоминаний.
+func compareUsers(field string, a, b domain.User) int {
+	switch field {
+	case SortByName:
+		return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	case SortByUsername:
+		return cmp.Compare(strings.ToLower(a.Username), strings.ToLower(b.Username))
+	case SortByID:
+		return cmp.Compare(a.ID, b.ID)
+	case SortByActivity:
+		return cmp.Or(
+			cmp.Compare(a.Activity.MessageCount, b.Activity.MessageCount),
+			cmp.Compare(a.Activity.LastMessageDate, b.Activity.LastMessageDate),
+			cmp.Compare(a.Activity.MentionCount, b.Activity.MentionCount),
+		)
+	}
+	return 0
+}
+
+func matchPresence(want *bool, value string) bool {
+	return want == nil || *want == (value != "")
+}
+
+func parseOptionalBool(values url.Values, key string) (*bool, error) {
+	raw := values.Get(key)
+	if raw == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q", key, raw)
+	}
+	return &v, nil
+}
+
+func parseOptionalRegexp(values url.Values, key string) (*regexp.Regexp, error) {
+	raw := values.Get(key)
+	if raw == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return re, nil
+}
+
+func parseOptionalID(values url.Values, key string) (int64, error) {
+	raw := values.Get(key)
+	if raw == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", key, raw)
+	}
+	return v, nil
+}
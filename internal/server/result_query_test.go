@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/url"
+	"telegram-chat-parser/internal/domain"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultQuery(t *testing.T) {
+	users := []domain.User{
+		{ID: 10, Name: "Иван Петров", Username: "ivan", Bio: "Go developer", Activity: domain.ActivityStats{MessageCount: 5}},
+		{ID: 20, Name: "anna", Bio: "Пишу в @anna_blog", Channel: "anna_blog", Activity: domain.ActivityStats{MessageCount: 12}},
+		{ID: 30, Name: "Boris", Username: "boris", Activity: domain.ActivityStats{MessageCount: 5, LastMessageDate: "2024-05-01T00:00:00"}},
+		{ID: 40, Name: "Вера", Username: "vera"},
+	}
+
+	ids := func(users []domain.User) []int64 {
+		result := make([]int64, 0, len(users))
+		for _, u := range users {
+			result = append(result, u.ID)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []int64
+	}{
+		{"Без параметров сохраняется исходный порядок", "", []int64{10, 20, 30, 40}},
+		{"Только с username", "has_username=true", []int64{10, 30, 40}},
+		{"Без username", "has_username=false", []int64{20}},
+		{"С bio и каналом", "has_bio=1&has_channel=1", []int64{20}},
+		{"Подстрока имени без учета регистра", "name=ПЕТР", []int64{10}},
+		{"Подстрока bio", "bio=developer", []int64{10}},
+		{"Регулярное выражение для имени", "name_regex=^[A-Za-z]", []int64{20, 30}},
+		{"Регулярное выражение для bio", "bio_regex=@[a-z_]{3}", []int64{20}},
+		{"Диапазон ID", "min_id=20&max_id=30", []int64{20, 30}},
+		{"Сортировка по имени", "sort=name", []int64{20, 30, 40, 10}},
+		{"Сортировка по username по убыванию", "sort=username&order=desc", []int64{40, 10, 30, 20}},
+		{"Сортировка по ID по убыванию", "sort=id&order=desc", []int64{40, 30, 20, 10}},
+		{"Сортировка по активности по умолчанию по убыванию", "sort=activity", []int64{20, 30, 10, 40}},
+		{"Фильтр и сортировка вместе", "has_username=true&sort=activity&order=asc", []int64{40, 10, 30}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			require.NoError(t, err)
+			q, err := parseResultQuery(values)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, ids(q.Apply(users)))
+		})
+	}
+
+	t.Run("Apply не изменяет исходный срез", func(t *testing.T) {
+		q, err := parseResultQuery(url.Values{"sort": {"id"}, "order": {"desc"}})
+		require.NoError(t, err)
+		q.Apply(users)
+		assert.Equal(t, []int64{10, 20, 30, 40}, ids(users))
+	})
+
+	invalid := []string{
+		"has_username=maybe",
+		"name_regex=(",
+		"min_id=abc",
+		"min_id=30&max_id=20",
+		"sort=bio",
+		"order=random",
+	}
+	for _, query := range invalid {
+		t.Run("Некорректный запрос "+query, func(t *testing.T) {
+			values, err := url.ParseQuery(query)
+			require.NoError(t, err)
+			_, err = parseResultQuery(values)
+			assert.Error(t, err)
+		})
+	}
+}
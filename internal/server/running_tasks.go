@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"telegram-chat-parser/internal/progress"
+)
+
+// runningTasks хранит функции отмены и трекеры прогресса задач, выполняющихся в этом процессе.
+type runningTasks struct {
+	tasks map[string]runningTask
+	mutex sync.Mutex
+}
+
+type runningTask struct {
+	cancel  context.CancelFunc
+	tracker *progress.Tracker
+	// done закрывается, когда задача завершена и ее итог сохранен.
+	done chan struct{}
+}
+
+func newRunningTasks() *runningTasks {
+	return &runningTasks{tasks: make(map[string]runningTask)}
+}
+
+// start создает контекст выполнения задачи с трекером прогресса. Возвращаемую функцию
+// done нужно вызвать по завершении задачи: она освобождает контекст и снимает задачу с учета.
+func (rt *runningTasks) start(taskID string) (ctx context.Context, done func()) {
+	tracker := progress.NewTracker()
+	ctx, cancel := context.WithCancel(progress.NewContext(context.Background(), tracker))
+
+	task := runningTask{cancel: cancel, tracker: tracker, done: make(chan struct{})}
+
+	rt.mutex.Lock()
+	rt.tasks[taskID] = task
+	rt.mutex.Unlock()
+
+	return ctx, func() {
+		rt.mutex.Lock()
+		delete(rt.tasks, taskID)
+		rt.mutex.Unlock()
+		cancel()
+		close(task.done)
+	}
+}
+
+// cancel отменяет контекст выполняющейся задачи. Возвращает false, если задача
+// не выполняется в этом процессе (еще не запущена, уже завершена или запущена до перезапуска).
+func (rt *runningTasks) cancel(taskID string) bool {
+	rt.mutex.Lock()
+	task, ok := rt.tasks[taskID]
+	rt.mutex.Unlock()
+
+	if ok {
+		task.cancel()
+	}
+	return ok
+}
+
+// cancelAll отменяет контексты всех выполняющихся задач, например при остановке сервера.
+func (rt *runningTasks) cancelAll() {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+	for _, task := range rt.tasks {
+		task.cancel()
+	}
+}
+
+// watch возвращает трекер выполняющейся задачи и канал, закрывающийся по ее завершении.
+func (rt *runningTasks) watch(taskID string) (*progress.Tracker, <-chan struct{}, bool) {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	task, ok := rt.tasks[taskID]
+	if !ok {
+		return nil, nil, false
+	}
+	return task.tracker, task.done, true
+}
+
+// progress возвращает текущий прогресс выполняющейся задачи.
+func (rt *runningTasks) progress(taskID string) (progress.Snapshot, bool) {
+	rt.mutex.Lock()
+	task, ok := rt.tasks[taskID]
+	rt.mutex.Unlock()
+
+	if !ok {
+		return progress.Snapshot{}, false
+	}
+	return task.tracker.Snapshot(), true
+}
@@ -3,23 +3,36 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"mime/multipart"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"telegram-chat-parser/internal/cache"
 	"telegram-chat-parser/internal/domain"
+	"telegram-chat-parser/internal/metrics"
 	"telegram-chat-parser/internal/pkg/config"
+	"telegram-chat-parser/internal/progress"
+	"telegram-chat-parser/internal/quota"
+	"telegram-chat-parser/internal/tracing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ChatProcessor определяет интерфейс для варианта использования, который обрабатывает чаты.
 type ChatProcessor interface {
-	ProcessChat(ctx context.Context, filePaths []string) ([]domain.User, error)
-	ProcessChatFromData(ctx context.Context, fileDataList [][]byte) ([]domain.User, error)
+	ProcessChat(ctx context.Context, filePaths []string, filter domain.ChatFilter) ([]domain.User, error)
+	ListChats(ctx context.Context, filePaths []string) ([]domain.ChatInfo, error)
 }
 
 // Server представляет HTTP-сервер
@@ -28,17 +41,59 @@ type Server struct {
 	cfg        *config.Config
 	taskStore  *TaskStore
 	cacheStore *cache.CacheStore
+	quotas     *quota.Manager
 	processor  ChatProcessor
+	reloadPool PoolReloadFunc
+	clientPool ClientPool
+	running    *runningTasks
+	queue      *taskQueue
+	webhooks   *webhookNotifier
+	// stopping отличает отмену задач при остановке сервера от отмены через DELETE.
+	stopping atomic.Bool
+}
+
+// Option — функциональная опция для настройки Server.
+type Option func(*Server)
+
+// WithQuotaManager задает менеджер суточных квот ключей API.
+// По умолчанию счетчики квот хранятся в памяти.
+func WithQuotaManager(m *quota.Manager) Option {
+	return func(s *Server) {
+		if m != nil {
+			s.quotas = m
+		}
+	}
 }
 
 // New создает новый экземпляр Server
-func New(cfg *config.Config, processor ChatProcessor, taskStore *TaskStore, cacheStore *cache.CacheStore) (*Server, error) {
+func New(cfg *config.Config, processor ChatProcessor, taskStore *TaskStore, cacheStore *cache.CacheStore, opts ...Option) (*Server, error) {
+	s := &Server{
+		cfg:        cfg,
+		taskStore:  taskStore,
+		cacheStore: cacheStore,
+		quotas:     quota.NewManager(),
+		processor:  processor,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	quotas := s.quotas
+
 	chiRouter := chi.NewRouter()
+	running := newRunningTasks()
+	webhooks := newWebhookNotifier(cfg.Webhook, taskStore)
+	queue := newTaskQueue(cfg.Processing.MaxConcurrentTasks, cfg.Processing.MaxQueuedTasks)
+	s.running, s.queue, s.webhooks = running, queue, webhooks
+	keys := newAPIKeys(cfg.Auth.Keys)
 
 	// Промежуточное ПО
+	chiRouter.Use(traceRequests)
 	chiRouter.Use(middleware.Logger)
 	chiRouter.Use(middleware.Recoverer)
 
+	// Метрики в формате Prometheus; доступны без ключа API, как и /health.
+	chiRouter.Method(http.MethodGet, "/metrics", metrics.Handler())
+
 	// Конечная точка для проверки работоспособности
 	chiRouter.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -50,10 +105,24 @@ func New(cfg *config.Config, processor ChatProcessor, taskStore *TaskStore, cach
 		})
 	})
 
-	// Маршруты API
+	// Маршруты API. Если настроены ключи, каждый запрос должен содержать ключ,
+	// а задачи доступны только создавшему их ключу.
 	chiRouter.Route("/api/v1", func(r chi.Router) {
+		r.Use(keys.middleware)
+
 		// Конечная точка для запуска новой задачи обработки
 		r.Post("/process", func(w http.ResponseWriter, r *http.Request) {
+			// Итог загрузки учитывается в метриках; ветки с ошибками запроса его не меняют.
+			uploadResult := metrics.UploadInvalid
+			defer func() { metrics.Uploads.WithLabelValues(uploadResult).Inc() }()
+
+			// Заполненность очереди проверяется до чтения загрузки, чтобы не принимать файлы зря.
+			if queue.full() {
+				uploadResult = metrics.UploadQueueFull
+				writeQueueFull(w, queue)
+				return
+			}
+
 			if err := r.ParseMultipartForm(cfg.Server.MaxUploadSizeMB << 20); err != nil {
 				http.Error(w, "Failed to parse form", http.StatusBadRequest)
 				return
@@ -65,42 +134,156 @@ func New(cfg *config.Config, processor ChatProcessor, taskStore *TaskStore, cach
 				return
 			}
 
-			taskID := uuid.NewString()
-			var fileDataList [][]byte
+			filter, err := parseChatFilter(r.MultipartForm.Value)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 
-			for i, fileHeader := range files {
-				file, err := fileHeader.Open()
-				if err != nil {
-					http.Error(w, "Failed to open uploaded file", http.StatusInternalServerError)
+			priority, err := parseTaskPriority(r.FormValue("priority"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			// Необязательный адрес уведомления о завершении задачи.
+			callbackURL := strings.TrimSpace(r.FormValue("callback_url"))
+			if callbackURL != "" {
+				if !webhooks.enabled() {
+					http.Error(w, "Callbacks are not configured on the server", http.StatusBadRequest)
 					return
 				}
-				defer file.Close()
-
-				data, err := io.ReadAll(file)
-				if err != nil {
-					http.Error(w, "Failed to read uploaded file", http.StatusInternalServerError)
+				if callbackURL, err = webhooks.parseCallbackURL(r.Context(), callbackURL); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
 					return
 				}
-				fileDataList = append(fileDataList, data)
-				slog.Info("Uploaded file read into memory", "size", len(data), "index", i)
 			}
 
-			// Создание задачи в хранилище
-			taskStore.CreateTask(taskID, cfg.Processing.CacheTTL)
+			// Задача списывается с суточной квоты ключа после проверки запроса. Если задачу
+			// не удалось принять, квота возвращается.
+			account := requestQuota(quotas, r)
+			if err := account.Take(quota.KindUploads); err != nil {
+				uploadResult = metrics.UploadQuotaExceeded
+				writeQuotaExceeded(w, quotas, quota.KindUploads, err)
+				return
+			}
+			defer func() {
+				if uploadResult != metrics.UploadAccepted {
+					account.Refund(quota.KindUploads)
+				}
+			}()
 
-			// Запуск обработки в горутине
-			go func(dataList [][]byte) {
-				taskStore.UpdateTaskStatus(taskID, TaskStatusProcessing)
+			taskID := uuid.NewString()
+			uploadResult = metrics.UploadError
 
-				// Передаем фоновый контекст; use case сам управляет своим таймаутом.
-				result, err := processor.ProcessChatFromData(context.Background(), dataList)
-				if err != nil {
-					taskStore.UpdateTaskError(taskID, err.Error())
+			// Загруженные файлы сохраняются во временный каталог задачи,
+			// чтобы обработка читала их потоково, а не держала в памяти.
+			uploadDir, err := os.MkdirTemp("", "tg-chat-parser-"+taskID+"-")
+			if err != nil {
+				http.Error(w, "Failed to store uploaded files", http.StatusInternalServerError)
+				return
+			}
+
+			filePaths, err := saveUploadedFiles(files, uploadDir)
+			if err != nil {
+				slog.Error("Failed to store uploaded files", "task_id", taskID, "error", err)
+				_ = os.RemoveAll(uploadDir)
+				http.Error(w, "Failed to read uploaded file", http.StatusInternalServerError)
+				return
+			}
+
+			// Создание задачи в хранилище
+			if err := taskStore.CreateOwnedTask(taskID, requestOwner(r), cfg.Processing.CacheTTL); err != nil {
+				slog.Error("Failed to create task", "task_id", taskID, "error", err)
+				_ = os.RemoveAll(uploadDir)
+				http.Error(w, "Failed to create task", http.StatusInternalServerError)
+				return
+			}
+			if callbackURL != "" {
+				if err := taskStore.SetTaskCallback(taskID, callbackURL, webhooks.resultURL(taskID)); err != nil {
+					slog.Error("Failed to save task callback", "task_id", taskID, "error", err)
+					_ = os.RemoveAll(uploadDir)
+					http.Error(w, "Failed to create task", http.StatusInternalServerError)
 					return
 				}
+			}
 
-				taskStore.UpdateTaskResult(taskID, result)
-			}(fileDataList)
+			// Постановка задачи в очередь. Задача учитывается как выполняющаяся сразу,
+			// чтобы ее можно было отменить и наблюдать за ней, пока она ждет в очереди.
+			taskCtx, done := running.start(taskID)
+			// Запросы к Telegram API при обогащении списываются с квоты ключа.
+			taskCtx = quota.NewContext(taskCtx, account)
+			// Обработка продолжает трассу запроса на загрузку, а спаны задачи помечаются ее ID.
+			trace.SpanFromContext(r.Context()).SetAttributes(tracing.TaskIDKey.String(taskID))
+			taskCtx = tracing.ContextWithTaskID(tracing.ContinueTrace(taskCtx, r.Context()), taskID)
+			err = queue.push(taskID, priority, func() {
+				// Уведомление отправляется последним, когда итог задачи сохранен.
+				defer webhooks.notify(taskID)
+				defer done()
+				// Итоговый прогресс сохраняется до снятия задачи с учета, чтобы статус
+				// всегда содержал прогресс.
+				defer func() {
+					if err := taskStore.UpdateTaskProgress(taskID, progress.FromContext(taskCtx).Snapshot()); err != nil {
+						slog.Warn("Failed to save task progress", "task_id", taskID, "error", err)
+					}
+				}()
+				defer func() {
+					if err := os.RemoveAll(uploadDir); err != nil {
+						slog.Warn("Failed to remove upload directory", "dir", uploadDir, "error", err)
+					}
+				}()
+
+				if taskCtx.Err() != nil {
+					if s.stopping.Load() {
+						slog.Warn("Task interrupted by shutdown while queued", "task_id", taskID)
+						taskStore.UpdateTaskError(taskID, InterruptedTaskMessage)
+						return
+					}
+					slog.Info("Task cancelled while queued", "task_id", taskID)
+					return
+				}
+				taskStore.UpdateTaskStatus(taskID, TaskStatusProcessing)
+				defer observeTaskDuration(taskStore, taskID, time.Now())
+
+				// Контекст задачи отменяется через DELETE /tasks/{taskID};
+				// таймаутом задачи управляет сам use case.
+				spanCtx, span := tracing.Start(taskCtx, "task.Process")
+				result, err := processor.ProcessChat(spanCtx, filePaths, filter)
+				tracing.End(span, err)
+				var partialErr *domain.PartialResultError
+				switch {
+				case err == nil:
+					err = taskStore.UpdateTaskResult(taskID, result)
+				case errors.As(err, &partialErr):
+					// Обогащение прервано таймаутом или отменой: сохраняется то, что успели собрать.
+					slog.Warn("Task finished with partial result", "task_id", taskID, "users", len(result), "unresolved", len(partialErr.Unresolved), "error", err)
+					err = taskStore.UpdateTaskPartialResult(taskID, result, partialErr.Unresolved, err.Error())
+				case taskCtx.Err() != nil && s.stopping.Load():
+					slog.Warn("Task interrupted by shutdown", "task_id", taskID, "error", err)
+					err = taskStore.UpdateTaskError(taskID, InterruptedTaskMessage)
+				case taskCtx.Err() != nil:
+					slog.Info("Task cancelled", "task_id", taskID)
+					err = taskStore.UpdateTaskResult(taskID, result)
+				default:
+					err = taskStore.UpdateTaskError(taskID, err.Error())
+				}
+				if err != nil {
+					slog.Error("Failed to save task result", "task_id", taskID, "error", err)
+				}
+			})
+			if err != nil {
+				// Очередь заполнилась после проверки в начале запроса или сервер останавливается.
+				done()
+				if err := taskStore.DeleteTask(taskID); err != nil {
+					slog.Warn("Failed to delete rejected task", "task_id", taskID, "error", err)
+				}
+				_ = os.RemoveAll(uploadDir)
+				uploadResult = metrics.UploadQueueFull
+				writeQueueFull(w, queue)
+				return
+			}
+			uploadResult = metrics.UploadAccepted
+			metrics.UploadSize.Observe(float64(uploadSize(files)))
 
 			// Возврат идентификатора задачи
 			w.Header().Set("Content-Type", "application/json")
@@ -108,6 +291,52 @@ func New(cfg *config.Config, processor ChatProcessor, taskStore *TaskStore, cach
 			json.NewEncoder(w).Encode(map[string]string{"task_id": taskID})
 		})
 
+		// Конечная точка для перечисления чатов в загруженных файлах (например, в полном
+		// экспорте аккаунта), чтобы клиент мог выбрать чаты для /process.
+		r.Post("/chats", func(w http.ResponseWriter, r *http.Request) {
+			if err := r.ParseMultipartForm(cfg.Server.MaxUploadSizeMB << 20); err != nil {
+				http.Error(w, "Failed to parse form", http.StatusBadRequest)
+				return
+			}
+
+			files := r.MultipartForm.File["files"]
+			if len(files) == 0 {
+				http.Error(w, "No files uploaded", http.StatusBadRequest)
+				return
+			}
+
+			uploadDir, err := os.MkdirTemp("", "tg-chat-parser-chats-")
+			if err != nil {
+				http.Error(w, "Failed to store uploaded files", http.StatusInternalServerError)
+				return
+			}
+			defer func() {
+				if err := os.RemoveAll(uploadDir); err != nil {
+					slog.Warn("Failed to remove upload directory", "dir", uploadDir, "error", err)
+				}
+			}()
+
+			filePaths, err := saveUploadedFiles(files, uploadDir)
+			if err != nil {
+				slog.Error("Failed to store uploaded files", "error", err)
+				http.Error(w, "Failed to read uploaded file", http.StatusInternalServerError)
+				return
+			}
+
+			chats, err := processor.ListChats(r.Context(), filePaths)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+				return
+			}
+			if chats == nil {
+				chats = []domain.ChatInfo{}
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]interface{}{"chats": chats})
+		})
+
 		// Конечная точка для запуска новой задачи обработки по хешу
 		r.Post("/process-by-hash", func(w http.ResponseWriter, r *http.Request) {
 			// Разбор тела запроса
@@ -128,10 +357,15 @@ func New(cfg *config.Config, processor ChatProcessor, taskStore *TaskStore, cach
 			taskID := uuid.NewString()
 
 			// Создание задачи в хранилище
-			taskStore.CreateTask(taskID, cfg.Processing.CacheTTL)
+			if err := taskStore.CreateOwnedTask(taskID, requestOwner(r), cfg.Processing.CacheTTL); err != nil {
+				slog.Error("Failed to create task", "task_id", taskID, "error", err)
+				http.Error(w, "Failed to create task", http.StatusInternalServerError)
+				return
+			}
 
-			// Запуск обработки в горутине
-			go func() {
+			// Задача выполняется обработчиком очереди, как и задачи /process,
+			// поэтому останавливается вместе с сервером.
+			err := queue.push(taskID, 0, func() {
 				// Обновление статуса до "в обработке"
 				taskStore.UpdateTaskStatus(taskID, TaskStatusProcessing)
 
@@ -148,7 +382,14 @@ func New(cfg *config.Config, processor ChatProcessor, taskStore *TaskStore, cach
 				// В более продвинутой реализации вы могли бы хранить файл, связанный с хешем, и обрабатывать его здесь.
 				taskStore.UpdateTaskError(taskID, "File not found in cache for this hash")
 				slog.Info("Cache miss for hash", "hash", req.Hash, "task_id", taskID)
-			}()
+			})
+			if err != nil {
+				if err := taskStore.DeleteTask(taskID); err != nil {
+					slog.Warn("Failed to delete rejected task", "task_id", taskID, "error", err)
+				}
+				writeQueueFull(w, queue)
+				return
+			}
 
 			// Возврат идентификатора задачи
 			w.Header().Set("Content-Type", "application/json")
@@ -160,7 +401,7 @@ func New(cfg *config.Config, processor ChatProcessor, taskStore *TaskStore, cach
 		r.Get("/tasks/{taskID}", func(w http.ResponseWriter, r *http.Request) {
 			taskID := chi.URLParam(r, "taskID")
 
-			task, err := taskStore.GetTask(taskID)
+			task, err := getOwnedTask(taskStore, r, taskID)
 			if err != nil {
 				http.Error(w, "Task not found", http.StatusNotFound)
 				return
@@ -168,28 +409,72 @@ func New(cfg *config.Config, processor ChatProcessor, taskStore *TaskStore, cach
 
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"task_id":       task.ID,
-				"status":        task.Status,
-				"error_message": task.ErrorMessage,
+			json.NewEncoder(w).Encode(taskStatusResponse(task, running, queue))
+		})
+
+		// Конечная точка для потока событий задачи (Server-Sent Events): смена статуса,
+		// прогресс и обогащенные пользователи по мере получения.
+		r.Get("/tasks/{taskID}/events", func(w http.ResponseWriter, r *http.Request) {
+			streamTaskEvents(w, r, taskStore, running, queue, chi.URLParam(r, "taskID"))
+		})
+
+		// Конечная точка для отмены задачи
+		r.Delete("/tasks/{taskID}", func(w http.ResponseWriter, r *http.Request) {
+			taskID := chi.URLParam(r, "taskID")
+
+			if _, err := getOwnedTask(taskStore, r, taskID); err != nil {
+				http.Error(w, "Task not found", http.StatusNotFound)
+				return
+			}
+
+			// Статус меняется до отмены контекста, чтобы завершающаяся задача
+			// сохранила результат как частичный, а не как завершенный.
+			if err := taskStore.CancelTask(taskID); err != nil {
+				if errors.Is(err, ErrTaskFinished) {
+					http.Error(w, "Task is already finished", http.StatusConflict)
+					return
+				}
+				slog.Error("Failed to cancel task", "task_id", taskID, "error", err)
+				http.Error(w, "Failed to cancel task", http.StatusInternalServerError)
+				return
+			}
+			running.cancel(taskID)
+			// Задача из очереди завершается сразу, не дожидаясь свободного обработчика:
+			// она увидит отмененный контекст, удалит загруженные файлы и отправит уведомление.
+			queue.runDetached(taskID)
+			slog.Info("Task cancellation requested", "task_id", taskID)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]any{
+				"task_id": taskID,
+				"status":  TaskStatusCancelled,
 			})
 		})
 
-		// Конечная точка для получения результата задачи с пагинацией
+		// Конечная точка для получения результата задачи с фильтрацией, сортировкой и пагинацией
 		r.Get("/tasks/{taskID}/result", func(w http.ResponseWriter, r *http.Request) {
 			taskID := chi.URLParam(r, "taskID")
 
-			task, err := taskStore.GetTask(taskID)
+			task, err := getOwnedTask(taskStore, r, taskID)
 			if err != nil {
 				http.Error(w, "Task not found", http.StatusNotFound)
 				return
 			}
 
-			if task.Status != TaskStatusCompleted {
+			// Отмененная и частично выполненная задачи отдают собранный частичный результат.
+			if !task.Status.HasResult() {
 				http.Error(w, "Task is not completed", http.StatusBadRequest)
 				return
 			}
 
+			query, err := parseResultQuery(r.URL.Query())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			users := query.Apply(task.Result)
+
 			// Получение параметров пагинации
 			page := r.URL.Query().Get("page")
 			pageSize := r.URL.Query().Get("page_size")
@@ -207,7 +492,7 @@ func New(cfg *config.Config, processor ChatProcessor, taskStore *TaskStore, cach
 
 			// Вычисление смещения и нарезка данных
 			var paginatedData []domain.User
-			totalItems := len(task.Result)
+			totalItems := len(users)
 			offset := (parsedPage - 1) * parsedPageSize
 
 			if offset < totalItems {
@@ -215,7 +500,7 @@ func New(cfg *config.Config, processor ChatProcessor, taskStore *TaskStore, cach
 				if endIndex > totalItems {
 					endIndex = totalItems
 				}
-				paginatedData = task.Result[offset:endIndex]
+				paginatedData = users[offset:endIndex]
 			} else {
 				// Если смещение за пределами данных, возвращаем пустой срез
 				paginatedData = []domain.User{}
@@ -236,6 +521,8 @@ func New(cfg *config.Config, processor ChatProcessor, taskStore *TaskStore, cach
 					TotalPages  int `json:"total_pages"`
 				} `json:"pagination"`
 				Data []domain.User `json:"data"`
+				// Unresolved не зависит от фильтров и пагинации.
+				Unresolved []domain.UnresolvedParticipant `json:"unresolved,omitempty"`
 			}{
 				Pagination: struct {
 					CurrentPage int `json:"current_page"`
@@ -248,13 +535,48 @@ func New(cfg *config.Config, processor ChatProcessor, taskStore *TaskStore, cach
 					TotalItems:  totalItems,
 					TotalPages:  totalPages,
 				},
-				Data: paginatedData,
+				Data:       paginatedData,
+				Unresolved: task.Unresolved,
 			}
 
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusOK)
 			json.NewEncoder(w).Encode(response)
 		})
+
+		// Конечная точка для просмотра расхода суточных квот ключа запроса
+		r.Get("/quota", func(w http.ResponseWriter, r *http.Request) {
+			key, ok := apiKeyFromContext(r.Context())
+			if !ok {
+				http.Error(w, "API keys are not configured on the server", http.StatusNotFound)
+				return
+			}
+
+			usage, err := quotas.Usage(key.Name, quota.Limits{Uploads: key.DailyUploads, Lookups: key.DailyLookups})
+			if err != nil {
+				slog.Error("Failed to read quota usage", "key", key.Name, "error", err)
+				http.Error(w, "Failed to read quota usage", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(struct {
+				Key string `json:"key"`
+				quota.Usage
+			}{Key: key.Name, Usage: usage})
+		})
+
+		// Администрирование сервера — только для ключей с admin: true. Без такого ключа
+		// эндпоинты не регистрируются, даже если аутентификация отключена.
+		if keys.hasAdmin() {
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(keys.adminOnly)
+				s.adminRoutes(r)
+			})
+		} else {
+			slog.Warn("No admin API key configured, /api/v1/admin endpoints are disabled")
+		}
 	})
 
 	httpServer := &http.Server{
@@ -265,13 +587,7 @@ func New(cfg *config.Config, processor ChatProcessor, taskStore *TaskStore, cach
 		IdleTimeout:  cfg.Server.IdleTimeout,
 	}
 
-	s := &Server{
-		HTTPServer: httpServer,
-		cfg:        cfg,
-		taskStore:  taskStore,
-		cacheStore: cacheStore,
-		processor:  processor,
-	}
+	s.HTTPServer = httpServer
 
 	// Запуск тикера для очистки просроченных задач
 	ctx, cancel := context.WithCancel(context.Background())
@@ -280,6 +596,9 @@ func New(cfg *config.Config, processor ChatProcessor, taskStore *TaskStore, cach
 	// Запуск тикера для очистки просроченных элементов кеша
 	s.cacheStore.StartCleanupTicker(ctx, cfg.Server.CleanupInterval)
 
+	// Запуск тикера для очистки счетчиков квот за прошедшие сутки
+	s.quotas.StartCleanupTicker(ctx, cfg.Server.CleanupInterval)
+
 	// Нам нужен способ остановить тикер при завершении работы
 	// Это упрощенный подход; более надежное решение лучше бы управляло этим жизненным циклом.
 	// Пока что мы будем полагаться на отмену контекста основной функции.
@@ -291,13 +610,105 @@ func New(cfg *config.Config, processor ChatProcessor, taskStore *TaskStore, cach
 	return s, nil
 }
 
+// observeTaskDuration учитывает в метриках время обработки задачи с итоговым статусом.
+func observeTaskDuration(taskStore *TaskStore, taskID string, start time.Time) {
+	task, err := taskStore.GetTask(taskID)
+	if err != nil {
+		return
+	}
+	metrics.TaskDuration.WithLabelValues(string(task.Status)).Observe(time.Since(start).Seconds())
+}
+
+// uploadSize возвращает суммарный размер загруженных файлов.
+func uploadSize(files []*multipart.FileHeader) int64 {
+	var size int64
+	for _, f := range files {
+		size += f.Size
+	}
+	return size
+}
+
+// parseChatFilter собирает фильтр чатов из полей формы chat_id, chat_name и chat_type.
+// Каждое поле может повторяться; chat_id и chat_type также принимают значения через запятую.
+// Названия чатов через запятую не разделяются, так как могут ее содержать.
+func parseChatFilter(values map[string][]string) (domain.ChatFilter, error) {
+	var filter domain.ChatFilter
+	for _, raw := range splitFormValues(values["chat_id"]) {
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			return domain.ChatFilter{}, fmt.Errorf("invalid chat_id %q", raw)
+		}
+		filter.IDs = append(filter.IDs, id)
+	}
+	for _, name := range values["chat_name"] {
+		if name = strings.TrimSpace(name); name != "" {
+			filter.Names = append(filter.Names, name)
+		}
+	}
+	filter.Types = splitFormValues(values["chat_type"])
+	return filter, nil
+}
+
+func splitFormValues(values []string) []string {
+	var result []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				result = append(result, part)
+			}
+		}
+	}
+	return result
+}
+
+// saveUploadedFiles копирует загруженные файлы в dir и возвращает пути к копиям.
+// Копирование выполняется потоково, без чтения файла в память целиком.
+func saveUploadedFiles(files []*multipart.FileHeader, dir string) ([]string, error) {
+	paths := make([]string, 0, len(files))
+	for i, fileHeader := range files {
+		path, err := saveUploadedFile(fileHeader, filepath.Join(dir, fmt.Sprintf("%03d.upload", i)))
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("Uploaded file stored", "size", fileHeader.Size, "index", i)
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func saveUploadedFile(fileHeader *multipart.FileHeader, path string) (string, error) {
+	src, err := fileHeader.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer src.Close()
+
+	dst, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return "", fmt.Errorf("failed to copy uploaded file: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		return "", fmt.Errorf("failed to close file %s: %w", path, err)
+	}
+	return path, nil
+}
+
 // ListenAndServe запускает HTTP-сервер
 func (s *Server) ListenAndServe() error {
 	return s.HTTPServer.ListenAndServe()
 }
 
-// Shutdown корректно завершает работу HTTP-сервера
+// Shutdown корректно завершает работу HTTP-сервера, очереди задач и доставки уведомлений.
+// Выполняющиеся задачи отменяются и сохраняют частичный результат, если он есть, а
+// остальные незавершенные задачи получают статус 'failed' с InterruptedTaskMessage.
 func (s *Server) Shutdown(ctx context.Context) error {
 	slog.Info("Shutting down HTTP server")
-	return s.HTTPServer.Shutdown(ctx)
+	err := s.HTTPServer.Shutdown(ctx)
+	s.stopping.Store(true)
+	s.running.cancelAll()
+	return errors.Join(err, s.queue.stop(ctx), s.webhooks.stop(ctx))
 }
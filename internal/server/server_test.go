@@ -1,21 +1,27 @@
 package server
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"telegram-chat-parser/internal/cache"
 	"telegram-chat-parser/internal/domain"
+	"telegram-chat-parser/internal/metrics"
 	"telegram-chat-parser/internal/pkg/config"
+	"telegram-chat-parser/internal/progress"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -26,18 +32,18 @@ type mockProcessor struct {
 	mock.Mock
 }
 
-func (m *mockProcessor) ProcessChat(ctx context.Context, filePaths []string) ([]domain.User, error) {
-	args := m.Called(ctx, filePaths)
+func (m *mockProcessor) ProcessChat(ctx context.Context, filePaths []string, filter domain.ChatFilter) ([]domain.User, error) {
+	args := m.Called(ctx, filePaths, filter)
 	if res := args.Get(0); res != nil {
 		return res.([]domain.User), args.Error(1)
 	}
 	return nil, args.Error(1)
 }
 
-func (m *mockProcessor) ProcessChatFromData(ctx context.Context, fileDataList [][]byte) ([]domain.User, error) {
-	args := m.Called(ctx, fileDataList)
+func (m *mockProcessor) ListChats(ctx context.Context, filePaths []string) ([]domain.ChatInfo, error) {
+	args := m.Called(ctx, filePaths)
 	if res := args.Get(0); res != nil {
-		return res.([]domain.User), args.Error(1)
+		return res.([]domain.ChatInfo), args.Error(1)
 	}
 	return nil, args.Error(1)
 }
@@ -50,7 +56,9 @@ func TestServer(t *testing.T) {
 			CleanupInterval: 1 * time.Minute, // Устанавливаем ненулевое значение
 		},
 		Processing: config.Processing{
-			CacheTTL: 1 * time.Minute, // Устанавливаем ненулевое значение
+			CacheTTL:           1 * time.Minute, // Устанавливаем ненулевое значение
+			MaxConcurrentTasks: 2,
+			MaxQueuedTasks:     10,
 		},
 	}
 	mockProc := new(mockProcessor)
@@ -89,7 +97,7 @@ func TestServer(t *testing.T) {
 		require.NoError(t, err)
 		require.NoError(t, writer.Close())
 
-		mockProc.On("ProcessChatFromData", mock.Anything, mock.AnythingOfType("[][]uint8")).Return([]domain.User{}, nil).Once()
+		mockProc.On("ProcessChat", mock.Anything, mock.AnythingOfType("[]string"), domain.ChatFilter{}).Return([]domain.User{}, nil).Once()
 
 		req := httptest.NewRequest("POST", "/api/v1/process", &b)
 		req.Header.Set("Content-Type", writer.FormDataContentType())
@@ -107,6 +115,87 @@ func TestServer(t *testing.T) {
 		mockProc.AssertExpectations(t)
 	})
 
+	t.Run("Process Endpoint with chat filter", func(t *testing.T) {
+		body, contentType := newUploadForm(t, map[string][]string{
+			"chat_id":   {"100, 200"},
+			"chat_name": {"Work, Inc."},
+			"chat_type": {"private_supergroup", "public_channel"},
+		})
+		expectedFilter := domain.ChatFilter{
+			IDs:   []int{100, 200},
+			Names: []string{"Work, Inc."},
+			Types: []string{"private_supergroup", "public_channel"},
+		}
+		done := make(chan struct{})
+		mockProc.On("ProcessChat", mock.Anything, mock.AnythingOfType("[]string"), expectedFilter).
+			Return([]domain.User{}, nil).Once().Run(func(mock.Arguments) { close(done) })
+
+		req := httptest.NewRequest("POST", "/api/v1/process", body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("ProcessChat was not called")
+		}
+		mockProc.AssertExpectations(t)
+	})
+
+	t.Run("Process Endpoint with invalid chat_id", func(t *testing.T) {
+		body, contentType := newUploadForm(t, map[string][]string{"chat_id": {"abc"}})
+
+		req := httptest.NewRequest("POST", "/api/v1/process", body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Metrics Endpoint", func(t *testing.T) {
+		invalid := metrics.Uploads.WithLabelValues(metrics.UploadInvalid)
+		before := testutil.ToFloat64(invalid)
+
+		body, contentType := newUploadForm(t, map[string][]string{"chat_id": {"abc"}})
+		req := httptest.NewRequest("POST", "/api/v1/process", body)
+		req.Header.Set("Content-Type", contentType)
+		srv.HTTPServer.Handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, before+1, testutil.ToFloat64(invalid))
+
+		req = httptest.NewRequest("GET", "/metrics", nil)
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Header().Get("Content-Type"), "text/plain")
+		assert.Contains(t, rr.Body.String(), fmt.Sprintf("chat_parser_uploads_total{result=\"invalid\"} %v\n", testutil.ToFloat64(invalid)))
+	})
+
+	t.Run("Chats Endpoint", func(t *testing.T) {
+		body, contentType := newUploadForm(t, nil)
+		chats := []domain.ChatInfo{
+			{ID: 1, Name: "Family", Type: "private_group", MessageCount: 10},
+			{ID: 2, Name: "News", Type: "public_channel", MessageCount: 3},
+		}
+		mockProc.On("ListChats", mock.Anything, mock.AnythingOfType("[]string")).Return(chats, nil).Once()
+
+		req := httptest.NewRequest("POST", "/api/v1/chats", body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var resp struct {
+			Chats []domain.ChatInfo `json:"chats"`
+		}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		assert.Equal(t, chats, resp.Chats)
+		mockProc.AssertExpectations(t)
+	})
+
 	t.Run("Task Status Endpoint", func(t *testing.T) {
 		taskID := "test-task-1"
 		srv.taskStore.CreateTask(taskID, time.Minute)
@@ -123,6 +212,151 @@ func TestServer(t *testing.T) {
 		assert.Equal(t, string(TaskStatusPending), resp["status"])
 	})
 
+	t.Run("Task Status Endpoint - Progress", func(t *testing.T) {
+		body, contentType := newUploadForm(t, map[string][]string{"chat_name": {"progress"}})
+		reported := make(chan struct{})
+		release := make(chan struct{})
+		mockProc.On("ProcessChat", mock.Anything, mock.AnythingOfType("[]string"), domain.ChatFilter{Names: []string{"progress"}}).
+			Run(func(args mock.Arguments) {
+				tracker := progress.FromContext(args.Get(0).(context.Context))
+				tracker.SetFilesTotal(2)
+				tracker.FileParsed(10)
+				tracker.EnrichmentStarted(8)
+				tracker.Enriched(domain.User{ID: 1})
+				close(reported)
+				<-release
+				tracker.Finish()
+			}).
+			Return([]domain.User{}, nil).Once()
+
+		req := httptest.NewRequest("POST", "/api/v1/process", body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusAccepted, rr.Code)
+		var created map[string]string
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&created))
+		taskID := created["task_id"]
+
+		getProgress := func() *progress.Snapshot {
+			req := httptest.NewRequest("GET", "/api/v1/tasks/"+taskID, nil)
+			rr := httptest.NewRecorder()
+			srv.HTTPServer.Handler.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code)
+			var resp struct {
+				Status   TaskStatus         `json:"status"`
+				Progress *progress.Snapshot `json:"progress"`
+			}
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+			return resp.Progress
+		}
+
+		select {
+		case <-reported:
+		case <-time.After(time.Second):
+			t.Fatal("processing did not start")
+		}
+		live := getProgress()
+		require.NotNil(t, live)
+		assert.Equal(t, progress.StageEnriching, live.Stage)
+		assert.Equal(t, 1, live.FilesParsed)
+		assert.Equal(t, 8, live.ParticipantsTotal)
+		assert.Equal(t, 1, live.Enriched)
+
+		// После завершения задачи итоговый прогресс берется из хранилища.
+		close(release)
+		require.Eventually(t, func() bool {
+			task, err := taskStore.GetTask(taskID)
+			return err == nil && task.Progress != nil
+		}, time.Second, 5*time.Millisecond)
+		final := getProgress()
+		require.NotNil(t, final)
+		assert.Equal(t, progress.StageFinished, final.Stage)
+		mockProc.AssertExpectations(t)
+	})
+
+	t.Run("Task Events Endpoint", func(t *testing.T) {
+		httpSrv := httptest.NewServer(srv.HTTPServer.Handler)
+		defer httpSrv.Close()
+
+		body, contentType := newUploadForm(t, map[string][]string{"chat_name": {"events"}})
+		release := make(chan struct{})
+		users := []domain.User{{ID: 1, Name: "First"}, {ID: 2, Name: "Second"}}
+		mockProc.On("ProcessChat", mock.Anything, mock.AnythingOfType("[]string"), domain.ChatFilter{Names: []string{"events"}}).
+			Run(func(args mock.Arguments) {
+				tracker := progress.FromContext(args.Get(0).(context.Context))
+				<-release
+				tracker.EnrichmentStarted(len(users))
+				for _, u := range users {
+					tracker.Enriched(u)
+				}
+				tracker.Finish()
+			}).
+			Return(users, nil).Once()
+
+		resp, err := http.Post(httpSrv.URL+"/api/v1/process", contentType, body)
+		require.NoError(t, err)
+		var created map[string]string
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+		resp.Body.Close()
+		taskID := created["task_id"]
+
+		resp, err = http.Get(httpSrv.URL + "/api/v1/tasks/" + taskID + "/events")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		events := readEvents(resp.Body)
+		first := <-events
+		assert.Equal(t, EventStatus, first.name)
+		close(release)
+
+		var got []string
+		var streamed []domain.User
+		var done map[string]any
+		for e := range events {
+			got = append(got, e.name)
+			switch e.name {
+			case EventUser:
+				var u domain.User
+				require.NoError(t, json.Unmarshal([]byte(e.data), &u))
+				streamed = append(streamed, u)
+			case EventDone:
+				require.NoError(t, json.Unmarshal([]byte(e.data), &done))
+			}
+		}
+
+		assert.Equal(t, users, streamed, "events: %v", got)
+		assert.Contains(t, got, EventProgress)
+		require.NotNil(t, done, "events: %v", got)
+		assert.Equal(t, string(TaskStatusCompleted), done["status"])
+		assert.Equal(t, EventDone, got[len(got)-1])
+		mockProc.AssertExpectations(t)
+	})
+
+	t.Run("Task Events Endpoint - Finished Task", func(t *testing.T) {
+		taskID := "events-finished"
+		srv.taskStore.CreateTask(taskID, time.Minute)
+		srv.taskStore.UpdateTaskError(taskID, "boom")
+
+		req := httptest.NewRequest("GET", "/api/v1/tasks/"+taskID+"/events", nil)
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var names []string
+		for e := range readEvents(rr.Body) {
+			names = append(names, e.name)
+		}
+		assert.Equal(t, []string{EventStatus, EventDone}, names)
+
+		req = httptest.NewRequest("GET", "/api/v1/tasks/non-existent/events", nil)
+		rr = httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
 	t.Run("Task Not Found", func(t *testing.T) {
 		req := httptest.NewRequest("GET", "/api/v1/tasks/non-existent", nil)
 		rr := httptest.NewRecorder()
@@ -130,6 +364,125 @@ func TestServer(t *testing.T) {
 		assert.Equal(t, http.StatusNotFound, rr.Code)
 	})
 
+	t.Run("Cancel Task Endpoint", func(t *testing.T) {
+		body, contentType := newUploadForm(t, map[string][]string{"chat_name": {"cancel-me"}})
+		partial := []domain.User{{ID: 1, Name: "Partial"}}
+		started := make(chan struct{})
+		mockProc.On("ProcessChat", mock.Anything, mock.AnythingOfType("[]string"), domain.ChatFilter{Names: []string{"cancel-me"}}).
+			Run(func(args mock.Arguments) {
+				close(started)
+				<-args.Get(0).(context.Context).Done()
+			}).
+			Return(partial, context.Canceled).Once()
+
+		req := httptest.NewRequest("POST", "/api/v1/process", body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusAccepted, rr.Code)
+		var created map[string]string
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&created))
+		taskID := created["task_id"]
+
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("processing did not start")
+		}
+
+		req = httptest.NewRequest("DELETE", "/api/v1/tasks/"+taskID, nil)
+		rr = httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		// Задача сохраняет частичный результат, собранный до отмены.
+		require.Eventually(t, func() bool {
+			task, err := taskStore.GetTask(taskID)
+			return err == nil && len(task.Result) > 0
+		}, time.Second, 5*time.Millisecond)
+		task, err := taskStore.GetTask(taskID)
+		require.NoError(t, err)
+		assert.Equal(t, TaskStatusCancelled, task.Status)
+		assert.Empty(t, task.ErrorMessage)
+
+		req = httptest.NewRequest("GET", "/api/v1/tasks/"+taskID+"/result", nil)
+		rr = httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var result struct {
+			Data []domain.User `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&result))
+		assert.Equal(t, partial, result.Data)
+
+		// Повторная отмена завершенной задачи невозможна.
+		req = httptest.NewRequest("DELETE", "/api/v1/tasks/"+taskID, nil)
+		rr = httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		mockProc.AssertExpectations(t)
+	})
+
+	t.Run("Cancel Task Endpoint - Not Found", func(t *testing.T) {
+		req := httptest.NewRequest("DELETE", "/api/v1/tasks/non-existent", nil)
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Partial Result on Enrichment Timeout", func(t *testing.T) {
+		body, contentType := newUploadForm(t, map[string][]string{"chat_name": {"slow"}})
+		partial := []domain.User{{ID: 1, Name: "Resolved"}}
+		unresolved := []domain.UnresolvedParticipant{{Username: "late", Reason: domain.UnresolvedTimeout}}
+		enrichErr := fmt.Errorf("failed to enrich data: %w", &domain.PartialResultError{
+			Unresolved: unresolved,
+			Err:        context.DeadlineExceeded,
+		})
+		mockProc.On("ProcessChat", mock.Anything, mock.AnythingOfType("[]string"), domain.ChatFilter{Names: []string{"slow"}}).
+			Return(partial, enrichErr).Once()
+
+		req := httptest.NewRequest("POST", "/api/v1/process", body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusAccepted, rr.Code)
+		var created map[string]string
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&created))
+		taskID := created["task_id"]
+
+		require.Eventually(t, func() bool {
+			task, err := taskStore.GetTask(taskID)
+			return err == nil && task.Status == TaskStatusPartial
+		}, time.Second, 5*time.Millisecond)
+
+		req = httptest.NewRequest("GET", "/api/v1/tasks/"+taskID, nil)
+		rr = httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var status struct {
+			Status          TaskStatus `json:"status"`
+			ErrorMessage    string     `json:"error_message"`
+			UnresolvedCount int        `json:"unresolved_count"`
+		}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&status))
+		assert.Equal(t, TaskStatusPartial, status.Status)
+		assert.Contains(t, status.ErrorMessage, "deadline exceeded")
+		assert.Equal(t, 1, status.UnresolvedCount)
+
+		req = httptest.NewRequest("GET", "/api/v1/tasks/"+taskID+"/result", nil)
+		rr = httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var result struct {
+			Data       []domain.User                  `json:"data"`
+			Unresolved []domain.UnresolvedParticipant `json:"unresolved"`
+		}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&result))
+		assert.Equal(t, partial, result.Data)
+		assert.Equal(t, unresolved, result.Unresolved)
+		mockProc.AssertExpectations(t)
+	})
+
 	t.Run("Task Result Endpoint - Not Completed", func(t *testing.T) {
 		taskID := "test-task-2"
 		srv.taskStore.CreateTask(taskID, time.Minute)
@@ -176,4 +529,95 @@ func TestServer(t *testing.T) {
 		assert.Equal(t, int64(5), resp.Data[0].ID)
 		assert.Equal(t, int64(9), resp.Data[4].ID)
 	})
+
+	t.Run("Task Result Endpoint - Filtering and Sorting", func(t *testing.T) {
+		taskID := "test-task-4"
+		srv.taskStore.CreateTask(taskID, time.Minute)
+		result := make([]domain.User, 10)
+		for i := 0; i < 10; i++ {
+			result[i] = domain.User{ID: int64(i)}
+			if i%2 == 0 {
+				result[i].Username = fmt.Sprintf("user%d", i)
+			}
+		}
+		srv.taskStore.UpdateTaskResult(taskID, result)
+
+		req := httptest.NewRequest("GET", "/api/v1/tasks/"+taskID+"/result?has_username=true&sort=id&order=desc&page=1&page_size=2", nil)
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var resp struct {
+			Pagination struct {
+				TotalItems int `json:"total_items"`
+				TotalPages int `json:"total_pages"`
+			} `json:"pagination"`
+			Data []domain.User `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+
+		// Пагинация считается по отфильтрованному набору
+		assert.Equal(t, 5, resp.Pagination.TotalItems)
+		assert.Equal(t, 3, resp.Pagination.TotalPages)
+		require.Len(t, resp.Data, 2)
+		assert.Equal(t, int64(8), resp.Data[0].ID)
+		assert.Equal(t, int64(6), resp.Data[1].ID)
+	})
+
+	t.Run("Task Result Endpoint - Invalid Query", func(t *testing.T) {
+		taskID := "test-task-5"
+		srv.taskStore.CreateTask(taskID, time.Minute)
+		srv.taskStore.UpdateTaskResult(taskID, []domain.User{{ID: 1}})
+
+		req := httptest.NewRequest("GET", "/api/v1/tasks/"+taskID+"/result?name_regex=(", nil)
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+// newUploadForm создает multipart-форму с одним файлом экспорта и дополнительными полями.
+func newUploadForm(t *testing.T, fields map[string][]string) (*bytes.Buffer, string) {
+	t.Helper()
+	var b bytes.Buffer
+	writer := multipart.NewWriter(&b)
+	fw, err := writer.CreateFormFile("files", "result.json")
+	require.NoError(t, err)
+	_, err = fw.Write([]byte(`{}`))
+	require.NoError(t, err)
+	for name, values := range fields {
+		for _, v := range values {
+			require.NoError(t, writer.WriteField(name, v))
+		}
+	}
+	require.NoError(t, writer.Close())
+	return &b, writer.FormDataContentType()
+}
+
+type sseEvent struct {
+	name string
+	data string
+}
+
+// readEvents разбирает поток Server-Sent Events; канал закрывается по окончании потока.
+func readEvents(r io.Reader) <-chan sseEvent {
+	events := make(chan sseEvent)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(r)
+		var e sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				e.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				e.data = strings.TrimPrefix(line, "data: ")
+			case line == "" && e.name != "":
+				events <- e
+				e = sseEvent{}
+			}
+		}
+	}()
+	return events
 }
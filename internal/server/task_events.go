@@ -0,0 +1,181 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"telegram-chat-parser/internal/progress"
+	"time"
+)
+
+// Типы событий потока задачи.
+const (
+	// EventStatus — текущий статус задачи; отправляется при подключении, при каждой смене статуса
+	// и при изменении позиции в очереди.
+	EventStatus = "status"
+	// EventProgress — изменение прогресса обработки.
+	EventProgress = "progress"
+	// EventUser — обогащенный пользователь, отправляется по мере получения.
+	EventUser = "user"
+	// EventDone — итоговый статус задачи, после которого поток закрывается.
+	EventDone = "done"
+)
+
+const (
+	// eventsProgressInterval ограничивает частоту событий progress: при разборе больших
+	// экспортов прогресс меняется каждую тысячу сообщений.
+	eventsProgressInterval = 500 * time.Millisecond
+	// eventsPollInterval — как часто поток перечитывает задачу из хранилища. Нужен для
+	// задач без трекера прогресса, например задач по хэшу.
+	eventsPollInterval = time.Second
+	// eventsKeepAliveInterval — интервал комментариев, не дающих прокси закрыть соединение.
+	eventsKeepAliveInterval = 15 * time.Second
+)
+
+// streamTaskEvents передает события задачи в формате Server-Sent Events, пока задача
+// не завершится или клиент не отключится. Пользователи, обогащенные до подключения,
+// отправляются сразу, поэтому клиент может подключиться в любой момент.
+func streamTaskEvents(w http.ResponseWriter, r *http.Request, taskStore *TaskStore, running *runningTasks, queue *taskQueue, taskID string) {
+	task, err := getOwnedTask(taskStore, r, taskID)
+	if err != nil {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// Поток живет дольше write_timeout сервера.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		slog.Debug("Failed to disable write deadline for event stream", "task_id", taskID, "error", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(event string, data any) bool {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			slog.Error("Failed to encode task event", "task_id", taskID, "event", event, "error", err)
+			return false
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	status, position := task.Status, queue.position(taskID)
+	if !send(EventStatus, taskStatusResponse(task, running, queue)) {
+		return
+	}
+
+	poll := time.NewTicker(eventsPollInterval)
+	defer poll.Stop()
+	keepAlive := time.NewTicker(eventsKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	var (
+		sentUsers      int
+		tracker        *progress.Tracker
+		lastProgress   progress.Snapshot
+		lastProgressAt time.Time
+		progressTimer  <-chan time.Time
+	)
+	for {
+		current, done, isRunning := running.watch(taskID)
+		// После завершения задачи трекер удаляется из списка выполняемых, но пользователи,
+		// полученные перед самым завершением, еще не отправлены.
+		if current != nil {
+			tracker = current
+		}
+		// Канал изменений запрашивается до чтения состояния, чтобы не пропустить изменение.
+		changed := tracker.Changed()
+
+		for _, user := range tracker.Users(sentUsers) {
+			if !send(EventUser, user) {
+				return
+			}
+			sentUsers++
+		}
+
+		if isRunning {
+			snapshot := tracker.Snapshot()
+			if !sameProgress(snapshot, lastProgress) {
+				if wait := eventsProgressInterval - time.Since(lastProgressAt); wait > 0 {
+					if progressTimer == nil {
+						progressTimer = time.After(wait)
+					}
+				} else {
+					if !send(EventProgress, snapshot) {
+						return
+					}
+					lastProgress, lastProgressAt = snapshot, time.Now()
+				}
+			}
+		}
+
+		task, err := taskStore.GetTask(taskID)
+		if err != nil {
+			slog.Warn("Task disappeared while streaming events", "task_id", taskID, "error", err)
+			return
+		}
+		// Итог отправляется после завершения горутины задачи, когда сохранены
+		// результат и итоговый прогресс.
+		if task.Status.IsFinished() && !isRunning {
+			send(EventDone, taskStatusResponse(task, running, queue))
+			return
+		}
+		if p := queue.position(taskID); task.Status != status || p != position {
+			status, position = task.Status, p
+			if !send(EventStatus, taskStatusResponse(task, running, queue)) {
+				return
+			}
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changed:
+		case <-done:
+		case <-progressTimer:
+			progressTimer = nil
+		case <-poll.C:
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil || rc.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// sameProgress сравнивает прогресс без учета оценки оставшегося времени,
+// которая меняется вместе с остальными полями.
+func sameProgress(a, b progress.Snapshot) bool {
+	a.ETASeconds, b.ETASeconds = nil, nil
+	return a == b
+}
+
+// taskStatusResponse формирует ответ о статусе задачи. Прогресс выполняющейся задачи
+// берется из ее трекера, завершенной — из хранилища; ожидающая задача получает позицию в очереди.
+func taskStatusResponse(task *Task, running *runningTasks, queue *taskQueue) map[string]interface{} {
+	response := map[string]interface{}{
+		"task_id":          task.ID,
+		"status":           task.Status,
+		"error_message":    task.ErrorMessage,
+		"unresolved_count": len(task.Unresolved),
+	}
+	if position := queue.position(task.ID); position > 0 {
+		response["queue_position"] = position
+	}
+	if snapshot, ok := running.progress(task.ID); ok {
+		response["progress"] = snapshot
+	} else if task.Progress != nil {
+		response["progress"] = task.Progress
+	}
+	if task.Callback != nil {
+		response["callback"] = task.Callback
+	}
+	return response
+}
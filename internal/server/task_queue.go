@@ -0,0 +1,221 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"telegram-chat-parser/internal/metrics"
+	"time"
+)
+
+// ErrQueueFull возвращается, когда в очереди задач нет свободных мест.
+var ErrQueueFull = errors.New("task queue is full")
+
+// ErrQueueStopped возвращается при постановке задачи в остановленную очередь.
+var ErrQueueStopped = errors.New("task queue is stopped")
+
+// Границы приоритета задачи (поле priority формы /process).
+const (
+	MinTaskPriority = -10
+	MaxTaskPriority = 10
+)
+
+const (
+	// queueDefaultRetryAfter — оценка ожидания, пока не завершилась ни одна задача.
+	queueDefaultRetryAfter = 30 * time.Second
+	// queueDurationWeight — вес последней задачи в скользящей средней длительности задач.
+	queueDurationWeight = 0.2
+)
+
+// taskQueue ограничивает число одновременно выполняемых задач обработки: все они
+// используют общий пул клиентов Telegram. Задачи сверх лимита ждут в очереди —
+// сначала с большим приоритетом, при равном приоритете в порядке поступления.
+// Размер очереди ограничен, поэтому лишние задачи отклоняются сразу, а не копятся.
+type taskQueue struct {
+	mutex     sync.Mutex
+	cond      *sync.Cond
+	pending   []queuedTask
+	workers   int
+	maxQueued int
+	seq       uint64
+	// avgDuration — скользящая средняя длительности задач для оценки Retry-After.
+	avgDuration time.Duration
+	// stopped запрещает постановку новых задач; обработчики завершаются, выполнив оставшиеся.
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+type queuedTask struct {
+	id       string
+	priority int
+	run      func()
+}
+
+// newTaskQueue создает очередь и запускает workers обработчиков задач.
+func newTaskQueue(workers, maxQueued int) *taskQueue {
+	q := &taskQueue{workers: workers, maxQueued: maxQueued}
+	q.cond = sync.NewCond(&q.mutex)
+	q.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q
+}
+
+// push ставит задачу в очередь. Возвращает ErrQueueFull, если очередь заполнена,
+// и ErrQueueStopped, если очередь остановлена.
+func (q *taskQueue) push(taskID string, priority int, run func()) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.stopped {
+		return ErrQueueStopped
+	}
+	if len(q.pending) >= q.maxQueued {
+		return ErrQueueFull
+	}
+	// Новая задача встает за всеми задачами с тем же или большим приоритетом.
+	i := sort.Search(len(q.pending), func(i int) bool { return q.pending[i].priority < priority })
+	q.pending = slices.Insert(q.pending, i, queuedTask{id: taskID, priority: priority, run: run})
+	q.updateDepthLocked()
+	q.cond.Signal()
+	return nil
+}
+
+// full сообщает, заполнена ли очередь.
+func (q *taskQueue) full() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.pending) >= q.maxQueued
+}
+
+// position возвращает позицию задачи в очереди, начиная с 1, или 0, если задача не ждет в очереди.
+func (q *taskQueue) position(taskID string) int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for i, t := range q.pending {
+		if t.id == taskID {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// runDetached убирает задачу из очереди и сразу выполняет ее в отдельной горутине, не
+// дожидаясь свободного обработчика. stop ждет и такие задачи. Возвращает false, если
+// задачи нет в очереди.
+func (q *taskQueue) runDetached(taskID string) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for i, t := range q.pending {
+		if t.id == taskID {
+			q.pending = slices.Delete(q.pending, i, i+1)
+			q.updateDepthLocked()
+			// Пока задача была в очереди, обработчики не завершились, поэтому stop
+			// еще ждет wg, и добавление в него безопасно.
+			q.wg.Add(1)
+			go func() {
+				defer q.wg.Done()
+				t.run()
+			}()
+			return true
+		}
+	}
+	return false
+}
+
+// retryAfter оценивает, через сколько в очереди освободится место: в среднем одна
+// из выполняющихся задач завершается за среднюю длительность, деленную на число обработчиков.
+func (q *taskQueue) retryAfter() time.Duration {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.avgDuration == 0 {
+		return queueDefaultRetryAfter
+	}
+	return max(q.avgDuration/time.Duration(q.workers), time.Second)
+}
+
+// stop запрещает постановку новых задач и ждет, пока обработчики выполнят задачи,
+// оставшиеся в очереди, и завершатся задачи, запущенные runDetached, но не дольше ctx. Чтобы остановка не затягивалась, контексты
+// задач нужно отменить заранее: отмененная задача завершается сразу.
+func (q *taskQueue) stop(ctx context.Context) error {
+	q.mutex.Lock()
+	q.stopped = true
+	q.cond.Broadcast()
+	q.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to stop task queue: %w", ctx.Err())
+	}
+}
+
+func (q *taskQueue) work() {
+	defer q.wg.Done()
+	for {
+		q.mutex.Lock()
+		for len(q.pending) == 0 && !q.stopped {
+			q.cond.Wait()
+		}
+		if len(q.pending) == 0 {
+			q.mutex.Unlock()
+			return
+		}
+		task := q.pending[0]
+		q.pending = slices.Delete(q.pending, 0, 1)
+		q.updateDepthLocked()
+		q.mutex.Unlock()
+
+		start := time.Now()
+		task.run()
+		q.recordDuration(time.Since(start))
+	}
+}
+
+// updateDepthLocked обновляет метрику длины очереди. Вызывается под q.mutex.
+func (q *taskQueue) updateDepthLocked() {
+	metrics.TaskQueueDepth.Set(float64(len(q.pending)))
+}
+
+func (q *taskQueue) recordDuration(d time.Duration) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.avgDuration == 0 {
+		q.avgDuration = d
+		return
+	}
+	q.avgDuration = time.Duration(float64(q.avgDuration)*(1-queueDurationWeight) + float64(d)*queueDurationWeight)
+}
+
+// writeQueueFull отвечает 429 Too Many Requests с оценкой ожидания в Retry-After.
+func writeQueueFull(w http.ResponseWriter, q *taskQueue) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(q.retryAfter().Seconds()))))
+	http.Error(w, "Task queue is full, try again later", http.StatusTooManyRequests)
+}
+
+// parseTaskPriority разбирает поле priority формы; пустое значение означает приоритет 0.
+func parseTaskPriority(raw string) (int, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, nil
+	}
+	priority, err := strconv.Atoi(raw)
+	if err != nil || priority < MinTaskPriority || priority > MaxTaskPriority {
+		return 0, fmt.Errorf("invalid priority %q: integer from %d to %d expected", raw, MinTaskPriority, MaxTaskPriority)
+	}
+	return priority, nil
+}
@@ -0,0 +1,297 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"telegram-chat-parser/internal/cache"
+	"telegram-chat-parser/internal/domain"
+	"telegram-chat-parser/internal/pkg/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskQueue(t *testing.T) {
+	t.Run("Порядок по приоритету и поступлению", func(t *testing.T) {
+		q := newTaskQueue(0, 10) // Без обработчиков задачи остаются в очереди.
+		require.NoError(t, q.push("a", 0, func() {}))
+		require.NoError(t, q.push("b", 5, func() {}))
+		require.NoError(t, q.push("c", 0, func() {}))
+		require.NoError(t, q.push("d", -1, func() {}))
+		require.NoError(t, q.push("e", 5, func() {}))
+
+		for want, id := range []string{"b", "e", "a", "c", "d"} {
+			assert.Equal(t, want+1, q.position(id), id)
+		}
+		assert.Zero(t, q.position("missing"))
+
+		assert.True(t, q.runDetached("a"))
+		assert.Equal(t, 3, q.position("c"))
+		assert.False(t, q.runDetached("a"))
+	})
+
+	t.Run("Остановка ждет задачу, запущенную вне обработчиков", func(t *testing.T) {
+		q := newTaskQueue(0, 10)
+		release := make(chan struct{})
+		finished := make(chan struct{})
+		require.NoError(t, q.push("a", 0, func() {
+			<-release
+			close(finished)
+		}))
+		require.True(t, q.runDetached("a"))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		require.Error(t, q.stop(ctx))
+
+		close(release)
+		require.NoError(t, q.stop(context.Background()))
+		select {
+		case <-finished:
+		default:
+			t.Fatal("stop вернулся до завершения задачи")
+		}
+	})
+
+	t.Run("Ограничение размера очереди", func(t *testing.T) {
+		q := newTaskQueue(0, 2)
+		require.NoError(t, q.push("a", 0, func() {}))
+		assert.False(t, q.full())
+		require.NoError(t, q.push("b", 0, func() {}))
+		assert.True(t, q.full())
+		assert.ErrorIs(t, q.push("c", MaxTaskPriority, func() {}), ErrQueueFull)
+	})
+
+	t.Run("Ограничение числа одновременных задач", func(t *testing.T) {
+		q := newTaskQueue(1, 10)
+		release := make(chan struct{})
+		started := make(chan string, 2)
+		require.NoError(t, q.push("first", 0, func() {
+			started <- "first"
+			<-release
+		}))
+		require.NoError(t, q.push("second", 0, func() { started <- "second" }))
+
+		assert.Equal(t, "first", <-started)
+		select {
+		case <-started:
+			t.Fatal("вторая задача запущена до завершения первой")
+		case <-time.After(50 * time.Millisecond):
+		}
+		assert.Equal(t, 1, q.position("second"))
+
+		close(release)
+		assert.Equal(t, "second", <-started)
+	})
+
+	t.Run("Остановка", func(t *testing.T) {
+		q := newTaskQueue(1, 10)
+		release := make(chan struct{})
+		var finished []string
+		require.NoError(t, q.push("running", 0, func() {
+			<-release
+			finished = append(finished, "running")
+		}))
+		require.NoError(t, q.push("queued", 0, func() { finished = append(finished, "queued") }))
+
+		stopped := make(chan error, 1)
+		go func() { stopped <- q.stop(context.Background()) }()
+		require.Eventually(t, func() bool {
+			return errors.Is(q.push("late", 0, func() {}), ErrQueueStopped)
+		}, time.Second, 5*time.Millisecond)
+
+		// Остановка ждет выполняющуюся задачу и задачи, оставшиеся в очереди.
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, q.stop(ctx), context.DeadlineExceeded)
+
+		close(release)
+		require.NoError(t, <-stopped)
+		assert.Equal(t, []string{"running", "queued"}, finished)
+	})
+
+	t.Run("Оценка Retry-After", func(t *testing.T) {
+		q := newTaskQueue(0, 1)
+		q.workers = 2
+		assert.Equal(t, queueDefaultRetryAfter, q.retryAfter())
+		q.recordDuration(10 * time.Second)
+		assert.Equal(t, 5*time.Second, q.retryAfter())
+		q.recordDuration(100 * time.Millisecond)
+		assert.Less(t, q.retryAfter(), 5*time.Second)
+	})
+
+	t.Run("Разбор приоритета", func(t *testing.T) {
+		for raw, want := range map[string]int{"": 0, "3": 3, " -10 ": -10, "10": 10} {
+			got, err := parseTaskPriority(raw)
+			require.NoError(t, err, raw)
+			assert.Equal(t, want, got)
+		}
+		for _, raw := range []string{"11", "-11", "high"} {
+			_, err := parseTaskPriority(raw)
+			assert.Error(t, err, raw)
+		}
+	})
+}
+
+func TestServer_TaskQueue(t *testing.T) {
+	cfg := &config.Config{
+		Server:     config.Server{CleanupInterval: time.Minute},
+		Processing: config.Processing{CacheTTL: time.Minute, MaxConcurrentTasks: 1, MaxQueuedTasks: 1},
+	}
+	mockProc := new(mockProcessor)
+	srv, err := New(cfg, mockProc, NewTaskStore(), cache.NewCacheStore())
+	require.NoError(t, err)
+
+	submit := func(fields map[string][]string) *httptest.ResponseRecorder {
+		body, contentType := newUploadForm(t, fields)
+		req := httptest.NewRequest("POST", "/api/v1/process", body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+		return rr
+	}
+	taskIDOf := func(rr *httptest.ResponseRecorder) string {
+		var created map[string]string
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+		return created["task_id"]
+	}
+	status := func(taskID string) map[string]any {
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/api/v1/tasks/"+taskID, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		return resp
+	}
+
+	// Первая задача занимает единственный обработчик, пока тест ее не отпустит.
+	release := make(chan struct{})
+	started := make(chan struct{})
+	mockProc.On("ProcessChat", mock.Anything, mock.AnythingOfType("[]string"), domain.ChatFilter{Names: []string{"running"}}).
+		Run(func(args mock.Arguments) {
+			close(started)
+			<-release
+		}).
+		Return([]domain.User{}, nil).Once()
+
+	rr := submit(map[string][]string{"chat_name": {"running"}})
+	require.Equal(t, http.StatusAccepted, rr.Code)
+	runningID := taskIDOf(rr)
+	<-started
+
+	rr = submit(map[string][]string{"chat_name": {"queued"}, "priority": {"3"}})
+	require.Equal(t, http.StatusAccepted, rr.Code)
+	queuedID := taskIDOf(rr)
+
+	t.Run("Позиция в очереди", func(t *testing.T) {
+		resp := status(queuedID)
+		assert.Equal(t, string(TaskStatusPending), resp["status"])
+		assert.Equal(t, float64(1), resp["queue_position"])
+		assert.Equal(t, "queued", resp["progress"].(map[string]any)["stage"])
+
+		assert.NotContains(t, status(runningID), "queue_position")
+	})
+
+	t.Run("Заполненная очередь", func(t *testing.T) {
+		rr := submit(nil)
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Equal(t, "30", rr.Header().Get("Retry-After"))
+	})
+
+	t.Run("Отмена задачи в очереди", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, httptest.NewRequest("DELETE", "/api/v1/tasks/"+queuedID, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		resp := status(queuedID)
+		assert.Equal(t, string(TaskStatusCancelled), resp["status"])
+		assert.NotContains(t, resp, "queue_position")
+
+		// Место в очереди освободилось.
+		mockProc.On("ProcessChat", mock.Anything, mock.AnythingOfType("[]string"), domain.ChatFilter{}).
+			Return([]domain.User{}, nil).Once()
+		rr = submit(nil)
+		require.Equal(t, http.StatusAccepted, rr.Code)
+		nextID := taskIDOf(rr)
+
+		close(release)
+		assert.Eventually(t, func() bool {
+			return status(nextID)["status"] == string(TaskStatusCompleted)
+		}, 5*time.Second, 10*time.Millisecond)
+		mockProc.AssertExpectations(t)
+	})
+
+	t.Run("Некорректный приоритет", func(t *testing.T) {
+		rr := submit(map[string][]string{"priority": {"urgent"}})
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	cfg := &config.Config{
+		Server:     config.Server{CleanupInterval: time.Minute},
+		Processing: config.Processing{CacheTTL: time.Minute, MaxConcurrentTasks: 1, MaxQueuedTasks: 10},
+	}
+	mockProc := new(mockProcessor)
+	cacheStore := cache.NewCacheStore()
+	srv, err := New(cfg, mockProc, NewTaskStore(), cacheStore)
+	require.NoError(t, err)
+
+	submit := func(target string, body io.Reader, contentType string) string {
+		req := httptest.NewRequest("POST", target, body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusAccepted, rr.Code)
+		var created map[string]string
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+		return created["task_id"]
+	}
+	waitStatus := func(taskID string, want TaskStatus) {
+		t.Helper()
+		assert.Eventually(t, func() bool {
+			task, err := srv.taskStore.GetTask(taskID)
+			return err == nil && task.Status == want
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	// Задача по хэшу выполняется обработчиком очереди.
+	require.NoError(t, cacheStore.Put("hash-1", []domain.User{{ID: 1}}, time.Minute))
+	hashID := submit("/api/v1/process-by-hash", strings.NewReader(`{"hash":"hash-1"}`), "application/json")
+	waitStatus(hashID, TaskStatusCompleted)
+
+	// Первая задача выполняется до отмены контекста, вторая ждет в очереди.
+	started := make(chan struct{})
+	mockProc.On("ProcessChat", mock.Anything, mock.AnythingOfType("[]string"), domain.ChatFilter{}).
+		Run(func(args mock.Arguments) {
+			close(started)
+			<-args.Get(0).(context.Context).Done()
+		}).
+		Return(nil, context.Canceled).Once()
+	body, contentType := newUploadForm(t, nil)
+	runningID := submit("/api/v1/process", body, contentType)
+	<-started
+	body, contentType = newUploadForm(t, nil)
+	queuedID := submit("/api/v1/process", body, contentType)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, srv.Shutdown(ctx))
+
+	for _, id := range []string{runningID, queuedID} {
+		task, err := srv.taskStore.GetTask(id)
+		require.NoError(t, err)
+		assert.Equal(t, TaskStatusFailed, task.Status, id)
+		assert.Equal(t, InterruptedTaskMessage, task.ErrorMessage, id)
+	}
+	assert.ErrorIs(t, srv.queue.push("late", 0, func() {}), ErrQueueStopped)
+	mockProc.AssertExpectations(t)
+}
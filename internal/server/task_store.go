@@ -2,9 +2,12 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"sync"
+	"log/slog"
 	"telegram-chat-parser/internal/domain"
+	"telegram-chat-parser/internal/progress"
+	"telegram-chat-parser/internal/storage"
 	"time"
 )
 
@@ -16,113 +19,285 @@ const (
 	TaskStatusProcessing TaskStatus = "processing"
 	TaskStatusCompleted  TaskStatus = "completed"
 	TaskStatusFailed     TaskStatus = "failed"
+	TaskStatusCancelled  TaskStatus = "cancelled"
+	// TaskStatusPartial — обработка прервана (например, по таймауту), но часть участников
+	// обогащена. Необработанные участники перечислены в Task.Unresolved.
+	TaskStatusPartial TaskStatus = "partial"
 )
 
+// InterruptedTaskMessage — сообщение об ошибке задачи, прерванной перезапуском сервера.
+const InterruptedTaskMessage = "interrupted by restart"
+
+// ErrTaskFinished возвращается при попытке отменить уже завершенную задачу.
+var ErrTaskFinished = errors.New("task is already finished")
+
+// IsFinished сообщает, находится ли задача в конечном статусе.
+func (s TaskStatus) IsFinished() bool {
+	return s == TaskStatusCompleted || s == TaskStatusFailed || s == TaskStatusCancelled || s == TaskStatusPartial
+}
+
+// HasResult сообщает, можно ли получить результат задачи в этом статусе.
+func (s TaskStatus) HasResult() bool {
+	return s == TaskStatusCompleted || s == TaskStatusCancelled || s == TaskStatusPartial
+}
+
 // Task представляет собой одну задачу обработки
 type Task struct {
-	ID           string
-	Status       TaskStatus
-	Result       []domain.User
-	ErrorMessage string
-	CreatedAt    time.Time
-	ExpiresAt    time.Time // Для автоматической очистки
+	ID     string        `json:"id"`
+	Status TaskStatus    `json:"status"`
+	Result []domain.User `json:"result,omitempty"`
+	// Unresolved перечисляет участников, не попавших в частичный результат, с причинами.
+	Unresolved   []domain.UnresolvedParticipant `json:"unresolved,omitempty"`
+	ErrorMessage string                         `json:"error_message,omitempty"`
+	// Progress — итоговый прогресс обработки; прогресс выполняющейся задачи хранится в памяти.
+	Progress *progress.Snapshot `json:"progress,omitempty"`
+	// Callback — адрес уведомления о завершении задачи и история его доставки.
+	Callback *TaskCallback `json:"callback,omitempty"`
+	// Owner — имя ключа API, создавшего задачу; пусто, если аутентификация отключена.
+	Owner     string    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"` // Для автоматической очистки
+}
+
+// CallbackStatus представляет состояние доставки уведомления о завершении задачи
+type CallbackStatus string
+
+const (
+	// CallbackPending — уведомление еще не отправлено или ожидает повторной попытки.
+	CallbackPending CallbackStatus = "pending"
+	// CallbackDelivered — получатель ответил кодом 2xx.
+	CallbackDelivered CallbackStatus = "delivered"
+	// CallbackFailed — попытки исчерпаны или получатель отклонил уведомление.
+	CallbackFailed CallbackStatus = "failed"
+)
+
+// TaskCallback описывает уведомление о завершении задачи.
+type TaskCallback struct {
+	URL string `json:"url"`
+	// ResultURL — ссылка на результат задачи, передаваемая в уведомлении.
+	ResultURL string            `json:"result_url"`
+	Status    CallbackStatus    `json:"status"`
+	Attempts  []CallbackAttempt `json:"attempts,omitempty"`
 }
 
-// TaskStore управляет хранением и извлечением задач
+// CallbackAttempt — одна попытка доставки уведомления.
+type CallbackAttempt struct {
+	Attempt int       `json:"attempt"`
+	At      time.Time `json:"at"`
+	// StatusCode — код ответа получателя; 0, если ответ не получен.
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// TaskStore управляет хранением и извлечением задач.
+// Задачи хранятся в storage.Store: в памяти или во встроенной базе на диске.
 type TaskStore struct {
-	tasks map[string]*Task
-	mutex sync.RWMutex
+	store storage.Store[Task]
 }
 
-// NewTaskStore создает новый экземпляр TaskStore
+// NewTaskStore создает новый экземпляр TaskStore с хранением задач в памяти
 func NewTaskStore() *TaskStore {
-	return &TaskStore{
-		tasks: make(map[string]*Task),
-	}
+	return NewTaskStoreWithStorage(storage.NewMemoryStore[Task]())
+}
+
+// NewTaskStoreWithStorage создает TaskStore поверх указанного хранилища.
+func NewTaskStoreWithStorage(store storage.Store[Task]) *TaskStore {
+	return &TaskStore{store: store}
 }
 
 // CreateTask создает новую задачу со статусом 'pending'
-func (ts *TaskStore) CreateTask(taskID string, ttl time.Duration) {
-	ts.mutex.Lock()
-	defer ts.mutex.Unlock()
+func (ts *TaskStore) CreateTask(taskID string, ttl time.Duration) error {
+	return ts.CreateOwnedTask(taskID, "", ttl)
+}
 
+// CreateOwnedTask создает новую задачу со статусом 'pending', принадлежащую владельцу owner.
+func (ts *TaskStore) CreateOwnedTask(taskID, owner string, ttl time.Duration) error {
 	now := time.Now()
-	ts.tasks[taskID] = &Task{
+	task := Task{
 		ID:        taskID,
 		Status:    TaskStatusPending,
+		Owner:     owner,
 		CreatedAt: now,
 		ExpiresAt: now.Add(ttl),
 	}
+	if err := ts.store.Put(taskID, task, task.ExpiresAt); err != nil {
+		return fmt.Errorf("не удалось сохранить задачу %s: %w", taskID, err)
+	}
+	return nil
 }
 
-// UpdateTaskStatus обновляет статус задачи
+// UpdateTaskStatus обновляет статус задачи. Статус отмененной задачи не изменяется.
 func (ts *TaskStore) UpdateTaskStatus(taskID string, status TaskStatus) error {
-	ts.mutex.Lock()
-	defer ts.mutex.Unlock()
+	return ts.update(taskID, func(task *Task) {
+		if task.Status != TaskStatusCancelled {
+			task.Status = status
+		}
+	})
+}
 
-	task, exists := ts.tasks[taskID]
-	if !exists {
-		return fmt.Errorf("задача с ID %s не найдена", taskID)
-	}
+// UpdateTaskResult обновляет результат и статус задачи на 'completed'.
+// Для отмененной задачи сохраняется частичный результат, а статус остается 'cancelled'.
+func (ts *TaskStore) UpdateTaskResult(taskID string, result []domain.User) error {
+	return ts.update(taskID, func(task *Task) {
+		if task.Status != TaskStatusCancelled {
+			task.Status = TaskStatusCompleted
+		}
+		task.Result = result
+	})
+}
 
-	task.Status = status
-	return nil
+// UpdateTaskPartialResult сохраняет частичный результат, список необработанных участников
+// и ошибку, прервавшую обработку, и переводит задачу в статус 'partial'.
+// Статус отмененной задачи не изменяется.
+func (ts *TaskStore) UpdateTaskPartialResult(taskID string, result []domain.User, unresolved []domain.UnresolvedParticipant, errorMessage string) error {
+	return ts.update(taskID, func(task *Task) {
+		if task.Status != TaskStatusCancelled {
+			task.Status = TaskStatusPartial
+		}
+		task.Result = result
+		task.Unresolved = unresolved
+		task.ErrorMessage = errorMessage
+	})
 }
 
-// UpdateTaskResult обновляет результат и статус задачи на 'completed'
-func (ts *TaskStore) UpdateTaskResult(taskID string, result []domain.User) error {
-	ts.mutex.Lock()
-	defer ts.mutex.Unlock()
+// UpdateTaskProgress сохраняет итоговый прогресс обработки задачи.
+func (ts *TaskStore) UpdateTaskProgress(taskID string, snapshot progress.Snapshot) error {
+	return ts.update(taskID, func(task *Task) {
+		task.Progress = &snapshot
+	})
+}
 
-	task, exists := ts.tasks[taskID]
-	if !exists {
-		return fmt.Errorf("задача с ID %s не найдена", taskID)
-	}
+// SetTaskCallback задает адрес уведомления о завершении задачи.
+func (ts *TaskStore) SetTaskCallback(taskID, callbackURL, resultURL string) error {
+	return ts.update(taskID, func(task *Task) {
+		task.Callback = &TaskCallback{URL: callbackURL, ResultURL: resultURL, Status: CallbackPending}
+	})
+}
 
-	task.Status = TaskStatusCompleted
-	task.Result = result
-	return nil
+// AddCallbackAttempt записывает попытку доставки уведомления и новое состояние доставки.
+func (ts *TaskStore) AddCallbackAttempt(taskID string, attempt CallbackAttempt, status CallbackStatus) error {
+	return ts.update(taskID, func(task *Task) {
+		if task.Callback == nil {
+			return
+		}
+		// Задачи из хранилища в памяти разделяют указатель на Callback, поэтому
+		// он заменяется копией, а не изменяется на месте.
+		callback := *task.Callback
+		callback.Attempts = append(append([]CallbackAttempt(nil), callback.Attempts...), attempt)
+		callback.Status = status
+		task.Callback = &callback
+	})
 }
 
-// UpdateTaskError обновляет сообщение об ошибке и статус задачи на 'failed'
+// UpdateTaskError обновляет сообщение об ошибке и статус задачи на 'failed'.
+// Отмененная задача не изменяется.
 func (ts *TaskStore) UpdateTaskError(taskID string, errorMessage string) error {
-	ts.mutex.Lock()
-	defer ts.mutex.Unlock()
+	return ts.update(taskID, func(task *Task) {
+		if task.Status == TaskStatusCancelled {
+			return
+		}
+		task.Status = TaskStatusFailed
+		task.ErrorMessage = errorMessage
+	})
+}
 
-	task, exists := ts.tasks[taskID]
-	if !exists {
-		return fmt.Errorf("задача с ID %s не найдена", taskID)
+// CancelTask переводит незавершенную задачу в статус 'cancelled'.
+// Для завершенной задачи возвращает ErrTaskFinished.
+func (ts *TaskStore) CancelTask(taskID string) error {
+	var finished bool
+	err := ts.update(taskID, func(task *Task) {
+		if task.Status.IsFinished() {
+			finished = true
+			return
+		}
+		task.Status = TaskStatusCancelled
+	})
+	if err != nil {
+		return err
+	}
+	if finished {
+		return fmt.Errorf("задача с ID %s: %w", taskID, ErrTaskFinished)
 	}
-
-	task.Status = TaskStatusFailed
-	task.ErrorMessage = errorMessage
 	return nil
 }
 
-// GetTask извлекает задачу по ее ID
+// GetTask извлекает задачу по ее ID. Просроченные задачи не возвращаются.
 func (ts *TaskStore) GetTask(taskID string) (*Task, error) {
-	ts.mutex.RLock()
-	defer ts.mutex.RUnlock()
-
-	task, exists := ts.tasks[taskID]
-	if !exists {
+	task, err := ts.store.Get(taskID)
+	if errors.Is(err, storage.ErrNotFound) {
 		return nil, fmt.Errorf("задача с ID %s не найдена", taskID)
 	}
+	if err != nil {
+		return nil, fmt.Errorf("не удалось загрузить задачу %s: %w", taskID, err)
+	}
+	return &task, nil
+}
 
-	return task, nil
+// DeleteTask удаляет задачу из хранилища.
+func (ts *TaskStore) DeleteTask(taskID string) error {
+	if err := ts.store.Delete(taskID); err != nil {
+		return fmt.Errorf("не удалось удалить задачу %s: %w", taskID, err)
+	}
+	return nil
 }
 
+// FailInterrupted переводит задачи, оставшиеся в статусах 'pending' и 'processing',
+// в статус 'failed' с сообщением reason и возвращает их количество. Вызывается при
+// запуске с постоянным хранилищем: очередь задач хранится в памяти, поэтому задачи,
+// не завершенные до перезапуска, уже никогда не будут выполнены.
+func (ts *TaskStore) FailInterrupted(reason string) (int, error) {
+	ids, err := ts.store.Keys()
+	if err != nil {
+		return 0, fmt.Errorf("не удалось получить список задач: %w", err)
+	}
+	failed := 0
+	for _, id := range ids {
+		err := ts.store.Update(id, func(task *Task) error {
+			if task.Status != TaskStatusPending && task.Status != TaskStatusProcessing {
+				return errTaskUnchanged
+			}
+			task.Status = TaskStatusFailed
+			task.ErrorMessage = reason
+			return nil
+		})
+		switch {
+		case err == nil:
+			failed++
+		case errors.Is(err, errTaskUnchanged), errors.Is(err, storage.ErrNotFound):
+		default:
+			return failed, fmt.Errorf("не удалось обновить задачу %s: %w", id, err)
+		}
+	}
+	return failed, nil
+}
+
+// errTaskUnchanged прерывает обновление задачи, которую не нужно изменять.
+var errTaskUnchanged = errors.New("task unchanged")
+
 // CleanupExpired удаляет просроченные задачи из хранилища
 func (ts *TaskStore) CleanupExpired() {
-	ts.mutex.Lock()
-	defer ts.mutex.Unlock()
+	removed, err := ts.store.DeleteExpired(time.Now())
+	if err != nil {
+		slog.Error("failed to cleanup expired tasks", "error", err)
+		return
+	}
+	if removed > 0 {
+		slog.Debug("expired tasks removed", "count", removed)
+	}
+}
 
-	now := time.Now()
-	for taskID, task := range ts.tasks {
-		if now.After(task.ExpiresAt) {
-			delete(ts.tasks, taskID)
-		}
+func (ts *TaskStore) update(taskID string, fn func(task *Task)) error {
+	err := ts.store.Update(taskID, func(task *Task) error {
+		fn(task)
+		return nil
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("задача с ID %s не найдена", taskID)
+	}
+	if err != nil {
+		return fmt.Errorf("не удалось обновить задачу %s: %w", taskID, err)
 	}
+	return nil
 }
 
 // StartCleanupTicker запускает тикер для периодической очистки просроченных задач
@@ -2,7 +2,9 @@ package server
 
 import (
 	"context"
+	"path/filepath"
 	"telegram-chat-parser/internal/domain"
+	"telegram-chat-parser/internal/storage"
 	"testing"
 	"time"
 
@@ -14,7 +16,7 @@ func TestTaskStore(t *testing.T) {
 	t.Run("NewTaskStore", func(t *testing.T) {
 		ts := NewTaskStore()
 		assert.NotNil(t, ts)
-		assert.NotNil(t, ts.tasks)
+		assert.NotNil(t, ts.store)
 	})
 
 	t.Run("CreateAndGetTask", func(t *testing.T) {
@@ -71,6 +73,35 @@ func TestTaskStore(t *testing.T) {
 		assert.Error(t, err)
 	})
 
+	t.Run("UpdateTaskPartialResult", func(t *testing.T) {
+		ts := NewTaskStore()
+		taskID := "task-1"
+		ts.CreateTask(taskID, time.Minute)
+
+		result := []domain.User{{ID: 1, Name: "User"}}
+		unresolved := []domain.UnresolvedParticipant{{Username: "slow", Reason: domain.UnresolvedTimeout}}
+		require.NoError(t, ts.UpdateTaskPartialResult(taskID, result, unresolved, "timed out"))
+
+		task, _ := ts.GetTask(taskID)
+		assert.Equal(t, TaskStatusPartial, task.Status)
+		assert.True(t, task.Status.IsFinished())
+		assert.True(t, task.Status.HasResult())
+		assert.Equal(t, result, task.Result)
+		assert.Equal(t, unresolved, task.Unresolved)
+		assert.Equal(t, "timed out", task.ErrorMessage)
+
+		// Отмененная задача сохраняет частичный результат, но остается отмененной.
+		cancelledID := "task-2"
+		ts.CreateTask(cancelledID, time.Minute)
+		require.NoError(t, ts.CancelTask(cancelledID))
+		require.NoError(t, ts.UpdateTaskPartialResult(cancelledID, result, unresolved, "context canceled"))
+		task, _ = ts.GetTask(cancelledID)
+		assert.Equal(t, TaskStatusCancelled, task.Status)
+		assert.Equal(t, unresolved, task.Unresolved)
+
+		assert.Error(t, ts.UpdateTaskPartialResult("non-existent", nil, nil, ""))
+	})
+
 	t.Run("UpdateTaskError", func(t *testing.T) {
 		ts := NewTaskStore()
 		taskID := "task-1"
@@ -88,6 +119,34 @@ func TestTaskStore(t *testing.T) {
 		assert.Error(t, err)
 	})
 
+	t.Run("CancelTask", func(t *testing.T) {
+		ts := NewTaskStore()
+		taskID := "task-1"
+		ts.CreateTask(taskID, time.Minute)
+		ts.UpdateTaskStatus(taskID, TaskStatusProcessing)
+
+		require.NoError(t, ts.CancelTask(taskID))
+
+		// Завершение отмененной задачи сохраняет частичный результат, но не меняет статус.
+		result := []domain.User{{ID: 1}}
+		require.NoError(t, ts.UpdateTaskResult(taskID, result))
+		require.NoError(t, ts.UpdateTaskError(taskID, "context canceled"))
+		require.NoError(t, ts.UpdateTaskStatus(taskID, TaskStatusProcessing))
+
+		task, _ := ts.GetTask(taskID)
+		assert.Equal(t, TaskStatusCancelled, task.Status)
+		assert.Equal(t, result, task.Result)
+		assert.Empty(t, task.ErrorMessage)
+
+		assert.ErrorIs(t, ts.CancelTask(taskID), ErrTaskFinished)
+		assert.Error(t, ts.CancelTask("non-existent"))
+
+		completedID := "task-2"
+		ts.CreateTask(completedID, time.Minute)
+		ts.UpdateTaskResult(completedID, nil)
+		assert.ErrorIs(t, ts.CancelTask(completedID), ErrTaskFinished)
+	})
+
 	t.Run("CleanupExpired", func(t *testing.T) {
 		ts := NewTaskStore()
 		expiredTaskID := "expired"
@@ -125,3 +184,80 @@ func TestTaskStore_StartCleanupTicker(t *testing.T) {
 	cancel()
 	time.Sleep(50 * time.Millisecond)
 }
+
+func TestTaskStore_PersistentStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.db")
+	open := func() (*TaskStore, func()) {
+		db, err := storage.OpenBolt(path)
+		require.NoError(t, err)
+		store, err := storage.NewBoltStore[Task](db, "tasks")
+		require.NoError(t, err)
+		return NewTaskStoreWithStorage(store), func() { db.Close() }
+	}
+
+	ts, closeDB := open()
+	require.NoError(t, ts.CreateTask("task-1", time.Minute))
+	result := []domain.User{{ID: 1, Name: "User", Sources: []domain.ParticipantSource{domain.SourceAuthor}}}
+	require.NoError(t, ts.UpdateTaskResult("task-1", result))
+	require.NoError(t, ts.CreateTask("expired", -time.Minute))
+	closeDB()
+
+	// После перезапуска задача и ее результат доступны, просроченная задача — нет.
+	ts, closeDB = open()
+	defer closeDB()
+
+	task, err := ts.GetTask("task-1")
+	require.NoError(t, err)
+	assert.Equal(t, TaskStatusCompleted, task.Status)
+	assert.Equal(t, result, task.Result)
+
+	_, err = ts.GetTask("expired")
+	assert.Error(t, err)
+}
+
+func TestTaskStore_FailInterrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.db")
+	open := func() (*TaskStore, func()) {
+		db, err := storage.OpenBolt(path)
+		require.NoError(t, err)
+		store, err := storage.NewBoltStore[Task](db, "tasks")
+		require.NoError(t, err)
+		return NewTaskStoreWithStorage(store), func() { db.Close() }
+	}
+
+	ts, closeDB := open()
+	require.NoError(t, ts.CreateTask("pending", time.Minute))
+	require.NoError(t, ts.CreateTask("processing", time.Minute))
+	require.NoError(t, ts.UpdateTaskStatus("processing", TaskStatusProcessing))
+	require.NoError(t, ts.CreateTask("completed", time.Minute))
+	require.NoError(t, ts.UpdateTaskResult("completed", nil))
+	require.NoError(t, ts.CreateTask("cancelled", time.Minute))
+	require.NoError(t, ts.CancelTask("cancelled"))
+	closeDB()
+
+	// После перезапуска незавершенные задачи никто не выполнит: они помечаются ошибкой.
+	ts, closeDB = open()
+	defer closeDB()
+
+	failed, err := ts.FailInterrupted(InterruptedTaskMessage)
+	require.NoError(t, err)
+	assert.Equal(t, 2, failed)
+
+	for _, id := range []string{"pending", "processing"} {
+		task, err := ts.GetTask(id)
+		require.NoError(t, err)
+		assert.Equal(t, TaskStatusFailed, task.Status, id)
+		assert.Equal(t, InterruptedTaskMessage, task.ErrorMessage, id)
+	}
+	task, err := ts.GetTask("completed")
+	require.NoError(t, err)
+	assert.Equal(t, TaskStatusCompleted, task.Status)
+	task, err = ts.GetTask("cancelled")
+	require.NoError(t, err)
+	assert.Equal(t, TaskStatusCancelled, task.Status)
+
+	// Повторный запуск ничего не меняет.
+	failed, err = ts.FailInterrupted(InterruptedTaskMessage)
+	require.NoError(t, err)
+	assert.Zero(t, failed)
+}
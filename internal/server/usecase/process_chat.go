@@ -5,14 +5,24 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"log/slog"
+	"os"
 	"telegram-chat-parser/internal/adapters/source"
 	"telegram-chat-parser/internal/cache"
 	"telegram-chat-parser/internal/domain"
 	"telegram-chat-parser/internal/pkg/config"
 	"telegram-chat-parser/internal/ports"
+	"telegram-chat-parser/internal/progress"
+	"telegram-chat-parser/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// progressBatch — через сколько сообщений разбор сообщает трекеру прогресса о просмотренных сообщениях.
+const progressBatch = 1000
+
 // ProcessChatUseCase инкапсулирует бизнес-логику для обработки файла экспорта чата.
 type ProcessChatUseCase struct {
 	cfg        *config.Config
@@ -22,7 +32,8 @@ type ProcessChatUseCase struct {
 	cacheStore *cache.CacheStore
 }
 
-// NewProcessChatUseCase создает новый экземпляр ProcessChatUseCase.
+// NewProcessChatUseCase создает новый экземпляр ProcessChatUseCase. parser должен
+// реализовывать ports.MultiChatParser: экспорт разбирается только потоково.
 func NewProcessChatUseCase(
 	cfg *config.Config,
 	parser ports.Parser,
@@ -39,90 +50,148 @@ func NewProcessChatUseCase(
 	}
 }
 
+// chatSource описывает один файл экспорта, который можно прочитать потоково.
+// open может вызываться несколько раз: сначала для вычисления хеша, затем для разбора.
+type chatSource struct {
+	name string
+	open func() (io.ReadCloser, error)
+}
+
 // ProcessChat обрабатывает несколько файлов экспорта чата.
 // Он извлекает, разбирает, объединяет участников и затем обогащает их данные.
-func (uc *ProcessChatUseCase) ProcessChat(ctx context.Context, filePaths []string) ([]domain.User, error) {
-	taskTimeout := uc.cfg.Processing.TaskTimeout
-	slog.InfoContext(ctx, "Starting chat processing task", "configured_timeout", taskTimeout.String())
+// Файлы читаются потоково, поэтому их размер не ограничен объемом памяти.
+// Архивы ZIP и tar.gz заменяются найденными в них файлами экспорта.
+// filter выбирает чаты полного экспорта аккаунта; пустой фильтр выбирает все чаты.
+func (uc *ProcessChatUseCase) ProcessChat(ctx context.Context, filePaths []string, filter domain.ChatFilter) (users []domain.User, err error) {
+	ctx, span := tracing.Start(ctx, "ProcessChatUseCase.ProcessChat", attribute.Int("files", len(filePaths)))
+	defer func() { tracing.End(span, err) }()
+
+	filePaths, cleanup, err := uc.expandArchives(filePaths)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
 
-	// Создаем новый контекст с таймаутом для всей задачи, если он задан.
-	// 0 означает отсутствие таймаута.
-	var taskCtx context.Context
-	var cancel context.CancelFunc
-	if taskTimeout > 0 {
-		taskCtx, cancel = context.WithTimeout(ctx, taskTimeout)
-	} else {
-		taskCtx, cancel = context.WithCancel(ctx)
+	return uc.process(ctx, fileSources(filePaths), filter)
+}
+
+// ListChats перечисляет чаты, содержащиеся в файлах экспорта, не извлекая участников.
+// Позволяет клиенту выбрать чаты полного экспорта аккаунта перед обработкой.
+func (uc *ProcessChatUseCase) ListChats(ctx context.Context, filePaths []string) ([]domain.ChatInfo, error) {
+	multiParser, ok := uc.parser.(ports.MultiChatParser)
+	if !ok {
+		return nil, fmt.Errorf("parser does not support listing chats")
 	}
-	defer cancel()
 
-	var allRawParticipants []domain.RawParticipant
-	var fileHashes []string
+	filePaths, cleanup, err := uc.expandArchives(filePaths)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
 
-	for _, filePath := range filePaths {
-		fileHash, err := cache.CalculateFileHash(filePath)
+	var chats []domain.ChatInfo
+	for _, src := range fileSources(filePaths) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		found, err := listSourceChats(multiParser, src)
 		if err != nil {
-			return nil, fmt.Errorf("failed to compute hash of file %s: %w", filePath, err)
+			return nil, err
 		}
-		fileHashes = append(fileHashes, fileHash)
+		chats = append(chats, found...)
 	}
+	return chats, nil
+}
 
-	// Создание единого хеша для набора файлов
-	combinedHash := cache.CalculateHashFromString(fmt.Sprintf("%v", fileHashes))
+func listSourceChats(multiParser ports.MultiChatParser, src chatSource) ([]domain.ChatInfo, error) {
+	r, err := src.open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract data from %s: %w", src.name, err)
+	}
+	defer r.Close()
 
-	// Проверка кеша по единому хешу
-	if cachedItem, found := uc.cacheStore.Get(combinedHash); found {
-		slog.Info("Попадание в кеш для набора файлов", "hash", combinedHash)
-		return cachedItem.Data, nil
+	chats, err := multiParser.ParseChats(r, domain.ChatFilter{}, func(*domain.ChatInfo, *domain.Message) error { return nil })
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse data from %s: %w", src.name, err)
 	}
+	return chats, nil
+}
 
+// fileSources создает источники для файлов на диске.
+func fileSources(filePaths []string) []chatSource {
+	sources := make([]chatSource, 0, len(filePaths))
 	for _, filePath := range filePaths {
-		slog.Info("Обработка файла", "path", filePath)
+		sources = append(sources, chatSource{
+			name: filePath,
+			open: func() (io.ReadCloser, error) { return os.Open(filePath) },
+		})
+	}
+	return sources
+}
+
+// expandArchives заменяет архивы в списке файлов на извлеченные из них файлы экспорта.
+// Извлеченные файлы размещаются во временном каталоге, который удаляет возвращаемая функция cleanup.
+func (uc *ProcessChatUseCase) expandArchives(filePaths []string) ([]string, func(), error) {
+	cleanup := func() {}
+	limits := source.ArchiveLimits{
+		MaxEntries:        uc.cfg.Processing.MaxArchiveEntries,
+		MaxExtractedBytes: uc.cfg.Processing.MaxArchiveExtractedMB << 20,
+	}
 
-		ds := source.NewCliSource(filePath)
-		data, err := ds.Fetch()
+	var workDir string
+	expanded := make([]string, 0, len(filePaths))
+	for _, filePath := range filePaths {
+		kind, err := source.DetectArchive(filePath)
 		if err != nil {
-			return nil, fmt.Errorf("failed to extract data from %s: %w", filePath, err)
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to extract data from %s: %w", filePath, err)
+		}
+		if kind == source.ArchiveNone {
+			expanded = append(expanded, filePath)
+			continue
 		}
 
-		chat, err := uc.parser.Parse(data)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse data from %s: %w", filePath, err)
+		if workDir == "" {
+			workDir, err = os.MkdirTemp("", "tg-chat-parser-archive-")
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to create directory for archive: %w", err)
+			}
+			dir := workDir
+			cleanup = func() {
+				if err := os.RemoveAll(dir); err != nil {
+					slog.Warn("Failed to remove archive directory", "dir", dir, "error", err)
+				}
+			}
 		}
-		slog.Info("Разобран чат", "path", filePath, "message_count", len(chat.Messages))
 
-		rawParticipants, err := uc.extractor.ExtractRawParticipants(chat)
+		archiveDir, err := os.MkdirTemp(workDir, "archive-")
 		if err != nil {
-			return nil, fmt.Errorf("failed to extract participants from %s: %w", filePath, err)
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to create directory for archive: %w", err)
 		}
-		slog.Info("Извлечены участники", "path", filePath, "count", len(rawParticipants))
-
-		allRawParticipants = append(allRawParticipants, rawParticipants...)
-	}
-
-	slog.Info("Всего сырых участников из всех чатов", "count", len(allRawParticipants))
 
-	// Обогащение объединенного списка участников
-	slog.Info("Обогащение данных через Telegram API...")
-	finalUsers, err := uc.enricher.Enrich(taskCtx, allRawParticipants)
-	if err != nil {
-		return nil, fmt.Errorf("failed to enrich data: %w", err)
+		paths, err := source.NewArchiveSource(filePath, kind, limits).Extract(archiveDir)
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		slog.Info("Извлечены файлы экспорта из архива", "archive", filePath, "type", kind, "files", len(paths))
+		expanded = append(expanded, paths...)
 	}
 
-	// Кеширование окончательного результата
-	ttl := uc.cfg.Processing.CacheTTL
-	uc.cacheStore.Put(combinedHash, finalUsers, ttl)
-	slog.Info("Результат кеширован для набора файлов", "hash", combinedHash, "ttl", ttl.String())
-
-	slog.Info("Обработка успешно завершена", "user_count", len(finalUsers))
-	return finalUsers, nil
+	return expanded, cleanup, nil
 }
 
-// ProcessChatFromData обрабатывает несколько файлов экспорта чата из данных в памяти.
-// Он разбирает, объединяет участников и затем обогащает их данные.
-func (uc *ProcessChatUseCase) ProcessChatFromData(ctx context.Context, fileDataList [][]byte) ([]domain.User, error) {
+// process реализует общий конвейер: хеширование, проверка кеша, разбор,
+// извлечение участников, обогащение и кеширование результата.
+// О ходе обработки сообщается трекеру из контекста, если он есть.
+func (uc *ProcessChatUseCase) process(ctx context.Context, sources []chatSource, filter domain.ChatFilter) ([]domain.User, error) {
+	tracker := progress.FromContext(ctx)
+	tracker.SetFilesTotal(len(sources))
+	defer tracker.Finish()
+
 	taskTimeout := uc.cfg.Processing.TaskTimeout
-	slog.InfoContext(ctx, "Starting chat processing task from data", "configured_timeout", taskTimeout.String())
+	slog.InfoContext(ctx, "Starting chat processing task", "configured_timeout", taskTimeout.String(), "files", len(sources))
 
 	// Создаем новый контекст с таймаутом для всей задачи, если он задан.
 	// 0 означает отсутствие таймаута.
@@ -138,55 +207,160 @@ func (uc *ProcessChatUseCase) ProcessChatFromData(ctx context.Context, fileDataL
 	var allRawParticipants []domain.RawParticipant
 	var fileHashes []string
 
-	// Вычисляем хеши для каждого блока данных
-	for _, data := range fileDataList {
-		h := sha256.New()
-		h.Write(data)
-		fileHash := hex.EncodeToString(h.Sum(nil))
+	for _, src := range sources {
+		fileHash, err := hashSource(taskCtx, src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute hash of %s: %w", src.name, err)
+		}
 		fileHashes = append(fileHashes, fileHash)
 	}
 
-	// Создание единого хеша для набора файлов
-	combinedHash := cache.CalculateHashFromString(fmt.Sprintf("%v", fileHashes))
+	// Создание единого хеша для набора файлов. Результат для выбранных чатов
+	// отличается от результата по всему экспорту, поэтому фильтр входит в ключ.
+	cacheKey := fmt.Sprintf("%v", fileHashes)
+	if !filter.IsEmpty() {
+		cacheKey += "|" + filter.String()
+	}
+	combinedHash := cache.CalculateHashFromString(cacheKey)
 
 	// Проверка кеша по единому хешу
-	if cachedItem, found := uc.cacheStore.Get(combinedHash); found {
+	cachedItem, found := uc.cacheStore.Get(combinedHash)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("cache.hit", found))
+	if found {
 		slog.Info("Попадание в кеш для набора файлов", "hash", combinedHash)
 		return cachedItem.Data, nil
 	}
 
-	for i, data := range fileDataList {
-		slog.Info("Обработка данных из файла", "index", i, "size", len(data))
-
-		chat, err := uc.parser.Parse(data)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse data from file %d: %w", i, err)
-		}
-		slog.Info("Разобран чат", "index", i, "message_count", len(chat.Messages))
+	selectedChats := 0
+	for _, src := range sources {
+		slog.Info("Обработка файла", "source", src.name)
 
-		rawParticipants, err := uc.extractor.ExtractRawParticipants(chat)
+		rawParticipants, selected, err := uc.extractFromSource(taskCtx, src, filter)
 		if err != nil {
-			return nil, fmt.Errorf("failed to extract participants from file %d: %w", i, err)
+			return nil, err
 		}
-		slog.Info("Извлечены участники", "index", i, "count", len(rawParticipants))
+		slog.Info("Извлечены участники", "source", src.name, "count", len(rawParticipants))
 
+		tracker.FileParsed(len(rawParticipants))
+		selectedChats += selected
 		allRawParticipants = append(allRawParticipants, rawParticipants...)
 	}
 
+	if !filter.IsEmpty() && selectedChats == 0 {
+		return nil, fmt.Errorf("no chats match the filter (%s)", filter)
+	}
+
 	slog.Info("Всего сырых участников из всех чатов", "count", len(allRawParticipants))
 
 	// Обогащение объединенного списка участников
 	slog.Info("Обогащение данных через Telegram API...")
 	finalUsers, err := uc.enricher.Enrich(taskCtx, allRawParticipants)
 	if err != nil {
-		return nil, fmt.Errorf("failed to enrich data: %w", err)
+		// Частичный результат возвращается вместе с ошибкой, например для отмененной задачи,
+		// но не кешируется.
+		return finalUsers, fmt.Errorf("failed to enrich data: %w", err)
 	}
 
 	// Кеширование окончательного результата
 	ttl := uc.cfg.Processing.CacheTTL
-	uc.cacheStore.Put(combinedHash, finalUsers, ttl)
-	slog.Info("Результат кеширован для набора файлов", "hash", combinedHash, "ttl", ttl.String())
+	if err := uc.cacheStore.Put(combinedHash, finalUsers, ttl); err != nil {
+		// Результат уже получен, поэтому ошибка кеширования не прерывает задачу.
+		slog.Warn("Не удалось кешировать результат", "hash", combinedHash, "error", err)
+	} else {
+		slog.Info("Результат кеширован для набора файлов", "hash", combinedHash, "ttl", ttl.String())
+	}
 
 	slog.Info("Обработка успешно завершена", "user_count", len(finalUsers))
 	return finalUsers, nil
 }
+
+// extractFromSource разбирает один источник и извлекает из него участников.
+// Сообщения передаются в коллектор по одному и не накапливаются в памяти.
+// Возвращает также количество выбранных чатов. Разбор прерывается при отмене ctx.
+func (uc *ProcessChatUseCase) extractFromSource(ctx context.Context, src chatSource, filter domain.ChatFilter) (participants []domain.RawParticipant, selected int, err error) {
+	ctx, span := tracing.Start(ctx, "ProcessChatUseCase.extractFromSource", attribute.String("source", src.name))
+	defer func() {
+		span.SetAttributes(attribute.Int("participants", len(participants)))
+		tracing.End(span, err)
+	}()
+
+	// Экспорт разбирается только потоково: парсер без ParseChats загрузил бы его в память целиком.
+	multiParser, ok := uc.parser.(ports.MultiChatParser)
+	if !ok {
+		return nil, 0, fmt.Errorf("parser %T does not support streaming", uc.parser)
+	}
+
+	rc, err := src.open()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to extract data from %s: %w", src.name, err)
+	}
+	defer rc.Close()
+	r := contextReader{ctx: ctx, r: rc}
+
+	tracker := progress.FromContext(ctx)
+	scanned := 0
+	defer func() { tracker.MessagesScanned(scanned % progressBatch) }()
+
+	collector := uc.extractor.NewCollector()
+	// Участники извлекаются по ходу разбора, поэтому спан разбора вложен в спан извлечения.
+	extractCtx, extractSpan := tracing.Start(ctx, "ExtractionService.ExtractRawParticipants")
+	_, parseSpan := tracing.Start(extractCtx, "Parser.ParseChats")
+	chats, err := multiParser.ParseChats(r, filter, func(_ *domain.ChatInfo, msg *domain.Message) error {
+		collector.Add(msg)
+		scanned++
+		if scanned%progressBatch == 0 {
+			tracker.MessagesScanned(progressBatch)
+		}
+		return nil
+	})
+	tracing.End(parseSpan, err)
+	if err != nil {
+		tracing.End(extractSpan, err)
+		return nil, 0, fmt.Errorf("failed to parse data from %s: %w", src.name, err)
+	}
+	participants = collector.Participants()
+	extractSpan.SetAttributes(attribute.Int("messages", scanned))
+	tracing.End(extractSpan, nil)
+
+	for _, chat := range chats {
+		if !chat.Selected {
+			slog.Debug("Чат пропущен фильтром", "source", src.name, "chat_id", chat.ID, "chat_name", chat.Name, "chat_type", chat.Type)
+			continue
+		}
+		selected++
+		slog.Info("Разобран чат", "source", src.name, "chat_id", chat.ID, "chat_name", chat.Name, "chat_type", chat.Type, "message_count", chat.MessageCount)
+	}
+	if len(chats) > 1 {
+		slog.Info("Разобран экспорт с несколькими чатами", "source", src.name, "chats", len(chats), "selected", selected)
+	}
+	return participants, selected, nil
+}
+
+// hashSource вычисляет SHA256 содержимого источника, не загружая его в память целиком.
+func hashSource(ctx context.Context, src chatSource) (string, error) {
+	r, err := src.open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open source: %w", err)
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, contextReader{ctx: ctx, r: r}); err != nil {
+		return "", fmt.Errorf("failed to read source: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// contextReader прерывает чтение после отмены контекста, чтобы разбор и хеширование
+// многогигабайтного файла останавливались без ожидания конца файла.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
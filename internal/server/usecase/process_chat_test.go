@@ -1,39 +1,73 @@
 package usecase
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"telegram-chat-parser/internal/adapters/parser"
 	"telegram-chat-parser/internal/cache"
+	"telegram-chat-parser/internal/core/services"
 	"telegram-chat-parser/internal/domain"
 	"telegram-chat-parser/internal/pkg/config"
+	"telegram-chat-parser/internal/ports"
+	"telegram-chat-parser/internal/progress"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 // Mocks for dependencies
+
+// mockParser — мок потокового парсера. ParseChats передает в fn сообщения, заданные
+// в ожидании для содержимого файла, как сообщения одного выбранного чата.
 type mockParser struct{ mock.Mock }
 
 func (m *mockParser) Parse(data []byte) (*domain.ExportedChat, error) {
-	args := m.Called(data)
-	if res := args.Get(0); res != nil {
-		return res.(*domain.ExportedChat), args.Error(1)
+	return nil, errors.New("mockParser supports only ParseChats")
+}
+
+func (m *mockParser) ParseChats(r io.Reader, filter domain.ChatFilter, fn func(chat *domain.ChatInfo, msg *domain.Message) error) ([]domain.ChatInfo, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
 	}
-	return nil, args.Error(1)
+	args := m.Called(string(data), filter)
+	if err := args.Error(1); err != nil {
+		return nil, err
+	}
+	chat := domain.ChatInfo{Selected: true}
+	messages, _ := args.Get(0).([]*domain.Message)
+	for _, msg := range messages {
+		chat.MessageCount++
+		if err := fn(&chat, msg); err != nil {
+			return nil, err
+		}
+	}
+	return []domain.ChatInfo{chat}, nil
 }
 
-type mockExtractor struct{ mock.Mock }
+// inMemoryParser разбирает только экспорт, загруженный в память целиком.
+type inMemoryParser struct{}
 
-func (m *mockExtractor) ExtractRawParticipants(chat *domain.ExportedChat) ([]domain.RawParticipant, error) {
-	args := m.Called(chat)
-	if res := args.Get(0); res != nil {
-		return res.([]domain.RawParticipant), args.Error(1)
-	}
-	return nil, args.Error(1)
+func (inMemoryParser) Parse(data []byte) (*domain.ExportedChat, error) {
+	return &domain.ExportedChat{}, nil
+}
+
+// message создает сообщение участника userID с именем name.
+func message(userID, name string) *domain.Message {
+	return &domain.Message{Type: "message", From: name, FromID: userID}
 }
 
 type mockEnricher struct{ mock.Mock }
@@ -46,6 +80,32 @@ func (m *mockEnricher) Enrich(ctx context.Context, participants []domain.RawPart
 	return nil, args.Error(1)
 }
 
+// author и mention создают ожидаемых участников, обнаруженных как автор и упоминание.
+func author(userID, name string) domain.RawParticipant {
+	return domain.RawParticipant{UserID: userID, Name: name, Sources: []domain.ParticipantSource{domain.SourceAuthor}}
+}
+
+func mention(username string) domain.RawParticipant {
+	return domain.RawParticipant{Username: username, Sources: []domain.ParticipantSource{domain.SourceMention}}
+}
+
+// sameParticipants сравнивает состав участников и способы их обнаружения без учета статистики активности.
+func sameParticipants(expected []domain.RawParticipant) interface{} {
+	return mock.MatchedBy(func(got []domain.RawParticipant) bool {
+		if len(got) != len(expected) {
+			return false
+		}
+		for i := range got {
+			p := got[i]
+			p.Activity = domain.ActivityStats{}
+			if !assert.ObjectsAreEqual(expected[i], p) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
 func createTempFile(t *testing.T, content string) string {
 	t.Helper()
 	tmpFile, err := os.CreateTemp(t.TempDir(), "test-*.json")
@@ -64,31 +124,24 @@ func TestProcessChatUseCase(t *testing.T) {
 	filePath := createTempFile(t, "{}")
 	t.Run("success flow with multiple files", func(t *testing.T) {
 		parser := new(mockParser)
-		extractor := new(mockExtractor)
 		enricher := new(mockEnricher)
 		cacheStore := cache.NewCacheStore()
-		uc := NewProcessChatUseCase(cfg, parser, extractor, enricher, cacheStore)
+		uc := NewProcessChatUseCase(cfg, parser, services.NewExtractionService(), enricher, cacheStore)
 
 		// File 1
 		filePath1 := createTempFile(t, `{"name": "chat1"}`)
-		chat1 := &domain.ExportedChat{Name: "Test Chat 1"}
-		rawParticipants1 := []domain.RawParticipant{{UserID: "user1"}}
-		parser.On("Parse", []byte(`{"name": "chat1"}`)).Return(chat1, nil).Once()
-		extractor.On("ExtractRawParticipants", chat1).Return(rawParticipants1, nil).Once()
+		parser.On("ParseChats", `{"name": "chat1"}`, domain.ChatFilter{}).Return([]*domain.Message{message("user1", "User 1")}, nil).Once()
 
 		// File 2
 		filePath2 := createTempFile(t, `{"name": "chat2"}`)
-		chat2 := &domain.ExportedChat{Name: "Test Chat 2"}
-		rawParticipants2 := []domain.RawParticipant{{UserID: "user2"}}
-		parser.On("Parse", []byte(`{"name": "chat2"}`)).Return(chat2, nil).Once()
-		extractor.On("ExtractRawParticipants", chat2).Return(rawParticipants2, nil).Once()
+		parser.On("ParseChats", `{"name": "chat2"}`, domain.ChatFilter{}).Return([]*domain.Message{message("user2", "User 2")}, nil).Once()
 
 		// Combined
-		allRawParticipants := append(rawParticipants1, rawParticipants2...)
+		allRawParticipants := []domain.RawParticipant{author("user1", "User 1"), author("user2", "User 2")}
 		finalUsers := []domain.User{{ID: 1, Name: "User 1"}, {ID: 2, Name: "User 2"}}
-		enricher.On("Enrich", mock.Anything, allRawParticipants).Return(finalUsers, nil).Once()
+		enricher.On("Enrich", mock.Anything, sameParticipants(allRawParticipants)).Return(finalUsers, nil).Once()
 
-		users, err := uc.ProcessChat(ctx, []string{filePath1, filePath2})
+		users, err := uc.ProcessChat(ctx, []string{filePath1, filePath2}, domain.ChatFilter{})
 
 		assert.NoError(t, err)
 		assert.Equal(t, finalUsers, users)
@@ -102,84 +155,321 @@ func TestProcessChatUseCase(t *testing.T) {
 		assert.Equal(t, finalUsers, cached.Data)
 
 		parser.AssertExpectations(t)
-		extractor.AssertExpectations(t)
 		enricher.AssertExpectations(t)
 	})
 
 	t.Run("cache hit", func(t *testing.T) {
 		parser := new(mockParser)
-		extractor := new(mockExtractor)
 		enricher := new(mockEnricher)
 		cacheStore := cache.NewCacheStore()
-		uc := NewProcessChatUseCase(cfg, parser, extractor, enricher, cacheStore)
+		uc := NewProcessChatUseCase(cfg, parser, services.NewExtractionService(), enricher, cacheStore)
 
 		cachedUsers := []domain.User{{ID: 99, Name: "Cached User"}}
 		fileHash, _ := cache.CalculateFileHash(filePath)
 		combinedHash := cache.CalculateHashFromString(fmt.Sprintf("%v", []string{fileHash}))
 		cacheStore.Put(combinedHash, cachedUsers, 10*time.Minute)
 
-		users, err := uc.ProcessChat(ctx, []string{filePath})
+		users, err := uc.ProcessChat(ctx, []string{filePath}, domain.ChatFilter{})
 
 		assert.NoError(t, err)
 		assert.Equal(t, cachedUsers, users)
-		parser.AssertNotCalled(t, "Parse", mock.Anything)
+		parser.AssertNotCalled(t, "ParseChats", mock.Anything, mock.Anything)
 	})
 
 	t.Run("fetch error", func(t *testing.T) {
 		uc := NewProcessChatUseCase(cfg, nil, nil, nil, cache.NewCacheStore())
-		_, err := uc.ProcessChat(ctx, []string{"non_existent_file.json"})
+		_, err := uc.ProcessChat(ctx, []string{"non_existent_file.json"}, domain.ChatFilter{})
 		assert.Error(t, err)
 	})
 
 	t.Run("parse error", func(t *testing.T) {
 		parser := new(mockParser)
-		uc := NewProcessChatUseCase(cfg, parser, nil, nil, cache.NewCacheStore())
+		uc := NewProcessChatUseCase(cfg, parser, services.NewExtractionService(), nil, cache.NewCacheStore())
 		parseErr := errors.New("parse error")
-		parser.On("Parse", mock.Anything).Return(nil, parseErr)
+		parser.On("ParseChats", mock.Anything, mock.Anything).Return(nil, parseErr)
 
-		_, err := uc.ProcessChat(ctx, []string{filePath})
+		_, err := uc.ProcessChat(ctx, []string{filePath}, domain.ChatFilter{})
 
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), parseErr.Error())
 		parser.AssertExpectations(t)
 	})
 
-	t.Run("extract error", func(t *testing.T) {
-		parser := new(mockParser)
-		extractor := new(mockExtractor)
-		uc := NewProcessChatUseCase(cfg, parser, extractor, nil, cache.NewCacheStore())
-
-		chat := &domain.ExportedChat{}
-		extractErr := errors.New("extract error")
-
-		parser.On("Parse", mock.Anything).Return(chat, nil)
-		extractor.On("ExtractRawParticipants", chat).Return(nil, extractErr)
+	t.Run("parser without streaming is rejected", func(t *testing.T) {
+		enricher := new(mockEnricher)
+		uc := NewProcessChatUseCase(cfg, inMemoryParser{}, services.NewExtractionService(), enricher, cache.NewCacheStore())
 
-		_, err := uc.ProcessChat(ctx, []string{filePath})
+		_, err := uc.ProcessChat(ctx, []string{filePath}, domain.ChatFilter{})
 
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), extractErr.Error())
-		extractor.AssertExpectations(t)
+		assert.ErrorContains(t, err, "does not support streaming")
+		enricher.AssertNotCalled(t, "Enrich", mock.Anything, mock.Anything)
 	})
 
 	t.Run("enrich error", func(t *testing.T) {
 		parser := new(mockParser)
-		extractor := new(mockExtractor)
 		enricher := new(mockEnricher)
-		uc := NewProcessChatUseCase(cfg, parser, extractor, enricher, cache.NewCacheStore())
+		uc := NewProcessChatUseCase(cfg, parser, services.NewExtractionService(), enricher, cache.NewCacheStore())
 
-		chat := &domain.ExportedChat{}
-		rawParticipants := []domain.RawParticipant{}
 		enrichErr := errors.New("enrich error")
 
-		parser.On("Parse", mock.Anything).Return(chat, nil)
-		extractor.On("ExtractRawParticipants", chat).Return(rawParticipants, nil)
+		parser.On("ParseChats", mock.Anything, mock.Anything).Return(nil, nil)
 		enricher.On("Enrich", mock.Anything, mock.AnythingOfType("[]domain.RawParticipant")).Return(nil, enrichErr)
 
-		_, err := uc.ProcessChat(ctx, []string{filePath})
+		_, err := uc.ProcessChat(ctx, []string{filePath}, domain.ChatFilter{})
 
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), enrichErr.Error())
 		enricher.AssertExpectations(t)
 	})
+
+	t.Run("cancelled enrichment returns partial result without caching", func(t *testing.T) {
+		parser := new(mockParser)
+		enricher := new(mockEnricher)
+		cacheStore := cache.NewCacheStore()
+		uc := NewProcessChatUseCase(cfg, parser, services.NewExtractionService(), enricher, cacheStore)
+
+		cancelPath := createTempFile(t, `{"name": "cancel"}`)
+		partial := []domain.User{{ID: 1, Name: "User 1"}}
+
+		parser.On("ParseChats", mock.Anything, mock.Anything).Return([]*domain.Message{message("user1", "User 1")}, nil)
+		enricher.On("Enrich", mock.Anything, mock.Anything).Return(partial, context.Canceled)
+
+		users, err := uc.ProcessChat(ctx, []string{cancelPath}, domain.ChatFilter{})
+
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, partial, users)
+
+		fileHash, _ := cache.CalculateFileHash(cancelPath)
+		_, found := cacheStore.Get(cache.CalculateHashFromString(fmt.Sprintf("%v", []string{fileHash})))
+		assert.False(t, found, "Частичный результат не должен кешироваться")
+	})
+
+	t.Run("cancelled context stops processing before enrichment", func(t *testing.T) {
+		parser := new(mockParser)
+		enricher := new(mockEnricher)
+		uc := NewProcessChatUseCase(cfg, parser, services.NewExtractionService(), enricher, cache.NewCacheStore())
+
+		cancelledCtx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := uc.ProcessChat(cancelledCtx, []string{filePath}, domain.ChatFilter{})
+
+		assert.ErrorIs(t, err, context.Canceled)
+		parser.AssertNotCalled(t, "ParseChats", mock.Anything, mock.Anything)
+		enricher.AssertNotCalled(t, "Enrich", mock.Anything, mock.Anything)
+	})
+
+	t.Run("streaming parser feeds extractor incrementally", func(t *testing.T) {
+		enricher := new(mockEnricher)
+		uc := NewProcessChatUseCase(cfg, parser.NewJsonParser(), services.NewExtractionService(), enricher, cache.NewCacheStore())
+
+		streamPath := createTempFile(t, `{
+			"name": "Big Chat",
+			"about": "ignored",
+			"messages": [
+				{"id": 1, "type": "message", "from": "John", "from_id": "user1", "text_entities": [{"type": "mention", "text": "@jane"}]},
+				{"id": 2, "type": "message", "from": "John", "from_id": "user1", "text_entities": []}
+			]
+		}`)
+
+		expectedRaw := []domain.RawParticipant{author("user1", "John"), mention("@jane")}
+		finalUsers := []domain.User{{ID: 1, Name: "John"}}
+		enricher.On("Enrich", mock.Anything, sameParticipants(expectedRaw)).Return(finalUsers, nil).Once()
+
+		users, err := uc.ProcessChat(ctx, []string{streamPath}, domain.ChatFilter{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, finalUsers, users)
+		enricher.AssertExpectations(t)
+	})
+
+	t.Run("progress is reported to tracker from context", func(t *testing.T) {
+		enricher := new(mockEnricher)
+		uc := NewProcessChatUseCase(cfg, parser.NewJsonParser(), services.NewExtractionService(), enricher, cache.NewCacheStore())
+
+		path := createTempFile(t, `{"name": "Progress", "messages": [
+			{"id": 1, "type": "message", "from": "John", "from_id": "user1", "text_entities": [{"type": "mention", "text": "@jane"}]},
+			{"id": 2, "type": "message", "from": "Ann", "from_id": "user2", "text_entities": []},
+			{"id": 3, "type": "message", "from": "John", "from_id": "user1", "text_entities": []}
+		]}`)
+		tracker := progress.NewTracker()
+		enricher.On("Enrich", mock.Anything, mock.Anything).Return([]domain.User{}, nil).Once()
+
+		_, err := uc.ProcessChat(progress.NewContext(ctx, tracker), []string{path}, domain.ChatFilter{})
+
+		assert.NoError(t, err)
+		s := tracker.Snapshot()
+		assert.Equal(t, progress.StageFinished, s.Stage)
+		assert.Equal(t, 1, s.FilesTotal)
+		assert.Equal(t, 1, s.FilesParsed)
+		assert.Equal(t, int64(3), s.MessagesScanned)
+		assert.Equal(t, 3, s.RawParticipants)
+		enricher.AssertExpectations(t)
+	})
+
+	t.Run("zip archive is expanded into export files", func(t *testing.T) {
+		archiveCfg := &config.Config{Processing: config.Processing{
+			CacheTTL:              10 * time.Minute,
+			MaxArchiveEntries:     10,
+			MaxArchiveExtractedMB: 1,
+		}}
+		enricher := new(mockEnricher)
+		uc := NewProcessChatUseCase(archiveCfg, parser.NewJsonParser(), services.NewExtractionService(), enricher, cache.NewCacheStore())
+
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for name, content := range map[string]string{
+			"ChatExport/result.json":        `{"messages": [{"id": 1, "type": "message", "from": "Ann", "from_id": "user7"}]}`,
+			"ChatExport/photos/photo_1.jpg": "binary",
+		} {
+			w, err := zw.Create(name)
+			assert.NoError(t, err)
+			_, err = w.Write([]byte(content))
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, zw.Close())
+		archivePath := createTempFile(t, buf.String())
+
+		finalUsers := []domain.User{{ID: 7, Name: "Ann"}}
+		enricher.On("Enrich", mock.Anything, sameParticipants([]domain.RawParticipant{author("user7", "Ann")})).Return(finalUsers, nil).Once()
+
+		users, err := uc.ProcessChat(ctx, []string{archivePath}, domain.ChatFilter{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, finalUsers, users)
+		enricher.AssertExpectations(t)
+	})
+	accountExport := `{
+		"about": "Here is the data you requested.",
+		"personal_information": {"user_id": 1, "first_name": "Me"},
+		"chats": {
+			"about": "This page lists all chats from this export.",
+			"list": [
+				{"name": "Family", "type": "private_group", "id": 100, "messages": [
+					{"id": 1, "type": "message", "from": "Mom", "from_id": "user10"}
+				]},
+				{"name": "Work", "type": "private_supergroup", "id": 200, "messages": [
+					{"id": 1, "type": "message", "from": "Boss", "from_id": "user20", "text_entities": [{"type": "mention", "text": "@colleague"}]}
+				]}
+			]
+		},
+		"left_chats": {"list": [
+			{"name": "Old", "type": "public_supergroup", "id": 300, "messages": [
+				{"id": 1, "type": "message", "from": "Stranger", "from_id": "user30"}
+			]}
+		]}
+	}`
+
+	t.Run("account export with chat filter", func(t *testing.T) {
+		enricher := new(mockEnricher)
+		cacheStore := cache.NewCacheStore()
+		uc := NewProcessChatUseCase(cfg, parser.NewAutoParser(), services.NewExtractionService(), enricher, cacheStore)
+		exportPath := createTempFile(t, accountExport)
+
+		expectedRaw := []domain.RawParticipant{author("user20", "Boss"), mention("@colleague")}
+		finalUsers := []domain.User{{ID: 20, Name: "Boss"}}
+		enricher.On("Enrich", mock.Anything, sameParticipants(expectedRaw)).Return(finalUsers, nil).Once()
+
+		users, err := uc.ProcessChat(ctx, []string{exportPath}, domain.ChatFilter{Types: []string{"private_supergroup"}})
+
+		assert.NoError(t, err)
+		assert.Equal(t, finalUsers, users)
+		enricher.AssertExpectations(t)
+
+		// Результат по всему экспорту не должен браться из кеша отфильтрованного запроса.
+		fileHash, _ := cache.CalculateFileHash(exportPath)
+		_, found := cacheStore.Get(cache.CalculateHashFromString(fmt.Sprintf("%v", []string{fileHash})))
+		assert.False(t, found)
+	})
+
+	t.Run("account export without filter uses all chats", func(t *testing.T) {
+		enricher := new(mockEnricher)
+		uc := NewProcessChatUseCase(cfg, parser.NewAutoParser(), services.NewExtractionService(), enricher, cache.NewCacheStore())
+		exportPath := createTempFile(t, accountExport)
+
+		expectedRaw := []domain.RawParticipant{
+			author("user10", "Mom"),
+			author("user20", "Boss"),
+			mention("@colleague"),
+			author("user30", "Stranger"),
+		}
+		enricher.On("Enrich", mock.Anything, sameParticipants(expectedRaw)).Return([]domain.User{}, nil).Once()
+
+		_, err := uc.ProcessChat(ctx, []string{exportPath}, domain.ChatFilter{})
+
+		assert.NoError(t, err)
+		enricher.AssertExpectations(t)
+	})
+
+	t.Run("filter matching no chats fails", func(t *testing.T) {
+		enricher := new(mockEnricher)
+		uc := NewProcessChatUseCase(cfg, parser.NewAutoParser(), services.NewExtractionService(), enricher, cache.NewCacheStore())
+		exportPath := createTempFile(t, accountExport)
+
+		_, err := uc.ProcessChat(ctx, []string{exportPath}, domain.ChatFilter{Names: []string{"missing"}})
+
+		assert.ErrorContains(t, err, "no chats match the filter")
+		enricher.AssertNotCalled(t, "Enrich", mock.Anything, mock.Anything)
+	})
+
+	t.Run("list chats", func(t *testing.T) {
+		uc := NewProcessChatUseCase(cfg, parser.NewAutoParser(), services.NewExtractionService(), nil, cache.NewCacheStore())
+		exportPath := createTempFile(t, accountExport)
+
+		chats, err := uc.ListChats(ctx, []string{exportPath})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []domain.ChatInfo{
+			{ID: 100, Name: "Family", Type: "private_group", MessageCount: 1, Selected: true},
+			{ID: 200, Name: "Work", Type: "private_supergroup", MessageCount: 1, Selected: true},
+			{ID: 300, Name: "Old", Type: "public_supergroup", MessageCount: 1, Selected: true},
+		}, chats)
+	})
+
+	t.Run("list chats requires multi chat parser", func(t *testing.T) {
+		uc := NewProcessChatUseCase(cfg, inMemoryParser{}, nil, nil, cache.NewCacheStore())
+		_, err := uc.ListChats(ctx, []string{filePath})
+		assert.Error(t, err)
+	})
+}
+
+func TestProcessChatUseCase_ExtractionSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	cfg := &config.Config{Processing: config.Processing{CacheTTL: 10 * time.Minute}}
+	export := `{"name": "Chat", "messages": [
+		{"id": 1, "type": "message", "from": "John", "from_id": "user1", "text_entities": [{"type": "mention", "text": "@jane"}]},
+		{"id": 2, "type": "message", "from": "Ann", "from_id": "user2", "text_entities": []}
+	]}`
+
+	// Участники извлекаются по ходу разбора, но извлечение отмечено отдельным спаном.
+	for name, p := range map[string]ports.Parser{"json": parser.NewJsonParser(), "auto": parser.NewAutoParser()} {
+		t.Run(name, func(t *testing.T) {
+			recorder.Reset()
+			enricher := new(mockEnricher)
+			enricher.On("Enrich", mock.Anything, mock.Anything).Return([]domain.User{}, nil).Once()
+			uc := NewProcessChatUseCase(cfg, p, services.NewExtractionService(), enricher, cache.NewCacheStore())
+
+			_, err := uc.ProcessChat(context.Background(), []string{createTempFile(t, export)}, domain.ChatFilter{})
+			require.NoError(t, err)
+
+			var extract, parse sdktrace.ReadOnlySpan
+			for _, span := range recorder.Ended() {
+				switch span.Name() {
+				case "ExtractionService.ExtractRawParticipants":
+					extract = span
+				case "Parser.ParseChats":
+					parse = span
+				}
+			}
+			require.NotNil(t, extract, "нет спана извлечения участников")
+			require.NotNil(t, parse, "нет спана разбора")
+			assert.Equal(t, extract.SpanContext().SpanID(), parse.Parent().SpanID(), "разбор вложен в извлечение")
+			assert.Contains(t, extract.Attributes(), attribute.Int("messages", 2))
+			assert.Equal(t, codes.Unset, extract.Status().Code)
+		})
+	}
 }
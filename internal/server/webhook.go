@@ -0,0 +1,327 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"telegram-chat-parser/internal/pkg/config"
+	"time"
+)
+
+// Заголовки уведомления о завершении задачи.
+const (
+	// SignatureHeader содержит подпись тела уведомления: "sha256=" и HMAC-SHA256 в hex.
+	SignatureHeader = "X-Signature-256"
+	// AttemptHeader содержит номер попытки доставки, начиная с 1.
+	AttemptHeader = "X-Webhook-Attempt"
+)
+
+// WebhookEventTaskFinished — тип уведомления о переходе задачи в конечный статус.
+const WebhookEventTaskFinished = "task.finished"
+
+// errForbiddenCallbackAddress возвращается, когда callback_url указывает во внутреннюю
+// сеть сервера. Такие адреса разрешает только webhook.allow_private_networks.
+var errForbiddenCallbackAddress = errors.New("callback address is in a private network")
+
+// Внутренние сети, которые не учитывают методы netip.Addr: "эта сеть" (RFC 1122),
+// куда входит 0.0.0.0, и адреса провайдерского NAT (RFC 6598).
+var (
+	thisNetwork        = netip.MustParsePrefix("0.0.0.0/8")
+	sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+)
+
+// webhookPayload — тело уведомления о завершении задачи.
+type webhookPayload struct {
+	Event           string     `json:"event"`
+	TaskID          string     `json:"task_id"`
+	Status          TaskStatus `json:"status"`
+	ErrorMessage    string     `json:"error_message,omitempty"`
+	ResultCount     int        `json:"result_count"`
+	UnresolvedCount int        `json:"unresolved_count"`
+	// ResultURL отсутствует у задач без результата (failed).
+	ResultURL  string    `json:"result_url,omitempty"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// webhookNotifier доставляет уведомления о завершении задач на callback_url.
+// Тело уведомления одинаково во всех попытках, поэтому получатель может
+// отбрасывать повторы по task_id.
+type webhookNotifier struct {
+	cfg        config.Webhook
+	taskStore  *TaskStore
+	httpClient *http.Client
+	sleep      func(ctx context.Context, d time.Duration) error
+	lookupIP   func(ctx context.Context, host string) ([]netip.Addr, error)
+
+	// ctx отменяется при остановке и прерывает доставку и паузы между попытками.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// mutex защищает stopped и добавление доставок в wg.
+	mutex   sync.Mutex
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+func newWebhookNotifier(cfg config.Webhook, taskStore *TaskStore) *webhookNotifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !cfg.AllowPrivateNetworks {
+		// Адрес получателя проверяется и при подключении: DNS-имя, проверенное при
+		// создании задачи, могло с тех пор начать указывать во внутреннюю сеть. Прокси не
+		// используется, иначе проверялся бы адрес прокси, а не получателя.
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: callbackDialControl}
+		transport.Proxy = nil
+		transport.DialContext = dialer.DialContext
+	}
+	return &webhookNotifier{
+		cfg:       cfg,
+		taskStore: taskStore,
+		httpClient: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: transport,
+			// Перенаправление не выполняется: иначе подписанное уведомление ушло бы на
+			// адрес, который не указывал создатель задачи. Ответ 3xx считается отказом.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		sleep: sleepContext,
+		lookupIP: func(ctx context.Context, host string) ([]netip.Addr, error) {
+			return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// notify запускает доставку уведомления о завершении задачи в фоне, чтобы паузы между
+// попытками не занимали обработчик очереди задач. После stop уведомления не отправляются.
+func (n *webhookNotifier) notify(taskID string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.stopped {
+		slog.Warn("Webhook not sent: server is shutting down", "task_id", taskID)
+		return
+	}
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		n.deliver(n.ctx, taskID)
+	}()
+}
+
+// stop прерывает начатые доставки и ждет их завершения, но не дольше ctx.
+// Недоставленные уведомления остаются в задаче со статусом pending.
+func (n *webhookNotifier) stop(ctx context.Context) error {
+	n.mutex.Lock()
+	n.stopped = true
+	n.mutex.Unlock()
+	n.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to stop webhook delivery: %w", ctx.Err())
+	}
+}
+
+// enabled сообщает, настроен ли ключ подписи уведомлений.
+func (n *webhookNotifier) enabled() bool {
+	return n.cfg.Secret != ""
+}
+
+// resultURL возвращает ссылку на результат задачи по адресу webhook.public_url или пустую
+// строку, если адрес не задан. Адрес из заголовков запроса не используется: их задает
+// клиент, а ссылка попадает в подписанное уведомление.
+func (n *webhookNotifier) resultURL(taskID string) string {
+	base := strings.TrimSuffix(n.cfg.PublicURL, "/")
+	if base == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/api/v1/tasks/%s/result", base, taskID)
+}
+
+// deliver отправляет уведомление о завершении задачи, если для нее задан callback_url,
+// повторяя попытки с экспоненциальной паузой. Каждая попытка записывается в задачу.
+func (n *webhookNotifier) deliver(ctx context.Context, taskID string) {
+	task, err := n.taskStore.GetTask(taskID)
+	if err != nil || task.Callback == nil {
+		return
+	}
+	logger := slog.With("task_id", taskID, "callback_url", task.Callback.URL)
+
+	payload := webhookPayload{
+		Event:           WebhookEventTaskFinished,
+		TaskID:          task.ID,
+		Status:          task.Status,
+		ErrorMessage:    task.ErrorMessage,
+		ResultCount:     len(task.Result),
+		UnresolvedCount: len(task.Unresolved),
+		FinishedAt:      time.Now().UTC(),
+	}
+	if task.Status.HasResult() {
+		payload.ResultURL = task.Callback.ResultURL
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logger.Error("Failed to encode webhook payload", "error", err)
+		return
+	}
+	signature := signPayload(n.cfg.Secret, body)
+
+	backoff := n.cfg.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		statusCode, err := n.send(ctx, task.Callback.URL, body, signature, attempt)
+
+		record := CallbackAttempt{Attempt: attempt, At: time.Now(), StatusCode: statusCode}
+		status := CallbackDelivered
+		retry := false
+		if err != nil {
+			record.Error = err.Error()
+			retry = attempt < n.cfg.MaxAttempts && retryableStatus(statusCode) &&
+				!errors.Is(err, errForbiddenCallbackAddress)
+			status = CallbackFailed
+			if retry {
+				status = CallbackPending
+			}
+		}
+		if err := n.taskStore.AddCallbackAttempt(taskID, record, status); err != nil {
+			logger.Warn("Failed to record webhook attempt", "attempt", attempt, "error", err)
+		}
+
+		switch status {
+		case CallbackDelivered:
+			logger.Info("Webhook delivered", "attempt", attempt)
+			return
+		case CallbackFailed:
+			logger.Error("Webhook delivery failed", "attempt", attempt, "error", err)
+			return
+		}
+
+		logger.Warn("Webhook delivery attempt failed, retrying", "attempt", attempt, "backoff", backoff, "error", err)
+		if err := n.sleep(ctx, backoff); err != nil {
+			return
+		}
+		backoff = min(backoff*2, n.cfg.MaxBackoff)
+	}
+}
+
+// send выполняет одну попытку доставки. Возвращает код ответа (0, если ответ не получен)
+// и ошибку для ответов вне диапазона 2xx.
+func (n *webhookNotifier) send(ctx context.Context, callbackURL string, body []byte, signature string, attempt int) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, signature)
+	req.Header.Set(AttemptHeader, strconv.Itoa(attempt))
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send request: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// retryableStatus сообщает, имеет ли смысл повторять доставку после ответа statusCode.
+// Остальные ответы 4xx означают, что получатель отклонил уведомление.
+func retryableStatus(statusCode int) bool {
+	return statusCode == 0 || statusCode >= 500 ||
+		statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests
+}
+
+// signPayload вычисляет значение заголовка X-Signature-256 для тела уведомления.
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// parseCallbackURL проверяет адрес уведомления: допускаются абсолютные http(s)-адреса
+// вне внутренней сети сервера, если ее не разрешает webhook.allow_private_networks.
+func (n *webhookNotifier) parseCallbackURL(ctx context.Context, raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Hostname() == "" {
+		return "", fmt.Errorf("invalid callback_url %q: absolute http(s) URL expected", raw)
+	}
+	if !n.cfg.AllowPrivateNetworks {
+		if err := n.checkCallbackHost(ctx, u.Hostname()); err != nil {
+			return "", fmt.Errorf("invalid callback_url %q: %w", raw, err)
+		}
+	}
+	return u.String(), nil
+}
+
+// checkCallbackHost проверяет, что host и все его адреса находятся вне внутренней сети.
+func (n *webhookNotifier) checkCallbackHost(ctx context.Context, host string) error {
+	addrs := []netip.Addr{}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		addrs = append(addrs, ip)
+	} else if addrs, err = n.lookupIP(ctx, host); err != nil {
+		return fmt.Errorf("failed to resolve host: %w", err)
+	}
+	for _, ip := range addrs {
+		if forbiddenCallbackIP(ip) {
+			return fmt.Errorf("%w: %s", errForbiddenCallbackAddress, ip)
+		}
+	}
+	return nil
+}
+
+// callbackDialControl запрещает подключение к адресам внутренней сети при доставке уведомлений.
+func callbackDialControl(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", host, err)
+	}
+	if forbiddenCallbackIP(ip) {
+		return fmt.Errorf("%w: %s", errForbiddenCallbackAddress, ip)
+	}
+	return nil
+}
+
+// forbiddenCallbackIP сообщает, что адрес относится к внутренней сети: loopback, частные
+// сети, link-local (включая адрес метаданных облака 169.254.169.254), multicast и т. п.
+func forbiddenCallbackIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return !ip.IsGlobalUnicast() || ip.IsPrivate() || thisNetwork.Contains(ip) || sharedAddressSpace.Contains(ip)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,379 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"telegram-chat-parser/internal/cache"
+	"telegram-chat-parser/internal/domain"
+	"telegram-chat-parser/internal/pkg/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func testWebhookConfig() config.Webhook {
+	return config.Webhook{
+		Secret: "secret",
+		// Тестовые получатели слушают loopback.
+		AllowPrivateNetworks: true,
+		Timeout:              time.Second,
+		MaxAttempts:          3,
+		InitialBackoff:       time.Second,
+		MaxBackoff:           time.Second * 3 / 2,
+	}
+}
+
+// webhookReceiver отвечает на уведомления кодами из statuses по очереди и запоминает запросы.
+type webhookReceiver struct {
+	mutex    sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	wr.mutex.Lock()
+	defer wr.mutex.Unlock()
+	status := http.StatusOK
+	if n := len(wr.requests); n < len(wr.statuses) {
+		status = wr.statuses[n]
+	}
+	wr.requests = append(wr.requests, r)
+	wr.bodies = append(wr.bodies, body)
+	w.WriteHeader(status)
+}
+
+func TestWebhookNotifier_Deliver(t *testing.T) {
+	newTask := func(t *testing.T, callbackURL string) (*TaskStore, string) {
+		taskStore := NewTaskStore()
+		taskID := "webhook-task"
+		require.NoError(t, taskStore.CreateTask(taskID, time.Minute))
+		require.NoError(t, taskStore.SetTaskCallback(taskID, callbackURL, "http://parser/api/v1/tasks/"+taskID+"/result"))
+		require.NoError(t, taskStore.UpdateTaskResult(taskID, []domain.User{{ID: 1}, {ID: 2}}))
+		return taskStore, taskID
+	}
+	newNotifier := func(taskStore *TaskStore, backoffs *[]time.Duration) *webhookNotifier {
+		n := newWebhookNotifier(testWebhookConfig(), taskStore)
+		n.sleep = func(ctx context.Context, d time.Duration) error {
+			*backoffs = append(*backoffs, d)
+			return nil
+		}
+		return n
+	}
+
+	t.Run("Повтор после ошибки сервера", func(t *testing.T) {
+		receiver := &webhookReceiver{statuses: []int{http.StatusInternalServerError, http.StatusTooManyRequests}}
+		ts := httptest.NewServer(receiver)
+		defer ts.Close()
+		taskStore, taskID := newTask(t, ts.URL)
+		var backoffs []time.Duration
+
+		newNotifier(taskStore, &backoffs).deliver(context.Background(), taskID)
+
+		require.Len(t, receiver.requests, 3)
+		assert.Equal(t, []time.Duration{time.Second, time.Second * 3 / 2}, backoffs, "пауза удваивается до max_backoff")
+		for i, r := range receiver.requests {
+			assert.Equal(t, signPayload("secret", receiver.bodies[i]), r.Header.Get(SignatureHeader))
+			assert.Equal(t, string(rune('1'+i)), r.Header.Get(AttemptHeader))
+			assert.Equal(t, receiver.bodies[0], receiver.bodies[i], "тело одинаково во всех попытках")
+		}
+
+		var payload webhookPayload
+		require.NoError(t, json.Unmarshal(receiver.bodies[0], &payload))
+		assert.Equal(t, WebhookEventTaskFinished, payload.Event)
+		assert.Equal(t, taskID, payload.TaskID)
+		assert.Equal(t, TaskStatusCompleted, payload.Status)
+		assert.Equal(t, 2, payload.ResultCount)
+		assert.Equal(t, "http://parser/api/v1/tasks/webhook-task/result", payload.ResultURL)
+
+		task, err := taskStore.GetTask(taskID)
+		require.NoError(t, err)
+		assert.Equal(t, CallbackDelivered, task.Callback.Status)
+		require.Len(t, task.Callback.Attempts, 3)
+		assert.Equal(t, http.StatusInternalServerError, task.Callback.Attempts[0].StatusCode)
+		assert.NotEmpty(t, task.Callback.Attempts[0].Error)
+		assert.Equal(t, http.StatusOK, task.Callback.Attempts[2].StatusCode)
+		assert.Empty(t, task.Callback.Attempts[2].Error)
+	})
+
+	t.Run("Отклоненное уведомление не повторяется", func(t *testing.T) {
+		receiver := &webhookReceiver{statuses: []int{http.StatusBadRequest}}
+		ts := httptest.NewServer(receiver)
+		defer ts.Close()
+		taskStore, taskID := newTask(t, ts.URL)
+		var backoffs []time.Duration
+
+		newNotifier(taskStore, &backoffs).deliver(context.Background(), taskID)
+
+		assert.Len(t, receiver.requests, 1)
+		assert.Empty(t, backoffs)
+		task, err := taskStore.GetTask(taskID)
+		require.NoError(t, err)
+		assert.Equal(t, CallbackFailed, task.Callback.Status)
+		assert.Len(t, task.Callback.Attempts, 1)
+	})
+
+	t.Run("Попытки исчерпаны", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		callbackURL := ts.URL
+		ts.Close() // Получатель недоступен.
+		taskStore, taskID := newTask(t, callbackURL)
+		var backoffs []time.Duration
+
+		newNotifier(taskStore, &backoffs).deliver(context.Background(), taskID)
+
+		task, err := taskStore.GetTask(taskID)
+		require.NoError(t, err)
+		assert.Equal(t, CallbackFailed, task.Callback.Status)
+		require.Len(t, task.Callback.Attempts, 3)
+		assert.Zero(t, task.Callback.Attempts[0].StatusCode)
+		assert.Len(t, backoffs, 2)
+	})
+
+	t.Run("Перенаправление не выполняется", func(t *testing.T) {
+		target := &webhookReceiver{}
+		targetServer := httptest.NewServer(target)
+		defer targetServer.Close()
+		ts := httptest.NewServer(http.RedirectHandler(targetServer.URL, http.StatusTemporaryRedirect))
+		defer ts.Close()
+		taskStore, taskID := newTask(t, ts.URL)
+		var backoffs []time.Duration
+
+		newNotifier(taskStore, &backoffs).deliver(context.Background(), taskID)
+
+		assert.Empty(t, target.requests)
+		task, err := taskStore.GetTask(taskID)
+		require.NoError(t, err)
+		assert.Equal(t, CallbackFailed, task.Callback.Status)
+		require.Len(t, task.Callback.Attempts, 1)
+		assert.Equal(t, http.StatusTemporaryRedirect, task.Callback.Attempts[0].StatusCode)
+	})
+
+	t.Run("Остановка прерывает повторы", func(t *testing.T) {
+		receiver := &webhookReceiver{statuses: []int{http.StatusInternalServerError}}
+		ts := httptest.NewServer(receiver)
+		defer ts.Close()
+		taskStore, taskID := newTask(t, ts.URL)
+		n := newWebhookNotifier(testWebhookConfig(), taskStore)
+		n.cfg.InitialBackoff = time.Hour
+
+		n.notify(taskID)
+		require.Eventually(t, func() bool {
+			task, err := taskStore.GetTask(taskID)
+			return err == nil && len(task.Callback.Attempts) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		// Доставка ждет повтора в фоне; остановка не ждет паузу.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		require.NoError(t, n.stop(ctx))
+		task, err := taskStore.GetTask(taskID)
+		require.NoError(t, err)
+		assert.Equal(t, CallbackPending, task.Callback.Status)
+
+		// После остановки уведомления не отправляются.
+		n.notify(taskID)
+		require.NoError(t, n.stop(ctx))
+		receiver.mutex.Lock()
+		assert.Len(t, receiver.requests, 1)
+		receiver.mutex.Unlock()
+	})
+
+	t.Run("Адрес во внутренней сети проверяется при подключении", func(t *testing.T) {
+		receiver := &webhookReceiver{}
+		ts := httptest.NewServer(receiver)
+		defer ts.Close()
+		// Адрес мог пройти проверку при создании задачи, если DNS-имя тогда указывало наружу.
+		taskStore, taskID := newTask(t, ts.URL)
+		cfg := testWebhookConfig()
+		cfg.AllowPrivateNetworks = false
+		n := newWebhookNotifier(cfg, taskStore)
+		var backoffs []time.Duration
+		n.sleep = func(ctx context.Context, d time.Duration) error {
+			backoffs = append(backoffs, d)
+			return nil
+		}
+
+		n.deliver(context.Background(), taskID)
+
+		assert.Empty(t, receiver.requests)
+		assert.Empty(t, backoffs, "запрещенный адрес не повторяется")
+		task, err := taskStore.GetTask(taskID)
+		require.NoError(t, err)
+		assert.Equal(t, CallbackFailed, task.Callback.Status)
+		require.Len(t, task.Callback.Attempts, 1)
+		assert.Contains(t, task.Callback.Attempts[0].Error, errForbiddenCallbackAddress.Error())
+	})
+
+	t.Run("Задача без callback_url", func(t *testing.T) {
+		taskStore := NewTaskStore()
+		require.NoError(t, taskStore.CreateTask("plain", time.Minute))
+		var backoffs []time.Duration
+
+		newNotifier(taskStore, &backoffs).deliver(context.Background(), "plain")
+
+		task, err := taskStore.GetTask("plain")
+		require.NoError(t, err)
+		assert.Nil(t, task.Callback)
+	})
+}
+
+func TestWebhookNotifier_ParseCallbackURL(t *testing.T) {
+	cfg := testWebhookConfig()
+	cfg.AllowPrivateNetworks = false
+	n := newWebhookNotifier(cfg, NewTaskStore())
+	n.lookupIP = func(_ context.Context, host string) ([]netip.Addr, error) {
+		switch host {
+		case "hooks.example.com":
+			return []netip.Addr{netip.MustParseAddr("203.0.113.10")}, nil
+		case "internal.example.com":
+			return []netip.Addr{netip.MustParseAddr("203.0.113.10"), netip.MustParseAddr("10.0.0.5")}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	ctx := context.Background()
+
+	for _, callbackURL := range []string{"https://hooks.example.com/task", "http://203.0.113.10:8080/hook", "http://[2001:db8::1]/hook"} {
+		got, err := n.parseCallbackURL(ctx, callbackURL)
+		assert.NoError(t, err, callbackURL)
+		assert.Equal(t, callbackURL, got)
+	}
+
+	for _, callbackURL := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://10.1.2.3/hook",
+		"http://192.168.0.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://100.64.0.1/hook",
+		"http://0.0.0.0/hook",
+		"http://[::1]/hook",
+		"http://[fd00::1]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+		"http://internal.example.com/hook",
+	} {
+		_, err := n.parseCallbackURL(ctx, callbackURL)
+		assert.ErrorIs(t, err, errForbiddenCallbackAddress, callbackURL)
+	}
+
+	_, err := n.parseCallbackURL(ctx, "http://unknown.example.com/hook")
+	assert.ErrorContains(t, err, "failed to resolve host")
+
+	// Внутренняя сеть разрешается явно в конфигурации.
+	n.cfg.AllowPrivateNetworks = true
+	_, err = n.parseCallbackURL(ctx, "http://127.0.0.1:8080/hook")
+	assert.NoError(t, err)
+}
+
+func TestWebhookNotifier_ResultURL(t *testing.T) {
+	n := newWebhookNotifier(testWebhookConfig(), NewTaskStore())
+	assert.Empty(t, n.resultURL("task-1"), "без public_url ссылка не строится")
+
+	n.cfg.PublicURL = "https://parser.example.com/"
+	assert.Equal(t, "https://parser.example.com/api/v1/tasks/task-1/result", n.resultURL("task-1"))
+}
+
+func TestServer_ProcessCallback(t *testing.T) {
+	cfg := &config.Config{
+		Server:     config.Server{CleanupInterval: time.Minute},
+		Processing: config.Processing{CacheTTL: time.Minute, MaxConcurrentTasks: 1, MaxQueuedTasks: 1},
+		Webhook:    testWebhookConfig(),
+	}
+	cfg.Webhook.PublicURL = "https://parser.example.com/"
+	mockProc := new(mockProcessor)
+	srv, err := New(cfg, mockProc, NewTaskStore(), cache.NewCacheStore())
+	require.NoError(t, err)
+
+	delivered := make(chan []byte, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, signPayload("secret", body), r.Header.Get(SignatureHeader))
+		delivered <- body
+	}))
+	defer receiver.Close()
+
+	t.Run("Уведомление о завершении", func(t *testing.T) {
+		mockProc.On("ProcessChat", mock.Anything, mock.AnythingOfType("[]string"), domain.ChatFilter{}).
+			Return([]domain.User{{ID: 1}}, nil).Once()
+
+		body, contentType := newUploadForm(t, map[string][]string{"callback_url": {receiver.URL}})
+		req := httptest.NewRequest("POST", "/api/v1/process", body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusAccepted, rr.Code)
+		var created map[string]string
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+		taskID := created["task_id"]
+
+		var payload webhookPayload
+		select {
+		case raw := <-delivered:
+			require.NoError(t, json.Unmarshal(raw, &payload))
+		case <-time.After(5 * time.Second):
+			t.Fatal("уведомление не получено")
+		}
+		assert.Equal(t, taskID, payload.TaskID)
+		assert.Equal(t, TaskStatusCompleted, payload.Status)
+		assert.Equal(t, 1, payload.ResultCount)
+		assert.Equal(t, "https://parser.example.com/api/v1/tasks/"+taskID+"/result", payload.ResultURL)
+
+		// Попытка записывается после получения ответа.
+		assert.Eventually(t, func() bool {
+			task, err := srv.taskStore.GetTask(taskID)
+			return err == nil && task.Callback.Status == CallbackDelivered && len(task.Callback.Attempts) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+		mockProc.AssertExpectations(t)
+	})
+
+	t.Run("Некорректный callback_url", func(t *testing.T) {
+		for _, callbackURL := range []string{"ftp://example.com/hook", "/relative", "http://"} {
+			body, contentType := newUploadForm(t, map[string][]string{"callback_url": {callbackURL}})
+			req := httptest.NewRequest("POST", "/api/v1/process", body)
+			req.Header.Set("Content-Type", contentType)
+			rr := httptest.NewRecorder()
+			srv.HTTPServer.Handler.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, callbackURL)
+		}
+	})
+
+	t.Run("callback_url во внутренней сети", func(t *testing.T) {
+		cfg := *cfg
+		cfg.Webhook.AllowPrivateNetworks = false
+		srv, err := New(&cfg, mockProc, NewTaskStore(), cache.NewCacheStore())
+		require.NoError(t, err)
+
+		for _, callbackURL := range []string{receiver.URL, "http://169.254.169.254/latest/meta-data"} {
+			body, contentType := newUploadForm(t, map[string][]string{"callback_url": {callbackURL}})
+			req := httptest.NewRequest("POST", "/api/v1/process", body)
+			req.Header.Set("Content-Type", contentType)
+			rr := httptest.NewRecorder()
+			srv.HTTPServer.Handler.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, callbackURL)
+			assert.Contains(t, rr.Body.String(), "private network", callbackURL)
+		}
+	})
+
+	t.Run("Уведомления не настроены", func(t *testing.T) {
+		cfg := *cfg
+		cfg.Webhook.Secret = ""
+		srv, err := New(&cfg, mockProc, NewTaskStore(), cache.NewCacheStore())
+		require.NoError(t, err)
+
+		body, contentType := newUploadForm(t, map[string][]string{"callback_url": {receiver.URL}})
+		req := httptest.NewRequest("POST", "/api/v1/process", body)
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		srv.HTTPServer.Handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
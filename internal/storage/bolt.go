@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltOpenTimeout ограничивает ожидание блокировки файла базы, которую держит другой процесс.
+const boltOpenTimeout = 5 * time.Second
+
+// OpenBolt открывает (или создает) файл встроенной базы bbolt.
+// Одну базу могут использовать несколько BoltStore с разными бакетами.
+func OpenBolt(path string) (*bolt.DB, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create storage directory %s: %w", dir, err)
+		}
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// BoltStore хранит записи в бакете базы bbolt на диске, поэтому они переживают перезапуск.
+// Значение записи — 8 байт срока действия (Unix-время в наносекундах, 0 — бессрочно)
+// и JSON-представление значения. Срок в начале записи позволяет удалять просроченные
+// записи без разбора JSON.
+type BoltStore[T any] struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+// NewBoltStore создает хранилище в бакете bucket, создавая бакет при необходимости.
+// Закрытие db остается за вызывающим.
+func NewBoltStore[T any](db *bolt.DB, bucket string) (*BoltStore[T], error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bucket %s: %w", bucket, err)
+	}
+	return &BoltStore[T]{db: db, bucket: []byte(bucket)}, nil
+}
+
+// Get возвращает значение по ключу или ErrNotFound.
+func (s *BoltStore[T]) Get(key string) (T, error) {
+	var value T
+	err := s.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(s.bucket).Get([]byte(key))
+		if raw == nil {
+			return ErrNotFound
+		}
+		expiresAt, err := decodeBoltValue(raw, &value)
+		if err != nil {
+			return fmt.Errorf("failed to decode %s/%s: %w", s.bucket, key, err)
+		}
+		if expired(expiresAt, time.Now()) {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return value, nil
+}
+
+// Put сохраняет значение, заменяя существующее.
+func (s *BoltStore[T]) Put(key string, value T, expiresAt time.Time) error {
+	raw, err := encodeBoltValue(value, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s/%s: %w", s.bucket, key, err)
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(s.bucket).Put([]byte(key), raw)
+	})
+}
+
+// Update атомарно изменяет существующее значение, сохраняя срок его действия.
+func (s *BoltStore[T]) Update(key string, fn func(value *T) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(s.bucket)
+		raw := b.Get([]byte(key))
+		if raw == nil {
+			return ErrNotFound
+		}
+		var value T
+		expiresAt, err := decodeBoltValue(raw, &value)
+		if err != nil {
+			return fmt.Errorf("failed to decode %s/%s: %w", s.bucket, key, err)
+		}
+		if expired(expiresAt, time.Now()) {
+			return ErrNotFound
+		}
+		if err := fn(&value); err != nil {
+			return err
+		}
+		updated, err := encodeBoltValue(value, expiresAt)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s/%s: %w", s.bucket, key, err)
+		}
+		return b.Put([]byte(key), updated)
+	})
+}
+
+// Delete удаляет значение по ключу.
+func (s *BoltStore[T]) Delete(key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(s.bucket).Delete([]byte(key))
+	})
+}
+
+// Keys возвращает ключи непросроченных записей.
+func (s *BoltStore[T]) Keys() ([]string, error) {
+	var keys []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		now := time.Now()
+		return tx.Bucket(s.bucket).ForEach(func(k, v []byte) error {
+			if len(v) >= 8 && !expired(boltExpiresAt(v), now) {
+				keys = append(keys, string(k))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys of %s: %w", s.bucket, err)
+	}
+	return keys, nil
+}
+
+// DeleteExpired удаляет просроченные записи.
+func (s *BoltStore[T]) DeleteExpired(now time.Time) (int, error) {
+	removed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		// Удаление через курсор во время обхода пропускает элементы, поэтому ключи
+		// сначала собираются, а затем удаляются.
+		var keys [][]byte
+		b := tx.Bucket(s.bucket)
+		err := b.ForEach(func(k, v []byte) error {
+			if len(v) < 8 || expired(boltExpiresAt(v), now) {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		removed = len(keys)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired entries from %s: %w", s.bucket, err)
+	}
+	return removed, nil
+}
+
+func encodeBoltValue(value any, expiresAt time.Time) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	raw := make([]byte, 8, 8+len(data))
+	if !expiresAt.IsZero() {
+		binary.BigEndian.PutUint64(raw, uint64(expiresAt.UnixNano()))
+	}
+	return append(raw, data...), nil
+}
+
+func decodeBoltValue(raw []byte, value any) (time.Time, error) {
+	if len(raw) < 8 {
+		return time.Time{}, fmt.Errorf("value is too short")
+	}
+	if err := json.Unmarshal(raw[8:], value); err != nil {
+		return time.Time{}, err
+	}
+	return boltExpiresAt(raw), nil
+}
+
+func boltExpiresAt(raw []byte) time.Time {
+	nanos := binary.BigEndian.Uint64(raw[:8])
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(nanos))
+}
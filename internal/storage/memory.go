@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore хранит записи в памяти процесса. Данные теряются при перезапуске.
+type MemoryStore[T any] struct {
+	items map[string]memoryItem[T]
+	mutex sync.RWMutex
+}
+
+type memoryItem[T any] struct {
+	value     T
+	expiresAt time.Time
+}
+
+// NewMemoryStore создает новый экземпляр MemoryStore.
+func NewMemoryStore[T any]() *MemoryStore[T] {
+	return &MemoryStore[T]{
+		items: make(map[string]memoryItem[T]),
+	}
+}
+
+// Get возвращает значение по ключу или ErrNotFound.
+func (s *MemoryStore[T]) Get(key string) (T, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	item, exists := s.items[key]
+	if !exists || expired(item.expiresAt, time.Now()) {
+		var zero T
+		return zero, ErrNotFound
+	}
+	return item.value, nil
+}
+
+// Put сохраняет значение, заменяя существующее.
+func (s *MemoryStore[T]) Put(key string, value T, expiresAt time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.items[key] = memoryItem[T]{value: value, expiresAt: expiresAt}
+	return nil
+}
+
+// Update атомарно изменяет существующее значение, сохраняя срок его действия.
+func (s *MemoryStore[T]) Update(key string, fn func(value *T) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	item, exists := s.items[key]
+	if !exists || expired(item.expiresAt, time.Now()) {
+		return ErrNotFound
+	}
+	if err := fn(&item.value); err != nil {
+		return err
+	}
+	s.items[key] = item
+	return nil
+}
+
+// Delete удаляет значение по ключу.
+func (s *MemoryStore[T]) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.items, key)
+	return nil
+}
+
+// Keys возвращает ключи непросроченных записей.
+func (s *MemoryStore[T]) Keys() ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	now := time.Now()
+	keys := make([]string, 0, len(s.items))
+	for key, item := range s.items {
+		if !expired(item.expiresAt, now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// DeleteExpired удаляет просроченные записи.
+func (s *MemoryStore[T]) DeleteExpired(now time.Time) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	removed := 0
+	for key, item := range s.items {
+		if expired(item.expiresAt, now) {
+			delete(s.items, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,42 @@
+// Package storage предоставляет хранилища записей с ограниченным сроком жизни,
+// на которых построены хранилища задач и кэша результатов.
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound возвращается, когда записи нет или срок ее действия истек.
+var ErrNotFound = errors.New("storage: not found")
+
+// Типы хранилищ, выбираемые в конфигурации.
+const (
+	TypeMemory = "memory"
+	TypeBolt   = "bolt"
+)
+
+// Store хранит значения типа T по строковому ключу. Каждая запись имеет срок действия:
+// просроченные записи не возвращаются и удаляются DeleteExpired.
+// Нулевой expiresAt означает бессрочную запись.
+type Store[T any] interface {
+	// Get возвращает значение по ключу или ErrNotFound.
+	Get(key string) (T, error)
+	// Put сохраняет значение, заменяя существующее.
+	Put(key string, value T, expiresAt time.Time) error
+	// Update атомарно изменяет существующее значение, сохраняя срок его действия.
+	// Если fn возвращает ошибку, значение не изменяется. Для отсутствующего ключа возвращает ErrNotFound.
+	Update(key string, fn func(value *T) error) error
+	// Delete удаляет значение по ключу. Отсутствие ключа не является ошибкой.
+	Delete(key string) error
+	// Keys возвращает ключи непросроченных записей в произвольном порядке.
+	Keys() ([]string, error)
+	// DeleteExpired удаляет записи, срок действия которых истек к моменту now,
+	// и возвращает их количество.
+	DeleteExpired(now time.Time) (int, error)
+}
+
+// expired проверяет, истек ли срок действия записи к моменту now.
+func expired(expiresAt, now time.Time) bool {
+	return !expiresAt.IsZero() && now.After(expiresAt)
+}
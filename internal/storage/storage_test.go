@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testValue struct {
+	Name  string
+	Count int
+}
+
+func TestStores(t *testing.T) {
+	backends := map[string]func(t *testing.T) Store[testValue]{
+		TypeMemory: func(t *testing.T) Store[testValue] {
+			return NewMemoryStore[testValue]()
+		},
+		TypeBolt: func(t *testing.T) Store[testValue] {
+			db, err := OpenBolt(filepath.Join(t.TempDir(), "data", "test.db"))
+			require.NoError(t, err)
+			t.Cleanup(func() { db.Close() })
+			store, err := NewBoltStore[testValue](db, "test")
+			require.NoError(t, err)
+			return store
+		},
+	}
+
+	for name, newStore := range backends {
+		t.Run(name, func(t *testing.T) {
+			t.Run("Запись и чтение", func(t *testing.T) {
+				s := newStore(t)
+				require.NoError(t, s.Put("a", testValue{Name: "A", Count: 1}, time.Now().Add(time.Minute)))
+
+				v, err := s.Get("a")
+				require.NoError(t, err)
+				assert.Equal(t, testValue{Name: "A", Count: 1}, v)
+
+				_, err = s.Get("missing")
+				assert.ErrorIs(t, err, ErrNotFound)
+			})
+
+			t.Run("Просроченная запись не возвращается и удаляется", func(t *testing.T) {
+				s := newStore(t)
+				require.NoError(t, s.Put("old", testValue{Name: "old"}, time.Now().Add(-time.Second)))
+				require.NoError(t, s.Put("new", testValue{Name: "new"}, time.Now().Add(time.Minute)))
+				require.NoError(t, s.Put("forever", testValue{Name: "forever"}, time.Time{}))
+
+				_, err := s.Get("old")
+				assert.ErrorIs(t, err, ErrNotFound)
+				keys, err := s.Keys()
+				require.NoError(t, err)
+				assert.ElementsMatch(t, []string{"new", "forever"}, keys)
+				assert.ErrorIs(t, s.Update("old", func(*testValue) error { return nil }), ErrNotFound)
+
+				removed, err := s.DeleteExpired(time.Now())
+				require.NoError(t, err)
+				assert.Equal(t, 1, removed)
+
+				_, err = s.Get("new")
+				assert.NoError(t, err)
+				_, err = s.Get("forever")
+				assert.NoError(t, err)
+			})
+
+			t.Run("Обновление и удаление", func(t *testing.T) {
+				s := newStore(t)
+				require.NoError(t, s.Put("a", testValue{Count: 1}, time.Now().Add(time.Minute)))
+
+				require.NoError(t, s.Update("a", func(v *testValue) error {
+					v.Count++
+					return nil
+				}))
+				errAbort := errors.New("abort")
+				err := s.Update("a", func(v *testValue) error {
+					v.Count = 100
+					return errAbort
+				})
+				assert.ErrorIs(t, err, errAbort)
+
+				v, err := s.Get("a")
+				require.NoError(t, err)
+				assert.Equal(t, 2, v.Count)
+
+				assert.ErrorIs(t, s.Update("missing", func(*testValue) error { return nil }), ErrNotFound)
+
+				require.NoError(t, s.Delete("a"))
+				require.NoError(t, s.Delete("a"))
+				_, err = s.Get("a")
+				assert.ErrorIs(t, err, ErrNotFound)
+			})
+		})
+	}
+}
+
+func TestBoltStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "persist.db")
+
+	db, err := OpenBolt(path)
+	require.NoError(t, err)
+	store, err := NewBoltStore[testValue](db, "values")
+	require.NoError(t, err)
+	expiresAt := time.Now().Add(time.Hour)
+	require.NoError(t, store.Put("a", testValue{Name: "A"}, expiresAt))
+	require.NoError(t, db.Close())
+
+	db, err = OpenBolt(path)
+	require.NoError(t, err)
+	defer db.Close()
+	store, err = NewBoltStore[testValue](db, "values")
+	require.NoError(t, err)
+
+	v, err := store.Get("a")
+	require.NoError(t, err)
+	assert.Equal(t, "A", v.Name)
+
+	// Срок действия сохраняется вместе с записью.
+	removed, err := store.DeleteExpired(expiresAt.Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+}
@@ -10,18 +10,25 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gotd/td/session"
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/telegram/auth/qrlogin"
 	"github.com/gotd/td/tg"
 	"golang.org/x/term"
 
+	"telegram-chat-parser/internal/metrics"
 	trm "telegram-chat-parser/internal/pkg/term"
+	"telegram-chat-parser/internal/ports"
 )
 
+// methodHelpGetConfig используется проверкой здоровья и расходует только общий бюджет клиента.
+const methodHelpGetConfig = "help.getConfig"
+
 var (
 	// ErrFloodWaitActive возвращается, когда клиент не может выполнить запрос из-за активного ограничения FLOOD_WAIT.
 	ErrFloodWaitActive = errors.New("client is in flood wait")
@@ -76,28 +83,53 @@ type authenticator interface {
 // Client представляет собой потокобезопасный клиент для Telegram API,
 // который инкапсулирует логику аутентификации, обработки ошибок FLOOD_WAIT и выполнения запросов.
 type Client struct {
-	id         string
-	tgRunner   telegramRunner
-	authFlow   authFlow
+	id string
+	// label — метка клиента в метриках; в отличие от id не меняется при перезапуске.
+	label    string
+	tgRunner telegramRunner
+	authFlow authFlow
+	// remoteFlow выполняет вход без терминала с кодом и паролем из remoteAuth.
+	remoteFlow authFlow
+	remoteAuth *RemoteAuthenticator
+	// qrFlow выполняет вход по QR-коду; задан, если LoginMethod — LoginQR.
+	qrFlow     authFlow
+	termAuth   authenticator
 	isTerminal func(fd int) bool
 	clock      func() time.Time
 	log        *slog.Logger
 
+	weight   int
+	inFlight atomic.Int32
+
 	mu             sync.RWMutex
 	unhealthyUntil time.Time
+	lastFloodWait  time.Time
 	lastRequest    time.Time
 	requestDelay   time.Duration
+	limiter        *rateLimiter
 	runErr         chan error
+	stopped        chan struct{} // Закрывается после завершения фонового процесса.
 	startOnce      sync.Once
 }
 
 // Config содержит конфигурацию для создания нового клиента.
 type Config struct {
-	APIID        int
-	APIHash      string
-	PhoneNumber  string
-	SessionPath  string
-	RequestDelay time.Duration
+	APIID       int
+	APIHash     string
+	PhoneNumber string
+	SessionPath string
+	// SessionStorage — хранилище сессии аккаунта. Если не задано, сессия хранится
+	// в файле SessionPath.
+	SessionStorage session.Storage
+	RequestDelay   time.Duration
+	// RequestLimit ограничивает частоту всех запросов клиента.
+	RequestLimit RateLimit
+	// MethodLimits задает отдельные ограничения для методов API (ключи — ports.Method*).
+	MethodLimits map[string]RateLimit
+	// Weight — доля запросов клиента при взвешенном выборе. 0 означает 1.
+	Weight int
+	// LoginMethod — способ входа в аккаунт: LoginCode (по умолчанию) или LoginQR.
+	LoginMethod string
 }
 
 // ClientOption определяет функциональную опцию для конфигурации клиента.
@@ -114,32 +146,64 @@ func WithLogger(l *slog.Logger) ClientOption {
 
 // NewClient создает новый экземпляр Client.
 func NewClient(cfg Config, opts ...ClientOption) *Client {
-	// Создаем аутентификатор для терминала.
+	// Создаем аутентификаторы для терминала и для входа через API администрирования.
 	termAuth := trm.NewTerminal(cfg.PhoneNumber)
+	remoteAuth := NewRemoteAuthenticator(cfg.PhoneNumber)
 
 	// Настраиваем хранилище сессии.
-	sessionStorage := &session.FileStorage{Path: cfg.SessionPath}
+	sessionStorage := cfg.SessionStorage
+	if sessionStorage == nil {
+		sessionStorage = &session.FileStorage{Path: cfg.SessionPath}
+	}
 
 	// Создаем и настраиваем базовый клиент gotd.
-	tgClient := telegram.NewClient(cfg.APIID, cfg.APIHash, telegram.Options{
+	tgOpts := telegram.Options{
 		SessionStorage: sessionStorage,
-	})
+	}
+	// Подтверждение входа по QR-коду приходит обновлением updateLoginToken.
+	var loggedIn qrlogin.LoggedIn
+	if cfg.LoginMethod == LoginQR {
+		dispatcher := tg.NewUpdateDispatcher()
+		loggedIn = qrlogin.OnLoginToken(dispatcher)
+		tgOpts.UpdateHandler = dispatcher
+	}
+	tgClient := telegram.NewClient(cfg.APIID, cfg.APIHash, tgOpts)
 
 	c := &Client{
 		id:           uuid.NewString(),
+		label:        MaskPhone(cfg.PhoneNumber),
 		tgRunner:     &prodRunner{Client: tgClient},
 		authFlow:     auth.NewFlow(termAuth, auth.SendCodeOptions{}),
+		remoteFlow:   auth.NewFlow(remoteAuth, auth.SendCodeOptions{}),
+		remoteAuth:   remoteAuth,
+		termAuth:     termAuth,
 		isTerminal:   func(fd int) bool { return term.IsTerminal(fd) },
 		clock:        time.Now,
 		log:          slog.Default(),
 		runErr:       make(chan error, 1),
+		stopped:      make(chan struct{}),
 		requestDelay: cfg.RequestDelay,
+		weight:       max(cfg.Weight, 1),
+	}
+
+	if cfg.LoginMethod == LoginQR {
+		c.qrFlow = &qrFlow{
+			qr:       tgClient.QR(),
+			loggedIn: loggedIn,
+			show:     c.showQR,
+			password: c.qrPassword,
+			passwordFailed: func(err error) {
+				c.remoteAuth.finish(err, true)
+			},
+		}
 	}
 
 	for _, opt := range opts {
 		opt(c)
 	}
 
+	c.limiter = newRateLimiter(cfg.RequestLimit, cfg.MethodLimits, c.clock())
+
 	return c
 }
 
@@ -148,6 +212,13 @@ func (c *Client) ID() string {
 	return c.id
 }
 
+// MetricsLabel возвращает метку клиента в метриках — номер телефона со скрытыми средними
+// цифрами. В отличие от ID, она одинакова после перезапуска сервера и перезагрузки пула,
+// поэтому число серий метрик не растет, а метку можно сопоставить с аккаунтом.
+func (c *Client) MetricsLabel() string {
+	return c.label
+}
+
 // GetRecoveryTime возвращает время, до которого клиент считается неработоспособным.
 func (c *Client) GetRecoveryTime() time.Time {
 	c.mu.RLock()
@@ -171,13 +242,24 @@ func (c *Client) Start(ctx context.Context) {
 					} else {
 						c.log.WarnContext(runCtx, "Session check failed, attempting interactive auth", "client_id", c.id, "error", err)
 					}
-					if !c.isTerminal(int(os.Stdout.Fd())) {
-						return fmt.Errorf("session is invalid and cannot perform interactive auth in non-terminal: %w", err)
-					}
-					if authErr := c.authFlow.Run(runCtx, c.tgRunner.Auth()); authErr != nil {
-						return fmt.Errorf("interactive auth failed: %w", authErr)
+					if c.qrFlow != nil {
+						// QR-код показывается и в терминале, и через API администрирования.
+						if authErr := c.runRemoteAuth(runCtx, c.qrFlow); authErr != nil {
+							return fmt.Errorf("qr auth failed: %w", authErr)
+						}
+						c.log.InfoContext(runCtx, "QR auth successful, session saved", "client_id", c.id)
+					} else if c.isTerminal(int(os.Stdout.Fd())) {
+						if authErr := c.authFlow.Run(runCtx, c.tgRunner.Auth()); authErr != nil {
+							return fmt.Errorf("interactive auth failed: %w", authErr)
+						}
+						c.log.InfoContext(runCtx, "Interactive auth successful, session saved", "client_id", c.id)
+					} else {
+						// Без терминала код и пароль передаются через API администрирования.
+						if authErr := c.runRemoteAuth(runCtx, c.remoteFlow); authErr != nil {
+							return fmt.Errorf("remote auth failed: %w", authErr)
+						}
+						c.log.InfoContext(runCtx, "Remote auth successful, session saved", "client_id", c.id)
 					}
-					c.log.InfoContext(runCtx, "Interactive auth successful, session saved", "client_id", c.id)
 				}
 				c.log.InfoContext(runCtx, "Telegram client authenticated and ready", "client_id", c.id)
 
@@ -194,10 +276,74 @@ func (c *Client) Start(ctx context.Context) {
 
 			c.runErr <- err
 			close(c.runErr)
+			close(c.stopped)
 		}()
 	})
 }
 
+// runRemoteAuth выполняет вход в аккаунт через flow с кодом и паролем, переданными через
+// SubmitAuthCode и SubmitAuthPassword, или по QR-коду. Неверный или истекший код и
+// неверный пароль не прерывают вход: Telegram отправляет новый код, и попытку можно повторить.
+func (c *Client) runRemoteAuth(ctx context.Context, flow authFlow) error {
+	for {
+		c.log.WarnContext(ctx, "Waiting for login via admin API", "client_id", c.id)
+		err := flow.Run(ctx, c.tgRunner.Auth())
+		retry := err != nil && ctx.Err() == nil && retryableAuthError(err)
+		c.remoteAuth.finish(err, retry)
+		if !retry {
+			return err
+		}
+		c.log.WarnContext(ctx, "Remote auth attempt failed, requesting a new code", "client_id", c.id, "error", err)
+	}
+}
+
+// showQR показывает новый QR-код для входа: через API администрирования и, если
+// сервер запущен в терминале, в стандартном выводе. Сам токен в лог не пишется.
+func (c *Client) showQR(ctx context.Context, token qrlogin.Token) error {
+	c.remoteAuth.ShowQR(token)
+	c.log.WarnContext(ctx, "Waiting for QR login confirmation", "client_id", c.id, "expires_at", token.Expires())
+	if c.isTerminal(int(os.Stdout.Fd())) {
+		return printQR(os.Stdout, token)
+	}
+	return nil
+}
+
+// qrPassword запрашивает пароль 2FA после подтверждения QR-кода: в терминале, если
+// он есть, иначе через API администрирования.
+func (c *Client) qrPassword(ctx context.Context) (string, error) {
+	if c.isTerminal(int(os.Stdout.Fd())) {
+		return c.termAuth.Password(ctx)
+	}
+	return c.remoteAuth.Password(ctx)
+}
+
+// AuthQRCode возвращает текущий QR-код для входа в формате PNG.
+// Возвращает ErrAuthNotPending, если клиент не ждет входа по QR-коду.
+func (c *Client) AuthQRCode() ([]byte, error) {
+	token, ok := c.remoteAuth.QR()
+	if !ok {
+		return nil, ErrAuthNotPending
+	}
+	return qrPNG(token)
+}
+
+// AuthStatus возвращает состояние входа в аккаунт через API администрирования.
+func (c *Client) AuthStatus() AuthStatus {
+	return c.remoteAuth.Status()
+}
+
+// SubmitAuthCode передает код подтверждения входу, ожидающему его.
+// Возвращает ErrAuthNotPending, если клиент не ждет код.
+func (c *Client) SubmitAuthCode(code string) error {
+	return c.remoteAuth.SubmitCode(code)
+}
+
+// SubmitAuthPassword передает пароль 2FA входу, ожидающему его.
+// Возвращает ErrAuthNotPending, если клиент не ждет пароль.
+func (c *Client) SubmitAuthPassword(password string) error {
+	return c.remoteAuth.SubmitPassword(password)
+}
+
 // Health проверяет работоспособность клиента.
 // Если активен FLOOD_WAIT, возвращает ошибку.
 // В противном случае выполняет легковесный запрос к API.
@@ -208,7 +354,7 @@ func (c *Client) Health(ctx context.Context) error {
 	}
 
 	// Выполняем легковесный запрос для проверки связи.
-	err := c.do(ctx, func(ctx context.Context) error {
+	err := c.do(ctx, methodHelpGetConfig, func(ctx context.Context) error {
 		_, err := c.tgRunner.API().HelpGetConfig(ctx)
 		return err
 	})
@@ -222,7 +368,7 @@ func (c *Client) Health(ctx context.Context) error {
 func (c *Client) UsersGetUsers(ctx context.Context, request []tg.InputUserClass) ([]tg.UserClass, error) {
 	var result []tg.UserClass
 	c.log.DebugContext(ctx, "Executing API call: UsersGetUsers")
-	err := c.do(ctx, func(ctx context.Context) error {
+	err := c.do(ctx, ports.MethodUsersGetUsers, func(ctx context.Context) error {
 		res, err := c.tgRunner.API().UsersGetUsers(ctx, request)
 		if err == nil {
 			result = res
@@ -240,7 +386,7 @@ func (c *Client) UsersGetUsers(ctx context.Context, request []tg.InputUserClass)
 func (c *Client) ContactsResolveUsername(ctx context.Context, req *tg.ContactsResolveUsernameRequest) (*tg.ContactsResolvedPeer, error) {
 	var result *tg.ContactsResolvedPeer
 	c.log.DebugContext(ctx, "Executing API call: ContactsResolveUsername", "username", req.Username)
-	err := c.do(ctx, func(ctx context.Context) error {
+	err := c.do(ctx, ports.MethodContactsResolveUsername, func(ctx context.Context) error {
 		res, err := c.tgRunner.API().ContactsResolveUsername(ctx, req)
 		if err == nil {
 			result = res
@@ -257,7 +403,7 @@ func (c *Client) ContactsResolveUsername(ctx context.Context, req *tg.ContactsRe
 func (c *Client) UsersGetFullUser(ctx context.Context, inputUser tg.InputUserClass) (*tg.UsersUserFull, error) {
 	var result *tg.UsersUserFull
 	c.log.DebugContext(ctx, "Executing API call: UsersGetFullUser")
-	err := c.do(ctx, func(ctx context.Context) error {
+	err := c.do(ctx, ports.MethodUsersGetFullUser, func(ctx context.Context) error {
 		res, err := c.tgRunner.API().UsersGetFullUser(ctx, inputUser)
 		if err == nil {
 			result = res
@@ -270,15 +416,51 @@ func (c *Client) UsersGetFullUser(ctx context.Context, inputUser tg.InputUserCla
 	return result, err
 }
 
+// InFlight возвращает количество запросов, которые клиент выполняет или ожидает выполнить.
+func (c *Client) InFlight() int {
+	return int(c.inFlight.Load())
+}
+
+// Stopped возвращает канал, который закрывается после завершения фонового процесса,
+// запущенного Start: после этого клиент больше не использует сессию.
+func (c *Client) Stopped() <-chan struct{} {
+	return c.stopped
+}
+
+// LastFloodWait возвращает время последней ошибки FLOOD_WAIT или нулевое время.
+func (c *Client) LastFloodWait() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastFloodWait
+}
+
+// Weight возвращает вес клиента для взвешенного выбора.
+func (c *Client) Weight() int {
+	return max(c.weight, 1)
+}
+
+// RateBudget возвращает, сколько запросов method клиент может выполнить без ожидания.
+// Если ограничения не заданы, возвращает +Inf.
+func (c *Client) RateBudget(method string) float64 {
+	return c.limiter.budget(method, c.clock())
+}
+
 // do — это основной метод, который выполняет всю работу.
 // Он проверяет состояние, запускает клиент, обрабатывает аутентификацию и ошибки.
-func (c *Client) do(ctx context.Context, f func(ctx context.Context) error) error {
-	c.log.DebugContext(ctx, "Executing 'do' method")
+func (c *Client) do(ctx context.Context, method string, f func(ctx context.Context) error) error {
+	c.log.DebugContext(ctx, "Executing 'do' method", "method", method)
+	c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+
 	if err := c.checkHealthStatus(); err != nil {
 		c.log.WarnContext(ctx, "Client is unhealthy, aborting 'do'", "error", err)
 		return err
 	}
 
+	if err := c.waitRateLimit(ctx, method); err != nil {
+		return err
+	}
+
 	c.applyRequestDelay(ctx)
 
 	// Предполагается, что c.Start() был вызван, и клиент работает в фоновом режиме.
@@ -303,8 +485,13 @@ func (c *Client) do(ctx context.Context, f func(ctx context.Context) error) erro
 	return opErr
 }
 
-// checkHealthStatus проверяет, не находится ли клиент в состоянии FLOOD_WAIT.
+// checkHealthStatus проверяет, не ждет ли клиент входа в аккаунт и не находится ли он
+// в состоянии FLOOD_WAIT.
 func (c *Client) checkHealthStatus() error {
+	if c.remoteAuth.Pending() {
+		return fmt.Errorf("%w: %s", ErrAuthRequired, c.remoteAuth.Status().State)
+	}
+
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
@@ -317,6 +504,31 @@ func (c *Client) checkHealthStatus() error {
 	return nil
 }
 
+// waitRateLimit резервирует запрос в корзинах токенов клиента и ждет, пока он станет
+// доступен. Если ожидание не укладывается в дедлайн контекста, резерв возвращается и
+// запрос не выполняется: роутер может отдать его клиенту с оставшимся бюджетом.
+func (c *Client) waitRateLimit(ctx context.Context, method string) error {
+	wait, cancel := c.limiter.reserve(method, c.clock())
+	if wait <= 0 {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+		cancel()
+		return fmt.Errorf("%w: %s needs %v", ErrRateLimited, method, wait)
+	}
+
+	c.log.DebugContext(ctx, "Waiting for request budget", "method", method, "duration", wait)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		cancel()
+		return ctx.Err()
+	}
+}
+
 // applyRequestDelay обеспечивает задержку между запросами.
 func (c *Client) applyRequestDelay(ctx context.Context) {
 	if c.requestDelay <= 0 {
@@ -350,11 +562,20 @@ func (c *Client) handleError(err error) {
 		c.mu.Lock()
 		defer c.mu.Unlock()
 
-		c.unhealthyUntil = c.clock().Add(waitDuration)
+		c.lastFloodWait = c.clock()
+		c.unhealthyUntil = c.lastFloodWait.Add(waitDuration)
+		metrics.FloodWait.WithLabelValues(c.label).Observe(waitDuration.Seconds())
 		c.log.Warn("Client got FLOOD_WAIT, set unhealthy", "wait_duration", waitDuration, "until", c.unhealthyUntil)
 	}
 }
 
+// IsFloodWait сообщает, вызвана ли ошибка ограничением FLOOD_WAIT: полученным от Telegram
+// или еще действующим у клиента.
+func IsFloodWait(err error) bool {
+	_, ok := parseFloodWait(err)
+	return ok || errors.Is(err, ErrFloodWaitActive)
+}
+
 // parseFloodWait извлекает длительность ожидания из ошибки.
 func parseFloodWait(err error) (time.Duration, bool) {
 	if err == nil {
@@ -373,3 +594,12 @@ func parseFloodWait(err error) (time.Duration, bool) {
 
 	return time.Duration(seconds) * time.Second, true
 }
+
+// MaskPhone скрывает средние цифры номера телефона: +79991234567 -> +79*******67.
+func MaskPhone(phone string) string {
+	const keepPrefix, keepSuffix = 3, 2
+	if len(phone) <= keepPrefix+keepSuffix {
+		return strings.Repeat("*", len(phone))
+	}
+	return phone[:keepPrefix] + strings.Repeat("*", len(phone)-keepPrefix-keepSuffix) + phone[len(phone)-keepSuffix:]
+}
@@ -6,14 +6,21 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/gotd/td/telegram/auth"
 	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+
+	"telegram-chat-parser/internal/metrics"
+	"telegram-chat-parser/internal/ports"
 )
 
 // --- Mocks ---
@@ -48,7 +55,8 @@ func (m *mockTelegramAPI) HelpGetConfig(ctx context.Context) (*tg.Config, error)
 
 type mockTelegramRunner struct {
 	mock.Mock
-	api *mockTelegramAPI
+	api  *mockTelegramAPI
+	auth telegramAuth
 }
 
 func newMockTelegramRunner() *mockTelegramRunner {
@@ -78,7 +86,7 @@ func (m *mockTelegramRunner) API() telegramAPI {
 }
 
 func (m *mockTelegramRunner) Auth() telegramAuth {
-	return nil
+	return m.auth
 }
 
 type mockAuthFlow struct {
@@ -123,14 +131,17 @@ func newTestClient(t *testing.T) (*Client, *mockTelegramRunner, *mockAuthFlow, *
 
 	client := &Client{
 		id:             "test-client",
+		label:          "+10*******00",
 		tgRunner:       runner,
 		authFlow:       authFlow,
+		remoteAuth:     NewRemoteAuthenticator("+10000000000"),
 		isTerminal:     func(fd int) bool { return true }, // Assume interactive for tests
 		clock:          clock.Now,
 		log:            logger,
 		mu:             sync.RWMutex{},
 		unhealthyUntil: time.Time{},
 		runErr:         make(chan error, 1),
+		stopped:        make(chan struct{}),
 	}
 
 	// No default auth check mock anymore. It's context-dependent.
@@ -168,6 +179,12 @@ func TestClient_FloodWait_BlocksRequests(t *testing.T) {
 
 	// 2. Check internal state
 	require.True(t, client.unhealthyUntil.After(clock.Now()))
+	require.Equal(t, clock.Now(), client.LastFloodWait())
+	require.Zero(t, client.InFlight())
+	var floodWait dto.Metric
+	require.NoError(t, metrics.FloodWait.WithLabelValues("+10*******00").(prometheus.Metric).Write(&floodWait))
+	require.Equal(t, uint64(1), floodWait.GetHistogram().GetSampleCount())
+	require.Equal(t, float64(60), floodWait.GetHistogram().GetSampleSum())
 
 	// 3. Second call should be blocked immediately
 	err = client.Health(ctx)
@@ -280,34 +297,132 @@ func TestClient_Authentication_Fails(t *testing.T) {
 	authFlow.AssertExpectations(t)
 }
 
-func TestClient_NonInteractiveAuthFails(t *testing.T) {
+// fakeFlowClient отвечает на запросы входа в аккаунт заданными ошибками SignIn.
+type fakeFlowClient struct {
+	mu        sync.Mutex
+	sendCodes int
+	signIns   []error
+	passwords []string
+	// passwordErrs — ошибки первых вызовов Password; остальные вызовы успешны.
+	passwordErrs []error
+}
+
+func (f *fakeFlowClient) SendCode(ctx context.Context, phone string, options auth.SendCodeOptions) (tg.AuthSentCodeClass, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sendCodes++
+	return &tg.AuthSentCode{Type: &tg.AuthSentCodeTypeSMS{}, PhoneCodeHash: "hash"}, nil
+}
+
+func (f *fakeFlowClient) SignIn(ctx context.Context, phone, code, codeHash string) (*tg.AuthAuthorization, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	err := f.signIns[0]
+	f.signIns = f.signIns[1:]
+	return &tg.AuthAuthorization{}, err
+}
+
+func (f *fakeFlowClient) Password(ctx context.Context, password string) (*tg.AuthAuthorization, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.passwords = append(f.passwords, password)
+	if len(f.passwordErrs) > 0 {
+		err := f.passwordErrs[0]
+		f.passwordErrs = f.passwordErrs[1:]
+		return nil, err
+	}
+	return &tg.AuthAuthorization{}, nil
+}
+
+func (f *fakeFlowClient) SignUp(ctx context.Context, s auth.SignUp) (*tg.AuthAuthorization, error) {
+	return nil, errors.New("unexpected sign up")
+}
+
+func TestClient_NonInteractiveAuthUsesRemoteAuth(t *testing.T) {
 	client, runner, authFlow, _ := newTestClient(t)
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	client.isTerminal = func(fd int) bool { return false } // Set to non-interactive
+	client.remoteFlow = auth.NewFlow(client.remoteAuth, auth.SendCodeOptions{})
+	flowClient := &fakeFlowClient{signIns: []error{
+		tgerr.New(400, "PHONE_CODE_INVALID"),
+		auth.ErrPasswordAuthNeeded,
+	}}
+	runner.auth = flowClient
 
-	// 1. Initial session check fails
 	runner.api.On("UsersGetUsers", mock.Anything, mock.Anything).Return(nil, errors.New("auth session invalid")).Once()
+	runner.On("Run", mock.Anything, mock.Anything).
+		Return(func(ctx context.Context, f func(context.Context) error) error { return f(ctx) }).
+		Once()
 
-	// Auth flow should NOT be called
+	waitState := func(state string) AuthStatus {
+		t.Helper()
+		require.Eventually(t, func() bool { return client.AuthStatus().State == state }, time.Second, 5*time.Millisecond)
+		return client.AuthStatus()
+	}
+
+	// Пока вход не выполнен, клиент не выполняет запросы.
+	client.Start(ctx)
+	status := waitState(AuthStateWaitingCode)
+	require.Equal(t, "sms", status.CodeType)
+	require.ErrorIs(t, client.Health(ctx), ErrAuthRequired)
+	require.ErrorIs(t, client.SubmitAuthPassword("secret"), ErrAuthNotPending)
+
+	// Неверный код не прерывает вход: Telegram отправляет новый код.
+	require.NoError(t, client.SubmitAuthCode("00000"))
+	require.ErrorIs(t, client.SubmitAuthCode("00000"), ErrAuthNotPending)
+	require.Eventually(t, func() bool {
+		s := client.AuthStatus()
+		return s.State == AuthStateWaitingCode && s.LastError != ""
+	}, time.Second, 5*time.Millisecond)
+	require.Contains(t, client.AuthStatus().LastError, "PHONE_CODE_INVALID")
+
+	require.NoError(t, client.SubmitAuthCode("12345"))
+	waitState(AuthStateWaitingPassword)
+	require.NoError(t, client.SubmitAuthPassword("secret"))
+	require.Equal(t, AuthStatus{}, waitState(AuthStateNone))
+
+	flowClient.mu.Lock()
+	require.Equal(t, 2, flowClient.sendCodes)
+	require.Equal(t, []string{"secret"}, flowClient.passwords)
+	flowClient.mu.Unlock()
 	authFlow.AssertNotCalled(t, "Run", mock.Anything, mock.Anything)
 
-	// The runner's Run method will return an error because the setup function failed
-	var runErr error
+	// После входа клиент снова выполняет запросы.
+	runner.api.On("HelpGetConfig", ctx).Return(&tg.Config{}, nil).Once()
+	require.NoError(t, client.Health(ctx))
+
+	cancel()
+	require.ErrorIs(t, <-client.runErr, context.Canceled)
+	select {
+	case <-client.Stopped():
+	case <-time.After(time.Second):
+		t.Fatal("client is not stopped")
+	}
+}
+
+func TestClient_RemoteAuthFails(t *testing.T) {
+	client, runner, _, _ := newTestClient(t)
+	ctx := context.Background()
+	client.isTerminal = func(fd int) bool { return false }
+	client.remoteFlow = auth.NewFlow(client.remoteAuth, auth.SendCodeOptions{})
+	runner.auth = &fakeFlowClient{signIns: []error{tgerr.New(400, "PHONE_NUMBER_BANNED")}}
+
+	runner.api.On("UsersGetUsers", mock.Anything, mock.Anything).Return(nil, errors.New("auth session invalid")).Once()
 	runner.On("Run", mock.Anything, mock.Anything).
-		Run(func(args mock.Arguments) {
-			f := args.Get(1).(func(ctx context.Context) error)
-			runErr = f(ctx)
-		}).
-		Return(func(context.Context, func(context.Context) error) error {
-			return runErr
-		}).
+		Return(func(ctx context.Context, f func(context.Context) error) error { return f(ctx) }).
 		Once()
 
 	client.Start(ctx)
-	err := <-client.runErr
+	require.Eventually(t, func() bool { return client.AuthStatus().State == AuthStateWaitingCode }, time.Second, 5*time.Millisecond)
+	require.NoError(t, client.SubmitAuthCode("12345"))
 
-	require.Error(t, err)
-	require.ErrorContains(t, err, "cannot perform interactive auth in non-terminal")
+	err := <-client.runErr
+	require.ErrorContains(t, err, "remote auth failed")
+	require.ErrorContains(t, err, "PHONE_NUMBER_BANNED")
+	status := client.AuthStatus()
+	require.Equal(t, AuthStateFailed, status.State)
+	require.Contains(t, status.LastError, "PHONE_NUMBER_BANNED")
 }
 
 func TestParseFloodWait(t *testing.T) {
@@ -388,3 +503,46 @@ func TestClient_OtherApiMethods(t *testing.T) {
 		runner.api.AssertExpectations(t)
 	})
 }
+
+func TestClient_RateLimit(t *testing.T) {
+	client, runner, _, clock := newTestClient(t)
+	client.limiter = newRateLimiter(RateLimit{}, map[string]RateLimit{
+		ports.MethodContactsResolveUsername: {PerMinute: 60},
+	}, clock.Now())
+	runner.api.On("ContactsResolveUsername", mock.Anything, mock.Anything).Return(&tg.ContactsResolvedPeer{}, nil)
+	runner.api.On("UsersGetFullUser", mock.Anything, mock.Anything).Return(&tg.UsersUserFull{}, nil)
+
+	_, err := client.ContactsResolveUsername(context.Background(), &tg.ContactsResolveUsernameRequest{})
+	require.NoError(t, err)
+	require.Zero(t, client.RateBudget(ports.MethodContactsResolveUsername))
+	require.True(t, math.IsInf(client.RateBudget(ports.MethodUsersGetFullUser), 1))
+
+	t.Run("budget exhausted before deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		_, err := client.ContactsResolveUsername(ctx, &tg.ContactsResolveUsernameRequest{})
+		require.ErrorIs(t, err, ErrRateLimited)
+		runner.api.AssertNumberOfCalls(t, "ContactsResolveUsername", 1)
+		// Клиент остается здоровым, а другие методы доступны.
+		require.True(t, client.GetRecoveryTime().IsZero())
+		_, err = client.UsersGetFullUser(ctx, &tg.InputUserSelf{})
+		require.NoError(t, err)
+	})
+
+	t.Run("budget refills", func(t *testing.T) {
+		clock.Advance(time.Second)
+		require.Equal(t, 1.0, client.RateBudget(ports.MethodContactsResolveUsername))
+
+		_, err := client.ContactsResolveUsername(context.Background(), &tg.ContactsResolveUsernameRequest{})
+		require.NoError(t, err)
+		runner.api.AssertNumberOfCalls(t, "ContactsResolveUsername", 2)
+	})
+}
+
+func TestMaskPhone(t *testing.T) {
+	require.Equal(t, "+79*******67", MaskPhone("+79991234567"))
+	require.Equal(t, "+12*45", MaskPhone("+12345"))
+	require.Equal(t, "****", MaskPhone("+123"))
+	require.Equal(t, "", MaskPhone(""))
+}
@@ -0,0 +1,116 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/telegram/auth/qrlogin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"rsc.io/qr"
+)
+
+// Способы входа в аккаунт.
+const (
+	// LoginCode — вход по коду подтверждения из SMS или приложения Telegram.
+	LoginCode = "code"
+	// LoginQR — вход по QR-коду, который подтверждается в приложении Telegram на телефоне.
+	LoginQR = "qr"
+)
+
+// qrPNGScale — размер модуля QR-кода в пикселях PNG.
+const qrPNGScale = 8
+
+// qrAuthenticator выполняет вход по QR-коду; реализуется qrlogin.QR.
+type qrAuthenticator interface {
+	Auth(ctx context.Context, loggedIn qrlogin.LoggedIn, show func(ctx context.Context, token qrlogin.Token) error, exceptIDs ...int64) (*tg.AuthAuthorization, error)
+}
+
+// qrFlow выполняет вход по QR-коду (auth.exportLoginToken): показывает QR-код, пока его
+// не подтвердят в приложении Telegram, и при необходимости запрашивает пароль 2FA.
+// Реализует authFlow.
+type qrFlow struct {
+	qr       qrAuthenticator
+	loggedIn qrlogin.LoggedIn
+	// show вызывается для каждого нового QR-кода: Telegram обновляет его каждые 30 секунд.
+	show func(ctx context.Context, token qrlogin.Token) error
+	// password запрашивает пароль 2FA, если аккаунт им защищен.
+	password func(ctx context.Context) (string, error)
+	// passwordFailed сообщает о неверном пароле 2FA перед повторным запросом.
+	passwordFailed func(err error)
+}
+
+// Run выполняет вход по QR-коду.
+func (f *qrFlow) Run(ctx context.Context, client auth.FlowClient) error {
+	_, err := f.qr.Auth(ctx, f.loggedIn, f.show)
+	if !tgerr.Is(err, "SESSION_PASSWORD_NEEDED") {
+		return err
+	}
+
+	// QR-код подтвержден, но аккаунт защищен паролем. Неверный пароль запрашивается
+	// повторно: подтвержденный вход по QR-коду при этом сохраняется.
+	for {
+		password, err := f.password(ctx)
+		if err != nil {
+			return fmt.Errorf("get password: %w", err)
+		}
+		_, err = client.Password(ctx, password)
+		if !errors.Is(err, auth.ErrPasswordInvalid) {
+			return err
+		}
+		f.passwordFailed(err)
+	}
+}
+
+// qrPNG возвращает QR-код токена входа в формате PNG.
+func qrPNG(token qrlogin.Token) ([]byte, error) {
+	code, err := qr.Encode(token.URL(), qr.M)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode QR code: %w", err)
+	}
+	code.Scale = qrPNGScale
+	return code.PNG(), nil
+}
+
+// printQR выводит QR-код токена входа в терминал. Каждый символ содержит два модуля
+// кода по вертикали, поэтому код остается квадратным в моноширинном шрифте.
+func printQR(w io.Writer, token qrlogin.Token) error {
+	code, err := qr.Encode(token.URL(), qr.L)
+	if err != nil {
+		return fmt.Errorf("failed to encode QR code: %w", err)
+	}
+
+	const quiet = 2 // Светлая рамка вокруг кода, без которой его плохо распознают.
+	black := func(x, y int) bool {
+		x, y = x-quiet, y-quiet
+		return x >= 0 && y >= 0 && x < code.Size && y < code.Size && code.Black(x, y)
+	}
+
+	var b strings.Builder
+	b.WriteString("Scan the QR code in Telegram: Settings > Devices > Link Desktop Device\n")
+	size := code.Size + 2*quiet
+	for y := 0; y < size; y += 2 {
+		for x := 0; x < size; x++ {
+			// Темные модули выводятся пробелом, светлые — заполненным блоком,
+			// чтобы код читался и на темном фоне терминала.
+			top, bottom := black(x, y), black(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteRune(' ')
+			case top:
+				b.WriteRune('▄')
+			case bottom:
+				b.WriteRune('▀')
+			default:
+				b.WriteRune('█')
+			}
+		}
+		b.WriteRune('\n')
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
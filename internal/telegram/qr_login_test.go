@@ -0,0 +1,142 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/telegram/auth/qrlogin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeQR показывает QR-код и ждет, пока тест подтвердит вход через accepted.
+type fakeQR struct {
+	token    qrlogin.Token
+	accepted chan error
+}
+
+func (f *fakeQR) Auth(ctx context.Context, _ qrlogin.LoggedIn, show func(ctx context.Context, token qrlogin.Token) error, _ ...int64) (*tg.AuthAuthorization, error) {
+	if err := show(ctx, f.token); err != nil {
+		return nil, err
+	}
+	select {
+	case err := <-f.accepted:
+		return &tg.AuthAuthorization{}, err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func newTestToken() qrlogin.Token {
+	return qrlogin.NewToken([]byte("login-token"), int(time.Now().Add(30*time.Second).Unix()))
+}
+
+func TestClient_QRLogin(t *testing.T) {
+	client, runner, authFlow, _ := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client.isTerminal = func(fd int) bool { return false }
+	qr := &fakeQR{token: newTestToken(), accepted: make(chan error, 1)}
+	client.qrFlow = &qrFlow{
+		qr:             qr,
+		show:           client.showQR,
+		password:       client.qrPassword,
+		passwordFailed: func(err error) { client.remoteAuth.finish(err, true) },
+	}
+	flowClient := &fakeFlowClient{passwordErrs: []error{auth.ErrPasswordInvalid}}
+	runner.auth = flowClient
+
+	runner.api.On("UsersGetUsers", mock.Anything, mock.Anything).Return(nil, errors.New("auth session invalid")).Once()
+	runner.On("Run", mock.Anything, mock.Anything).
+		Return(func(ctx context.Context, f func(context.Context) error) error { return f(ctx) }).
+		Once()
+
+	waitState := func(state string) AuthStatus {
+		t.Helper()
+		require.Eventually(t, func() bool { return client.AuthStatus().State == state }, time.Second, 5*time.Millisecond)
+		return client.AuthStatus()
+	}
+
+	_, err := client.AuthQRCode()
+	require.ErrorIs(t, err, ErrAuthNotPending)
+
+	client.Start(ctx)
+	status := waitState(AuthStateWaitingQR)
+	require.NotNil(t, status.QRExpiresAt)
+	require.Equal(t, qr.token.Expires(), *status.QRExpiresAt)
+	require.ErrorIs(t, client.Health(ctx), ErrAuthRequired)
+	require.ErrorIs(t, client.SubmitAuthCode("12345"), ErrAuthNotPending)
+
+	png, err := client.AuthQRCode()
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(png, []byte("\x89PNG\r\n\x1a\n")))
+
+	// QR-код подтвержден на телефоне, но аккаунт защищен паролем 2FA.
+	qr.accepted <- tgerr.New(401, "SESSION_PASSWORD_NEEDED")
+	status = waitState(AuthStateWaitingPassword)
+	require.Nil(t, status.QRExpiresAt)
+	_, err = client.AuthQRCode()
+	require.ErrorIs(t, err, ErrAuthNotPending)
+
+	// Неверный пароль запрашивается повторно без нового QR-кода.
+	require.NoError(t, client.SubmitAuthPassword("wrong"))
+	require.Eventually(t, func() bool {
+		s := client.AuthStatus()
+		return s.State == AuthStateWaitingPassword && s.LastError != ""
+	}, time.Second, 5*time.Millisecond)
+	require.NoError(t, client.SubmitAuthPassword("secret"))
+	require.Equal(t, AuthStatus{}, waitState(AuthStateNone))
+
+	flowClient.mu.Lock()
+	require.Equal(t, []string{"wrong", "secret"}, flowClient.passwords)
+	require.Zero(t, flowClient.sendCodes)
+	flowClient.mu.Unlock()
+	authFlow.AssertNotCalled(t, "Run", mock.Anything, mock.Anything)
+
+	cancel()
+	require.ErrorIs(t, <-client.runErr, context.Canceled)
+}
+
+func TestClient_QRLoginFails(t *testing.T) {
+	client, runner, _, _ := newTestClient(t)
+	client.isTerminal = func(fd int) bool { return false }
+	qr := &fakeQR{token: newTestToken(), accepted: make(chan error, 1)}
+	client.qrFlow = &qrFlow{qr: qr, show: client.showQR}
+	runner.api.On("UsersGetUsers", mock.Anything, mock.Anything).Return(nil, errors.New("auth session invalid")).Once()
+	runner.On("Run", mock.Anything, mock.Anything).
+		Return(func(ctx context.Context, f func(context.Context) error) error { return f(ctx) }).
+		Once()
+
+	client.Start(context.Background())
+	require.Eventually(t, func() bool { return client.AuthStatus().State == AuthStateWaitingQR }, time.Second, 5*time.Millisecond)
+	qr.accepted <- tgerr.New(400, "AUTH_TOKEN_EXPIRED")
+
+	err := <-client.runErr
+	require.ErrorContains(t, err, "qr auth failed")
+	require.ErrorContains(t, err, "AUTH_TOKEN_EXPIRED")
+	require.Equal(t, AuthStateFailed, client.AuthStatus().State)
+	_, err = client.AuthQRCode()
+	require.ErrorIs(t, err, ErrAuthNotPending)
+}
+
+func TestPrintQR(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, printQR(&buf, newTestToken()))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Greater(t, len(lines), 10)
+	// Все строки кода одной ширины, а код квадратный: строка вмещает два ряда модулей.
+	width := len([]rune(lines[1]))
+	for _, line := range lines[1:] {
+		require.Len(t, []rune(line), width)
+	}
+	require.Equal(t, (width+1)/2, len(lines)-1)
+	require.NotContains(t, buf.String(), newTestToken().URL())
+}
@@ -0,0 +1,131 @@
+package telegram
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"telegram-chat-parser/internal/ports"
+)
+
+// ErrRateLimited возвращается, когда бюджет запросов клиента исчерпан и дождаться его
+// пополнения не позволяет контекст запроса.
+var ErrRateLimited = ports.ErrRateLimited
+
+// RateLimit задает ограничение частоты запросов «корзиной токенов»: корзина вмещает
+// Burst запросов и пополняется со скоростью PerMinute запросов в минуту.
+type RateLimit struct {
+	// PerMinute — скорость пополнения корзины. 0 отключает ограничение.
+	PerMinute float64
+	// Burst — сколько запросов можно выполнить подряд без ожидания. 0 означает 1.
+	Burst int
+}
+
+// tokenBucket — корзина токенов. Количество токенов может уходить в минус: так
+// резервируются запросы, ожидающие пополнения корзины.
+type tokenBucket struct {
+	rate   float64 // токенов в секунду
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket создает полную корзину или возвращает nil, если ограничение отключено.
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	if limit.PerMinute <= 0 {
+		return nil
+	}
+	burst := float64(max(limit.Burst, 1))
+	return &tokenBucket{rate: limit.PerMinute / 60, burst: burst, tokens: burst, last: now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+}
+
+// reserve забирает токен и возвращает, сколько нужно подождать, пока он станет доступен.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// rateLimiter ограничивает частоту запросов одного клиента: общей корзиной для всех
+// запросов и отдельными корзинами для методов, которые Telegram ограничивает строже.
+type rateLimiter struct {
+	mu       sync.Mutex
+	requests *tokenBucket
+	methods  map[string]*tokenBucket
+}
+
+func newRateLimiter(requests RateLimit, methods map[string]RateLimit, now time.Time) *rateLimiter {
+	l := &rateLimiter{
+		requests: newTokenBucket(requests, now),
+		methods:  make(map[string]*tokenBucket, len(methods)),
+	}
+	for method, limit := range methods {
+		if b := newTokenBucket(limit, now); b != nil {
+			l.methods[method] = b
+		}
+	}
+	return l
+}
+
+// reserve резервирует запрос method во всех подходящих корзинах. Возвращает ожидание
+// до момента, когда запрос можно выполнить, и функцию отмены резерва.
+// nil-ограничитель ничего не ограничивает.
+func (l *rateLimiter) reserve(method string, now time.Time) (time.Duration, func()) {
+	if l == nil {
+		return 0, func() {}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	buckets := l.buckets(method)
+	var wait time.Duration
+	for _, b := range buckets {
+		wait = max(wait, b.reserve(now))
+	}
+	cancel := func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for _, b := range buckets {
+			b.tokens = math.Min(b.burst, b.tokens+1)
+		}
+	}
+	return wait, cancel
+}
+
+// budget возвращает, сколько запросов method можно выполнить без ожидания.
+// Без ограничений возвращает +Inf.
+func (l *rateLimiter) budget(method string, now time.Time) float64 {
+	budget := math.Inf(1)
+	if l == nil {
+		return budget
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, b := range l.buckets(method) {
+		b.refill(now)
+		budget = math.Min(budget, math.Max(b.tokens, 0))
+	}
+	return budget
+}
+
+func (l *rateLimiter) buckets(method string) []*tokenBucket {
+	var buckets []*tokenBucket
+	if l.requests != nil {
+		buckets = append(buckets, l.requests)
+	}
+	if b := l.methods[method]; b != nil {
+		buckets = append(buckets, b)
+	}
+	return buckets
+}
@@ -0,0 +1,63 @@
+package telegram
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("burst then refill", func(t *testing.T) {
+		l := newRateLimiter(RateLimit{PerMinute: 60, Burst: 2}, nil, now)
+
+		assert.Equal(t, 2.0, l.budget("any", now))
+		for i := 0; i < 2; i++ {
+			wait, _ := l.reserve("any", now)
+			require.Zero(t, wait)
+		}
+		assert.Zero(t, l.budget("any", now))
+
+		// Третий запрос ждет пополнения корзины, четвертый — еще секунду.
+		wait, _ := l.reserve("any", now)
+		assert.Equal(t, time.Second, wait)
+		wait, cancel := l.reserve("any", now)
+		assert.Equal(t, 2*time.Second, wait)
+
+		// Отмененный резерв возвращает токен.
+		cancel()
+		assert.Equal(t, 1.0, l.budget("any", now.Add(2*time.Second)))
+	})
+
+	t.Run("method budget is separate", func(t *testing.T) {
+		l := newRateLimiter(RateLimit{PerMinute: 600, Burst: 10}, map[string]RateLimit{
+			"contacts.resolveUsername": {PerMinute: 2},
+		}, now)
+
+		wait, _ := l.reserve("contacts.resolveUsername", now)
+		require.Zero(t, wait)
+		assert.Zero(t, l.budget("contacts.resolveUsername", now))
+		assert.Equal(t, 9.0, l.budget("users.getFullUser", now))
+
+		wait, _ = l.reserve("contacts.resolveUsername", now)
+		assert.Equal(t, 30*time.Second, wait)
+		assert.Equal(t, 8.0, l.budget("users.getFullUser", now), "общий бюджет расходуется всеми методами")
+	})
+
+	t.Run("no limits", func(t *testing.T) {
+		l := newRateLimiter(RateLimit{}, map[string]RateLimit{"contacts.resolveUsername": {}}, now)
+		wait, _ := l.reserve("contacts.resolveUsername", now)
+		assert.Zero(t, wait)
+		assert.True(t, math.IsInf(l.budget("contacts.resolveUsername", now), 1))
+
+		var nilLimiter *rateLimiter
+		wait, cancel := nilLimiter.reserve("any", now)
+		cancel()
+		assert.Zero(t, wait)
+		assert.True(t, math.IsInf(nilLimiter.budget("any", now), 1))
+	})
+}
@@ -0,0 +1,207 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/telegram/auth/qrlogin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// Состояния входа в аккаунт через API администрирования.
+const (
+	// AuthStateNone — вход не требуется или уже выполнен.
+	AuthStateNone = ""
+	// AuthStateWaitingCode — Telegram отправил код подтверждения, клиент ждет его.
+	AuthStateWaitingCode = "waiting_code"
+	// AuthStateWaitingPassword — аккаунт защищен паролем 2FA, клиент ждет его.
+	AuthStateWaitingPassword = "waiting_password"
+	// AuthStateWaitingQR — клиент показывает QR-код и ждет, пока его подтвердят в
+	// приложении Telegram на телефоне.
+	AuthStateWaitingQR = "waiting_qr"
+	// AuthStateSigningIn — код или пароль получен и проверяется Telegram.
+	AuthStateSigningIn = "signing_in"
+	// AuthStateFailed — вход завершился ошибкой, после которой клиент остановлен.
+	AuthStateFailed = "failed"
+)
+
+var (
+	// ErrAuthNotPending возвращается, когда клиент не ждет код или пароль, например
+	// потому что вход уже выполнен или ждет другое значение.
+	ErrAuthNotPending = errors.New("client is not waiting for this login step")
+	// ErrAuthRequired возвращается запросами клиента, пока вход в аккаунт не выполнен.
+	ErrAuthRequired = errors.New("client is waiting for login")
+)
+
+// AuthStatus описывает ход входа в аккаунт для администрирования.
+type AuthStatus struct {
+	State string `json:"state"`
+	// Since — когда клиент перешел в текущее состояние.
+	Since time.Time `json:"since"`
+	// CodeType — куда Telegram отправил код: app, sms, call и т. д.
+	CodeType string `json:"code_type,omitempty"`
+	// QRExpiresAt — когда истекает текущий QR-код; после этого показывается новый.
+	QRExpiresAt *time.Time `json:"qr_expires_at,omitempty"`
+	// LastError — ошибка последней попытки входа, например неверный код.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// RemoteAuthenticator выполняет вход в аккаунт без терминала: код подтверждения и
+// пароль 2FA передаются через SubmitCode и SubmitPassword, то есть через эндпоинты
+// администрирования сервера. Реализует auth.UserAuthenticator.
+type RemoteAuthenticator struct {
+	phone     string
+	codes     chan string
+	passwords chan string
+	clock     func() time.Time
+
+	mu     sync.Mutex
+	status AuthStatus
+	// qrToken — токен входа, который показывается в QR-коде в состоянии AuthStateWaitingQR.
+	qrToken qrlogin.Token
+}
+
+var _ auth.UserAuthenticator = (*RemoteAuthenticator)(nil)
+
+// NewRemoteAuthenticator создает аутентификатор для аккаунта с номером phone.
+func NewRemoteAuthenticator(phone string) *RemoteAuthenticator {
+	return &RemoteAuthenticator{
+		phone:     phone,
+		codes:     make(chan string, 1),
+		passwords: make(chan string, 1),
+		clock:     time.Now,
+	}
+}
+
+// Phone возвращает номер телефона.
+func (a *RemoteAuthenticator) Phone(_ context.Context) (string, error) {
+	return a.phone, nil
+}
+
+// Code ждет код подтверждения, переданный через SubmitCode.
+func (a *RemoteAuthenticator) Code(ctx context.Context, sentCode *tg.AuthSentCode) (string, error) {
+	codeType := ""
+	if sentCode != nil && sentCode.Type != nil {
+		codeType = strings.ToLower(strings.TrimPrefix(sentCode.Type.TypeName(), "auth.sentCodeType"))
+	}
+	return a.wait(ctx, a.codes, AuthStateWaitingCode, codeType)
+}
+
+// Password ждет пароль 2FA, переданный через SubmitPassword.
+func (a *RemoteAuthenticator) Password(ctx context.Context) (string, error) {
+	return a.wait(ctx, a.passwords, AuthStateWaitingPassword, "")
+}
+
+// AcceptTermsOfService принимает Условия обслуживания.
+func (a *RemoteAuthenticator) AcceptTermsOfService(_ context.Context, _ tg.HelpTermsOfService) error {
+	return nil
+}
+
+// SignUp не реализован, так как мы не поддерживаем регистрацию новых пользователей.
+func (a *RemoteAuthenticator) SignUp(_ context.Context) (auth.UserInfo, error) {
+	return auth.UserInfo{}, errors.New("signup not implemented")
+}
+
+// SubmitCode передает код подтверждения ожидающему входу.
+func (a *RemoteAuthenticator) SubmitCode(code string) error {
+	return a.submit(a.codes, AuthStateWaitingCode, code)
+}
+
+// SubmitPassword передает пароль 2FA ожидающему входу.
+func (a *RemoteAuthenticator) SubmitPassword(password string) error {
+	return a.submit(a.passwords, AuthStateWaitingPassword, password)
+}
+
+// ShowQR переводит вход в состояние AuthStateWaitingQR с новым токеном входа.
+func (a *RemoteAuthenticator) ShowQR(token qrlogin.Token) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	expires := token.Expires()
+	if a.status.State != AuthStateWaitingQR {
+		a.status.Since = a.clock()
+	}
+	a.status.State, a.status.CodeType, a.status.QRExpiresAt = AuthStateWaitingQR, "", &expires
+	a.qrToken = token
+}
+
+// QR возвращает токен входа для QR-кода, если клиент ждет подтверждения входа по нему.
+func (a *RemoteAuthenticator) QR() (qrlogin.Token, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.status.State != AuthStateWaitingQR {
+		return qrlogin.Token{}, false
+	}
+	return a.qrToken, true
+}
+
+// Status возвращает текущее состояние входа.
+func (a *RemoteAuthenticator) Status() AuthStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.status
+}
+
+// Pending сообщает, что вход начат и не завершен успешно.
+func (a *RemoteAuthenticator) Pending() bool {
+	return a.Status().State != AuthStateNone
+}
+
+// wait переводит вход в состояние state и ждет значение из ch.
+func (a *RemoteAuthenticator) wait(ctx context.Context, ch chan string, state, codeType string) (string, error) {
+	// Значение, переданное для прерванного ожидания, не должно попасть в следующее.
+	select {
+	case <-ch:
+	default:
+	}
+
+	a.mu.Lock()
+	a.status.State, a.status.Since, a.status.CodeType = state, a.clock(), codeType
+	a.status.QRExpiresAt, a.qrToken = nil, qrlogin.Token{}
+	a.mu.Unlock()
+
+	select {
+	case v := <-ch:
+		return v, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// submit передает значение, если вход ждет именно его.
+func (a *RemoteAuthenticator) submit(ch chan string, state, value string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.status.State != state {
+		return ErrAuthNotPending
+	}
+	a.status.State, a.status.Since = AuthStateSigningIn, a.clock()
+	ch <- value // Канал пуст: ожидание очищает его, а повторная отправка отклоняется выше.
+	return nil
+}
+
+// finish фиксирует итог попытки входа. После успешного входа состояние сбрасывается;
+// после ошибки, которую можно исправить повтором, вход продолжится с новым кодом.
+func (a *RemoteAuthenticator) finish(err error, retry bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch {
+	case err == nil:
+		a.status, a.qrToken = AuthStatus{}, qrlogin.Token{}
+	case retry:
+		a.status.LastError = err.Error()
+	default:
+		a.status, a.qrToken = AuthStatus{State: AuthStateFailed, Since: a.clock(), LastError: err.Error()}, qrlogin.Token{}
+	}
+}
+
+// retryableAuthError сообщает, что попытку входа можно повторить: код неверен или
+// истек, либо неверен пароль 2FA.
+func retryableAuthError(err error) bool {
+	return errors.Is(err, auth.ErrPasswordInvalid) ||
+		tgerr.Is(err, "PHONE_CODE_INVALID", "PHONE_CODE_EXPIRED", "PHONE_CODE_EMPTY")
+}
@@ -0,0 +1,79 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/telegram/auth/qrlogin"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteAuthenticator(t *testing.T) {
+	a := NewRemoteAuthenticator("+10000000000")
+	require.False(t, a.Pending())
+	require.ErrorIs(t, a.SubmitCode("12345"), ErrAuthNotPending)
+
+	t.Run("код, переданный прерванному ожиданию, не используется повторно", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			_, err := a.Code(ctx, &tg.AuthSentCode{Type: &tg.AuthSentCodeTypeApp{}})
+			done <- err
+		}()
+		require.Eventually(t, func() bool { return a.Status().State == AuthStateWaitingCode }, time.Second, time.Millisecond)
+		require.Equal(t, "app", a.Status().CodeType)
+		require.True(t, a.Pending())
+
+		// Код принят, но ожидание прервано раньше, чем он прочитан.
+		cancel()
+		require.ErrorIs(t, <-done, context.Canceled)
+		_ = a.SubmitCode("stale")
+
+		codes := make(chan string, 1)
+		go func() {
+			code, _ := a.Code(context.Background(), &tg.AuthSentCode{})
+			codes <- code
+		}()
+		require.Eventually(t, func() bool { return a.Status().State == AuthStateWaitingCode }, time.Second, time.Millisecond)
+		require.NoError(t, a.SubmitCode("12345"))
+		require.Equal(t, "12345", <-codes)
+		require.Equal(t, AuthStateSigningIn, a.Status().State)
+	})
+
+	t.Run("успешный вход сбрасывает состояние", func(t *testing.T) {
+		a.finish(nil, false)
+		require.Equal(t, AuthStatus{}, a.Status())
+		require.False(t, a.Pending())
+	})
+}
+
+func TestRemoteAuthenticator_QR(t *testing.T) {
+	a := NewRemoteAuthenticator("+10000000000")
+	_, ok := a.QR()
+	require.False(t, ok)
+
+	first := qrlogin.NewToken([]byte("first"), int(time.Now().Add(30*time.Second).Unix()))
+	a.ShowQR(first)
+	token, ok := a.QR()
+	require.True(t, ok)
+	require.Equal(t, first, token)
+	status := a.Status()
+	require.Equal(t, AuthStateWaitingQR, status.State)
+	require.Equal(t, first.Expires(), *status.QRExpiresAt)
+
+	// Новый QR-код заменяет истекший, не сбрасывая начало ожидания.
+	second := qrlogin.NewToken([]byte("second"), int(time.Now().Add(60*time.Second).Unix()))
+	a.ShowQR(second)
+	token, _ = a.QR()
+	require.Equal(t, second, token)
+	require.Equal(t, status.Since, a.Status().Since)
+	require.Equal(t, second.Expires(), *a.Status().QRExpiresAt)
+
+	a.finish(errors.New("boom"), false)
+	_, ok = a.QR()
+	require.False(t, ok)
+	require.Nil(t, a.Status().QRExpiresAt)
+}
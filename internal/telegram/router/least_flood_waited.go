@@ -0,0 +1,37 @@
+package router
+
+import (
+	"sync/atomic"
+	"telegram-chat-parser/internal/ports"
+	"time"
+)
+
+// LeastFloodWaitedStrategy выбирает клиента, дольше всех не получавшего FLOOD_WAIT.
+// Клиенты без FLOOD_WAIT предпочтительнее всех, среди них выбор идет по кругу.
+type LeastFloodWaitedStrategy struct {
+	counter atomic.Uint32
+}
+
+// NewLeastFloodWaitedStrategy создает стратегию выбора клиента с самым давним FLOOD_WAIT.
+func NewLeastFloodWaitedStrategy() *LeastFloodWaitedStrategy {
+	return &LeastFloodWaitedStrategy{}
+}
+
+// Next возвращает клиента с самым давним последним FLOOD_WAIT.
+func (s *LeastFloodWaitedStrategy) Next(clients []ports.TelegramClient) (ports.TelegramClient, error) {
+	if len(clients) == 0 {
+		return nil, ErrNoHealthyClients
+	}
+	var oldest []ports.TelegramClient
+	var oldestAt time.Time
+	for _, c := range clients {
+		at := lastFloodWait(c)
+		if len(oldest) == 0 || at.Before(oldestAt) {
+			oldest, oldestAt = oldest[:0], at
+		}
+		if at.Equal(oldestAt) {
+			oldest = append(oldest, c)
+		}
+	}
+	return roundRobinAmong(&s.counter, oldest), nil
+}
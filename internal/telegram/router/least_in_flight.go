@@ -0,0 +1,36 @@
+package router
+
+import (
+	"sync/atomic"
+	"telegram-chat-parser/internal/ports"
+)
+
+// LeastInFlightStrategy выбирает клиента с наименьшим числом выполняемых запросов.
+// Среди одинаково загруженных клиентов выбор идет по кругу.
+type LeastInFlightStrategy struct {
+	counter atomic.Uint32
+}
+
+// NewLeastInFlightStrategy создает стратегию выбора наименее загруженного клиента.
+func NewLeastInFlightStrategy() *LeastInFlightStrategy {
+	return &LeastInFlightStrategy{}
+}
+
+// Next возвращает клиента с наименьшим числом запросов в работе.
+func (s *LeastInFlightStrategy) Next(clients []ports.TelegramClient) (ports.TelegramClient, error) {
+	if len(clients) == 0 {
+		return nil, ErrNoHealthyClients
+	}
+	var least []ports.TelegramClient
+	minInFlight := 0
+	for _, c := range clients {
+		n := inFlight(c)
+		if len(least) == 0 || n < minInFlight {
+			least, minInFlight = least[:0], n
+		}
+		if n == minInFlight {
+			least = append(least, c)
+		}
+	}
+	return roundRobinAmong(&s.counter, least), nil
+}
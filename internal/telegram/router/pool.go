@@ -0,0 +1,244 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gotd/td/session"
+
+	"telegram-chat-parser/internal/pkg/config"
+	"telegram-chat-parser/internal/ports"
+	"telegram-chat-parser/internal/telegram"
+)
+
+const (
+	// defaultDrainTimeout — сколько удаленный из пула клиент завершает начатые запросы.
+	defaultDrainTimeout = time.Minute
+	// drainPollInterval — как часто проверяется, завершил ли удаляемый клиент запросы.
+	drainPollInterval = 100 * time.Millisecond
+)
+
+// ErrNoServers возвращается, когда в конфигурации нет ни одного включенного сервера.
+// Пул при этом не изменяется.
+var ErrNoServers = errors.New("no enabled telegram servers")
+
+// ReloadResult описывает изменения пула после перезагрузки конфигурации.
+type ReloadResult struct {
+	Added     int `json:"added"`
+	Removed   int `json:"removed"`
+	Restarted int `json:"restarted"` // Клиенты, конфигурация которых изменилась.
+	Unchanged int `json:"unchanged"`
+}
+
+// poolEntry — клиент пула вместе с конфигурацией, из которой он создан.
+type poolEntry struct {
+	server config.TelegramAPIServer
+	client ports.TelegramClient
+	cancel context.CancelFunc // Останавливает фоновый процесс клиента.
+	// started — клиент запущен. Клиент, заменяющий перезапускаемый, запускается только
+	// после остановки прежнего: оба используют одну сессию и один номер телефона.
+	started bool
+	// stopped закрывается, когда клиент удален из пула и остановлен.
+	stopped chan struct{}
+}
+
+// serverKey идентифицирует аккаунт при перезагрузке: клиенты с тем же номером телефона
+// и той же конфигурацией продолжают работать без перезапуска.
+func serverKey(srv config.TelegramAPIServer) string {
+	return srv.PhoneNumber
+}
+
+// newTelegramClient создает клиента Telegram по конфигурации сервера.
+func (r *Router) newTelegramClient(srvCfg config.TelegramAPIServer) ports.TelegramClient {
+	var sessionStorage session.Storage
+	if r.sessionStorage != nil {
+		sessionStorage = r.sessionStorage(srvCfg)
+	}
+	// Используем опцию WithLogger, чтобы передать логгер роутера в каждый клиент.
+	return telegram.NewClient(telegram.Config{
+		APIID:          srvCfg.APIID,
+		APIHash:        srvCfg.APIHash,
+		PhoneNumber:    srvCfg.PhoneNumber,
+		SessionPath:    srvCfg.SessionFile,
+		SessionStorage: sessionStorage,
+		RequestDelay:   srvCfg.RequestDelay,
+		RequestLimit:   rateLimit(srvCfg.RateLimits.Requests),
+		MethodLimits: map[string]telegram.RateLimit{
+			ports.MethodContactsResolveUsername: rateLimit(srvCfg.RateLimits.ResolveUsername),
+			ports.MethodUsersGetFullUser:        rateLimit(srvCfg.RateLimits.GetFullUser),
+		},
+		Weight:      srvCfg.Weight,
+		LoginMethod: srvCfg.LoginMethod,
+	}, telegram.WithLogger(r.log.With("client_phone", srvCfg.PhoneNumber)))
+}
+
+func rateLimit(cfg config.RateLimit) telegram.RateLimit {
+	return telegram.RateLimit{PerMinute: cfg.PerMinute, Burst: cfg.Burst}
+}
+
+// Reload приводит пул клиентов в соответствие со списком серверов: запускает клиентов
+// для новых серверов, перезапускает клиентов с измененной конфигурацией и удаляет
+// клиентов отключенных и удаленных серверов. Удаленные клиенты сразу перестают выдаваться
+// роутером, но останавливаются только после завершения начатых запросов.
+func (r *Router) Reload(servers []config.TelegramAPIServer) (ReloadResult, error) {
+	res, err := r.applyServers(servers)
+	if err != nil {
+		r.log.Error("Telegram client pool reload rejected", "error", err)
+		return res, err
+	}
+	r.log.Info("Telegram client pool reloaded",
+		"added", res.Added, "removed", res.Removed, "restarted", res.Restarted, "unchanged", res.Unchanged)
+	return res, nil
+}
+
+func (r *Router) applyServers(servers []config.TelegramAPIServer) (ReloadResult, error) {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+
+	desired := make(map[string]config.TelegramAPIServer, len(servers))
+	for _, srv := range servers {
+		if !srv.Disabled {
+			desired[serverKey(srv)] = srv
+		}
+	}
+	if len(desired) == 0 {
+		return ReloadResult{}, ErrNoServers
+	}
+
+	var res ReloadResult
+	var removed []*poolEntry
+	restarted := make(map[string]*poolEntry)
+
+	r.mu.Lock()
+	for key, e := range r.entries {
+		srv, ok := desired[key]
+		if ok && srv == e.server {
+			res.Unchanged++
+			continue
+		}
+		if ok {
+			restarted[key] = e
+		}
+		r.removeClientLocked(e.client.ID())
+		delete(r.entries, key)
+		removed = append(removed, e)
+	}
+	for key, srv := range desired {
+		if _, ok := r.entries[key]; ok {
+			continue
+		}
+		ctx, cancel := context.WithCancel(r.ctx)
+		e := &poolEntry{server: srv, client: r.newClient(srv), cancel: cancel, stopped: make(chan struct{})}
+		r.entries[key] = e
+		if prev, ok := restarted[key]; ok {
+			res.Restarted++
+			r.wg.Add(1)
+			go r.startAfter(ctx, e, prev.stopped)
+			continue
+		}
+		res.Added++
+		r.startLocked(ctx, e)
+	}
+	res.Removed = len(removed) - len(restarted)
+	r.updatePoolMetricsLocked()
+	r.mu.Unlock()
+
+	for _, e := range removed {
+		r.wg.Add(1)
+		go r.drain(e)
+	}
+	return res, nil
+}
+
+// startLocked запускает клиента и добавляет его в пул здоровых. Вызывается под r.mu.
+func (r *Router) startLocked(ctx context.Context, e *poolEntry) {
+	e.client.Start(ctx)
+	e.started = true
+	r.healthy[e.client.ID()] = e.client
+	r.log.Info("Client added to pool", "client_id", e.client.ID(), "client_phone", e.server.PhoneNumber)
+}
+
+// startAfter запускает клиента после закрытия prev, то есть после остановки клиента,
+// которого он заменяет. Клиент не запускается, если до этого его удалили из пула
+// или роутер остановлен.
+func (r *Router) startAfter(ctx context.Context, e *poolEntry, prev <-chan struct{}) {
+	defer r.wg.Done()
+	select {
+	case <-prev:
+	case <-ctx.Done():
+		return
+	case <-r.done:
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if ctx.Err() != nil || r.entries[serverKey(e.server)] != e {
+		return
+	}
+	r.startLocked(ctx, e)
+	r.updatePoolMetricsLocked()
+}
+
+// removeClientLocked убирает клиента из пулов роутера. Вызывается под r.mu.
+func (r *Router) removeClientLocked(id string) {
+	delete(r.healthy, id)
+	delete(r.unhealthy, id)
+	delete(r.scheduledRecovery, id)
+	delete(r.quarantined, id)
+	delete(r.stats, id)
+	if s, ok := r.strategy.(ports.StatefulStrategy); ok {
+		s.Forget(id)
+	}
+}
+
+// drain дожидается завершения начатых клиентом запросов и останавливает его.
+// Запросы, начатые через уже выданную обертку после остановки, завершатся ошибкой,
+// и вызывающий код повторит их с другим клиентом.
+func (r *Router) drain(e *poolEntry) {
+	defer r.wg.Done()
+	defer close(e.stopped)
+	defer r.stopEntry(e)
+
+	id := e.client.ID()
+	r.log.Info("Draining client removed from pool", "client_id", id, "client_phone", e.server.PhoneNumber)
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	deadline := time.NewTimer(r.drainTimeout)
+	defer deadline.Stop()
+	for inFlight(e.client) > 0 {
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			r.log.Warn("Client drain timed out, stopping with requests in flight", "client_id", id, "in_flight", inFlight(e.client))
+			return
+		case <-r.done:
+			return
+		}
+	}
+	r.log.Info("Client drained and stopped", "client_id", id)
+}
+
+// stopEntry останавливает фоновый процесс клиента и ждет его завершения, но не дольше
+// drainTimeout: после этого клиент больше не использует сессию.
+func (r *Router) stopEntry(e *poolEntry) {
+	e.cancel()
+
+	r.mu.RLock()
+	started := e.started
+	r.mu.RUnlock()
+	sc, ok := e.client.(ports.StoppableClient)
+	if !started || !ok {
+		return
+	}
+	timeout := time.NewTimer(r.drainTimeout)
+	defer timeout.Stop()
+	select {
+	case <-sc.Stopped():
+	case <-timeout.C:
+		r.log.Warn("Client did not stop in time", "client_id", e.client.ID())
+	case <-r.done:
+	}
+}
@@ -0,0 +1,260 @@
+package router
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"telegram-chat-parser/internal/pkg/config"
+	"telegram-chat-parser/internal/ports"
+)
+
+// poolClient — мок клиента, созданного роутером из конфигурации сервера.
+type poolClient struct {
+	*mockClient
+	server   config.TelegramAPIServer
+	inFlight atomic.Int32
+
+	mu  sync.Mutex
+	ctx context.Context
+	// hold, если задан, задерживает завершение фонового процесса после остановки клиента.
+	hold   chan struct{}
+	exited chan struct{}
+}
+
+func (c *poolClient) Start(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ctx = ctx
+	go func() {
+		<-ctx.Done()
+		c.mu.Lock()
+		hold := c.hold
+		c.mu.Unlock()
+		if hold != nil {
+			<-hold
+		}
+		close(c.exited)
+	}()
+}
+
+func (c *poolClient) Stopped() <-chan struct{} { return c.exited }
+
+// started сообщает, запущен ли клиент.
+func (c *poolClient) started() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ctx != nil
+}
+
+func (c *poolClient) InFlight() int { return int(c.inFlight.Load()) }
+
+// stopped сообщает, остановлен ли фоновый процесс клиента.
+func (c *poolClient) stopped() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ctx.Err() != nil
+}
+
+// withClientFactory подменяет создание клиентов Telegram в тестах.
+func withClientFactory(f func(config.TelegramAPIServer) ports.TelegramClient) Option {
+	return func(r *Router) {
+		r.newClient = f
+	}
+}
+
+// newTestPool создает роутер, клиенты которого создаются из конфигурации как poolClient.
+func newTestPool(t *testing.T, servers []config.TelegramAPIServer) (*Router, func(phone string) *poolClient) {
+	var mu sync.Mutex
+	created := make(map[string]*poolClient)
+	factory := func(srv config.TelegramAPIServer) ports.TelegramClient {
+		mu.Lock()
+		defer mu.Unlock()
+		c := &poolClient{mockClient: newMockClient(srv.PhoneNumber+"-"+srv.SessionFile, true), server: srv, exited: make(chan struct{})}
+		created[srv.PhoneNumber] = c
+		return c
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	r, err := NewRouter(context.Background(), WithServerConfigs(servers), WithLogger(logger),
+		WithHealthCheckInterval(time.Minute), WithDrainTimeout(time.Second), withClientFactory(factory))
+	require.NoError(t, err)
+	t.Cleanup(r.Stop)
+
+	return r, func(phone string) *poolClient {
+		mu.Lock()
+		defer mu.Unlock()
+		return created[phone]
+	}
+}
+
+func healthyIDs(r *Router) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ids := make([]string, 0, len(r.healthy))
+	for id := range r.healthy {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestRouter_Reload(t *testing.T) {
+	servers := []config.TelegramAPIServer{
+		{APIID: 1, APIHash: "a", PhoneNumber: "+1", SessionFile: "1.session"},
+		{APIID: 2, APIHash: "b", PhoneNumber: "+2", SessionFile: "2.session"},
+		{APIID: 3, APIHash: "c", PhoneNumber: "+3", SessionFile: "3.session", Disabled: true},
+	}
+	r, client := newTestPool(t, servers)
+	assert.ElementsMatch(t, []string{"+1-1.session", "+2-2.session"}, healthyIDs(r), "отключенный сервер не запускается")
+
+	first, second := client("+1"), client("+2")
+	// Второй клиент выполняет запрос во время перезагрузки.
+	second.inFlight.Add(1)
+
+	res, err := r.Reload([]config.TelegramAPIServer{
+		servers[0],
+		{APIID: 3, APIHash: "c", PhoneNumber: "+3", SessionFile: "3.session"},
+		{APIID: 4, APIHash: "d", PhoneNumber: "+4", SessionFile: "4.session"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ReloadResult{Added: 2, Removed: 1, Unchanged: 1}, res)
+	assert.ElementsMatch(t, []string{"+1-1.session", "+3-3.session", "+4-4.session"}, healthyIDs(r))
+	assert.Same(t, first, client("+1"), "неизмененный клиент не перезапускается")
+
+	// Удаленный клиент больше не выдается, но останавливается только после завершения запроса.
+	for i := 0; i < 10; i++ {
+		c, err := r.GetClient(context.Background())
+		require.NoError(t, err)
+		require.NotEqual(t, second.ID(), c.ID())
+	}
+	time.Sleep(3 * drainPollInterval)
+	assert.False(t, second.stopped())
+	second.inFlight.Add(-1)
+	assert.Eventually(t, second.stopped, time.Second, 10*time.Millisecond)
+	assert.False(t, first.stopped())
+
+	t.Run("Измененная конфигурация перезапускает клиента", func(t *testing.T) {
+		changed := servers[0]
+		changed.SessionFile = "1-new.session"
+		res, err := r.Reload([]config.TelegramAPIServer{changed, servers[1]})
+		require.NoError(t, err)
+		assert.Equal(t, ReloadResult{Added: 1, Removed: 2, Restarted: 1}, res)
+		assert.Eventually(t, first.stopped, time.Second, 10*time.Millisecond)
+		assert.Eventually(t, func() bool { return len(healthyIDs(r)) == 2 }, time.Second, 10*time.Millisecond)
+		assert.ElementsMatch(t, []string{"+1-1-new.session", "+2-2.session"}, healthyIDs(r))
+	})
+
+	t.Run("Пустой пул не применяется", func(t *testing.T) {
+		disabled := servers[0]
+		disabled.Disabled = true
+		_, err := r.Reload([]config.TelegramAPIServer{disabled})
+		require.ErrorIs(t, err, ErrNoServers)
+		assert.Len(t, healthyIDs(r), 2)
+	})
+
+	t.Run("Удаляется и нездоровый клиент", func(t *testing.T) {
+		unhealthy := client("+2")
+		r.setClientUnhealthy(unhealthy)
+
+		res, err := r.Reload([]config.TelegramAPIServer{{APIID: 1, APIHash: "a", PhoneNumber: "+1", SessionFile: "1-new.session"}})
+		require.NoError(t, err)
+		assert.Equal(t, ReloadResult{Removed: 1, Unchanged: 1}, res)
+		r.mu.RLock()
+		assert.Empty(t, r.unhealthy)
+		r.mu.RUnlock()
+		assert.Eventually(t, unhealthy.stopped, time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestRouter_ReloadDrainTimeout(t *testing.T) {
+	r, client := newTestPool(t, []config.TelegramAPIServer{
+		{APIID: 1, APIHash: "a", PhoneNumber: "+1"},
+		{APIID: 2, APIHash: "b", PhoneNumber: "+2"},
+	})
+	stuck := client("+2")
+	stuck.inFlight.Add(1)
+
+	_, err := r.Reload([]config.TelegramAPIServer{{APIID: 1, APIHash: "a", PhoneNumber: "+1"}})
+	require.NoError(t, err)
+	// Зависший запрос не мешает остановить клиента по истечении времени на завершение.
+	assert.Eventually(t, stuck.stopped, 3*time.Second, 50*time.Millisecond)
+}
+
+func TestRouter_ReloadRestartAfterDrain(t *testing.T) {
+	servers := []config.TelegramAPIServer{{APIID: 1, APIHash: "a", PhoneNumber: "+1", SessionFile: "1.session"}}
+	r, client := newTestPool(t, servers)
+	old := client("+1")
+	old.inFlight.Add(1)
+	old.mu.Lock()
+	old.hold = make(chan struct{})
+	old.mu.Unlock()
+
+	changed := servers[0]
+	changed.SessionFile = "1-new.session"
+	res, err := r.Reload([]config.TelegramAPIServer{changed})
+	require.NoError(t, err)
+	assert.Equal(t, ReloadResult{Restarted: 1}, res)
+	replacement := client("+1")
+	require.NotSame(t, old, replacement)
+
+	// Новый клиент с той же сессией не запускается, пока прежний выполняет запрос.
+	time.Sleep(3 * drainPollInterval)
+	assert.False(t, replacement.started())
+	assert.Empty(t, healthyIDs(r))
+
+	// И пока фоновый процесс прежнего клиента не завершен.
+	old.inFlight.Add(-1)
+	assert.Eventually(t, old.stopped, time.Second, 10*time.Millisecond)
+	time.Sleep(3 * drainPollInterval)
+	assert.False(t, replacement.started())
+
+	close(old.hold)
+	assert.Eventually(t, replacement.started, time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool { return len(healthyIDs(r)) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{replacement.ID()}, healthyIDs(r))
+
+	t.Run("Клиент, удаленный до запуска, не запускается", func(t *testing.T) {
+		current := client("+1")
+		current.inFlight.Add(1)
+		changed.SessionFile = "1-other.session"
+		_, err := r.Reload([]config.TelegramAPIServer{changed})
+		require.NoError(t, err)
+		pending := client("+1")
+
+		_, err = r.Reload([]config.TelegramAPIServer{{APIID: 2, APIHash: "b", PhoneNumber: "+2"}})
+		require.NoError(t, err)
+		current.inFlight.Add(-1)
+		assert.Eventually(t, current.stopped, time.Second, 10*time.Millisecond)
+		time.Sleep(3 * drainPollInterval)
+		assert.False(t, pending.started())
+		assert.Equal(t, []string{client("+2").ID()}, healthyIDs(r))
+	})
+}
+
+func TestRouter_ReloadForgetsStrategyState(t *testing.T) {
+	servers := []config.TelegramAPIServer{
+		{APIID: 1, APIHash: "a", PhoneNumber: "+1"},
+		{APIID: 2, APIHash: "b", PhoneNumber: "+2"},
+	}
+	r, client := newTestPool(t, servers)
+	weighted := NewWeightedStrategy()
+	r.SetStrategy(weighted)
+	for i := 0; i < 3; i++ {
+		_, err := r.GetClient(context.Background())
+		require.NoError(t, err)
+	}
+	removed := client("+2").ID()
+
+	_, err := r.Reload(servers[:1])
+	require.NoError(t, err)
+	weighted.mu.Lock()
+	defer weighted.mu.Unlock()
+	assert.NotContains(t, weighted.current, removed)
+	assert.Contains(t, weighted.current, client("+1").ID())
+}
@@ -5,14 +5,19 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"math"
 	"sync"
 	"time"
 
+	"telegram-chat-parser/internal/metrics"
 	"telegram-chat-parser/internal/pkg/config"
 	"telegram-chat-parser/internal/ports"
 	"telegram-chat-parser/internal/telegram"
+	"telegram-chat-parser/internal/tracing"
 
+	"github.com/gotd/td/session"
 	"github.com/gotd/td/tg"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var (
@@ -26,23 +31,20 @@ var (
 type Option func(*Router)
 
 // WithServerConfigs — опция для передачи конфигураций серверов.
-// Клиенты будут созданы внутри роутера.
+// Клиенты будут созданы внутри роутера; отключенные серверы пропускаются.
 func WithServerConfigs(serverConfigs []config.TelegramAPIServer) Option {
 	return func(r *Router) {
-		clients := make([]ports.TelegramClient, 0, len(serverConfigs))
-		for _, srvCfg := range serverConfigs {
-			// Используем опцию WithLogger, чтобы передать логгер роутера в каждый клиент.
-			// Логгер роутера к этому моменту уже должен быть инициализирован.
-			client := telegram.NewClient(telegram.Config{
-				APIID:        srvCfg.APIID,
-				APIHash:      srvCfg.APIHash,
-				PhoneNumber:  srvCfg.PhoneNumber,
-				SessionPath:  srvCfg.SessionFile,
-				RequestDelay: srvCfg.RequestDelay,
-			}, telegram.WithLogger(r.log.With("client_phone", srvCfg.PhoneNumber)))
-			clients = append(clients, client)
+		r.servers = serverConfigs
+	}
+}
+
+// WithDrainTimeout — опция для установки времени, в течение которого удаленный из пула
+// клиент завершает начатые запросы перед остановкой.
+func WithDrainTimeout(d time.Duration) Option {
+	return func(r *Router) {
+		if d > 0 {
+			r.drainTimeout = d
 		}
-		r.clients = clients
 	}
 }
 
@@ -64,6 +66,14 @@ func WithStrategy(s ports.Strategy) Option {
 	}
 }
 
+// WithSessionStorage задает хранилище сессий аккаунтов вместо файлов session_file,
+// например зашифрованные файлы или встроенную базу.
+func WithSessionStorage(f func(config.TelegramAPIServer) session.Storage) Option {
+	return func(r *Router) {
+		r.sessionStorage = f
+	}
+}
+
 // WithLogger — опция для установки логгера.
 func WithLogger(l *slog.Logger) Option {
 	return func(r *Router) {
@@ -78,11 +88,21 @@ type Router struct {
 	mu                sync.RWMutex
 	healthy           map[string]ports.TelegramClient
 	unhealthy         map[string]ports.TelegramClient
-	scheduledRecovery map[string]struct{} // Отслеживает клиентов, для которых уже запланировано восстановление.
+	scheduledRecovery map[string]struct{}     // Отслеживает клиентов, для которых уже запланировано восстановление.
+	quarantined       map[string]time.Time    // Клиенты в карантине и время его окончания (нулевое — бессрочно).
+	stats             map[string]*clientStats // Статистика вызовов клиентов.
 	strategy          ports.Strategy
 	log               *slog.Logger
 
-	clients             []ports.TelegramClient // Начальный список клиентов, созданный из конфигов
+	ctx          context.Context            // Контекст, в котором запускаются клиенты.
+	servers      []config.TelegramAPIServer // Начальный список серверов из конфигурации.
+	entries      map[string]*poolEntry      // Клиенты пула по ключу сервера.
+	newClient    func(config.TelegramAPIServer) ports.TelegramClient
+	reloadMu     sync.Mutex // Сериализует перезагрузки пула.
+	drainTimeout time.Duration
+	// sessionStorage возвращает хранилище сессии аккаунта; nil — файл session_file.
+	sessionStorage func(config.TelegramAPIServer) session.Storage
+
 	healthCheckInterval time.Duration
 	ticker              *time.Ticker
 	done                chan struct{}
@@ -96,27 +116,28 @@ func NewRouter(ctx context.Context, opts ...Option) (*Router, error) {
 		healthy:             make(map[string]ports.TelegramClient),
 		unhealthy:           make(map[string]ports.TelegramClient),
 		scheduledRecovery:   make(map[string]struct{}),
+		quarantined:         make(map[string]time.Time),
+		stats:               make(map[string]*clientStats),
+		entries:             make(map[string]*poolEntry),
 		strategy:            NewRoundRobinStrategy(),
 		healthCheckInterval: 30 * time.Second, // Значение по умолчанию
+		drainTimeout:        defaultDrainTimeout,
 		done:                make(chan struct{}),
 		log:                 slog.Default().With("component", "router"),
 	}
+	r.newClient = r.newTelegramClient
 
 	// Применяем опции
 	for _, opt := range opts {
 		opt(r)
 	}
 
-	if len(r.clients) == 0 {
-		return nil, errors.New("no server configs provided to router")
-	}
-
 	// Запускаем клиенты и инициализируем пул здоровых клиентов
-	for _, c := range r.clients {
-		c.Start(ctx)
-		r.healthy[c.ID()] = c
+	r.ctx = ctx
+	if _, err := r.applyServers(r.servers); err != nil {
+		return nil, fmt.Errorf("no server configs provided to router: %w", err)
 	}
-	r.clients = nil // Больше не нужен
+	r.servers = nil // Больше не нужен
 
 	// Запускаем фоновую проверку
 	r.ticker = time.NewTicker(r.healthCheckInterval)
@@ -127,8 +148,14 @@ func NewRouter(ctx context.Context, opts ...Option) (*Router, error) {
 }
 
 // GetClient возвращает работоспособного клиента согласно текущей стратегии.
+// Если в контексте указан метод API (ports.ContextWithMethod), стратегия выбирает среди
+// клиентов с оставшимся бюджетом этого метода, а при его отсутствии у всех — среди всех.
 // Возвращаемый клиент обернут в clientWrapper для обработки ошибок "на лету".
-func (r *Router) GetClient(ctx context.Context) (ports.TelegramClient, error) {
+func (r *Router) GetClient(ctx context.Context) (_ ports.TelegramClient, err error) {
+	method := ports.MethodFromContext(ctx)
+	ctx, span := tracing.Start(ctx, "Router.GetClient", tracing.MethodKey.String(method))
+	defer func() { tracing.End(span, err) }()
+
 	r.mu.RLock()
 	// Преобразуем map в срез для стратегии.
 	// Это компромисс ради удобства использования стратегий.
@@ -139,6 +166,11 @@ func (r *Router) GetClient(ctx context.Context) (ports.TelegramClient, error) {
 	}
 	strategy := r.strategy
 	r.mu.RUnlock()
+	span.SetAttributes(attribute.Int("router.healthy_clients", len(clients)))
+
+	if method != "" {
+		clients = withBudget(clients, method)
+	}
 
 	client, err := strategy.Next(clients)
 	if err != nil {
@@ -147,6 +179,7 @@ func (r *Router) GetClient(ctx context.Context) (ports.TelegramClient, error) {
 	}
 
 	r.log.DebugContext(ctx, "Client selected by strategy", "client_id", client.ID())
+	span.SetAttributes(tracing.ClientIDKey.String(client.ID()))
 
 	// Оборачиваем клиент в декоратор для перехвата ошибок.
 	return &clientWrapper{
@@ -155,7 +188,24 @@ func (r *Router) GetClient(ctx context.Context) (ports.TelegramClient, error) {
 	}, nil
 }
 
+// withBudget оставляет клиентов, которые могут выполнить запрос method без ожидания.
+// Если таких нет, возвращает исходный список: клиент дождется пополнения бюджета сам.
+func withBudget(clients []ports.TelegramClient, method string) []ports.TelegramClient {
+	available := make([]ports.TelegramClient, 0, len(clients))
+	for _, c := range clients {
+		if limited, ok := c.(ports.RateLimitedClient); ok && limited.RateBudget(method) < 1 {
+			continue
+		}
+		available = append(available, c)
+	}
+	if len(available) == 0 {
+		return clients
+	}
+	return available
+}
+
 // SetStrategy позволяет безопасно сменить стратегию выбора клиента на лету.
+// Стратегию по имени из конфигурации создает NewStrategy.
 func (r *Router) SetStrategy(s ports.Strategy) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -229,12 +279,16 @@ func (r *Router) checkUnhealthyClients() {
 		if !ok {
 			continue // Клиент мог быть перемещен или удален.
 		}
+		if r.isQuarantined(id) {
+			continue // Из карантина клиент возвращается только по его окончании или вручную.
+		}
 
 		if err := client.Health(context.Background()); err == nil {
 			r.log.Info("client recovered, moving back to healthy pool", "client_id", id)
 			r.setClientHealthy(id)
 		} else {
 			r.log.Debug("Client remains unhealthy", "client_id", id, "reason", err)
+			r.statsFor(id).recordError(err)
 		}
 	}
 }
@@ -290,6 +344,10 @@ func (r *Router) checkAndRecoverClient(clientID string) {
 		r.log.Debug("Client to recover not found in unhealthy pool (already recovered?)", "client_id", clientID)
 		return
 	}
+	if r.isQuarantined(clientID) {
+		r.log.Debug("Client is quarantined, skipping proactive recovery", "client_id", clientID)
+		return
+	}
 
 	r.log.Debug("Running health check for client", "client_id", clientID)
 	if err := client.Health(context.Background()); err == nil {
@@ -297,6 +355,7 @@ func (r *Router) checkAndRecoverClient(clientID string) {
 		r.setClientHealthy(clientID)
 	} else {
 		r.log.Warn("Recovery check failed, client remains unhealthy", "client_id", clientID, "reason", err)
+		r.statsFor(clientID).recordError(err)
 	}
 }
 
@@ -312,6 +371,7 @@ func (r *Router) setClientUnhealthy(client ports.TelegramClient) {
 
 	delete(r.healthy, id)
 	r.unhealthy[id] = client
+	r.updatePoolMetricsLocked()
 
 	r.log.Warn("Client moved to unhealthy pool", "client_id", id, "healthy_count", len(r.healthy), "unhealthy_count", len(r.unhealthy))
 }
@@ -325,13 +385,23 @@ func (r *Router) setClientHealthy(id string) {
 	if !ok {
 		return // Клиент уже был перемещен.
 	}
+	if r.quarantinedLocked(id) {
+		return // Клиент помещен в карантин, пока шла проверка.
+	}
 
 	delete(r.unhealthy, id)
 	r.healthy[id] = client
+	r.updatePoolMetricsLocked()
 
 	r.log.Info("Client moved back to healthy pool", "client_id", id, "healthy_count", len(r.healthy), "unhealthy_count", len(r.unhealthy))
 }
 
+// updatePoolMetricsLocked обновляет метрики размера пулов. Вызывается под r.mu.
+func (r *Router) updatePoolMetricsLocked() {
+	metrics.RouterClients.WithLabelValues(ClientStateHealthy).Set(float64(len(r.healthy)))
+	metrics.RouterClients.WithLabelValues(ClientStateUnhealthy).Set(float64(len(r.unhealthy)))
+}
+
 // --- clientWrapper ---
 
 // clientWrapper - это декоратор для Client, который перехватывает ошибки
@@ -342,34 +412,70 @@ type clientWrapper struct {
 	router *Router
 }
 
+// RateBudget возвращает бюджет запросов обернутого клиента; без ограничений — +Inf.
+func (w *clientWrapper) RateBudget(method string) float64 {
+	if limited, ok := w.TelegramClient.(ports.RateLimitedClient); ok {
+		return limited.RateBudget(method)
+	}
+	return math.Inf(1)
+}
+
+// reportCall учитывает вызов метода method в статистике клиента и сообщает роутеру
+// об ошибке, чтобы он принял решение о клиенте.
+// Исчерпанный бюджет запросов не делает клиента неработоспособным.
+func (w *clientWrapper) reportCall(method string, err error) {
+	w.router.statsFor(w.ID()).record(method, err)
+	metrics.TelegramRequests.WithLabelValues(method, metricsLabel(w.TelegramClient), callResult(err)).Inc()
+	if err == nil || errors.Is(err, telegram.ErrRateLimited) {
+		return
+	}
+	// Запускаем в горутине, чтобы не блокировать вызывающий код.
+	go w.router.handleClientError(w.TelegramClient, err)
+}
+
+// metricsLabel возвращает метку клиента в метриках. Клиенты Telegram помечаются
+// скрытым номером телефона, остальные — ID.
+func metricsLabel(c ports.TelegramClient) string {
+	if labeled, ok := c.(interface{ MetricsLabel() string }); ok {
+		return labeled.MetricsLabel()
+	}
+	return c.ID()
+}
+
+// callResult возвращает результат вызова API для метрик.
+func callResult(err error) string {
+	switch {
+	case err == nil:
+		return metrics.ResultOK
+	case errors.Is(err, telegram.ErrRateLimited):
+		return metrics.ResultRateLimited
+	case telegram.IsFloodWait(err):
+		return metrics.ResultFloodWait
+	default:
+		return metrics.ResultError
+	}
+}
+
 // Переопределяем все методы интерфейса TelegramAPIRepositoryInterface,
 // добавляя к ним обработку ошибок.
 
 func (w *clientWrapper) UsersGetUsers(ctx context.Context, request []tg.InputUserClass) ([]tg.UserClass, error) {
 	w.router.log.DebugContext(ctx, "Calling UsersGetUsers via wrapper", "client_id", w.ID())
 	res, err := w.TelegramClient.UsersGetUsers(ctx, request)
-	if err != nil {
-		// Сообщаем роутеру об ошибке, чтобы он принял решение.
-		// Запускаем в горутине, чтобы не блокировать вызывающий код.
-		go w.router.handleClientError(w.TelegramClient, err)
-	}
+	w.reportCall(ports.MethodUsersGetUsers, err)
 	return res, err
 }
 
 func (w *clientWrapper) ContactsResolveUsername(ctx context.Context, req *tg.ContactsResolveUsernameRequest) (*tg.ContactsResolvedPeer, error) {
 	w.router.log.DebugContext(ctx, "Calling ContactsResolveUsername via wrapper", "client_id", w.ID(), "username", req.Username)
 	res, err := w.TelegramClient.ContactsResolveUsername(ctx, req)
-	if err != nil {
-		go w.router.handleClientError(w.TelegramClient, err)
-	}
+	w.reportCall(ports.MethodContactsResolveUsername, err)
 	return res, err
 }
 
 func (w *clientWrapper) UsersGetFullUser(ctx context.Context, inputUser tg.InputUserClass) (*tg.UsersUserFull, error) {
 	w.router.log.DebugContext(ctx, "Calling UsersGetFullUser via wrapper", "client_id", w.ID())
 	res, err := w.TelegramClient.UsersGetFullUser(ctx, inputUser)
-	if err != nil {
-		go w.router.handleClientError(w.TelegramClient, err)
-	}
+	w.reportCall(ports.MethodUsersGetFullUser, err)
 	return res, err
 }
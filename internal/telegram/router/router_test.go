@@ -6,16 +6,24 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/gotd/td/tg"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
+	"telegram-chat-parser/internal/metrics"
 	"telegram-chat-parser/internal/pkg/config"
 	"telegram-chat-parser/internal/ports"
+	"telegram-chat-parser/internal/telegram"
+	"telegram-chat-parser/internal/tracing"
 )
 
 // mockClient - это мок-реализация интерфейса ports.TelegramClient для использования в тестах.
@@ -94,12 +102,24 @@ func (m *mockClient) UsersGetFullUser(ctx context.Context, inputUser tg.InputUse
 	return nil, m.returnErr
 }
 
+// budgetClient — мок клиента с ограничением частоты запросов.
+type budgetClient struct {
+	*mockClient
+	budgets map[string]float64
+}
+
+func (c *budgetClient) RateBudget(method string) float64 {
+	return c.budgets[method]
+}
+
 func newTestRouter(t *testing.T, clients []ports.TelegramClient, interval time.Duration) *Router {
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 	r := &Router{
 		healthy:             make(map[string]ports.TelegramClient),
 		unhealthy:           make(map[string]ports.TelegramClient),
 		scheduledRecovery:   make(map[string]struct{}),
+		quarantined:         make(map[string]time.Time),
+		stats:               make(map[string]*clientStats),
 		strategy:            NewRoundRobinStrategy(),
 		healthCheckInterval: interval,
 		done:                make(chan struct{}),
@@ -157,6 +177,111 @@ func TestRouter_GetClient(t *testing.T) {
 	require.Contains(t, []string{"client-1", "client-2"}, wrapper.TelegramClient.ID())
 }
 
+func TestRouter_GetClient_Span(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	r := newTestRouter(t, []ports.TelegramClient{newMockClient("client-1", true)}, time.Minute)
+	defer r.Stop()
+
+	ctx := tracing.ContextWithTaskID(context.Background(), "task-1")
+	ctx = ports.ContextWithMethod(ctx, ports.MethodUsersGetFullUser)
+	_, err := r.GetClient(ctx)
+	require.NoError(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	require.Equal(t, "Router.GetClient", spans[0].Name())
+	require.Subset(t, spans[0].Attributes(), []any{
+		tracing.TaskIDKey.String("task-1"),
+		tracing.ClientIDKey.String("client-1"),
+		tracing.MethodKey.String(ports.MethodUsersGetFullUser),
+	})
+}
+
+func TestRouter_GetClient_RateBudget(t *testing.T) {
+	exhausted := &budgetClient{mockClient: newMockClient("exhausted", true), budgets: map[string]float64{
+		ports.MethodContactsResolveUsername: 0.5,
+		ports.MethodUsersGetFullUser:        3,
+	}}
+	available := &budgetClient{mockClient: newMockClient("available", true), budgets: map[string]float64{
+		ports.MethodContactsResolveUsername: 2,
+	}}
+	unlimited := newMockClient("unlimited", true)
+
+	pick := func(r *Router, ctx context.Context) map[string]int {
+		picked := make(map[string]int)
+		for i := 0; i < 6; i++ {
+			c, err := r.GetClient(ctx)
+			require.NoError(t, err)
+			picked[c.ID()]++
+		}
+		return picked
+	}
+	resolveCtx := ports.ContextWithMethod(context.Background(), ports.MethodContactsResolveUsername)
+
+	t.Run("Клиенты без бюджета метода пропускаются", func(t *testing.T) {
+		r := newTestRouter(t, []ports.TelegramClient{exhausted, available, unlimited}, time.Minute)
+		defer r.Stop()
+
+		picked := pick(r, resolveCtx)
+		require.Zero(t, picked["exhausted"])
+		require.Equal(t, 6, picked["available"]+picked["unlimited"])
+
+		// Бюджеты методов независимы.
+		fullUserCtx := ports.ContextWithMethod(context.Background(), ports.MethodUsersGetFullUser)
+		picked = pick(r, fullUserCtx)
+		require.Zero(t, picked["available"])
+		require.Equal(t, 6, picked["exhausted"]+picked["unlimited"])
+	})
+
+	t.Run("Если бюджета нет ни у кого, выбираются все", func(t *testing.T) {
+		r := newTestRouter(t, []ports.TelegramClient{exhausted}, time.Minute)
+		defer r.Stop()
+
+		c, err := r.GetClient(resolveCtx)
+		require.NoError(t, err)
+		require.Equal(t, "exhausted", c.ID())
+		require.Equal(t, 0.5, c.(ports.RateLimitedClient).RateBudget(ports.MethodContactsResolveUsername))
+	})
+
+	t.Run("Исчерпанный бюджет не делает клиента нездоровым", func(t *testing.T) {
+		client := newMockClient("client-1", true)
+		client.setReturnError(fmt.Errorf("%w: wait 10s", ports.ErrRateLimited))
+		r := newTestRouter(t, []ports.TelegramClient{client}, time.Minute)
+		defer r.Stop()
+
+		c, err := r.GetClient(resolveCtx)
+		require.NoError(t, err)
+		require.True(t, math.IsInf(c.(ports.RateLimitedClient).RateBudget(ports.MethodUsersGetFullUser), 1))
+
+		_, err = c.ContactsResolveUsername(resolveCtx, &tg.ContactsResolveUsernameRequest{Username: "user"})
+		require.ErrorIs(t, err, ports.ErrRateLimited)
+
+		time.Sleep(50 * time.Millisecond)
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		require.Len(t, r.healthy, 1)
+		require.Empty(t, r.unhealthy)
+	})
+}
+
+func TestRouter_SetStrategy(t *testing.T) {
+	busy, idle := newStatsClient("busy"), newStatsClient("idle")
+	busy.inFlight = 5
+	r := newTestRouter(t, []ports.TelegramClient{busy, idle}, time.Minute)
+	defer r.Stop()
+
+	r.SetStrategy(NewLeastInFlightStrategy())
+	for i := 0; i < 3; i++ {
+		c, err := r.GetClient(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, "idle", c.ID())
+	}
+}
+
 func TestRouter_ClientFailsAndMovesToUnhealthy(t *testing.T) {
 	mockErr := errors.New("telegram API error")
 	client1 := newMockClient("client-1", true)
@@ -179,6 +304,7 @@ func TestRouter_ClientFailsAndMovesToUnhealthy(t *testing.T) {
 	// Вызываем метод API. Обертка должна перехватить ошибку и инициировать обработку.
 	_, apiErr := wrappedClient.UsersGetUsers(context.Background(), nil)
 	require.ErrorIs(t, apiErr, mockErr)
+	require.Equal(t, float64(1), testutil.ToFloat64(metrics.TelegramRequests.WithLabelValues(ports.MethodUsersGetUsers, "client-1", metrics.ResultError)))
 
 	// Даем время горутине в wrapper'е выполниться.
 	time.Sleep(50 * time.Millisecond)
@@ -191,6 +317,20 @@ func TestRouter_ClientFailsAndMovesToUnhealthy(t *testing.T) {
 	require.Equal(t, client1, r.unhealthy["client-1"])
 }
 
+func TestCallResult(t *testing.T) {
+	require.Equal(t, metrics.ResultOK, callResult(nil))
+	require.Equal(t, metrics.ResultRateLimited, callResult(fmt.Errorf("wrapped: %w", telegram.ErrRateLimited)))
+	require.Equal(t, metrics.ResultFloodWait, callResult(errors.New("rpc error code 420: FLOOD_WAIT (30)")))
+	require.Equal(t, metrics.ResultFloodWait, callResult(telegram.ErrFloodWaitActive))
+	require.Equal(t, metrics.ResultError, callResult(errors.New("boom")))
+}
+
+func TestMetricsLabel(t *testing.T) {
+	client := telegram.NewClient(telegram.Config{PhoneNumber: "+79991234567"})
+	require.Equal(t, "+79*******67", metricsLabel(client))
+	require.Equal(t, "client-1", metricsLabel(newMockClient("client-1", true)))
+}
+
 func TestRouter_ClientRecoversOnHealthCheck(t *testing.T) {
 	client1 := newMockClient("client-1", false) // Начинаем с нездорового клиента.
 	client1.setHealthy(false)
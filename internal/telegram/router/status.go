@@ -0,0 +1,336 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"telegram-chat-parser/internal/telegram"
+)
+
+// Состояния клиента в пуле.
+const (
+	ClientStateHealthy     = "healthy"
+	ClientStateUnhealthy   = "unhealthy"
+	ClientStateQuarantined = "quarantined"
+)
+
+// RequestCounter — количество вызовов метода API через роутер и сколько из них завершились ошибкой.
+type RequestCounter struct {
+	Total  int64 `json:"total"`
+	Errors int64 `json:"errors"`
+}
+
+// ClientStatus описывает состояние клиента пула для администрирования.
+type ClientStatus struct {
+	ID    string `json:"id"`
+	Phone string `json:"phone"` // Номер телефона со скрытыми средними цифрами.
+	State string `json:"state"`
+	// RecoveryTime — время окончания FLOOD_WAIT, если оно известно.
+	RecoveryTime *time.Time `json:"recovery_time,omitempty"`
+	// RecoveryScheduled — запланирована ли проверка клиента по окончании FLOOD_WAIT.
+	RecoveryScheduled bool `json:"recovery_scheduled"`
+	// QuarantinedUntil — окончание карантина; пусто для бессрочного карантина.
+	QuarantinedUntil *time.Time                `json:"quarantined_until,omitempty"`
+	InFlight         int                       `json:"in_flight"`
+	LastError        string                    `json:"last_error,omitempty"`
+	LastErrorAt      *time.Time                `json:"last_error_at,omitempty"`
+	Requests         map[string]RequestCounter `json:"requests"`
+	// Auth — ход входа в аккаунт, если клиент ждет код или пароль 2FA либо вход не удался.
+	Auth *telegram.AuthStatus `json:"auth,omitempty"`
+}
+
+// authClient — клиент, вход в аккаунт которого завершается через API администрирования.
+type authClient interface {
+	AuthStatus() telegram.AuthStatus
+	SubmitAuthCode(code string) error
+	SubmitAuthPassword(password string) error
+	AuthQRCode() ([]byte, error)
+}
+
+var _ authClient = (*telegram.Client)(nil)
+
+// clientStats — статистика вызовов клиента через роутер.
+type clientStats struct {
+	mu          sync.Mutex
+	requests    map[string]RequestCounter
+	lastError   string
+	lastErrorAt time.Time
+}
+
+func newClientStats() *clientStats {
+	return &clientStats{requests: make(map[string]RequestCounter)}
+}
+
+func (s *clientStats) record(method string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter := s.requests[method]
+	counter.Total++
+	if err != nil {
+		counter.Errors++
+	}
+	s.requests[method] = counter
+	if err != nil {
+		s.lastError, s.lastErrorAt = err.Error(), time.Now()
+	}
+}
+
+func (s *clientStats) recordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastError, s.lastErrorAt = err.Error(), time.Now()
+}
+
+// statsFor возвращает статистику клиента, создавая ее при первом обращении.
+func (r *Router) statsFor(id string) *clientStats {
+	r.mu.RLock()
+	stats, ok := r.stats[id]
+	r.mu.RUnlock()
+	if ok {
+		return stats
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stats, ok = r.stats[id]; ok {
+		return stats
+	}
+	stats = newClientStats()
+	// Вызовы клиента, уже удаленного из пула, не учитываются.
+	_, healthy := r.healthy[id]
+	_, unhealthy := r.unhealthy[id]
+	if healthy || unhealthy {
+		r.stats[id] = stats
+	}
+	return stats
+}
+
+// Clients возвращает состояние всех клиентов пула, упорядоченное по номеру телефона.
+func (r *Router) Clients() []ClientStatus {
+	r.mu.RLock()
+	ids := make([]string, 0, len(r.healthy)+len(r.unhealthy))
+	for id := range r.healthy {
+		ids = append(ids, id)
+	}
+	for id := range r.unhealthy {
+		ids = append(ids, id)
+	}
+	r.mu.RUnlock()
+
+	statuses := make([]ClientStatus, 0, len(ids))
+	for _, id := range ids {
+		if status, err := r.Client(id); err == nil {
+			statuses = append(statuses, status)
+		}
+	}
+	slices.SortFunc(statuses, func(a, b ClientStatus) int {
+		if c := strings.Compare(a.Phone, b.Phone); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return statuses
+}
+
+// Client возвращает состояние клиента пула или ErrClientNotFound.
+func (r *Router) Client(id string) (ClientStatus, error) {
+	r.mu.RLock()
+	client, healthy := r.healthy[id]
+	if !healthy {
+		var ok bool
+		if client, ok = r.unhealthy[id]; !ok {
+			r.mu.RUnlock()
+			return ClientStatus{}, fmt.Errorf("%w: %s", ErrClientNotFound, id)
+		}
+	}
+	_, scheduled := r.scheduledRecovery[id]
+	quarantinedUntil, quarantined := r.quarantined[id]
+	if quarantined && !quarantinedUntil.IsZero() && time.Now().After(quarantinedUntil) {
+		quarantined = false // Истекший карантин снимается при следующей проверке.
+	}
+	stats := r.stats[id]
+	phone := ""
+	for _, e := range r.entries {
+		if e.client.ID() == id {
+			phone = e.server.PhoneNumber
+			break
+		}
+	}
+	r.mu.RUnlock()
+
+	status := ClientStatus{
+		ID:                id,
+		Phone:             telegram.MaskPhone(phone),
+		State:             ClientStateHealthy,
+		RecoveryScheduled: scheduled,
+		InFlight:          inFlight(client),
+		Requests:          make(map[string]RequestCounter),
+	}
+	switch {
+	case quarantined:
+		status.State = ClientStateQuarantined
+		status.QuarantinedUntil = timePtr(quarantinedUntil)
+	case !healthy:
+		status.State = ClientStateUnhealthy
+	}
+	status.RecoveryTime = timePtr(client.GetRecoveryTime())
+	if ac, ok := client.(authClient); ok {
+		if auth := ac.AuthStatus(); auth.State != telegram.AuthStateNone {
+			status.Auth = &auth
+		}
+	}
+	if stats != nil {
+		stats.mu.Lock()
+		for method, counter := range stats.requests {
+			status.Requests[method] = counter
+		}
+		status.LastError = stats.lastError
+		status.LastErrorAt = timePtr(stats.lastErrorAt)
+		stats.mu.Unlock()
+	}
+	return status, nil
+}
+
+// CheckClient немедленно проверяет работоспособность клиента. Работоспособный клиент
+// возвращается в пул, даже если он был помещен в карантин. Возвращает ошибку проверки
+// или ErrClientNotFound.
+func (r *Router) CheckClient(ctx context.Context, id string) error {
+	r.mu.RLock()
+	client, ok := r.healthy[id]
+	if !ok {
+		client, ok = r.unhealthy[id]
+	}
+	r.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrClientNotFound, id)
+	}
+
+	if err := client.Health(ctx); err != nil {
+		r.log.Warn("Forced health check failed", "client_id", id, "error", err)
+		r.statsFor(id).recordError(err)
+		r.setClientUnhealthy(client)
+		return err
+	}
+
+	r.mu.Lock()
+	delete(r.quarantined, id)
+	r.mu.Unlock()
+	r.log.Info("Forced health check passed", "client_id", id)
+	r.setClientHealthy(id)
+	return nil
+}
+
+// Quarantine исключает клиента из пула на время d. Периодические проверки не возвращают
+// клиента в пул до окончания карантина; d = 0 означает карантин до принудительной
+// проверки через CheckClient.
+func (r *Router) Quarantine(id string, d time.Duration) error {
+	r.mu.Lock()
+	client, ok := r.healthy[id]
+	if !ok {
+		client, ok = r.unhealthy[id]
+	}
+	if !ok {
+		r.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrClientNotFound, id)
+	}
+	var until time.Time
+	if d > 0 {
+		until = time.Now().Add(d)
+	}
+	r.quarantined[id] = until
+	r.mu.Unlock()
+
+	r.log.Warn("Client quarantined", "client_id", id, "duration", d)
+	r.setClientUnhealthy(client)
+	return nil
+}
+
+// SubmitAuthCode передает код подтверждения клиенту, ожидающему входа в аккаунт.
+// Возвращает ErrClientNotFound или telegram.ErrAuthNotPending, если клиент не ждет код.
+func (r *Router) SubmitAuthCode(id, code string) error {
+	ac, err := r.authClient(id)
+	if err != nil {
+		return err
+	}
+	if err := ac.SubmitAuthCode(code); err != nil {
+		return err
+	}
+	r.log.Info("Login code submitted", "client_id", id)
+	return nil
+}
+
+// SubmitAuthPassword передает пароль 2FA клиенту, ожидающему входа в аккаунт.
+// Возвращает ErrClientNotFound или telegram.ErrAuthNotPending, если клиент не ждет пароль.
+func (r *Router) SubmitAuthPassword(id, password string) error {
+	ac, err := r.authClient(id)
+	if err != nil {
+		return err
+	}
+	if err := ac.SubmitAuthPassword(password); err != nil {
+		return err
+	}
+	r.log.Info("Login password submitted", "client_id", id)
+	return nil
+}
+
+// AuthQRCode возвращает PNG с QR-кодом для входа в аккаунт клиента.
+// Возвращает ErrClientNotFound или telegram.ErrAuthNotPending, если клиент не ждет входа по QR-коду.
+func (r *Router) AuthQRCode(id string) ([]byte, error) {
+	ac, err := r.authClient(id)
+	if err != nil {
+		return nil, err
+	}
+	return ac.AuthQRCode()
+}
+
+// authClient возвращает клиента пула, поддерживающего вход через API администрирования.
+func (r *Router) authClient(id string) (authClient, error) {
+	r.mu.RLock()
+	client, ok := r.healthy[id]
+	if !ok {
+		client, ok = r.unhealthy[id]
+	}
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrClientNotFound, id)
+	}
+	ac, ok := client.(authClient)
+	if !ok {
+		return nil, telegram.ErrAuthNotPending
+	}
+	return ac, nil
+}
+
+// isQuarantined сообщает, находится ли клиент в карантине.
+func (r *Router) isQuarantined(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.quarantinedLocked(id)
+}
+
+// quarantinedLocked сообщает, находится ли клиент в карантине, и снимает истекший
+// карантин. Вызывается под r.mu.
+func (r *Router) quarantinedLocked(id string) bool {
+	until, ok := r.quarantined[id]
+	if !ok {
+		return false
+	}
+	if until.IsZero() || time.Now().Before(until) {
+		return true
+	}
+	delete(r.quarantined, id)
+	r.log.Info("Client quarantine expired", "client_id", id)
+	return false
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
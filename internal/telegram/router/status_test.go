@@ -0,0 +1,204 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/telegram/auth/qrlogin"
+	"github.com/gotd/td/tg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"telegram-chat-parser/internal/pkg/config"
+	"telegram-chat-parser/internal/ports"
+	"telegram-chat-parser/internal/telegram"
+)
+
+func TestRouter_Clients(t *testing.T) {
+	r, client := newTestPool(t, []config.TelegramAPIServer{
+		{APIID: 1, APIHash: "a", PhoneNumber: "+79991234567"},
+		{APIID: 2, APIHash: "b", PhoneNumber: "+79990000002"},
+	})
+	first := client("+79991234567")
+
+	// Вызовы через обертку учитываются по методам.
+	wrapped := &clientWrapper{TelegramClient: first, router: r}
+	_, err := wrapped.ContactsResolveUsername(context.Background(), &tg.ContactsResolveUsernameRequest{Username: "user"})
+	require.NoError(t, err)
+	_, err = wrapped.UsersGetFullUser(context.Background(), &tg.InputUserSelf{})
+	require.NoError(t, err)
+	first.setReturnError(errors.New("RPC_ERROR: USERNAME_INVALID"))
+	_, err = wrapped.ContactsResolveUsername(context.Background(), &tg.ContactsResolveUsernameRequest{Username: "user"})
+	require.Error(t, err)
+	first.setRecoveryTime(time.Now().Add(time.Minute))
+
+	require.Eventually(t, func() bool {
+		status, err := r.Client(first.ID())
+		return err == nil && status.State == ClientStateUnhealthy
+	}, time.Second, 10*time.Millisecond)
+
+	clients := r.Clients()
+	require.Len(t, clients, 2)
+	status := clients[1]
+	assert.Equal(t, first.ID(), status.ID)
+	assert.Equal(t, "+79*******67", status.Phone)
+	assert.Equal(t, map[string]RequestCounter{
+		ports.MethodContactsResolveUsername: {Total: 2, Errors: 1},
+		ports.MethodUsersGetFullUser:        {Total: 1},
+	}, status.Requests)
+	assert.Equal(t, "RPC_ERROR: USERNAME_INVALID", status.LastError)
+	require.NotNil(t, status.LastErrorAt)
+	require.NotNil(t, status.RecoveryTime)
+	assert.True(t, status.RecoveryScheduled)
+
+	assert.Equal(t, ClientStateHealthy, clients[0].State)
+	assert.Empty(t, clients[0].Requests)
+	assert.Nil(t, clients[0].RecoveryTime)
+
+	_, err = r.Client("unknown")
+	assert.ErrorIs(t, err, ErrClientNotFound)
+}
+
+func TestRouter_Quarantine(t *testing.T) {
+	newRouter := func(t *testing.T) (*Router, *mockClient) {
+		client := newMockClient("client-1", true)
+		r := newTestRouter(t, []ports.TelegramClient{client, newMockClient("client-2", true)}, time.Minute)
+		t.Cleanup(r.Stop)
+		return r, client
+	}
+
+	t.Run("Бессрочный карантин снимается принудительной проверкой", func(t *testing.T) {
+		r, client := newRouter(t)
+		require.NoError(t, r.Quarantine(client.ID(), 0))
+
+		status, err := r.Client(client.ID())
+		require.NoError(t, err)
+		assert.Equal(t, ClientStateQuarantined, status.State)
+		assert.Nil(t, status.QuarantinedUntil)
+
+		// Периодическая проверка не возвращает клиента из карантина.
+		r.checkUnhealthyClients()
+		r.checkAndRecoverClient(client.ID())
+		for i := 0; i < 4; i++ {
+			c, err := r.GetClient(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, "client-2", c.ID())
+		}
+
+		require.NoError(t, r.CheckClient(context.Background(), client.ID()))
+		status, err = r.Client(client.ID())
+		require.NoError(t, err)
+		assert.Equal(t, ClientStateHealthy, status.State)
+	})
+
+	t.Run("Карантин истекает", func(t *testing.T) {
+		r, client := newRouter(t)
+		require.NoError(t, r.Quarantine(client.ID(), 20*time.Millisecond))
+		status, err := r.Client(client.ID())
+		require.NoError(t, err)
+		require.NotNil(t, status.QuarantinedUntil)
+
+		time.Sleep(30 * time.Millisecond)
+		r.checkUnhealthyClients()
+		status, err = r.Client(client.ID())
+		require.NoError(t, err)
+		assert.Equal(t, ClientStateHealthy, status.State)
+	})
+
+	t.Run("Неудачная принудительная проверка", func(t *testing.T) {
+		r, client := newRouter(t)
+		client.setHealthy(false)
+
+		err := r.CheckClient(context.Background(), client.ID())
+		require.Error(t, err)
+		status, err := r.Client(client.ID())
+		require.NoError(t, err)
+		assert.Equal(t, ClientStateUnhealthy, status.State)
+		assert.Equal(t, "client is not healthy", status.LastError)
+	})
+
+	t.Run("Неизвестный клиент", func(t *testing.T) {
+		r, _ := newRouter(t)
+		assert.ErrorIs(t, r.Quarantine("unknown", time.Minute), ErrClientNotFound)
+		assert.ErrorIs(t, r.CheckClient(context.Background(), "unknown"), ErrClientNotFound)
+	})
+}
+
+// loginClient — мок клиента, вход в аккаунт которого выполняется через API.
+type loginClient struct {
+	*mockClient
+	auth *telegram.RemoteAuthenticator
+}
+
+func (c *loginClient) AuthStatus() telegram.AuthStatus    { return c.auth.Status() }
+func (c *loginClient) SubmitAuthCode(code string) error   { return c.auth.SubmitCode(code) }
+func (c *loginClient) SubmitAuthPassword(pw string) error { return c.auth.SubmitPassword(pw) }
+
+func (c *loginClient) AuthQRCode() ([]byte, error) {
+	token, ok := c.auth.QR()
+	if !ok {
+		return nil, telegram.ErrAuthNotPending
+	}
+	return []byte(token.URL()), nil
+}
+
+func TestRouter_SubmitAuth(t *testing.T) {
+	login := &loginClient{mockClient: newMockClient("client-1", false), auth: telegram.NewRemoteAuthenticator("+79991234567")}
+	plain := newMockClient("client-2", true)
+	r := newTestRouter(t, []ports.TelegramClient{login, plain}, time.Minute)
+	t.Cleanup(r.Stop)
+
+	status, err := r.Client(login.ID())
+	require.NoError(t, err)
+	assert.Nil(t, status.Auth)
+	assert.ErrorIs(t, r.SubmitAuthCode(login.ID(), "12345"), telegram.ErrAuthNotPending)
+
+	codes := make(chan string, 1)
+	go func() {
+		code, _ := login.auth.Code(context.Background(), &tg.AuthSentCode{Type: &tg.AuthSentCodeTypeSMS{}})
+		codes <- code
+	}()
+	require.Eventually(t, func() bool {
+		status, err := r.Client(login.ID())
+		return err == nil && status.Auth != nil && status.Auth.State == telegram.AuthStateWaitingCode
+	}, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, r.SubmitAuthCode(login.ID(), "12345"))
+	assert.Equal(t, "12345", <-codes)
+	status, err = r.Client(login.ID())
+	require.NoError(t, err)
+	require.NotNil(t, status.Auth)
+	assert.Equal(t, telegram.AuthStateSigningIn, status.Auth.State)
+
+	assert.ErrorIs(t, r.SubmitAuthPassword(login.ID(), "secret"), telegram.ErrAuthNotPending)
+	assert.ErrorIs(t, r.SubmitAuthCode(plain.ID(), "12345"), telegram.ErrAuthNotPending)
+	assert.ErrorIs(t, r.SubmitAuthCode("unknown", "12345"), ErrClientNotFound)
+}
+
+func TestRouter_AuthQRCode(t *testing.T) {
+	login := &loginClient{mockClient: newMockClient("client-1", false), auth: telegram.NewRemoteAuthenticator("+79991234567")}
+	plain := newMockClient("client-2", true)
+	r := newTestRouter(t, []ports.TelegramClient{login, plain}, time.Minute)
+	t.Cleanup(r.Stop)
+
+	_, err := r.AuthQRCode(login.ID())
+	assert.ErrorIs(t, err, telegram.ErrAuthNotPending)
+
+	token := qrlogin.NewToken([]byte("token"), int(time.Now().Add(30*time.Second).Unix()))
+	login.auth.ShowQR(token)
+	code, err := r.AuthQRCode(login.ID())
+	require.NoError(t, err)
+	assert.Equal(t, token.URL(), string(code))
+
+	status, err := r.Client(login.ID())
+	require.NoError(t, err)
+	require.NotNil(t, status.Auth)
+	assert.Equal(t, telegram.AuthStateWaitingQR, status.Auth.State)
+
+	_, err = r.AuthQRCode(plain.ID())
+	assert.ErrorIs(t, err, telegram.ErrAuthNotPending)
+	_, err = r.AuthQRCode("unknown")
+	assert.ErrorIs(t, err, ErrClientNotFound)
+}
@@ -0,0 +1,68 @@
+package router
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"telegram-chat-parser/internal/ports"
+)
+
+// Имена стратегий выбора клиента в конфигурации (telegram_api.strategy).
+const (
+	StrategyRoundRobin       = "round_robin"
+	StrategyLeastInFlight    = "least_in_flight"
+	StrategyWeighted         = "weighted"
+	StrategyLeastFloodWaited = "least_flood_waited"
+)
+
+// NewStrategy создает стратегию выбора клиента по имени из конфигурации.
+// Пустое имя означает стратегию по умолчанию — round_robin.
+func NewStrategy(name string) (ports.Strategy, error) {
+	switch name {
+	case "", StrategyRoundRobin:
+		return NewRoundRobinStrategy(), nil
+	case StrategyLeastInFlight:
+		return NewLeastInFlightStrategy(), nil
+	case StrategyWeighted:
+		return NewWeightedStrategy(), nil
+	case StrategyLeastFloodWaited:
+		return NewLeastFloodWaitedStrategy(), nil
+	}
+	return nil, fmt.Errorf("unknown client selection strategy %q", name)
+}
+
+// roundRobinAmong выбирает по кругу среди равноценных клиентов. Роутер передает клиентов
+// в произвольном порядке, поэтому они упорядочиваются по ID.
+func roundRobinAmong(counter *atomic.Uint32, candidates []ports.TelegramClient) ports.TelegramClient {
+	slices.SortFunc(candidates, func(a, b ports.TelegramClient) int {
+		return strings.Compare(a.ID(), b.ID())
+	})
+	idx := counter.Add(1) - 1
+	return candidates[idx%uint32(len(candidates))]
+}
+
+// Клиенты, не сообщающие статистику, считаются незагруженными, без FLOOD_WAIT и с весом 1.
+
+func inFlight(c ports.TelegramClient) int {
+	if ic, ok := c.(ports.InFlightClient); ok {
+		return ic.InFlight()
+	}
+	return 0
+}
+
+func lastFloodWait(c ports.TelegramClient) time.Time {
+	if fc, ok := c.(ports.FloodWaitClient); ok {
+		return fc.LastFloodWait()
+	}
+	return time.Time{}
+}
+
+func weight(c ports.TelegramClient) int {
+	if wc, ok := c.(ports.WeightedClient); ok {
+		return max(wc.Weight(), 1)
+	}
+	return 1
+}
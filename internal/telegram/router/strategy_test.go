@@ -0,0 +1,140 @@
+package router
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"telegram-chat-parser/internal/ports"
+)
+
+// statsClient — мок клиента, сообщающего статистику для стратегий выбора.
+type statsClient struct {
+	*mockClient
+	inFlight      int
+	lastFloodWait time.Time
+	weight        int
+}
+
+func (c *statsClient) InFlight() int            { return c.inFlight }
+func (c *statsClient) LastFloodWait() time.Time { return c.lastFloodWait }
+func (c *statsClient) Weight() int              { return c.weight }
+
+func newStatsClient(id string) *statsClient {
+	return &statsClient{mockClient: newMockClient(id, true)}
+}
+
+// pickN выбирает клиента n раз и считает, сколько раз выбран каждый.
+func pickN(t *testing.T, s ports.Strategy, clients []ports.TelegramClient, n int) map[string]int {
+	t.Helper()
+	picked := make(map[string]int)
+	for i := 0; i < n; i++ {
+		c, err := s.Next(clients)
+		require.NoError(t, err)
+		picked[c.ID()]++
+	}
+	return picked
+}
+
+func TestNewStrategy(t *testing.T) {
+	testCases := []struct {
+		name string
+		want ports.Strategy
+	}{
+		{"", &RoundRobinStrategy{}},
+		{StrategyRoundRobin, &RoundRobinStrategy{}},
+		{StrategyLeastInFlight, &LeastInFlightStrategy{}},
+		{StrategyWeighted, &WeightedStrategy{}},
+		{StrategyLeastFloodWaited, &LeastFloodWaitedStrategy{}},
+	}
+	for _, tc := range testCases {
+		s, err := NewStrategy(tc.name)
+		require.NoError(t, err)
+		assert.IsType(t, tc.want, s, tc.name)
+	}
+
+	_, err := NewStrategy("random")
+	assert.Error(t, err)
+}
+
+func TestStrategies_NoClients(t *testing.T) {
+	for _, name := range []string{StrategyLeastInFlight, StrategyWeighted, StrategyLeastFloodWaited} {
+		s, err := NewStrategy(name)
+		require.NoError(t, err)
+		_, err = s.Next(nil)
+		assert.ErrorIs(t, err, ErrNoHealthyClients, name)
+	}
+}
+
+func TestLeastInFlightStrategy(t *testing.T) {
+	busy, idle1, idle2 := newStatsClient("busy"), newStatsClient("idle-1"), newStatsClient("idle-2")
+	busy.inFlight = 3
+	idle1.inFlight, idle2.inFlight = 1, 1
+	clients := []ports.TelegramClient{idle2, busy, idle1}
+
+	// Одинаково загруженные клиенты выбираются по очереди.
+	picked := pickN(t, NewLeastInFlightStrategy(), clients, 4)
+	assert.Equal(t, map[string]int{"idle-1": 2, "idle-2": 2}, picked)
+
+	// Клиент без статистики считается свободным.
+	plain := newMockClient("plain", true)
+	c, err := NewLeastInFlightStrategy().Next([]ports.TelegramClient{busy, plain})
+	require.NoError(t, err)
+	assert.Equal(t, "plain", c.ID())
+}
+
+func TestLeastFloodWaitedStrategy(t *testing.T) {
+	now := time.Now()
+	recent, old := newStatsClient("recent"), newStatsClient("old")
+	recent.lastFloodWait = now.Add(-time.Minute)
+	old.lastFloodWait = now.Add(-time.Hour)
+
+	s := NewLeastFloodWaitedStrategy()
+	c, err := s.Next([]ports.TelegramClient{recent, old})
+	require.NoError(t, err)
+	assert.Equal(t, "old", c.ID())
+
+	// Клиенты без FLOOD_WAIT предпочтительнее и выбираются по очереди.
+	never1, never2 := newStatsClient("never-1"), newStatsClient("never-2")
+	picked := pickN(t, s, []ports.TelegramClient{recent, never2, old, never1}, 4)
+	assert.Equal(t, map[string]int{"never-1": 2, "never-2": 2}, picked)
+}
+
+func TestWeightedStrategy(t *testing.T) {
+	heavy, light, plain := newStatsClient("heavy"), newStatsClient("light"), newMockClient("plain", true)
+	heavy.weight, light.weight = 3, 0 // Вес 0 означает 1.
+	clients := []ports.TelegramClient{plain, light, heavy}
+
+	s := NewWeightedStrategy()
+	assert.Equal(t, map[string]int{"heavy": 6, "light": 2, "plain": 2}, pickN(t, s, clients, 10))
+
+	// Тяжелый клиент не выбирается подряд больше, чем позволяет его доля.
+	var sequence []string
+	for i := 0; i < 5; i++ {
+		c, err := s.Next(clients)
+		require.NoError(t, err)
+		sequence = append(sequence, c.ID())
+	}
+	assert.Equal(t, []string{"heavy", "light", "heavy", "plain", "heavy"}, sequence)
+
+	// Накопленный вес удаленных из пула клиентов не хранится.
+	s.Forget("plain")
+	assert.NotContains(t, s.current, "plain")
+
+	t.Run("Клиент, временно исключенный из выбора, сохраняет долю", func(t *testing.T) {
+		s := NewWeightedStrategy()
+		all := []ports.TelegramClient{heavy, light}
+		picked := map[string]int{}
+		// light и heavy по очереди не попадают в выбор, например из-за бюджета метода.
+		for _, candidates := range [][]ports.TelegramClient{all, all, {heavy}, all, {light}, all} {
+			c, err := s.Next(candidates)
+			require.NoError(t, err)
+			if len(candidates) == len(all) {
+				picked[c.ID()]++
+			}
+		}
+		assert.Equal(t, map[string]int{"heavy": 3, "light": 1}, picked)
+	})
+}
@@ -0,0 +1,54 @@
+package router
+
+import (
+	"sync"
+	"telegram-chat-parser/internal/ports"
+)
+
+// WeightedStrategy распределяет запросы пропорционально весам клиентов (telegram_api.servers[].weight)
+// алгоритмом плавного взвешенного round robin: клиент с весом 3 получает три запроса
+// из каждых четырех при соседе с весом 1, но не подряд, а вперемешку.
+type WeightedStrategy struct {
+	mu      sync.Mutex
+	current map[string]int // Накопленный вес клиентов по ID.
+}
+
+// NewWeightedStrategy создает стратегию взвешенного выбора клиента.
+func NewWeightedStrategy() *WeightedStrategy {
+	return &WeightedStrategy{current: make(map[string]int)}
+}
+
+// Next возвращает клиента с наибольшим накопленным весом и уменьшает его вес на сумму весов.
+func (s *WeightedStrategy) Next(clients []ports.TelegramClient) (ports.TelegramClient, error) {
+	if len(clients) == 0 {
+		return nil, ErrNoHealthyClients
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var selected ports.TelegramClient
+	total := 0
+	for _, c := range clients {
+		id := c.ID()
+		w := weight(c)
+		s.current[id] += w
+		total += w
+		// При равном весе выбираем меньший ID, чтобы выбор не зависел от порядка клиентов.
+		if selected == nil || s.current[id] > s.current[selected.ID()] ||
+			(s.current[id] == s.current[selected.ID()] && id < selected.ID()) {
+			selected = c
+		}
+	}
+	s.current[selected.ID()] -= total
+	return selected, nil
+}
+
+// Forget забывает накопленный вес клиента, удаленного из пула. Клиенты, временно не
+// попавшие в выбор (в карантине или без бюджета метода), сохраняют накопленный вес,
+// чтобы после возвращения получать свою долю запросов.
+func (s *WeightedStrategy) Forget(clientID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.current, clientID)
+}
@@ -0,0 +1,187 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/session"
+
+	"telegram-chat-parser/internal/pkg/config"
+	"telegram-chat-parser/internal/storage"
+)
+
+// encryptedSessionPrefix отмечает зашифрованную сессию. Сессия gotd — JSON, поэтому
+// незашифрованная сессия с этого префикса не начинается.
+var encryptedSessionPrefix = []byte("tgcp-enc-v1:")
+
+// SessionEncryptor шифрует сессии AES-256-GCM, чтобы ключ авторизации аккаунта не
+// хранился на диске в открытом виде.
+type SessionEncryptor struct {
+	aead cipher.AEAD
+}
+
+// NewSessionEncryptor создает шифратор сессий с ключом key длиной config.SessionKeySize.
+func NewSessionEncryptor(key []byte) (*SessionEncryptor, error) {
+	if len(key) != config.SessionKeySize {
+		return nil, fmt.Errorf("session key must be %d bytes, got %d", config.SessionKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session cipher: %w", err)
+	}
+	return &SessionEncryptor{aead: aead}, nil
+}
+
+// Storage возвращает хранилище, которое шифрует сессию перед сохранением в next,
+// например в файл или базу.
+func (e *SessionEncryptor) Storage(next session.Storage) *EncryptedSessionStorage {
+	return &EncryptedSessionStorage{next: next, aead: e.aead}
+}
+
+// EncryptedSessionStorage хранит сессию в другом хранилище в зашифрованном виде.
+// Создается через SessionEncryptor.Storage.
+type EncryptedSessionStorage struct {
+	next session.Storage
+	aead cipher.AEAD
+}
+
+var _ session.Storage = (*EncryptedSessionStorage)(nil)
+
+// LoadSession загружает и расшифровывает сессию. Незашифрованная сессия, сохраненная до
+// включения шифрования, сразу перезаписывается в зашифрованном виде.
+func (s *EncryptedSessionStorage) LoadSession(ctx context.Context) ([]byte, error) {
+	data, err := s.next.LoadSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, encryptedSessionPrefix) {
+		slog.Warn("Loaded unencrypted telegram session, encrypting it")
+		if err := s.StoreSession(ctx, data); err != nil {
+			slog.Warn("Failed to encrypt telegram session, it will be encrypted on next save", "error", err)
+		}
+		return data, nil
+	}
+	data = data[len(encryptedSessionPrefix):]
+	nonceSize := s.aead.NonceSize()
+	if len(data) < nonceSize {
+		return nil, errors.New("encrypted session is too short")
+	}
+	plain, err := s.aead.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt session (wrong session key?): %w", err)
+	}
+	return plain, nil
+}
+
+// StoreSession шифрует сессию и сохраняет ее.
+func (s *EncryptedSessionStorage) StoreSession(ctx context.Context, data []byte) error {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate session nonce: %w", err)
+	}
+	sealed := make([]byte, 0, len(encryptedSessionPrefix)+len(nonce)+len(data)+s.aead.Overhead())
+	sealed = append(sealed, encryptedSessionPrefix...)
+	sealed = append(sealed, nonce...)
+	sealed = s.aead.Seal(sealed, nonce, data, nil)
+	return s.next.StoreSession(ctx, sealed)
+}
+
+// StoreSessionStorage хранит сессию аккаунта в storage.Store, например во встроенной базе
+// вместе с задачами: так сессии копируются и переносятся между серверами вместе с базой.
+type StoreSessionStorage struct {
+	store storage.Store[[]byte]
+	key   string
+}
+
+var _ session.Storage = (*StoreSessionStorage)(nil)
+
+// NewStoreSessionStorage создает хранилище сессии под ключом key, например номером телефона аккаунта.
+func NewStoreSessionStorage(store storage.Store[[]byte], key string) *StoreSessionStorage {
+	return &StoreSessionStorage{store: store, key: key}
+}
+
+// LoadSession загружает сессию или возвращает session.ErrNotFound.
+func (s *StoreSessionStorage) LoadSession(_ context.Context) ([]byte, error) {
+	data, err := s.store.Get(s.key)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && len(data) == 0) {
+		return nil, session.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+	return data, nil
+}
+
+// StoreSession сохраняет сессию бессрочно.
+func (s *StoreSessionStorage) StoreSession(_ context.Context, data []byte) error {
+	if err := s.store.Put(s.key, data, time.Time{}); err != nil {
+		return fmt.Errorf("failed to store session: %w", err)
+	}
+	return nil
+}
+
+// FallbackSessionStorage читает сессию из fallback, пока ее нет в основном хранилище,
+// и сохраняет только в основное. Так аккаунт переходит в новое хранилище, например из
+// файла в базу, без повторного входа.
+type FallbackSessionStorage struct {
+	primary  session.Storage
+	fallback session.Storage
+	// migrated вызывается, когда сессия из fallback сохранена в основное хранилище,
+	// например чтобы удалить файл сессии. Может быть nil.
+	migrated func() error
+
+	mu           sync.Mutex
+	fromFallback bool // Последняя загруженная сессия прочитана из fallback.
+}
+
+var _ session.Storage = (*FallbackSessionStorage)(nil)
+
+// NewFallbackSessionStorage создает хранилище с основным primary и резервным fallback.
+// migrated, если не nil, вызывается один раз после переноса сессии из fallback в primary.
+func NewFallbackSessionStorage(primary, fallback session.Storage, migrated func() error) *FallbackSessionStorage {
+	return &FallbackSessionStorage{primary: primary, fallback: fallback, migrated: migrated}
+}
+
+// LoadSession загружает сессию из основного хранилища, а если ее там нет — из резервного.
+func (s *FallbackSessionStorage) LoadSession(ctx context.Context) ([]byte, error) {
+	data, err := s.primary.LoadSession(ctx)
+	if !errors.Is(err, session.ErrNotFound) {
+		return data, err
+	}
+	data, err = s.fallback.LoadSession(ctx)
+	if err == nil {
+		s.mu.Lock()
+		s.fromFallback = true
+		s.mu.Unlock()
+	}
+	return data, err
+}
+
+// StoreSession сохраняет сессию в основное хранилище. Если сессия была прочитана из
+// резервного хранилища, после сохранения вызывается migrated.
+func (s *FallbackSessionStorage) StoreSession(ctx context.Context, data []byte) error {
+	if err := s.primary.StoreSession(ctx, data); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fromFallback && s.migrated != nil {
+		if err := s.migrated(); err != nil {
+			slog.Warn("Failed to clean up migrated telegram session", "error", err)
+		}
+	}
+	s.fromFallback = false
+	return nil
+}
@@ -0,0 +1,142 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gotd/td/session"
+	"github.com/stretchr/testify/require"
+
+	"telegram-chat-parser/internal/pkg/config"
+	"telegram-chat-parser/internal/storage"
+)
+
+var testSessionData = []byte(`{"Version":1,"Data":{"AuthKey":"c2VjcmV0"}}`)
+
+func TestEncryptedSessionStorage(t *testing.T) {
+	ctx := context.Background()
+	key := bytes.Repeat([]byte{1}, config.SessionKeySize)
+	encryptor, err := NewSessionEncryptor(key)
+	require.NoError(t, err)
+
+	t.Run("сессия хранится зашифрованной", func(t *testing.T) {
+		file := &session.FileStorage{Path: filepath.Join(t.TempDir(), "tg.session")}
+		s := encryptor.Storage(file)
+
+		_, err := s.LoadSession(ctx)
+		require.ErrorIs(t, err, session.ErrNotFound)
+
+		require.NoError(t, s.StoreSession(ctx, testSessionData))
+		raw, err := file.LoadSession(ctx)
+		require.NoError(t, err)
+		require.True(t, bytes.HasPrefix(raw, encryptedSessionPrefix))
+		require.NotContains(t, string(raw), "AuthKey")
+
+		data, err := s.LoadSession(ctx)
+		require.NoError(t, err)
+		require.Equal(t, testSessionData, data)
+
+		// Чужой ключ не расшифровывает сессию.
+		other, err := NewSessionEncryptor(bytes.Repeat([]byte{2}, config.SessionKeySize))
+		require.NoError(t, err)
+		_, err = other.Storage(file).LoadSession(ctx)
+		require.ErrorContains(t, err, "failed to decrypt session")
+	})
+
+	t.Run("незашифрованная сессия читается и сразу шифруется", func(t *testing.T) {
+		mem := &session.StorageMemory{}
+		require.NoError(t, mem.StoreSession(ctx, testSessionData))
+		s := encryptor.Storage(mem)
+
+		data, err := s.LoadSession(ctx)
+		require.NoError(t, err)
+		require.Equal(t, testSessionData, data)
+
+		raw, err := mem.LoadSession(ctx)
+		require.NoError(t, err)
+		require.True(t, bytes.HasPrefix(raw, encryptedSessionPrefix))
+		data, err = s.LoadSession(ctx)
+		require.NoError(t, err)
+		require.Equal(t, testSessionData, data)
+	})
+
+	t.Run("ключ неверной длины", func(t *testing.T) {
+		_, err := NewSessionEncryptor([]byte("short"))
+		require.Error(t, err)
+	})
+}
+
+func TestStoreSessionStorage(t *testing.T) {
+	ctx := context.Background()
+	db, err := storage.OpenBolt(filepath.Join(t.TempDir(), "storage.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	store, err := storage.NewBoltStore[[]byte](db, "sessions")
+	require.NoError(t, err)
+
+	s := NewStoreSessionStorage(store, "+10000000000")
+	_, err = s.LoadSession(ctx)
+	require.ErrorIs(t, err, session.ErrNotFound)
+
+	require.NoError(t, s.StoreSession(ctx, testSessionData))
+	data, err := s.LoadSession(ctx)
+	require.NoError(t, err)
+	require.Equal(t, testSessionData, data)
+
+	// Сессии аккаунтов хранятся под разными ключами.
+	_, err = NewStoreSessionStorage(store, "+20000000000").LoadSession(ctx)
+	require.ErrorIs(t, err, session.ErrNotFound)
+}
+
+func TestFallbackSessionStorage(t *testing.T) {
+	ctx := context.Background()
+	primary, fallback := &session.StorageMemory{}, &session.StorageMemory{}
+	migrated := 0
+	s := NewFallbackSessionStorage(primary, fallback, func() error {
+		migrated++
+		return nil
+	})
+
+	_, err := s.LoadSession(ctx)
+	require.ErrorIs(t, err, session.ErrNotFound)
+
+	// Пока в основном хранилище сессии нет, она читается из резервного.
+	require.NoError(t, fallback.StoreSession(ctx, []byte(`{"old":true}`)))
+	data, err := s.LoadSession(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []byte(`{"old":true}`), data)
+
+	require.Zero(t, migrated)
+
+	// После переноса в основное хранилище migrated вызывается один раз.
+	require.NoError(t, s.StoreSession(ctx, testSessionData))
+	require.Equal(t, 1, migrated)
+	data, err = s.LoadSession(ctx)
+	require.NoError(t, err)
+	require.Equal(t, testSessionData, data)
+	require.NoError(t, s.StoreSession(ctx, testSessionData))
+	require.Equal(t, 1, migrated)
+	data, err = fallback.LoadSession(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []byte(`{"old":true}`), data)
+}
+
+func TestFallbackSessionStorage_RemovesMigratedFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "session.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"old":true}`), 0o600))
+
+	s := NewFallbackSessionStorage(&session.StorageMemory{}, &session.FileStorage{Path: path}, func() error {
+		return os.Remove(path)
+	})
+	data, err := s.LoadSession(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []byte(`{"old":true}`), data)
+	require.FileExists(t, path)
+
+	require.NoError(t, s.StoreSession(ctx, testSessionData))
+	require.NoFileExists(t, path)
+}
@@ -0,0 +1,142 @@
+// Package tracing настраивает трассировку OpenTelemetry и содержит общие для сервиса
+// помощники: атрибуты спанов, передачу ID задачи через контекст и завершение спана
+// с ошибкой. Пока трассировка не настроена через Setup, спаны не записываются, но
+// контекст трассы из входящих запросов по-прежнему передается дальше.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Экспортеры трасс.
+const (
+	// ExporterNone отключает запись трасс.
+	ExporterNone = ""
+	// ExporterOTLP отправляет трассы в коллектор по OTLP/HTTP.
+	ExporterOTLP = "otlp"
+	// ExporterStdout выводит трассы в стандартный вывод, для локальной отладки.
+	ExporterStdout = "stdout"
+)
+
+// instrumentationName — имя, под которым сервис создает спаны.
+const instrumentationName = "telegram-chat-parser"
+
+// Атрибуты спанов сервиса.
+const (
+	TaskIDKey   = attribute.Key("task.id")
+	ClientIDKey = attribute.Key("telegram.client_id")
+	MethodKey   = attribute.Key("telegram.method")
+)
+
+// Config — настройки трассировки.
+type Config struct {
+	// ServiceName — имя сервиса в трассах (атрибут service.name).
+	ServiceName string
+	// Exporter — ExporterNone, ExporterOTLP или ExporterStdout.
+	Exporter string
+	// Endpoint — адрес коллектора OTLP (host:port). Пустой адрес означает значение
+	// переменной OTEL_EXPORTER_OTLP_ENDPOINT или localhost:4318.
+	Endpoint string
+	// Insecure отключает TLS при подключении к коллектору.
+	Insecure bool
+	// SampleRatio — доля записываемых трасс от 0 до 1. Решение вызывающего сервиса
+	// о записи трассы, переданное в запросе, имеет приоритет.
+	SampleRatio float64
+}
+
+// Setup настраивает глобальные провайдер трасс и формат передачи контекста трассы
+// (W3C Trace Context). Возвращает функцию, которая отправляет накопленные спаны и
+// останавливает экспорт; ее нужно вызвать при завершении работы.
+func Setup(ctx context.Context, cfg Config) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(),
+		resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Tracer возвращает трассировщик, которым сервис создает спаны.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start начинает спан name. Если в контексте есть ID задачи, он добавляется к атрибутам.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if taskID := TaskIDFromContext(ctx); taskID != "" {
+		attrs = append(attrs, TaskIDKey.String(taskID))
+	}
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End завершает спан, отмечая его ошибкой, если err не nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+type taskIDKey struct{}
+
+// ContextWithTaskID возвращает контекст с ID задачи, который Start добавляет к спанам.
+func ContextWithTaskID(ctx context.Context, taskID string) context.Context {
+	return context.WithValue(ctx, taskIDKey{}, taskID)
+}
+
+// TaskIDFromContext возвращает ID задачи из контекста или пустую строку.
+func TaskIDFromContext(ctx context.Context) string {
+	taskID, _ := ctx.Value(taskIDKey{}).(string)
+	return taskID
+}
+
+// ContinueTrace возвращает ctx, продолжающий трассу из from: спаны, начатые в нем,
+// станут дочерними для текущего спана from. Нужен для работы, которая продолжается
+// после завершения запроса, например для задачи в очереди.
+func ContinueTrace(ctx, from context.Context) context.Context {
+	return trace.ContextWithSpanContext(ctx, trace.SpanContextFromContext(from))
+}
@@ -0,0 +1,86 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans устанавливает глобальный провайдер, записывающий спаны в память.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return recorder
+}
+
+func TestStart(t *testing.T) {
+	recorder := recordSpans(t)
+
+	ctx := ContextWithTaskID(context.Background(), "task-1")
+	ctx, parent := Start(ctx, "parent")
+	_, child := Start(ContinueTrace(context.Background(), ctx), "child", ClientIDKey.String("client-1"))
+	End(child, errors.New("boom"))
+	End(parent, nil)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	childSpan, parentSpan := spans[0], spans[1]
+
+	assert.Contains(t, parentSpan.Attributes(), TaskIDKey.String("task-1"))
+	assert.Equal(t, codes.Unset, parentSpan.Status().Code)
+
+	// ContinueTrace переносит только контекст трассы, но не ID задачи.
+	assert.Equal(t, parentSpan.SpanContext().TraceID(), childSpan.SpanContext().TraceID())
+	assert.Equal(t, parentSpan.SpanContext().SpanID(), childSpan.Parent().SpanID())
+	assert.Contains(t, childSpan.Attributes(), ClientIDKey.String("client-1"))
+	assert.NotContains(t, childSpan.Attributes(), TaskIDKey.String("task-1"))
+	assert.Equal(t, codes.Error, childSpan.Status().Code)
+	assert.Equal(t, "boom", childSpan.Status().Description)
+}
+
+func TestSetup(t *testing.T) {
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		shutdown, err := Setup(context.Background(), Config{})
+		require.NoError(t, err)
+		assert.NoError(t, shutdown(context.Background()))
+		// Контекст трассы передается дальше, даже если спаны не записываются.
+		assert.Contains(t, otel.GetTextMapPropagator().Fields(), "traceparent")
+	})
+
+	t.Run("stdout", func(t *testing.T) {
+		shutdown, err := Setup(context.Background(), Config{ServiceName: "test", Exporter: ExporterStdout, SampleRatio: 0})
+		require.NoError(t, err)
+		_, span := Start(context.Background(), "not sampled")
+		assert.False(t, span.SpanContext().IsSampled())
+		span.End()
+		assert.NoError(t, shutdown(context.Background()))
+	})
+
+	t.Run("unknown exporter", func(t *testing.T) {
+		_, err := Setup(context.Background(), Config{Exporter: "jaeger"})
+		assert.Error(t, err)
+	})
+}
+
+func TestTaskIDFromContext(t *testing.T) {
+	assert.Empty(t, TaskIDFromContext(context.Background()))
+	assert.Equal(t, "task-1", TaskIDFromContext(ContextWithTaskID(context.Background(), "task-1")))
+	assert.False(t, trace.SpanContextFromContext(ContinueTrace(context.Background(), context.Background())).IsValid())
+}